@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"file_syn/internal/agent"
+	"file_syn/internal/config"
+	"file_syn/internal/runner"
+)
+
+// runAgent 执行 agent 子命令：在标准输入输出上为另一台主机上的 file_syn 提供扫描结果、摘要和文件内容
+func runAgent(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("agent", flag.ExitOnError)
+	fs.Usage = commandUsage(fs, "agent", "在标准输入输出上提供扫描结果、文件摘要和文件内容，\n"+
+		"供另一台主机上的 file_syn 通过 --left-command 或 --right-command（如 ssh host file_syn agent）访问本机目录")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+
+	// 标准输出只用于协议，错误输出到标准错误（ssh 会转发给对方）
+	if err := agent.Serve(ctx, os.Stdin, os.Stdout, agent.ServeOptions{ToolVersion: version}); err != nil {
+		fatal(err)
+	}
+}
+
+// remote 通过 agent 访问的远程目录（两侧都是本地目录时为 nil），退出前关闭
+var remote *runner.Remote
+
+// startAgents 为配置了 left_command 或 right_command 的一侧启动 agent，失败时退出
+func startAgents(cfg *config.Config) {
+	info := infoWriter(cfg)
+	var err error
+	remote, err = runner.StartRemote(cfg, func(format string, args ...any) {
+		fmt.Fprintf(info, format+"\n", args...)
+	})
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// closeAgents 关闭已启动的 agent 连接
+func closeAgents() {
+	remote.Close()
+	remote = nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"file_syn/internal/bundle"
+	"file_syn/internal/manifest"
+	"file_syn/internal/reporter"
+	"file_syn/pkg/models"
+)
+
+// runExport 执行 export 子命令：把使右侧目录变为左侧目录所需的差异打包为补丁包
+func runExport(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	var flags configFlags
+	flags.register(fs)
+	output := fs.String("output", "", "补丁包文件路径（tar.gz，必填）")
+	deltaThreshold := fs.Int64("delta-threshold", 0, deltaThresholdUsage)
+	fs.Usage = commandUsage(fs, "export --output <补丁包> [选项] [配置文件路径]", "把右侧目录变为左侧目录所需的新增和修改的文件、删除、权限和修改时间打包为补丁包")
+	fs.Parse(args)
+	ctx, cancel := withTimeout(ctx, flags.timeout)
+	defer cancel()
+
+	if *output == "" {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	cfg, err := flags.load(fs)
+	if err != nil {
+		fatal(err)
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "delta-threshold" {
+			cfg.Sync.DeltaThreshold = *deltaThreshold
+		}
+	})
+	if err := cfg.Finish(); err != nil {
+		fatal(err)
+	}
+	requireLocal(cfg, "export")
+	for _, dir := range []string{cfg.LeftDir, cfg.RightDir} {
+		if manifest.IsManifest(dir) {
+			fatal(fmt.Errorf("导出的两侧都必须是目录，不能是清单文件: %s", dir))
+		}
+	}
+
+	comparer, results, cache := compareDirs(ctx, cfg, newProgressLine(flags.progress))
+	saveHashCache(cache)
+	exitIfCanceled(ctx, cache)
+	for _, scanErr := range comparer.Errors() {
+		fmt.Fprintf(os.Stderr, "警告: %v（对应的路径不会导出）\n", scanErr)
+	}
+
+	// 先写入临时文件，完成后再重命名，避免留下不完整的补丁包
+	tmp, err := os.CreateTemp(filepath.Dir(*output), ".file_syn-*.tmp")
+	if err != nil {
+		fatal(fmt.Errorf("无法创建补丁包: %v", err))
+	}
+	defer os.Remove(tmp.Name())
+	m, err := bundle.Export(tmp, cfg.LeftDir, cfg.RightDir, results, bundle.Options{
+		ToolVersion:    version,
+		DeltaThreshold: cfg.Sync.DeltaMinSize(),
+	})
+	if closeErr := tmp.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("无法写出补丁包: %v", closeErr)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	if err := os.Rename(tmp.Name(), *output); err != nil {
+		fatal(fmt.Errorf("无法保存补丁包: %v", err))
+	}
+
+	var files, deltas int
+	var size int64
+	for _, e := range m.Entries {
+		if e.Op == models.OpCopy {
+			files++
+			size += e.Size
+		}
+		if e.Base != "" {
+			deltas++
+		}
+	}
+	for _, skipped := range m.Skipped {
+		fmt.Fprintf(os.Stderr, "警告: %s 无法读取，未导出\n", skipped)
+	}
+	info := infoWriter(cfg)
+	fmt.Fprintf(info, "已导出 %d 个操作（%d 个文件，%s）到 %s\n", len(m.Entries), files, reporter.FormatSize(size), *output)
+	if deltas > 0 {
+		if stat, err := os.Stat(*output); err == nil {
+			fmt.Fprintf(info, "其中 %d 个文件只打包了增量，补丁包大小 %s\n", deltas, reporter.FormatSize(stat.Size()))
+		}
+	}
+	if len(m.Skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "警告: 补丁包不完整，%d 个无法读取的路径未导出（已记录在清单的 skipped 中）\n", len(m.Skipped))
+	}
+}
+
+// runApply 执行 apply 子命令：验证前置条件后把补丁包应用到目标目录
+func runApply(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "只验证前置条件并打印计划执行的操作，不修改任何文件")
+	fs.Usage = commandUsage(fs, "apply [选项] <补丁包> <目标目录>", "验证目标目录与导出时的右侧目录一致后应用补丁包，任一操作失败时撤销全部修改")
+	fs.Parse(args)
+
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	target, err := filepath.Abs(fs.Arg(1))
+	if err != nil {
+		fatal(fmt.Errorf("无法获取目录的绝对路径: %v", err))
+	}
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		fatal(fmt.Errorf("目录不存在: %s", target))
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		fatal(fmt.Errorf("无法打开补丁包: %v", err))
+	}
+	defer f.Close()
+
+	// 前置条件不满足、补丁包无效或撤销失败时没有操作结果
+	results, err := bundle.Apply(f, target, bundle.ApplyOptions{DryRun: *dryRun})
+	if err != nil && results == nil {
+		fatal(err)
+	}
+	reporter.NewReporter(false).PrintSyncResults(results)
+	if err != nil {
+		fatal(fmt.Errorf("应用补丁包失败，已撤销全部修改"))
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"os"
+
+	"file_syn/internal/config"
+	"file_syn/internal/diff"
+	"file_syn/internal/hashcache"
+	"file_syn/internal/manifest"
+	"file_syn/internal/reporter"
+	"file_syn/internal/signing"
+	"file_syn/pkg/models"
+)
+
+// runCompare 执行 compare 子命令：对比两个目录并输出差异
+func runCompare(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	var flags configFlags
+	flags.register(fs)
+	failOn := fs.String("fail-on", "", "视为失败的状态，逗号分隔：added, deleted, modified, touched, renamed, unknown, warning（覆盖配置 fail_on）")
+	stream := fs.Bool("stream", false, "流式对比：逐个输出结果，内存占用与目录树大小无关，不支持 --renames（覆盖配置 stream）")
+	verifyKey := fs.String("verify-key", "", "公钥文件：作为一侧的清单必须带有该公钥的有效签名，否则拒绝对比（覆盖配置 verify_key）")
+	fs.Usage = commandUsage(fs, "compare [选项] [配置文件路径]", "对比左右两个目录并输出差异")
+	fs.Parse(args)
+	ctx, cancel := withTimeout(ctx, flags.timeout)
+	defer cancel()
+
+	cfg, err := flags.load(fs)
+	if err != nil {
+		fatal(err)
+	}
+	if *failOn != "" {
+		cfg.FailOn = splitList(*failOn)
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "stream":
+			cfg.Stream = *stream
+		case "verify-key":
+			cfg.VerifyKey = *verifyKey
+		}
+	})
+	if err := cfg.Finish(); err != nil {
+		fatal(err)
+	}
+	startAgents(cfg)
+	printer, err := newPrinter(cfg)
+	if err != nil {
+		fatal(err)
+	}
+
+	progress := newProgressLine(flags.progress)
+	if cfg.Stream {
+		code := streamCompare(ctx, cfg, printer, progress)
+		closeAgents()
+		os.Exit(code)
+	}
+
+	comparer, results, cache := compareDirs(ctx, cfg, progress)
+	saveHashCache(cache)
+
+	// 生成远程文件的内容差异时仍需读取文件内容，输出报告后才关闭 agent 连接
+	printer.PrintResults(results)
+	printer.PrintErrors(comparer.Errors())
+	flushReport(printer)
+	closeAgents()
+	os.Exit(resultExitCode(cfg, results, len(comparer.Errors())))
+}
+
+// compareDirs 打印运行信息并对比配置中的两个目录
+//
+// 返回使用的对比器、对比结果和打开的摘要缓存（未开启内容校验时为 nil），
+// 便于调用方重新对比或在同步后保存缓存。被中断时直接退出。
+func compareDirs(ctx context.Context, cfg *config.Config, progress *progressLine) (*diff.Comparer, []*models.DiffResult, *hashcache.Cache) {
+	printCompareInfo(cfg)
+
+	cache := openHashCache(cfg)
+	comparer := newComparer(cfg, cache, progress)
+	results, err := comparer.CompareContext(ctx, cfg.LeftDir, cfg.RightDir)
+	progress.clear()
+	if err != nil {
+		exitIfCanceled(ctx, cache)
+		fatal(err)
+	}
+	return comparer, results, cache
+}
+
+// newComparer 根据配置创建对比器（含重命名检测，适用于非流式对比）
+func newComparer(cfg *config.Config, cache *hashcache.Cache, progress *progressLine) *diff.Comparer {
+	return diff.NewComparerWithOptions(diff.Options{
+		Scan:          cfg.ScanOptions(cache),
+		Rules:         cfg.Compare.Rules(),
+		DetectRenames: cfg.DetectRenames,
+		ManifestKey:   loadVerifyKey(cfg),
+		Progress:      progress.callback(),
+		Remote:        remote.Openers(),
+	})
+}
+
+// streamCompare 流式对比配置中的两个目录，逐个输出结果并返回退出码
+//
+// 被中断时已输出的结果保留，不再输出统计信息。
+func streamCompare(ctx context.Context, cfg *config.Config, printer reporter.Printer, progress *progressLine) int {
+	printCompareInfo(cfg)
+
+	manifestKey := loadVerifyKey(cfg)
+	cache := openHashCache(cfg)
+	comparer := diff.NewComparerWithOptions(diff.Options{
+		Scan:        cfg.ScanOptions(cache),
+		Rules:       cfg.Compare.Rules(),
+		ManifestKey: manifestKey,
+		Progress:    progress.callback(),
+		Remote:      remote.Openers(),
+	})
+	results, err := comparer.CompareStreamContext(ctx, cfg.LeftDir, cfg.RightDir)
+	if err != nil {
+		fatal(err)
+	}
+
+	failed := false
+	for result := range results {
+		progress.pause(func() {
+			printer.PrintResult(result)
+		})
+		if cfg.FailsOn(result.Status) {
+			failed = true
+		}
+	}
+	progress.clear()
+	if ctx.Err() != nil {
+		flushReport(printer)
+		exitIfCanceled(ctx, cache)
+	}
+	printer.PrintSummary()
+	printer.PrintErrors(comparer.Errors())
+	flushReport(printer)
+	saveHashCache(cache)
+	return exitCode(cfg, failed, len(comparer.Errors()))
+}
+
+// loadVerifyKey 读取配置的签名公钥，未配置时返回 nil；配置了公钥但两侧都不是清单时退出
+func loadVerifyKey(cfg *config.Config) ed25519.PublicKey {
+	key, err := cfg.ManifestKey()
+	if err != nil {
+		fatal(err)
+	}
+	if key == nil {
+		return nil
+	}
+	fmt.Fprintf(infoWriter(cfg), "验证清单签名: 公钥 %s\n", signing.KeyID(key))
+	return key
+}
+
+// printCompareInfo 打印使用的配置文件和对比的目录
+func printCompareInfo(cfg *config.Config) {
+	info := infoWriter(cfg)
+	if cfg.ConfigPath != "" {
+		fmt.Fprintf(info, "配置文件: %s\n", cfg.ConfigPath)
+	}
+	fmt.Fprintf(info, "%s: %s\n", sideDisplay("左侧", cfg.LeftDir, cfg.LeftCommand), cfg.LeftDir)
+	fmt.Fprintf(info, "%s: %s\n", sideDisplay("右侧", cfg.RightDir, cfg.RightCommand), cfg.RightDir)
+	fmt.Fprintln(info, "正在扫描和对比...")
+}
+
+// sideDisplay 返回一侧的显示名称，如 左侧目录、左侧清单 或 左侧远程目录（command 为该侧的 agent 命令）
+func sideDisplay(side, path, command string) string {
+	if command != "" {
+		return side + "远程目录"
+	}
+	if manifest.IsManifest(path) {
+		return side + "清单"
+	}
+	return side + "目录"
+}
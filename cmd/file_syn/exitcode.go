@@ -0,0 +1,39 @@
+package main
+
+import (
+	"file_syn/internal/config"
+	"file_syn/pkg/models"
+)
+
+// 退出码（与 diff(1) 一致：0 表示一致，1 表示有差异，2 及以上表示运行错误）
+const (
+	exitOK        = 0 // 两侧一致，或没有 fail_on 中列出的差异
+	exitDifferent = 1 // 发现 fail_on 中列出的差异
+	exitError     = 2 // 运行错误：配置无效、扫描失败、同步操作失败等
+	exitWarning   = 3 // 扫描时出现错误且 fail_on 包含 warning
+
+	exitInterrupted = 130 // 被 SIGINT 或 SIGTERM 中断（与 shell 的约定一致：128 + SIGINT）
+)
+
+// resultExitCode 根据对比结果和扫描错误数量计算退出码
+func resultExitCode(cfg *config.Config, results []*models.DiffResult, scanErrors int) int {
+	failed := false
+	for _, result := range results {
+		if cfg.FailsOn(result.Status) {
+			failed = true
+			break
+		}
+	}
+	return exitCode(cfg, failed, scanErrors)
+}
+
+// exitCode 根据是否出现 fail_on 中列出的差异和扫描错误数量计算退出码
+func exitCode(cfg *config.Config, failed bool, scanErrors int) int {
+	if scanErrors > 0 && cfg.FailsOn(config.FailOnWarning) {
+		return exitWarning
+	}
+	if failed {
+		return exitDifferent
+	}
+	return exitOK
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"file_syn/internal/config"
+	"file_syn/internal/diff"
+	"file_syn/internal/hashcache"
+	"file_syn/internal/reporter"
+	"file_syn/internal/runner"
+	"file_syn/internal/textdiff"
+)
+
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// splitList 拆分逗号分隔的参数值，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// configFlags 覆盖配置文件字段的通用命令行参数
+type configFlags struct {
+	configPath    string
+	leftDir       string
+	rightDir      string
+	leftCommand   string
+	rightCommand  string
+	showUnchanged bool
+	format        string
+	language      string
+	hash          string
+	excludes      stringList
+	includes      stringList
+	detectRenames bool
+	followLinks   bool
+	attributes    string
+	mtimeTol      time.Duration
+	ignoreMtime   bool
+	workers       int
+	contentDiff   bool
+	diffContext   int
+	diffMaxSize   int64
+	progress      bool
+	timeout       time.Duration
+}
+
+// register 在参数集中注册通用参数
+func (f *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.configPath, "config", "", "配置文件路径（也可以作为第一个位置参数指定）")
+	fs.StringVar(&f.leftDir, "left", "", "左侧目录（覆盖配置 left_dir）")
+	fs.StringVar(&f.rightDir, "right", "", "右侧目录（覆盖配置 right_dir）")
+	fs.StringVar(&f.leftCommand, "left-command", "", "启动远程 agent 的命令，如 \"ssh host file_syn agent\"，--left 为远程主机上的目录（覆盖配置 left_command，仅 compare）")
+	fs.StringVar(&f.rightCommand, "right-command", "", "同 --left-command，用于右侧（覆盖配置 right_command，仅 compare）")
+	fs.BoolVar(&f.showUnchanged, "show-unchanged", false, "显示未变更的文件（覆盖配置 show_unchanged）")
+	fs.StringVar(&f.format, "format", "", "输出格式：text, json, ndjson 或 patch（覆盖配置 format）")
+	fs.StringVar(&f.language, "lang", "", "表格中差异详情的语言：zh 或 en（覆盖配置 language）")
+	fs.StringVar(&f.hash, "hash", "", "开启内容校验并指定摘要算法，如 sha256（覆盖配置 hash）")
+	fs.Var(&f.excludes, "exclude", "追加 .gitignore 语法的排除规则（可重复指定）")
+	fs.Var(&f.includes, "include", "追加重新包含被排除路径的规则（可重复指定）")
+	fs.BoolVar(&f.detectRenames, "renames", false, "检测重命名和移动的文件（覆盖配置 detect_renames）")
+	fs.BoolVar(&f.followLinks, "follow-symlinks", false, "跟随符号链接，按链接目标对比（覆盖配置 follow_symlinks）")
+	fs.StringVar(&f.attributes, "attributes", "", "参与对比的属性，逗号分隔："+attributeNames()+"（覆盖配置 compare.attributes）")
+	fs.DurationVar(&f.mtimeTol, "mtime-tolerance", diff.DefaultMtimeTolerance, "修改时间的容差，如 2s，0 表示必须完全相同（覆盖配置 compare.mtime_tolerance）")
+	fs.BoolVar(&f.ignoreMtime, "ignore-mtime-if-same-content", false, "内容摘要一致时不对比修改时间（覆盖配置 compare.ignore_mtime_if_same_content）")
+	fs.IntVar(&f.workers, "workers", 0, "每侧目录并发扫描的工作协程数（覆盖配置 scan_workers）")
+	fs.BoolVar(&f.contentDiff, "content-diff", false, "在表格后输出修改的文本文件的统一格式差异（覆盖配置 content_diff.enabled）")
+	fs.IntVar(&f.diffContext, "diff-context", textdiff.DefaultContext, "内容差异的上下文行数（覆盖配置 content_diff.context）")
+	fs.Int64Var(&f.diffMaxSize, "diff-max-size", textdiff.DefaultMaxSize, "生成内容差异的文件大小上限（字节），超过时只报告二进制文件不同（覆盖配置 content_diff.max_size）")
+	fs.BoolVar(&f.progress, "progress", true, "标准错误是终端时显示扫描进度（--progress=false 关闭）")
+	fs.DurationVar(&f.timeout, "timeout", 0, "扫描和对比的时间限制，如 30m（默认不限制）")
+}
+
+// attributeNames 返回逗号分隔的可以参与对比的属性名称
+func attributeNames() string {
+	names := make([]string, len(diff.Attributes))
+	for i, attribute := range diff.Attributes {
+		names[i] = string(attribute)
+	}
+	return strings.Join(names, ", ")
+}
+
+// load 加载配置文件并应用命令行参数
+//
+// 未指定配置文件时按默认顺序查找；找不到配置文件但通过 --left 和 --right
+// 指定了目录时，直接使用默认配置运行。
+func (f *configFlags) load(fs *flag.FlagSet) (*config.Config, error) {
+	configPath := f.configPath
+	if configPath == "" {
+		configPath = fs.Arg(0)
+	}
+	if configPath == "" {
+		configPath = config.FindConfigFile()
+	}
+
+	cfg := &config.Config{}
+	if configPath != "" {
+		var err error
+		if cfg, err = config.ReadConfig(configPath); err != nil {
+			return nil, err
+		}
+	} else if f.leftDir == "" || f.rightDir == "" {
+		return nil, fmt.Errorf("未找到配置文件，请指定配置文件路径或通过 --left 和 --right 指定目录")
+	}
+
+	// 只有显式指定的参数才覆盖配置（布尔参数也可以用 --show-unchanged=false 关闭）
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "left":
+			cfg.LeftDir = f.leftDir
+		case "right":
+			cfg.RightDir = f.rightDir
+		case "left-command":
+			cfg.LeftCommand = f.leftCommand
+		case "right-command":
+			cfg.RightCommand = f.rightCommand
+		case "show-unchanged":
+			cfg.ShowUnchanged = f.showUnchanged
+		case "format":
+			cfg.Format = f.format
+		case "lang":
+			cfg.Language = f.language
+		case "hash":
+			cfg.Hash = f.hash
+		case "renames":
+			cfg.DetectRenames = f.detectRenames
+		case "follow-symlinks":
+			cfg.FollowSymlinks = f.followLinks
+		case "attributes":
+			cfg.Compare.Attributes = splitList(f.attributes)
+		case "mtime-tolerance":
+			cfg.Compare.MtimeTolerance = f.mtimeTol.String()
+		case "ignore-mtime-if-same-content":
+			cfg.Compare.IgnoreMtimeIfSameContent = f.ignoreMtime
+		case "workers":
+			cfg.ScanWorkers = f.workers
+		case "content-diff":
+			cfg.ContentDiff.Enabled = f.contentDiff
+		case "diff-context":
+			cfg.ContentDiff.Context = &f.diffContext
+		case "diff-max-size":
+			cfg.ContentDiff.MaxSize = f.diffMaxSize
+		}
+	})
+	cfg.Exclude = append(cfg.Exclude, f.excludes...)
+	cfg.Include = append(cfg.Include, f.includes...)
+
+	return cfg, nil
+}
+
+// newPrinter 按配置的输出格式创建报告器
+func newPrinter(cfg *config.Config) (reporter.Printer, error) {
+	return reporter.NewWithOptions(cfg.Format, os.Stdout, reporter.Options{
+		ShowUnchanged: cfg.ShowUnchanged,
+		ContentDiff:   cfg.ContentDiffOptions(),
+		Language:      cfg.Language,
+		Remote:        remote.Readers(),
+	})
+}
+
+// infoWriter 返回提示信息的输出位置（机器可读格式下输出到标准错误，保持标准输出只有报告）
+func infoWriter(cfg *config.Config) *os.File {
+	if cfg.Format == reporter.FormatJSON || cfg.Format == reporter.FormatNDJSON || cfg.Format == reporter.FormatPatch {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// logStderr 向标准错误输出一行提示或警告信息
+func logStderr(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+}
+
+// openHashCache 开启内容校验时打开摘要缓存，失败时不使用缓存
+func openHashCache(cfg *config.Config) *hashcache.Cache {
+	return runner.OpenHashCache(cfg, logStderr)
+}
+
+// saveHashCache 保存摘要缓存
+func saveHashCache(cache *hashcache.Cache) {
+	runner.SaveHashCache(cache, logStderr)
+}
+
+// flushReport 写出报告器缓冲的内容，失败时退出
+func flushReport(printer reporter.Printer) {
+	if err := printer.Flush(); err != nil {
+		fatal(err)
+	}
+}
+
+// withTimeout timeout 大于 0 时为 ctx 设置时间限制
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout < 0 {
+		fatal(fmt.Errorf("无效的时间限制: %v", timeout))
+	}
+	if timeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// exitIfCanceled 扫描被中断或超时时保存摘要缓存并退出
+//
+// 收到中断信号时以 exitInterrupted 退出，超过 --timeout 时以 exitError 退出。
+func exitIfCanceled(ctx context.Context, cache *hashcache.Cache) {
+	err := ctx.Err()
+	if err == nil {
+		return
+	}
+	saveHashCache(cache)
+	if errors.Is(err, context.DeadlineExceeded) {
+		fatal(fmt.Errorf("超过时间限制"))
+	}
+	fmt.Fprintln(os.Stderr, "已中断")
+	os.Exit(exitInterrupted)
+}
+
+// requireLocal 检查两侧都是本地目录，command 子命令不支持通过 agent 访问的远程目录
+func requireLocal(cfg *config.Config, command string) {
+	if cfg.IsRemote() {
+		fatal(fmt.Errorf("%s 不支持远程目录（left_command 和 right_command 仅用于 compare）", command))
+	}
+}
+
+// fatal 打印错误并退出
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "错误: %v\n", err)
+	os.Exit(exitError)
+}
@@ -1,51 +1,168 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
 
 	"file_syn/internal/config"
-	"file_syn/internal/diff"
-	"file_syn/internal/reporter"
+	"file_syn/internal/hashcache"
 )
 
+// 版本信息，编译时通过 -ldflags "-X main.version=..." 写入
+var (
+	version   = "dev"
+	gitCommit = "unknown"
+	buildTime = "unknown"
+)
+
+// commands 子命令及其入口
+var commands = map[string]func(ctx context.Context, args []string){
+	"compare":  runCompare,
+	"sync":     runSync,
+	"snapshot": runSnapshot,
+	"export":   runExport,
+	"apply":    runApply,
+	"keygen":   runKeygen,
+	"sign":     runSign,
+	"verify":   runVerify,
+	"watch":    runWatch,
+	"agent":    runAgent,
+	"serve":    runServe,
+	"cache":    runCacheCommand,
+	"version":  runVersion,
+}
+
 func main() {
-	// 获取配置文件路径（如果通过命令行参数指定）
+	// 收到中断信号时取消正在进行的扫描和对比
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// 第一次中断后恢复默认的信号处理，再次中断时立即退出
+		<-ctx.Done()
+		stop()
+	}()
+
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			printUsage()
+			return
+		}
+		if run, ok := commands[args[0]]; ok {
+			run(ctx, args[1:])
+			return
+		}
+	}
+
+	// 未指定子命令时执行 compare，兼容 file_syn [选项] [配置文件路径] 的用法
+	runCompare(ctx, args)
+}
+
+// commandUsage 生成子命令的用法说明
+func commandUsage(fs *flag.FlagSet, usage, description string) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "\n用法: %s %s\n", os.Args[0], usage)
+		fmt.Fprintf(os.Stderr, "\n%s\n", description)
+		fmt.Fprintf(os.Stderr, "\n选项:\n")
+		fs.PrintDefaults()
+	}
+}
+
+// runVersion 执行 version 子命令：输出版本信息
+func runVersion(ctx context.Context, args []string) {
+	fmt.Printf("file_syn %s (commit %s, built %s, %s %s/%s)\n",
+		version, gitCommit, buildTime, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// runCacheCommand 执行摘要缓存相关的子命令
+func runCacheCommand(ctx context.Context, args []string) {
+	if len(args) == 0 || args[0] != "prune" {
+		fmt.Fprintf(os.Stderr, "用法: %s cache prune [配置文件路径]\n", os.Args[0])
+		os.Exit(exitError)
+	}
+
 	configPath := ""
-	if len(os.Args) > 1 {
-		configPath = os.Args[1]
+	if len(args) > 1 {
+		configPath = args[1]
+	}
+	if configPath == "" {
+		configPath = config.FindConfigFile()
+	}
+
+	// 没有配置文件时清理默认位置的缓存
+	cfg := &config.Config{}
+	if configPath != "" {
+		var err error
+		if cfg, err = config.ReadConfig(configPath); err != nil {
+			fatal(err)
+		}
+		if err := cfg.NormalizePaths(); err != nil {
+			fatal(err)
+		}
+	}
+
+	cachePath := cfg.HashCachePath()
+	if cachePath == "" {
+		fmt.Println("摘要缓存已禁用（hash_cache = none）")
+		return
 	}
 
-	// 加载配置
-	cfg, err := config.LoadConfig(configPath)
+	cache, err := hashcache.Open(cachePath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
-		fmt.Fprintf(os.Stderr, "\n用法: %s [配置文件路径]\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "示例: %s\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "      %s config/config.json\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "      %s /path/to/custom-config.json\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "\n如果未指定配置文件路径，程序将按以下顺序查找:\n")
-		fmt.Fprintf(os.Stderr, "  1. config/config.json\n")
-		fmt.Fprintf(os.Stderr, "  2. ./config/config.json\n")
-		fmt.Fprintf(os.Stderr, "  3. config.json\n")
-		os.Exit(1)
-	}
-
-	// 显示使用的配置文件路径
-	fmt.Printf("配置文件: %s\n", cfg.ConfigPath)
-	fmt.Printf("左侧目录: %s\n", cfg.LeftDir)
-	fmt.Printf("右侧目录: %s\n", cfg.RightDir)
-	fmt.Println("正在扫描和对比...")
-
-	// 执行对比
-	comparer := diff.NewComparer()
-	results, err := comparer.Compare(cfg.LeftDir, cfg.RightDir)
+		fatal(err)
+	}
+	removed, err := cache.Prune()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
-		os.Exit(1)
+		fatal(fmt.Errorf("清理摘要缓存失败: %v", err))
 	}
+	fmt.Printf("摘要缓存: %s\n", cachePath)
+	fmt.Printf("已删除 %d 个失效条目，保留 %d 个条目\n", removed, cache.Len())
+}
 
-	// 打印结果
-	reporter := reporter.NewReporter(cfg.ShowUnchanged)
-	reporter.PrintResults(results)
+// printUsage 打印命令行用法
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "\n用法: %s <命令> [选项] [配置文件路径]\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\n命令:\n")
+	fmt.Fprintf(os.Stderr, "  compare    对比左右两个目录并输出差异（默认命令）\n")
+	fmt.Fprintf(os.Stderr, "  sync       对比后同步两个目录\n")
+	fmt.Fprintf(os.Stderr, "  snapshot   扫描目录并保存为清单文件\n")
+	fmt.Fprintf(os.Stderr, "  export     把右侧目录变为左侧目录所需的差异打包为补丁包\n")
+	fmt.Fprintf(os.Stderr, "  apply      验证前置条件后把补丁包应用到目标目录\n")
+	fmt.Fprintf(os.Stderr, "  keygen     生成清单签名用的 ed25519 密钥对\n")
+	fmt.Fprintf(os.Stderr, "  sign       用私钥对清单文件签名\n")
+	fmt.Fprintf(os.Stderr, "  verify     用公钥验证清单文件的签名\n")
+	fmt.Fprintf(os.Stderr, "  watch      持续监测两个目录，输出状态发生变化的文件\n")
+	fmt.Fprintf(os.Stderr, "  agent      在标准输入输出上提供本机目录，供另一台主机对比\n")
+	fmt.Fprintf(os.Stderr, "  serve      以 HTTP 接口提供对比和同步任务\n")
+	fmt.Fprintf(os.Stderr, "  cache      管理摘要缓存（cache prune）\n")
+	fmt.Fprintf(os.Stderr, "  version    输出版本信息\n")
+	fmt.Fprintf(os.Stderr, "\n示例: %s compare config/config.json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s compare --left /data/a --right /data/b --format json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s sync --dry-run config/config.json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s sync --delete config/config.json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s sync --mode bidirectional --conflict newer config/config.json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s snapshot --hash sha256 --output data.json /data\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s export --output changes.tar.gz --left /data/new --right /data/old\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s apply changes.tar.gz /data/old\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s sign --key baseline.key data.json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s compare --verify-key baseline.key.pub --left data.json --right /data\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s compare --right-command \"ssh host file_syn agent\" --left /data --right /srv/data\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "      %s serve --addr :8080 --token-file token.txt backup=config/backup.json\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\n使用 %s <命令> --help 查看命令的选项。\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\n如果未指定配置文件路径，程序将按以下顺序查找:\n")
+	for i, path := range config.DefaultPaths {
+		fmt.Fprintf(os.Stderr, "  %d. %s\n", i+1, path)
+	}
+	fmt.Fprintf(os.Stderr, "找不到配置文件时必须通过 --left 和 --right 指定目录。\n")
+	fmt.Fprintf(os.Stderr, "\ncompare 的退出码:\n")
+	fmt.Fprintf(os.Stderr, "  0  两侧一致（或没有 --fail-on 中列出的差异）\n")
+	fmt.Fprintf(os.Stderr, "  1  发现差异\n")
+	fmt.Fprintf(os.Stderr, "  2  运行错误（配置无效、扫描失败、同步操作失败等）\n")
+	fmt.Fprintf(os.Stderr, "  3  扫描时出现错误且 --fail-on 包含 warning\n")
 }
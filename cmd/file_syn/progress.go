@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"file_syn/internal/reporter"
+	"file_syn/internal/scanner"
+)
+
+// progressLine 在终端上显示实时刷新的扫描进度行（输出到标准错误）
+//
+// 标准错误不是终端时 newProgressLine 返回 nil，所有方法都可以在 nil 上调用。
+type progressLine struct {
+	mu    sync.Mutex
+	width int
+	shown bool
+}
+
+// newProgressLine 标准错误是终端且 enabled 为 true 时创建进度行
+func newProgressLine(enabled bool) *progressLine {
+	if !enabled || !isTerminal(os.Stderr) {
+		return nil
+	}
+	width := 80
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 20 {
+		width = n
+	}
+	return &progressLine{width: width}
+}
+
+// isTerminal 判断文件是否为终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// callback 返回进度回调函数（进度行为 nil 时返回 nil，即不报告进度）
+func (p *progressLine) callback() func(scanner.Progress) {
+	if p == nil {
+		return nil
+	}
+	return p.update
+}
+
+// update 重新绘制进度行
+func (p *progressLine) update(progress scanner.Progress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	text := fmt.Sprintf("已扫描 %d 项", progress.Entries)
+	if progress.TotalBytes > 0 {
+		text += fmt.Sprintf(" | 已校验 %s / %s", reporter.FormatSize(progress.HashedBytes), reporter.FormatSize(progress.TotalBytes))
+	}
+	if progress.ETA > 0 {
+		text += fmt.Sprintf(" | 剩余约 %s", progress.ETA.Round(time.Second))
+	}
+	if progress.Path != "" {
+		text += " | " + progress.Path
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s", reporter.TruncateByWidth(text, p.width-1))
+	p.shown = true
+}
+
+// clear 清除进度行
+func (p *progressLine) clear() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clearLocked()
+}
+
+// pause 清除进度行后执行 fn（如输出结果），期间不重新绘制进度行
+func (p *progressLine) pause(fn func()) {
+	if p == nil {
+		fn()
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clearLocked()
+	fn()
+}
+
+func (p *progressLine) clearLocked() {
+	if p.shown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.shown = false
+	}
+}
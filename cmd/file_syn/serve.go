@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file_syn/internal/config"
+	"file_syn/internal/server"
+)
+
+// tokenEnv 未指定 --token-file 时从该环境变量读取访问令牌
+const tokenEnv = "FILE_SYN_TOKEN"
+
+// runServe 执行 serve 子命令：以 HTTP 接口提供对比和同步任务
+func runServe(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "监听地址")
+	tokenFile := fs.String("token-file", "", "访问令牌文件（默认读取环境变量 "+tokenEnv+"）")
+	jobs := fs.Int("jobs", server.DefaultMaxJobs, "同时运行的任务数上限")
+	queued := fs.Int("queue", server.DefaultMaxQueued, "等待运行的任务数上限，队列已满时拒绝新任务")
+	history := fs.Int("history", server.DefaultMaxHistory, "保留的已结束任务数")
+	shutdownTimeout := fs.Duration("shutdown-timeout", 30*time.Second, "关闭时等待正在运行的任务结束的时间，超时后取消任务")
+	fs.Usage = commandUsage(fs, "serve [选项] [名称=]配置文件...",
+		"以 HTTP 接口提供对比和同步任务，每个配置文件定义一个目录对（名称默认为配置文件名去掉扩展名）")
+	fs.Parse(args)
+
+	token, err := readToken(*tokenFile)
+	if err != nil {
+		fatal(err)
+	}
+	pairs, err := loadPairs(fs.Args())
+	if err != nil {
+		fatal(err)
+	}
+	s, err := server.New(pairs, server.Options{
+		Token:      token,
+		MaxJobs:    *jobs,
+		MaxQueued:  *queued,
+		MaxHistory: *history,
+		Log:        os.Stderr,
+	})
+	if err != nil {
+		fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fatal(err)
+	}
+	httpServer := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	fmt.Fprintf(os.Stderr, "正在监听 http://%s（%d 个目录对）\n", listener.Addr(), len(pairs))
+	errs := make(chan error, 1)
+	go func() { errs <- httpServer.Serve(listener) }()
+
+	select {
+	case err := <-errs:
+		fatal(err)
+	case <-ctx.Done():
+	}
+
+	// 先等待任务结束（期间仍然可以查询状态和读取结果），再关闭 HTTP 服务
+	fmt.Fprintln(os.Stderr, "正在关闭，等待正在运行的任务结束...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		fmt.Fprintln(os.Stderr, "警告: 等待超时，已取消正在运行的任务")
+	}
+	closeCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := httpServer.Shutdown(closeCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		fatal(err)
+	}
+}
+
+// readToken 读取访问令牌文件，未指定时使用环境变量 FILE_SYN_TOKEN
+func readToken(path string) (string, error) {
+	if path == "" {
+		if token := os.Getenv(tokenEnv); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("请通过 --token-file 或环境变量 %s 指定访问令牌", tokenEnv)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("无法读取访问令牌: %v", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("访问令牌文件为空: %s", path)
+	}
+	return token, nil
+}
+
+// loadPairs 加载目录对的配置，参数为 名称=配置文件 或 配置文件；没有参数时按默认顺序查找配置文件
+func loadPairs(args []string) (map[string]*config.Config, error) {
+	if len(args) == 0 {
+		configPath := config.FindConfigFile()
+		if configPath == "" {
+			return nil, fmt.Errorf("未找到配置文件，请指定至少一个配置文件")
+		}
+		args = []string{configPath}
+	}
+
+	pairs := make(map[string]*config.Config)
+	for _, arg := range args {
+		name, configPath, ok := strings.Cut(arg, "=")
+		if !ok {
+			configPath = arg
+			name = strings.TrimSuffix(filepath.Base(arg), filepath.Ext(arg))
+		}
+		if _, exists := pairs[name]; exists {
+			return nil, fmt.Errorf("目录对名称重复: %s（可以用 名称=配置文件 指定）", name)
+		}
+		cfg, err := config.LoadConfig(configPath)
+		if err != nil {
+			return nil, err
+		}
+		pairs[name] = cfg
+	}
+	return pairs, nil
+}
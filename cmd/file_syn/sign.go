@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"file_syn/internal/signing"
+)
+
+// runKeygen 执行 keygen 子命令：生成签名用的 ed25519 密钥对
+func runKeygen(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	force := fs.Bool("force", false, "覆盖已存在的密钥文件")
+	fs.Usage = commandUsage(fs, "keygen [选项] <私钥路径>", "生成 ed25519 密钥对，私钥写入指定路径，公钥写入 <私钥路径>.pub")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	privPath := fs.Arg(0)
+	pubPath := privPath + ".pub"
+	if *force {
+		for _, path := range []string{privPath, pubPath} {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				fatal(fmt.Errorf("无法删除已存在的密钥文件: %v", err))
+			}
+		}
+	}
+
+	pub, priv, err := signing.GenerateKey()
+	if err != nil {
+		fatal(err)
+	}
+	if err := signing.WritePrivateKey(privPath, priv); err != nil {
+		fatal(err)
+	}
+	if err := signing.WritePublicKey(pubPath, pub); err != nil {
+		os.Remove(privPath)
+		fatal(err)
+	}
+	fmt.Printf("私钥: %s\n", privPath)
+	fmt.Printf("公钥: %s\n", pubPath)
+	fmt.Printf("密钥标识: %s\n", signing.KeyID(pub))
+}
+
+// runSign 执行 sign 子命令：用私钥对清单文件签名
+func runSign(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("sign", flag.ExitOnError)
+	keyPath := fs.String("key", "", "私钥文件（必须指定）")
+	output := fs.String("output", "", "签名文件路径（默认为 <清单>"+signing.SignatureSuffix+"）")
+	fs.Usage = commandUsage(fs, "sign --key <私钥> [选项] <清单>", "对快照清单签名，签名保存在单独的签名文件中")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *keyPath == "" {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	manifestPath := fs.Arg(0)
+	sigPath := *output
+	if sigPath == "" {
+		sigPath = signing.SignatureFile(manifestPath)
+	}
+
+	key, err := signing.LoadPrivateKey(*keyPath)
+	if err != nil {
+		fatal(err)
+	}
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		fatal(fmt.Errorf("无法打开清单文件: %v", err))
+	}
+	sig, err := signing.Sign(f, key)
+	f.Close()
+	if err != nil {
+		fatal(err)
+	}
+	if err := sig.Write(sigPath); err != nil {
+		fatal(err)
+	}
+	fmt.Printf("已签名 %s（密钥 %s），签名保存到 %s\n", manifestPath, sig.KeyID, sigPath)
+}
+
+// runVerify 执行 verify 子命令：用公钥验证清单文件的签名
+//
+// 签名有效时退出码为 0，没有签名或签名无效时为 1，无法读取密钥等运行错误为 2。
+func runVerify(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	keyPath := fs.String("key", "", "公钥文件（必须指定）")
+	sigFlag := fs.String("signature", "", "签名文件路径（默认为 <清单>"+signing.SignatureSuffix+"）")
+	fs.Usage = commandUsage(fs, "verify --key <公钥> [选项] <清单>", "验证快照清单的签名")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 || *keyPath == "" {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	manifestPath := fs.Arg(0)
+	sigPath := *sigFlag
+	if sigPath == "" {
+		sigPath = signing.SignatureFile(manifestPath)
+	}
+
+	pub, err := signing.LoadPublicKey(*keyPath)
+	if err != nil {
+		fatal(err)
+	}
+	sig, err := signing.ReadSignature(sigPath)
+	if errors.Is(err, signing.ErrUnsigned) {
+		fmt.Fprintf(os.Stderr, "验证失败: %s %v（找不到 %s）\n", manifestPath, err, sigPath)
+		os.Exit(exitDifferent)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	f, err := os.Open(manifestPath)
+	if err != nil {
+		fatal(fmt.Errorf("无法打开清单文件: %v", err))
+	}
+	err = signing.Verify(f, sig, pub)
+	f.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "验证失败: %s: %v\n", manifestPath, err)
+		os.Exit(exitDifferent)
+	}
+	fmt.Printf("签名有效: %s（密钥 %s，签名于 %s）\n", manifestPath, sig.KeyID, sig.SignedAt.Local().Format("2006-01-02 15:04:05"))
+}
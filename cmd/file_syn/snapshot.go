@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"file_syn/internal/hasher"
+	"file_syn/internal/ignore"
+	"file_syn/internal/manifest"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// runSnapshot 执行 snapshot 子命令：扫描一个目录并保存为清单文件
+func runSnapshot(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	output := fs.String("output", "", "清单文件路径（默认输出到标准输出）")
+	format := fs.String("format", manifest.FormatJSON, "清单格式："+strings.Join(manifest.Formats, ", "))
+	hashAlgo := fs.String("hash", "", "计算内容摘要使用的算法，如 sha256（默认不计算）")
+	var excludes, includes stringList
+	fs.Var(&excludes, "exclude", ".gitignore 语法的排除规则（可重复指定）")
+	fs.Var(&includes, "include", "重新包含被排除路径的规则（可重复指定）")
+	ignoreFile := fs.String("ignore-file", ignore.DefaultFileName, "目录级忽略文件名（为空时不读取）")
+	followSymlinks := fs.Bool("follow-symlinks", false, "跟随符号链接，按链接目标记录（默认记录链接本身）")
+	metadata := fs.String("metadata", "", "额外记录的扩展元数据，逗号分隔：owner, special, xattr, acl（仅 Linux）")
+	workers := fs.Int("workers", 0, "并发扫描的工作协程数（默认为 CPU 核数，至少为 4）")
+	showProgress := fs.Bool("progress", true, "标准错误是终端时显示扫描进度（--progress=false 关闭）")
+	timeout := fs.Duration("timeout", 0, "扫描的时间限制，如 30m（默认不限制）")
+	fs.Usage = commandUsage(fs, "snapshot [选项] <目录>", "扫描目录并将结果保存为清单文件")
+	fs.Parse(args)
+	ctx, cancel := withTimeout(ctx, *timeout)
+	defer cancel()
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(exitError)
+	}
+	root, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		fatal(fmt.Errorf("无法获取目录的绝对路径: %v", err))
+	}
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		fatal(fmt.Errorf("目录不存在: %s", root))
+	}
+	if *hashAlgo != "" {
+		if _, err := hasher.New(*hashAlgo); err != nil {
+			fatal(err)
+		}
+	}
+	if !slices.Contains(manifest.Formats, *format) {
+		fatal(fmt.Errorf("不支持的清单格式: %s", *format))
+	}
+	metadataOptions, err := parseMetadata(*metadata)
+	if err != nil {
+		fatal(err)
+	}
+
+	progress := newProgressLine(*showProgress)
+	var tracker *scanner.Tracker
+	if callback := progress.callback(); callback != nil {
+		tracker = scanner.NewTracker(callback, 0)
+	}
+	s := scanner.NewFileScannerWithOptions(root, scanner.Options{
+		HashAlgo:   *hashAlgo,
+		Exclude:    excludes,
+		Include:    includes,
+		IgnoreFile: *ignoreFile,
+		Workers:    *workers,
+		Tracker:    tracker,
+		Metadata:   metadataOptions,
+
+		FollowSymlinks: *followSymlinks,
+	})
+	tracker.Start()
+	err = s.ScanContext(ctx)
+	tracker.Stop()
+	progress.clear()
+	exitIfCanceled(ctx, nil)
+	if err != nil {
+		fatal(fmt.Errorf("扫描目录失败: %v", err))
+	}
+	for _, scanErr := range s.Errors() {
+		fmt.Fprintf(os.Stderr, "警告: %v\n", scanErr)
+	}
+	m := manifest.New(root, *hashAlgo, s.GetFiles(), s.Errors())
+	m.ToolVersion = version
+
+	if *output == "" {
+		if err := m.WriteFormat(os.Stdout, *format); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Create(*output)
+	if err != nil {
+		fatal(fmt.Errorf("无法创建清单文件: %v", err))
+	}
+	err = m.WriteFormat(f, *format)
+	if closeErr := f.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("无法写出清单: %v", closeErr)
+	}
+	if err != nil {
+		fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "已保存 %d 个条目到 %s\n", len(m.Entries), *output)
+}
+
+// parseMetadata 解析逗号分隔的扩展元数据名称（与对比属性的名称一致）
+func parseMetadata(value string) (models.MetadataOptions, error) {
+	var options models.MetadataOptions
+	for _, name := range splitList(value) {
+		switch models.DifferenceKind(name) {
+		case models.DiffOwner:
+			options.Owner = true
+		case models.DiffSpecial:
+			options.Special = true
+		case models.DiffXattr:
+			options.Xattrs = true
+		case models.DiffACL:
+			options.ACL = true
+		default:
+			return options, fmt.Errorf("不支持的扩展元数据: %s", name)
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"file_syn/internal/manifest"
+	"file_syn/internal/runner"
+)
+
+// deltaThresholdUsage sync 和 export 的 --delta-threshold 选项说明
+const deltaThresholdUsage = "修改的文件不小于该大小（字节）时使用增量传输，只写入变化的部分（负数表示不使用，覆盖配置 sync.delta_threshold）"
+
+// runSync 执行 sync 子命令：对比两个目录后按同步模式同步
+func runSync(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	var flags configFlags
+	flags.register(fs)
+	dryRun := fs.Bool("dry-run", false, "只打印计划执行的同步操作，不修改任何文件")
+	deleteExtra := fs.Bool("delete", false, "同步时删除右侧目录中多余的文件（覆盖配置 sync.delete_extra）")
+	mode := fs.String("mode", "", "同步模式：mirror 或 bidirectional（覆盖配置 sync.mode）")
+	conflictPolicy := fs.String("conflict", "", "双向同步冲突解决策略：newer, left, right, keep-both, skip（覆盖配置 sync.conflict_policy）")
+	deltaThreshold := fs.Int64("delta-threshold", 0, deltaThresholdUsage)
+	fs.Usage = commandUsage(fs, "sync [选项] [配置文件路径]", "对比后将右侧目录同步为与左侧目录一致（或按基线双向同步）")
+	fs.Parse(args)
+	ctx, cancel := withTimeout(ctx, flags.timeout)
+	defer cancel()
+
+	cfg, err := flags.load(fs)
+	if err != nil {
+		fatal(err)
+	}
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "delete":
+			cfg.Sync.DeleteExtra = *deleteExtra
+		case "mode":
+			cfg.Sync.Mode = *mode
+		case "conflict":
+			cfg.Sync.ConflictPolicy = *conflictPolicy
+		case "delta-threshold":
+			cfg.Sync.DeltaThreshold = *deltaThreshold
+		}
+	})
+	if err := cfg.Finish(); err != nil {
+		fatal(err)
+	}
+	requireLocal(cfg, "sync")
+	for _, dir := range []string{cfg.LeftDir, cfg.RightDir} {
+		if manifest.IsManifest(dir) {
+			fatal(fmt.Errorf("同步的两侧都必须是目录，不能是清单文件: %s", dir))
+		}
+	}
+	printer, err := newPrinter(cfg)
+	if err != nil {
+		fatal(err)
+	}
+
+	comparer, results, cache := compareDirs(ctx, cfg, newProgressLine(flags.progress))
+	saveHashCache(cache)
+	printer.PrintResults(results)
+	printer.PrintErrors(comparer.Errors())
+
+	// 对比完成后才收到中断信号时不再开始同步（同步开始后会执行完所有操作）
+	if ctx.Err() != nil {
+		flushReport(printer)
+		exitIfCanceled(ctx, cache)
+	}
+
+	// 执行同步
+	err = runner.Sync(cfg, *dryRun, cache, results, printer)
+	flushReport(printer)
+	saveHashCache(cache)
+	if err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"file_syn/internal/reporter"
+	"file_syn/internal/watch"
+	"file_syn/pkg/models"
+)
+
+// runWatch 执行 watch 子命令：完整对比一次，之后监测两个目录的变化并输出状态发生变化的文件
+//
+// 收到中断信号或超过 --timeout 时正常退出（退出码 0）。
+func runWatch(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var flags configFlags
+	flags.register(fs)
+	interval := fs.Duration("interval", watch.DefaultInterval, "轮询时重新扫描的时间间隔（无法使用 inotify 或指定 --poll 时）")
+	debounce := fs.Duration("debounce", watch.DefaultDebounce, "最后一个变化之后等待多久重新对比，合并编辑器保存、复制大量文件等连续的变化")
+	poll := fs.Bool("poll", false, "不使用 inotify，每隔 --interval 重新扫描整个目录")
+	fs.Usage = commandUsage(fs, "watch [选项] [配置文件路径]", "持续监测两个目录，输出状态发生变化的文件\n"+
+		"inotify 事件队列溢出（如一次复制大量文件）时会重新扫描溢出一侧的整个目录，目录树很大时耗时较长，\n"+
+		"可以调大 fs.inotify.max_queued_events 避免溢出")
+	fs.Parse(args)
+	ctx, cancel := withTimeout(ctx, flags.timeout)
+	defer cancel()
+
+	cfg, err := flags.load(fs)
+	if err != nil {
+		fatal(err)
+	}
+	if err := cfg.Finish(); err != nil {
+		fatal(err)
+	}
+	requireLocal(cfg, "watch")
+	if *interval <= 0 {
+		fatal(fmt.Errorf("无效的时间间隔: %v", *interval))
+	}
+	if *debounce <= 0 {
+		fatal(fmt.Errorf("无效的去抖动时间: %v", *debounce))
+	}
+	printer, err := newPrinter(cfg)
+	if err != nil {
+		fatal(err)
+	}
+
+	printCompareInfo(cfg)
+	progress := newProgressLine(flags.progress)
+	cache := openHashCache(cfg)
+	comparer := newComparer(cfg, cache, progress)
+	view, err := comparer.NewView(ctx, cfg.LeftDir, cfg.RightDir)
+	progress.clear()
+	if err != nil {
+		exitIfCanceled(ctx, cache)
+		fatal(err)
+	}
+	saveHashCache(cache)
+	printer.PrintResults(view.Results())
+	printer.PrintErrors(view.Errors())
+	flushReport(printer)
+
+	info := infoWriter(cfg)
+	w := watch.New(view, watch.Options{
+		Debounce:   *debounce,
+		Interval:   *interval,
+		Poll:       *poll,
+		IgnoreFile: cfg.IgnoreFileName(),
+		Warn: func(err error) {
+			fmt.Fprintf(os.Stderr, "警告: %v\n", err)
+		},
+	})
+	fmt.Fprintf(info, "\n监测方式: 左侧 %s，右侧 %s\n",
+		watchModeDisplay(w.Mode(models.SideLeft), *interval), watchModeDisplay(w.Mode(models.SideRight), *interval))
+
+	w.Run(ctx, func(update *watch.Update) {
+		saveHashCache(cache)
+
+		// 变化的文件无论是否变为未变更都需要输出
+		now := update.Time.Format("2006-01-02 15:04:05")
+		printer, err := reporter.NewWithOptions(cfg.Format, os.Stdout, reporter.Options{
+			ShowUnchanged: true,
+			ContentDiff:   cfg.ContentDiffOptions(),
+			Language:      cfg.Language,
+		})
+		if err != nil {
+			fatal(err)
+		}
+		if len(update.Changed) > 0 {
+			fmt.Fprintf(info, "\n[%s] %d 个文件状态发生变化\n", now, len(update.Changed))
+			printer.PrintResults(update.Changed)
+		}
+		// 扫描错误只在发生变化时重新输出
+		if update.ErrorsChanged {
+			fmt.Fprintf(info, "\n[%s] 扫描错误发生变化，当前 %d 个\n", now, len(update.Errors))
+			printer.PrintErrors(update.Errors)
+		}
+		flushReport(printer)
+	})
+	saveHashCache(cache)
+}
+
+// watchModeDisplay 返回一侧监测方式的显示名称
+func watchModeDisplay(mode string, interval time.Duration) string {
+	switch mode {
+	case watch.ModeInotify:
+		return "inotify"
+	case watch.ModePoll:
+		return fmt.Sprintf("轮询（每隔 %v）", interval)
+	}
+	return "清单（不监测）"
+}
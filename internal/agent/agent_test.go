@@ -0,0 +1,260 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"file_syn/internal/diff"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// agentEnv 设置该环境变量时 TestHelperAgent 作为 agent 运行
+const agentEnv = "FILE_SYN_TEST_AGENT"
+
+// TestHelperAgent 不是真正的测试：startAgent 以子进程方式运行测试程序本身作为 agent
+func TestHelperAgent(t *testing.T) {
+	if os.Getenv(agentEnv) != "1" {
+		t.Skip("仅作为 agent 子进程运行")
+	}
+	if err := Serve(context.Background(), os.Stdin, os.Stdout, ServeOptions{ToolVersion: "test"}); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// startAgent 以子进程启动 agent（与 ssh host file_syn agent 的方式相同）
+func startAgent(t *testing.T) *Client {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("测试使用 /bin/sh 启动 agent")
+	}
+	t.Setenv(agentEnv, "1")
+	command := "'" + strings.ReplaceAll(os.Args[0], "'", `'\''`) + "' -test.run='^TestHelperAgent$'"
+	client, err := Start(command)
+	if err != nil {
+		t.Fatalf("启动 agent 失败: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// writeTree 在 root 下创建文件
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+}
+
+// setupDirs 创建左右两个目录
+func setupDirs(t *testing.T) (string, string) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	writeTree(t, leftDir, map[string]string{
+		"same.txt":       "same",
+		"changed.txt":    "left",
+		"only-left.txt":  "left",
+		"dir/nested.txt": "nested",
+		"dir-x/file.txt": "sibling",
+		"skip.log":       "excluded",
+	})
+	writeTree(t, rightDir, map[string]string{
+		"same.txt":       "same",
+		"changed.txt":    "right side",
+		"only-right.txt": "right",
+		"dir/nested.txt": "nested",
+		"dir-x/file.txt": "sibling",
+		"skip.log":       "excluded, different",
+	})
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, root := range []string{leftDir, rightDir} {
+		for _, name := range []string{"same.txt", "dir/nested.txt", "dir-x/file.txt"} {
+			os.Chtimes(filepath.Join(root, filepath.FromSlash(name)), modTime, modTime)
+		}
+	}
+	return leftDir, rightDir
+}
+
+// summarize 把对比结果转换为 路径:状态 的列表
+func summarize(results []*models.DiffResult) []string {
+	var lines []string
+	for _, result := range results {
+		lines = append(lines, result.Path+":"+result.Status)
+	}
+	return lines
+}
+
+func TestRemoteCompare(t *testing.T) {
+	leftDir, rightDir := setupDirs(t)
+	client := startAgent(t)
+	if client.ToolVersion() != "test" || client.Host() == "" {
+		t.Errorf("握手信息错误: %q %q", client.ToolVersion(), client.Host())
+	}
+
+	options := diff.Options{Scan: scanner.Options{HashAlgo: "sha256", Exclude: []string{"*.log"}}}
+	local, err := diff.NewComparerWithOptions(options).Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("本地对比失败: %v", err)
+	}
+
+	// 右侧通过 agent 扫描，结果应与本地扫描一致（包括摘要）
+	options.Remote = map[string]diff.Opener{
+		models.SideRight: func(path string, options scanner.Options) diff.Source { return client.Source(path, options) },
+	}
+	comparer := diff.NewComparerWithOptions(options)
+	remote, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("远程对比失败: %v", err)
+	}
+	if got, want := summarize(remote), summarize(local); !slices.Equal(got, want) {
+		t.Errorf("远程对比结果不一致:\n  远程: %v\n  本地: %v", got, want)
+	}
+	for _, result := range remote {
+		if info := result.RightInfo; info != nil && !info.IsDir && (info.Digest == "" || info.AbsPath != "") {
+			t.Errorf("%s 的远程条目应有摘要且没有本地路径: %+v", result.Path, info)
+		}
+	}
+
+	// 流式对比使用同一个连接
+	results, err := comparer.CompareStream(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("流式对比失败: %v", err)
+	}
+	var streamed []*models.DiffResult
+	for result := range results {
+		streamed = append(streamed, result)
+	}
+	if got, want := summarize(streamed), summarize(local); !slices.Equal(got, want) {
+		t.Errorf("流式远程对比结果不一致:\n  远程: %v\n  本地: %v", got, want)
+	}
+
+	// 远程目录不存在时对比失败，连接仍然可用
+	if _, err := comparer.Compare(leftDir, filepath.Join(rightDir, "missing")); err == nil {
+		t.Error("远程目录不存在时应该返回错误")
+	}
+	if _, err := comparer.Compare(leftDir, rightDir); err != nil {
+		t.Errorf("请求失败后连接应该仍然可用: %v", err)
+	}
+}
+
+func TestRead(t *testing.T) {
+	root := t.TempDir()
+	content := bytes.Repeat([]byte("0123456789"), 100000)
+	if err := os.WriteFile(filepath.Join(root, "data.bin"), content, 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	client := startAgent(t)
+
+	if data, err := io.ReadAll(client.Open(root, "data.bin")); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("读取的完整内容不一致: %d 字节, %v", len(data), err)
+	}
+
+	// 跨越多个数据帧的块
+	block := make([]byte, 3*dataChunk+7)
+	if n, err := client.ReadAt(root, "data.bin", block, 12345); err != nil || !bytes.Equal(block[:n], content[12345:12345+len(block)]) {
+		t.Errorf("读取的内容不一致: %d 字节, %v", n, err)
+	}
+	// 超出文件末尾
+	tail := make([]byte, 100)
+	if n, err := client.ReadAt(root, "data.bin", tail, int64(len(content)-10)); n != 10 || err != io.EOF {
+		t.Errorf("读到文件末尾时应返回 10 字节和 io.EOF: %d, %v", n, err)
+	}
+
+	for _, path := range []string{"../escape", "/etc/passwd", "missing"} {
+		if _, err := io.ReadAll(client.Open(root, path)); err == nil {
+			t.Errorf("%q 应该返回错误", path)
+		}
+	}
+	if _, err := client.ReadAt(root, "data.bin", block, 0); err != nil {
+		t.Errorf("请求失败后连接应该仍然可用: %v", err)
+	}
+}
+
+func TestWalkStopEarly(t *testing.T) {
+	root := t.TempDir()
+	files := make(map[string]string)
+	for i := range 3 * entryBatch {
+		files[filepath.Join("d", strings.Repeat("x", i%7+1)+string(rune('a'+i%26))+string(rune('a'+i/26)))] = "x"
+	}
+	writeTree(t, root, files)
+
+	// 在进程内通过管道连接
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(context.Background(), serverRead, serverWrite, ServeOptions{})
+		serverWrite.Close()
+	}()
+	client, err := NewClient(clientRead, clientWrite)
+	if err != nil {
+		t.Fatalf("连接失败: %v", err)
+	}
+
+	source := client.Source(root, scanner.Options{})
+	walk, _ := source.WalkContext(context.Background())
+	count := 0
+	for range walk {
+		if count++; count == 10 {
+			break
+		}
+	}
+	// 提前停止后剩余的条目被丢弃，连接可以继续使用
+	if err := source.ScanContext(context.Background()); err != nil || len(source.GetFiles()) != len(files)+1 {
+		t.Errorf("提前停止后重新扫描失败: %d 个条目, %v", len(source.GetFiles()), err)
+	}
+
+	client.Close()
+	if err := <-done; err != nil {
+		t.Errorf("连接关闭后 agent 应正常结束: %v", err)
+	}
+}
+
+func TestServeInvalid(t *testing.T) {
+	err := Serve(context.Background(), strings.NewReader("garbage data"), io.Discard, ServeOptions{})
+	if err == nil {
+		t.Error("无效的输入应该返回错误")
+	}
+
+	// 版本不一致时握手失败
+	clientRead, serverWrite := io.Pipe()
+	serverRead, clientWrite := io.Pipe()
+	go func() {
+		c := newConn(serverRead, serverWrite)
+		c.readFrame()
+		c.writeJSON(frameResponse, &response{Version: Version + 1})
+		c.w.Flush()
+	}()
+	if _, err := NewClient(clientRead, clientWrite); err == nil || !strings.Contains(err.Error(), "版本") {
+		t.Errorf("版本不一致时应该返回错误: %v", err)
+	}
+}
+
+func TestCanceled(t *testing.T) {
+	client := startAgent(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	source := client.Source(t.TempDir(), scanner.Options{})
+	if err := source.ScanContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后应该返回 context.Canceled: %v", err)
+	}
+	if _, err := client.ReadAt(t.TempDir(), "x", make([]byte, 1), 0); !errors.Is(err, errClosed) {
+		t.Errorf("取消后连接应该已关闭: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	"file_syn/internal/scanner"
+)
+
+// closeTimeout 关闭连接后等待 agent 退出的时间，超时后结束进程
+const closeTimeout = 5 * time.Second
+
+// errClosed 连接已关闭
+var errClosed = errors.New("与 agent 的连接已关闭")
+
+// Client 与一个 agent 的连接
+//
+// 同一时间只处理一个请求，多个协程可以共用同一个连接（请求依次进行）。
+type Client struct {
+	conn   *conn
+	reader io.Closer
+	writer io.Closer
+	cmd    *exec.Cmd // Start 启动的进程（NewClient 创建时为 nil）
+
+	mu     sync.Mutex // 保证请求依次进行
+	broken error      // 连接出错后的原因，之后的请求都返回该错误
+
+	host        string
+	toolVersion string
+}
+
+// Start 通过 shell 执行 command（如 ssh host file_syn agent）启动 agent 并完成握手
+//
+// command 的标准错误直接输出到本进程的标准错误，便于查看 ssh 等命令的提示和错误。
+func Start(command string) (*Client, error) {
+	cmd := shellCommand(command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("无法启动 agent（%s）: %v", command, err)
+	}
+
+	c := newClient(stdout, stdin)
+	c.cmd = cmd
+	if err := c.hello(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("无法连接 agent（%s）: %v", command, err)
+	}
+	return c, nil
+}
+
+// shellCommand 返回通过系统 shell 执行 command 的命令
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
+
+// NewClient 通过已建立的连接（r 读取 agent 的输出，w 写入 agent 的输入）完成握手
+func NewClient(r io.ReadCloser, w io.WriteCloser) (*Client, error) {
+	c := newClient(r, w)
+	if err := c.hello(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("无法连接 agent: %v", err)
+	}
+	return c, nil
+}
+
+func newClient(r io.ReadCloser, w io.WriteCloser) *Client {
+	return &Client{conn: newConn(r, w), reader: r, writer: w}
+}
+
+// hello 交换协议版本
+func (c *Client) hello() error {
+	resp, err := c.call(context.Background(), &request{Op: opHello, Version: Version}, nil)
+	if err != nil {
+		return err
+	}
+	if resp.Version != Version {
+		return fmt.Errorf("agent 的协议版本 %d 与本地的 %d 不同，请在两侧使用相同版本的 file_syn", resp.Version, Version)
+	}
+	c.host, c.toolVersion = resp.Host, resp.ToolVersion
+	return nil
+}
+
+// Host 返回 agent 所在的主机名
+func (c *Client) Host() string {
+	return c.host
+}
+
+// ToolVersion 返回 agent 的 file_syn 版本
+func (c *Client) ToolVersion() string {
+	return c.toolVersion
+}
+
+// Close 关闭连接；由 Start 启动时等待 agent 退出，超时后结束进程
+func (c *Client) Close() error {
+	c.writer.Close()
+	if c.cmd == nil {
+		return c.reader.Close()
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(closeTimeout):
+		c.cmd.Process.Kill()
+		return <-done
+	}
+}
+
+// abort 在请求进行中断开连接，使阻塞的读写立即返回
+func (c *Client) abort() {
+	c.writer.Close()
+	c.reader.Close()
+	if c.cmd != nil {
+		c.cmd.Process.Kill()
+	}
+}
+
+// Source 返回以 agent 所在主机上的目录 root 作为对比一侧的数据源
+//
+// 扫描选项中的摘要缓存和进度汇总只在本地有效，不会传给 agent。
+func (c *Client) Source(root string, options scanner.Options) *Source {
+	return &Source{client: c, root: root, options: newScanOptions(options)}
+}
+
+// ReadAt 从 agent 所在主机上目录 root 中文件 relPath 的 off 处读取内容到 p，
+// 语义与 io.ReaderAt 一致：读到的字节数少于 len(p) 时返回错误（到达文件末尾时为 io.EOF）
+func (c *Client) ReadAt(root, relPath string, p []byte, off int64) (int, error) {
+	var n int
+	for n < len(p) {
+		length := min(len(p)-n, maxRead)
+		start := n
+		resp, err := c.call(context.Background(), &request{Op: opRead, Root: root, Path: relPath, Offset: off + int64(n), Length: int64(length)},
+			func(kind byte, payload []byte) error {
+				if kind != frameData || len(payload) > len(p)-n {
+					return fmt.Errorf("意外的帧 %q", kind)
+				}
+				n += copy(p[n:], payload)
+				return nil
+			})
+		if err != nil {
+			return n, err
+		}
+		if int64(n-start) != resp.Size {
+			return n, fmt.Errorf("读取的长度与响应不一致")
+		}
+		if resp.EOF {
+			return n, io.EOF
+		}
+	}
+	return n, nil
+}
+
+// Open 返回从头读取 agent 所在主机上目录 root 中文件 relPath 内容的 Reader，
+// 读取时按需分段请求（用于生成远程文件的内容差异）
+func (c *Client) Open(root, relPath string) io.Reader {
+	read := readerAt(func(p []byte, off int64) (int, error) {
+		return c.ReadAt(root, relPath, p, off)
+	})
+	return bufio.NewReaderSize(io.NewSectionReader(read, 0, math.MaxInt64), dataChunk)
+}
+
+// readerAt 将读取函数适配为 io.ReaderAt
+type readerAt func(p []byte, off int64) (int, error)
+
+func (f readerAt) ReadAt(p []byte, off int64) (int, error) {
+	return f(p, off)
+}
+
+// requestError agent 处理请求失败（连接仍然可用）
+type requestError struct {
+	message string
+}
+
+func (e *requestError) Error() string {
+	return "agent: " + e.message
+}
+
+// call 发送请求并读取响应，数据帧交给 handle 处理（为 nil 时不接受数据帧）
+//
+// handle 返回错误或读写失败时连接无法继续使用；ctx 被取消时断开连接。
+// agent 处理请求失败时返回 *requestError，连接仍然可用。
+func (c *Client) call(ctx context.Context, req *request, handle func(kind byte, payload []byte) error) (*response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken != nil {
+		return nil, c.broken
+	}
+	stop := context.AfterFunc(ctx, c.abort)
+	resp, err := c.roundTrip(req, handle)
+	if !stop() && err == nil {
+		// ctx 已被取消，abort 已经开始断开连接，即使请求已经完成连接也不能继续使用
+		err = ctx.Err()
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		c.broken = fmt.Errorf("%w: %v", errClosed, err)
+		c.abort()
+		return nil, err
+	}
+	if resp.Error != "" {
+		return resp, &requestError{message: resp.Error}
+	}
+	return resp, nil
+}
+
+// roundTrip 写出请求并读取帧直到响应帧
+func (c *Client) roundTrip(req *request, handle func(kind byte, payload []byte) error) (*response, error) {
+	if err := c.conn.writeJSON(frameRequest, req); err != nil {
+		return nil, err
+	}
+	if err := c.conn.w.Flush(); err != nil {
+		return nil, err
+	}
+	for {
+		kind, payload, err := c.conn.readFrame()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if kind == frameResponse {
+			var resp response
+			if err := json.Unmarshal(payload, &resp); err != nil {
+				return nil, fmt.Errorf("无效的响应: %v", err)
+			}
+			return &resp, nil
+		}
+		if handle == nil {
+			return nil, fmt.Errorf("意外的帧 %q", kind)
+		}
+		if err := handle(kind, payload); err != nil {
+			return nil, err
+		}
+	}
+}
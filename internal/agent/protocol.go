@@ -0,0 +1,163 @@
+// Package agent 通过标准输入输出上的分帧协议访问另一台主机上的目录
+//
+// 远程主机上运行 file_syn agent，本地通过任意能够连接其标准输入输出的命令
+// （如 ssh host file_syn agent）启动它。agent 提供扫描结果、文件摘要和文件内容块，
+// 本地把远程目录作为对比的一侧（Source），与扫描本地目录的结果一致。
+//
+// 每帧由 1 字节类型、4 字节大端长度和内容组成。本地每次发送一个请求帧，
+// agent 依次回复零个或多个数据帧（扫描条目、扫描错误或文件内容），最后回复一个响应帧。
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// Version 协议的版本号，不兼容的变化时递增
+const Version = 1
+
+// 帧类型
+const (
+	frameRequest  = 'Q' // 请求（JSON）
+	frameResponse = 'R' // 请求的最终响应（JSON），每个请求恰好一个
+	frameEntries  = 'F' // 扫描到的条目（manifest.Entry 的 JSON 数组）
+	frameErrors   = 'X' // 扫描错误（manifest.ErrorEntry 的 JSON 数组）
+	frameData     = 'D' // 文件内容（原始字节）
+)
+
+// maxFrame 单帧内容的长度上限
+const maxFrame = 16 << 20
+
+// 请求的操作
+const (
+	opHello = "hello" // 握手：交换协议版本
+	opScan  = "scan"  // 按路径顺序扫描目录
+	opRead  = "read"  // 读取文件的一段内容
+)
+
+// entryBatch 扫描时每帧的条目数
+const entryBatch = 256
+
+// dataChunk 读取文件内容时每帧的字节数
+const dataChunk = 256 << 10
+
+// maxRead 单个读取请求的长度上限
+const maxRead = 64 << 20
+
+// request 请求
+type request struct {
+	Op      string       `json:"op"`
+	Version int          `json:"version,omitempty"` // 客户端的协议版本（hello）
+	Root    string       `json:"root,omitempty"`    // 远程主机上的目录（scan、read）
+	Path    string       `json:"path,omitempty"`    // 目录中的相对路径（read）
+	Scan    *scanOptions `json:"scan,omitempty"`    // 扫描选项（scan）
+	Offset  int64        `json:"offset,omitempty"`  // 读取的起始位置（read）
+	Length  int64        `json:"length,omitempty"`  // 读取的最大长度（read）
+}
+
+// response 响应
+type response struct {
+	Error       string `json:"error,omitempty"`        // 请求失败时的原因
+	Version     int    `json:"version,omitempty"`      // agent 的协议版本（hello）
+	ToolVersion string `json:"tool_version,omitempty"` // agent 的 file_syn 版本（hello）
+	Host        string `json:"host,omitempty"`         // agent 所在的主机名（hello）
+	Size        int64  `json:"size,omitempty"`         // 读取到的字节数（read）
+	EOF         bool   `json:"eof,omitempty"`          // 是否已读到文件末尾（read）
+}
+
+// scanOptions 可以传给 agent 的扫描选项（摘要缓存和进度只在本地使用）
+type scanOptions struct {
+	HashAlgo       string                 `json:"hash,omitempty"`
+	Exclude        []string               `json:"exclude,omitempty"`
+	Include        []string               `json:"include,omitempty"`
+	IgnoreFile     string                 `json:"ignore_file,omitempty"`
+	FollowSymlinks bool                   `json:"follow_symlinks,omitempty"`
+	Metadata       models.MetadataOptions `json:"metadata"`
+	Workers        int                    `json:"workers,omitempty"`
+}
+
+func newScanOptions(options scanner.Options) *scanOptions {
+	return &scanOptions{
+		HashAlgo:       options.HashAlgo,
+		Exclude:        options.Exclude,
+		Include:        options.Include,
+		IgnoreFile:     options.IgnoreFile,
+		FollowSymlinks: options.FollowSymlinks,
+		Metadata:       options.Metadata,
+		Workers:        options.Workers,
+	}
+}
+
+func (o *scanOptions) options() scanner.Options {
+	return scanner.Options{
+		HashAlgo:       o.HashAlgo,
+		Exclude:        o.Exclude,
+		Include:        o.Include,
+		IgnoreFile:     o.IgnoreFile,
+		FollowSymlinks: o.FollowSymlinks,
+		Metadata:       o.Metadata,
+		Workers:        o.Workers,
+	}
+}
+
+// conn 分帧读写
+type conn struct {
+	r *bufio.Reader
+	w *bufio.Writer
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{r: bufio.NewReader(r), w: bufio.NewWriter(w)}
+}
+
+// writeFrame 写出一帧（不刷新缓冲）
+func (c *conn) writeFrame(kind byte, payload []byte) error {
+	var header [5]byte
+	header[0] = kind
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	if _, err := c.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := c.w.Write(payload)
+	return err
+}
+
+// writeJSON 写出内容为 JSON 的一帧
+func (c *conn) writeJSON(kind byte, v any) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(kind, payload)
+}
+
+// readFrame 读取一帧
+func (c *conn) readFrame() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.BigEndian.Uint32(header[1:])
+	if n > maxFrame {
+		return 0, nil, fmt.Errorf("帧长度 %d 超过上限", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, unexpectedEOF(err)
+	}
+	return header[0], payload, nil
+}
+
+// unexpectedEOF 把帧中间的 EOF 转换为 io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
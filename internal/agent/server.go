@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"file_syn/internal/manifest"
+	"file_syn/internal/scanner"
+)
+
+// ServeOptions agent 的选项
+type ServeOptions struct {
+	ToolVersion string // 握手时告知对方的 file_syn 版本
+}
+
+// Serve 从 r 读取请求并把响应写出到 w，直到 r 结束
+//
+// 单个请求失败（如目录不存在）时在响应中返回原因并继续处理下一个请求；
+// 读写失败或收到无效的帧时返回错误。ctx 被取消时正在进行的扫描提前结束。
+func Serve(ctx context.Context, r io.Reader, w io.Writer, options ServeOptions) error {
+	s := &server{conn: newConn(r, w), options: options}
+	for {
+		kind, payload, err := s.conn.readFrame()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("无法读取请求: %v", err)
+		}
+		if kind != frameRequest {
+			return fmt.Errorf("期望请求帧，收到 %q", kind)
+		}
+		var req request
+		if err := json.Unmarshal(payload, &req); err != nil {
+			return fmt.Errorf("无效的请求: %v", err)
+		}
+
+		resp, err := s.handle(ctx, &req)
+		if err != nil {
+			return err
+		}
+		if err := s.conn.writeJSON(frameResponse, resp); err != nil {
+			return err
+		}
+		if err := s.conn.w.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+// server agent 一侧的连接
+type server struct {
+	conn    *conn
+	options ServeOptions
+}
+
+// handle 处理一个请求：请求本身的错误放在响应中，只有写出失败时返回错误
+func (s *server) handle(ctx context.Context, req *request) (*response, error) {
+	switch req.Op {
+	case opHello:
+		host, _ := os.Hostname()
+		return &response{Version: Version, ToolVersion: s.options.ToolVersion, Host: host}, nil
+	case opScan:
+		return s.scan(ctx, req)
+	case opRead:
+		return s.read(req)
+	default:
+		return &response{Error: fmt.Sprintf("不支持的操作: %s", req.Op)}, nil
+	}
+}
+
+// scan 按路径顺序扫描目录，分批写出条目；每批之前先写出新发生的扫描错误，
+// 使对方处理到某个条目时，该条目之前的扫描错误都已收到
+func (s *server) scan(ctx context.Context, req *request) (*response, error) {
+	if info, err := os.Stat(req.Root); err != nil || !info.IsDir() {
+		return &response{Error: fmt.Sprintf("目录不存在: %s", req.Root)}, nil
+	}
+	var options scanner.Options
+	if req.Scan != nil {
+		options = req.Scan.options()
+	}
+	fs := scanner.NewFileScannerWithOptions(req.Root, options)
+	files, err := fs.WalkContext(ctx)
+	if err != nil {
+		return &response{Error: err.Error()}, nil
+	}
+
+	batch := make([]*manifest.Entry, 0, entryBatch)
+	sent := make(map[string]bool)
+	flush := func() error {
+		var scanErrors []*manifest.ErrorEntry
+		for _, scanErr := range fs.Errors() {
+			if key := scanErr.Op + "\x00" + scanErr.Path; !sent[key] {
+				sent[key] = true
+				scanErrors = append(scanErrors, manifest.NewErrorEntry(scanErr))
+			}
+		}
+		if len(scanErrors) > 0 {
+			if err := s.conn.writeJSON(frameErrors, scanErrors); err != nil {
+				return err
+			}
+		}
+		if len(batch) > 0 {
+			if err := s.conn.writeJSON(frameEntries, batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		return nil
+	}
+
+	for info := range files {
+		batch = append(batch, manifest.NewEntry(info))
+		if len(batch) == entryBatch {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return &response{Error: fmt.Sprintf("扫描被中断: %v", err)}, nil
+	}
+	return &response{}, nil
+}
+
+// read 从文件的 req.Offset 处读取最多 req.Length 字节，分块写出
+func (s *server) read(req *request) (*response, error) {
+	path, err := localPath(req.Root, req.Path)
+	if err != nil {
+		return &response{Error: err.Error()}, nil
+	}
+	if req.Offset < 0 || req.Length < 0 || req.Length > maxRead {
+		return &response{Error: fmt.Sprintf("无效的读取范围: %d+%d", req.Offset, req.Length)}, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return &response{Error: err.Error()}, nil
+	}
+	defer f.Close()
+
+	r := io.NewSectionReader(f, req.Offset, req.Length)
+	buf := make([]byte, min(req.Length, dataChunk))
+	var size int64
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if err := s.conn.writeFrame(frameData, buf[:n]); err != nil {
+				return nil, err
+			}
+			size += int64(n)
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// 已写出的数据仍然有效，对方按响应中的错误处理
+			return &response{Size: size, Error: err.Error()}, nil
+		}
+	}
+	// 读取的长度不足时说明已到文件末尾
+	return &response{Size: size, EOF: size < req.Length}, nil
+}
+
+// localPath 返回目录 root 中相对路径 relPath 的本地路径，拒绝超出目录的路径
+func localPath(root, relPath string) (string, error) {
+	path := filepath.FromSlash(relPath)
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("无效的路径: %q", relPath)
+	}
+	return filepath.Join(root, path), nil
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"slices"
+	"sync"
+
+	"file_syn/internal/manifest"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// Source 以 agent 所在主机上的目录作为对比的一侧，提供与 scanner.FileScanner 相同的读取方法
+//
+// 条目的 AbsPath 为空（不是本地路径）。连接在流式遍历中途失败时，
+// 记录一个根目录的读取错误，使尚未对比的路径都被标记为 unknown。
+type Source struct {
+	client  *Client
+	root    string
+	options *scanOptions
+	files   map[string]*models.FileInfo
+
+	mu     sync.Mutex // 保护扫描错误（流式对比时由预读协程写入）
+	errors []*models.ScanError
+	index  *scanner.ErrorIndex
+}
+
+// Root 返回 agent 所在主机上的目录
+func (s *Source) Root() string {
+	return s.root
+}
+
+// ScanContext 通过 agent 扫描整个目录
+func (s *Source) ScanContext(ctx context.Context) error {
+	files := make(map[string]*models.FileInfo)
+	err := s.walk(ctx, func(info *models.FileInfo) bool {
+		files[info.Path] = info
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	s.files = files
+	return nil
+}
+
+// GetFiles 返回 ScanContext 得到的文件信息
+func (s *Source) GetFiles() map[string]*models.FileInfo {
+	return s.files
+}
+
+// WalkContext 按 scanner.ComparePaths 的顺序逐个产出 agent 扫描到的条目
+func (s *Source) WalkContext(ctx context.Context) (iter.Seq[*models.FileInfo], error) {
+	return func(yield func(*models.FileInfo) bool) {
+		if err := s.walk(ctx, yield); err != nil && ctx.Err() == nil {
+			s.addError(&models.ScanError{Op: models.ScanOpReadDir, Err: fmt.Errorf("远程扫描失败: %v", err)})
+		}
+	}, nil
+}
+
+// walk 请求 agent 扫描目录，把收到的条目依次交给 yield；yield 返回 false 后丢弃剩余的条目
+func (s *Source) walk(ctx context.Context, yield func(*models.FileInfo) bool) error {
+	s.mu.Lock()
+	s.errors, s.index = nil, scanner.NewErrorIndex()
+	s.mu.Unlock()
+
+	stopped := false
+	_, err := s.client.call(ctx, &request{Op: opScan, Root: s.root, Scan: s.options}, func(kind byte, payload []byte) error {
+		switch kind {
+		case frameEntries:
+			var entries []*manifest.Entry
+			if err := json.Unmarshal(payload, &entries); err != nil {
+				return fmt.Errorf("无效的扫描结果: %v", err)
+			}
+			for _, e := range entries {
+				if stopped {
+					break
+				}
+				stopped = !yield(e.FileInfo())
+			}
+		case frameErrors:
+			var scanErrors []*manifest.ErrorEntry
+			if err := json.Unmarshal(payload, &scanErrors); err != nil {
+				return fmt.Errorf("无效的扫描结果: %v", err)
+			}
+			for _, e := range scanErrors {
+				s.addError(e.ScanError())
+			}
+		default:
+			return fmt.Errorf("意外的帧 %q", kind)
+		}
+		return nil
+	})
+	return err
+}
+
+// addError 记录一个扫描错误
+func (s *Source) addError(err *models.ScanError) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors = append(s.errors, err)
+	s.index.Add(err.Op, err.Path)
+}
+
+// Errors 返回扫描错误，按路径排序
+func (s *Source) Errors() []*models.ScanError {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errors := slices.Clone(s.errors)
+	slices.SortStableFunc(errors, func(a, b *models.ScanError) int {
+		return scanner.ComparePaths(a.Path, b.Path)
+	})
+	return errors
+}
+
+// Unknown 判断 path 的状态是否因扫描错误而无法确定，见 scanner.ErrorIndex.Unknown
+func (s *Source) Unknown(path string, exists bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index == nil {
+		return false
+	}
+	return s.index.Unknown(path, exists)
+}
@@ -0,0 +1,431 @@
+package bundle
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"file_syn/internal/delta"
+	"file_syn/internal/hasher"
+	"file_syn/pkg/models"
+)
+
+// ApplyOptions 应用选项
+type ApplyOptions struct {
+	DryRun bool // 只验证前置条件并返回计划执行的操作，不修改目标目录
+}
+
+// PreconditionError 目标目录的当前状态与补丁包的前置条件不一致
+type PreconditionError struct {
+	Mismatches []string // 每个不一致的路径及原因
+}
+
+func (e *PreconditionError) Error() string {
+	const shown = 10
+	lines := e.Mismatches
+	if len(lines) > shown {
+		lines = append(lines[:shown:shown], fmt.Sprintf("... 共 %d 处不一致", len(e.Mismatches)))
+	}
+	return "目标目录与补丁包的前置条件不一致:\n  " + strings.Join(lines, "\n  ")
+}
+
+// Apply 读取补丁包并应用到目标目录 root
+//
+// 先验证全部前置条件，不一致时返回 *PreconditionError，不修改目标目录。
+// 文件内容先解压（增量由目标文件原有的内容重建）到目标目录中的临时目录并校验摘要，再依次执行操作；
+// 任一操作失败时按相反顺序撤销已执行的操作，使目标目录恢复原状。
+func Apply(r io.Reader, root string, options ApplyOptions) ([]*models.SyncResult, error) {
+	m, tr, err := Read(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := Verify(root, m); err != nil {
+		return nil, err
+	}
+
+	results := make([]*models.SyncResult, 0, len(m.Entries))
+	for _, e := range m.Entries {
+		results = append(results, &models.SyncResult{Operation: e.operation(root), DryRun: options.DryRun})
+	}
+	if options.DryRun {
+		return results, nil
+	}
+
+	staging, err := os.MkdirTemp(root, ".file_syn-apply-*")
+	if err != nil {
+		return nil, fmt.Errorf("无法创建临时目录: %v", err)
+	}
+	a := &applier{root: root, staging: staging, hashAlgo: m.HashAlgo}
+	if err := a.extract(tr, m); err != nil {
+		os.RemoveAll(staging)
+		return nil, err
+	}
+	for i, e := range m.Entries {
+		a.transfer(results[i], e)
+		if err := a.apply(e); err != nil {
+			err = fmt.Errorf("%s %s 失败: %v", e.Op, e.Path, err)
+			if rollbackErr := a.rollback(); rollbackErr != nil {
+				return nil, fmt.Errorf("%v；撤销失败: %v，原文件保留在 %s", err, rollbackErr, staging)
+			}
+			os.RemoveAll(staging)
+			results[i].Error = err
+			return results[:i+1], err
+		}
+	}
+	os.RemoveAll(staging)
+	return results, nil
+}
+
+// Verify 检查目标目录 root 是否满足清单中的全部前置条件
+func Verify(root string, m *Manifest) error {
+	var mismatches []string
+	for _, pre := range m.Preconditions {
+		if reason := check(root, pre, m.HashAlgo); reason != "" {
+			mismatches = append(mismatches, pre.Path+": "+reason)
+		}
+	}
+	if len(mismatches) > 0 {
+		return &PreconditionError{Mismatches: mismatches}
+	}
+	return nil
+}
+
+// check 检查一个前置条件，满足时返回空字符串，否则返回原因
+func check(root string, pre *Precondition, hashAlgo string) string {
+	if err := checkParents(root, pre.Path); err != nil {
+		return err.Error()
+	}
+	target := filepath.Join(root, filepath.FromSlash(pre.Path))
+	info, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		if pre.Exists {
+			return "不存在"
+		}
+		return ""
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if !pre.Exists {
+		return "已存在"
+	}
+
+	actual := fileType(info)
+	if actual != pre.Type {
+		return fmt.Sprintf("类型为 %s，期望 %s", actual, pre.Type)
+	}
+	switch actual {
+	case models.FileTypeFile:
+		digest, err := hasher.HashFile(target, hashAlgo)
+		if err != nil {
+			return err.Error()
+		}
+		if digest != pre.Digest {
+			return "内容已变化"
+		}
+	case models.FileTypeSymlink:
+		if linkTarget, err := os.Readlink(target); err != nil || linkTarget != pre.LinkTarget {
+			return "链接目标已变化"
+		}
+	}
+	return ""
+}
+
+// checkParents 检查路径的各级上级目录都是目录而不是符号链接，避免操作超出目标目录
+func checkParents(root, relPath string) error {
+	dir := root
+	parts := strings.Split(relPath, "/")
+	for _, part := range parts[:len(parts)-1] {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("上级路径 %s 不是目录", strings.TrimPrefix(dir, root+string(filepath.Separator)))
+		}
+	}
+	return nil
+}
+
+// fileType 返回文件信息对应的 models.FileType*
+func fileType(info os.FileInfo) string {
+	switch {
+	case info.IsDir():
+		return models.FileTypeDir
+	case info.Mode()&os.ModeSymlink != 0:
+		return models.FileTypeSymlink
+	default:
+		return models.FileTypeFile
+	}
+}
+
+// operation 返回操作对应的同步操作（用于报告）
+func (e *Entry) operation(root string) *models.SyncOperation {
+	op := &models.SyncOperation{
+		Type:   e.Op,
+		Path:   e.Path,
+		Target: filepath.Join(root, filepath.FromSlash(e.Path)),
+		Reason: "补丁包",
+	}
+	if e.Op == models.OpRename {
+		op.Source = filepath.Join(root, filepath.FromSlash(e.From))
+		op.Reason = "从 " + e.From + " 重命名"
+	}
+	return op
+}
+
+// applier 执行补丁包中的操作并记录撤销方法
+type applier struct {
+	root     string
+	staging  string // 目标目录中的临时目录，保存解压的文件内容和被替换的原文件
+	hashAlgo string
+	staged   map[string]string      // 文件内容名称到解压位置
+	deltas   map[string]delta.Stats // 增量内容名称到重建时写入和复用的字节数
+	undo     []func() error         // 已执行操作的撤销方法
+	seq      int                    // 临时文件的序号
+}
+
+// extract 把补丁包中的文件内容解压到临时目录（增量由目标文件原有的内容重建）并校验大小和摘要
+func (a *applier) extract(tr *tar.Reader, m *Manifest) error {
+	expected := make(map[string]*Entry)
+	for _, e := range m.Entries {
+		if e.Data != "" {
+			expected[e.Data] = e
+		}
+	}
+	a.staged = make(map[string]string, len(expected))
+	a.deltas = make(map[string]delta.Stats)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("无法读取补丁包: %v", err)
+		}
+		e, ok := expected[header.Name]
+		if !ok || a.staged[header.Name] != "" {
+			return fmt.Errorf("补丁包中有多余的条目: %s", header.Name)
+		}
+		if e.Base == "" && header.Size != e.Size {
+			return fmt.Errorf("补丁包中 %s 的大小与清单不一致", e.Path)
+		}
+		path := a.tempPath()
+		if err := a.extractFile(tr, path, e); err != nil {
+			return err
+		}
+		a.staged[header.Name] = path
+	}
+	if len(a.staged) != len(expected) {
+		return fmt.Errorf("补丁包不完整: 缺少 %d 个文件的内容", len(expected)-len(a.staged))
+	}
+	return nil
+}
+
+// extractFile 把补丁包中的一个文件内容写入 path
+func (a *applier) extractFile(r io.Reader, path string, e *Entry) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("无法创建临时文件: %v", err)
+	}
+	h, err := hasher.New(a.hashAlgo)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	var n int64
+	if e.Base != "" {
+		var stats delta.Stats
+		stats, err = a.patch(r, io.MultiWriter(f, h), e)
+		n = stats.Literal + stats.Matched
+		a.deltas[e.Data] = stats
+	} else {
+		n, err = io.Copy(io.MultiWriter(f, h), r)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("无法解压 %s: %v", e.Path, err)
+	}
+	if n != e.Size || fmt.Sprintf("%x", h.Sum(nil)) != e.Digest {
+		return fmt.Errorf("补丁包中 %s 的内容已损坏（摘要不一致）", e.Path)
+	}
+	return nil
+}
+
+// patch 以目标文件原有的内容为基准，按增量 r 重建文件内容写出到 w
+func (a *applier) patch(r io.Reader, w io.Writer, e *Entry) (delta.Stats, error) {
+	base, err := os.Open(a.target(e.Path))
+	if err != nil {
+		return delta.Stats{}, err
+	}
+	defer base.Close()
+	return delta.Patch(base, r, w)
+}
+
+// transfer 在 copy 操作的结果中记录写入和复用的字节数
+func (a *applier) transfer(result *models.SyncResult, e *Entry) {
+	if e.Op != models.OpCopy {
+		return
+	}
+	if stats, ok := a.deltas[e.Data]; ok {
+		result.Literal, result.Matched, result.Delta = stats.Literal, stats.Matched, true
+		return
+	}
+	result.Literal = e.Size
+}
+
+// tempPath 返回临时目录中一个新的路径
+func (a *applier) tempPath() string {
+	a.seq++
+	return filepath.Join(a.staging, fmt.Sprintf("%d", a.seq))
+}
+
+// target 返回相对路径在目标目录中的绝对路径
+func (a *applier) target(relPath string) string {
+	return filepath.Join(a.root, filepath.FromSlash(relPath))
+}
+
+// apply 执行一个操作，成功时记录撤销方法
+func (a *applier) apply(e *Entry) error {
+	if err := checkParents(a.root, e.Path); err != nil {
+		return err
+	}
+	target := a.target(e.Path)
+	switch e.Op {
+	case models.OpRename:
+		if err := checkParents(a.root, e.From); err != nil {
+			return err
+		}
+		if err := a.mkdirAll(filepath.Dir(target)); err != nil {
+			return err
+		}
+		source := a.target(e.From)
+		if err := os.Rename(source, target); err != nil {
+			return err
+		}
+		a.undo = append(a.undo, func() error { return os.Rename(target, source) })
+		return nil
+	case models.OpDelete:
+		// 移动到临时目录，撤销时移回
+		return a.moveAside(target)
+	case models.OpMkdir:
+		if err := os.Mkdir(target, os.FileMode(e.Mode)|0700); err != nil {
+			if os.IsExist(err) {
+				// 重命名时已经创建了上级目录
+				if info, statErr := os.Lstat(target); statErr == nil && info.IsDir() {
+					return nil
+				}
+			}
+			return err
+		}
+		a.undo = append(a.undo, func() error { return os.Remove(target) })
+		return nil
+	case models.OpCopy:
+		staged := a.staged[e.Data]
+		if err := setAttributes(staged, e); err != nil {
+			return err
+		}
+		return a.replace(staged, target)
+	case models.OpSymlink:
+		link := a.tempPath()
+		if err := os.Symlink(e.LinkTarget, link); err != nil {
+			return err
+		}
+		return a.replace(link, target)
+	case models.OpSetAttr:
+		info, err := os.Lstat(target)
+		if err != nil {
+			return err
+		}
+		// 修改权限和修改时间会跟随符号链接，可能修改目标目录之外的文件
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%s 是符号链接，不能设置属性", e.Path)
+		}
+		if err := setAttributes(target, e); err != nil {
+			return err
+		}
+		// 撤销时恢复包括 setuid、setgid 和粘滞位在内的全部权限位以及修改时间
+		mode := info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+		a.undo = append(a.undo, func() error {
+			if err := os.Chmod(target, mode); err != nil {
+				return err
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		})
+		return nil
+	default:
+		return fmt.Errorf("未知的操作类型: %s", e.Op)
+	}
+}
+
+// setAttributes 把 path 的权限和修改时间设置为操作中记录的值
+//
+// 补丁包不记录属主和扩展属性，应用时也不修改它们。
+func setAttributes(path string, e *Entry) error {
+	if err := os.Chmod(path, os.FileMode(e.Mode)); err != nil {
+		return err
+	}
+	return os.Chtimes(path, e.ModTime, e.ModTime)
+}
+
+// replace 用临时目录中的 staged 替换 target，target 原有的普通文件或符号链接移动到临时目录
+func (a *applier) replace(staged, target string) error {
+	if err := a.moveAside(target); err != nil {
+		return err
+	}
+	if err := os.Rename(staged, target); err != nil {
+		return err
+	}
+	a.undo = append(a.undo, func() error { return os.Rename(target, staged) })
+	return nil
+}
+
+// moveAside 把 target 移动到临时目录（不存在时不做任何事），撤销时移回
+func (a *applier) moveAside(target string) error {
+	if _, err := os.Lstat(target); os.IsNotExist(err) {
+		return nil
+	}
+	backup := a.tempPath()
+	if err := os.Rename(target, backup); err != nil {
+		return err
+	}
+	a.undo = append(a.undo, func() error { return os.Rename(backup, target) })
+	return nil
+}
+
+// mkdirAll 创建 dir 及其不存在的上级目录，撤销时删除新建的目录
+func (a *applier) mkdirAll(dir string) error {
+	if _, err := os.Lstat(dir); err == nil {
+		return nil
+	}
+	if err := a.mkdirAll(filepath.Dir(dir)); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return err
+	}
+	a.undo = append(a.undo, func() error { return os.Remove(dir) })
+	return nil
+}
+
+// rollback 按相反顺序撤销已执行的操作
+func (a *applier) rollback() error {
+	var errs []error
+	for i := len(a.undo) - 1; i >= 0; i-- {
+		if err := a.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	a.undo = nil
+	return errors.Join(errs...)
+}
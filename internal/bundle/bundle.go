@@ -0,0 +1,543 @@
+// Package bundle 把两个目录的差异打包为可离线传递的补丁包，并在目标目录中应用
+//
+// 补丁包是一个 tar.gz 文件：第一个条目为 manifest.json，记录应用前目标目录中
+// 各路径应有的状态（前置条件）和依次执行的操作；之后是 data/ 下新增和修改的文件内容。
+// 较大的修改文件只打包相对目标目录中原有内容的增量（见 delta 包），应用时由原有内容重建。
+// 应用时先验证全部前置条件，再执行操作，任一操作失败时撤销已执行的操作。
+package bundle
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"file_syn/internal/delta"
+	"file_syn/internal/hasher"
+	"file_syn/pkg/models"
+)
+
+// Version 补丁包格式的版本号，字段发生不兼容变化时递增（版本 2 增加了增量内容）
+const Version = 2
+
+// ManifestName 补丁包中清单条目的名称
+const ManifestName = "manifest.json"
+
+// dataDir 补丁包中文件内容所在的目录
+const dataDir = "data/"
+
+// Manifest 补丁包的清单
+type Manifest struct {
+	Version       int             `json:"version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ToolVersion   string          `json:"tool_version,omitempty"` // 生成补丁包的 file_syn 版本
+	Source        string          `json:"source"`                 // 导出时的左侧目录（应用后目标目录与其一致）
+	Base          string          `json:"base"`                   // 导出时的右侧目录（应用前目标目录应有的状态）
+	HashAlgo      string          `json:"hash"`                   // 前置条件和文件内容使用的摘要算法
+	Preconditions []*Precondition `json:"preconditions"`          // 应用前目标目录中各路径应有的状态
+	Entries       []*Entry        `json:"entries"`                // 按顺序执行的操作
+	Skipped       []string        `json:"skipped,omitempty"`      // 导出时无法读取（unknown 状态）而未导出的路径
+}
+
+// Precondition 应用前目标目录中一个路径应有的状态
+type Precondition struct {
+	Path       string `json:"path"`
+	Exists     bool   `json:"exists"`
+	Type       string `json:"type,omitempty"`        // models.FileType*（仅存在时）
+	Digest     string `json:"digest,omitempty"`      // 普通文件的内容摘要
+	LinkTarget string `json:"link_target,omitempty"` // 符号链接的目标
+}
+
+// Entry 补丁包中的一个操作
+//
+// Op 使用同步操作的类型：mkdir、copy（写入 Data 中的内容）、symlink、delete、setattr 和 rename。
+// setattr 只设置权限位和修改时间，不涉及属主和扩展属性。
+type Entry struct {
+	Op         string    `json:"op"`
+	Path       string    `json:"path"`                  // 目标目录中的相对路径
+	From       string    `json:"from,omitempty"`        // rename 的原路径
+	Mode       uint32    `json:"mode,omitempty"`        // 权限位（mkdir、copy、setattr）
+	ModTime    time.Time `json:"mod_time,omitzero"`     // 修改时间（mkdir、copy、setattr）
+	LinkTarget string    `json:"link_target,omitempty"` // 符号链接的目标（symlink）
+	Size       int64     `json:"size,omitempty"`        // 文件大小（copy）
+	Digest     string    `json:"digest,omitempty"`      // 文件内容的摘要（copy）
+	Data       string    `json:"data,omitempty"`        // 文件内容在补丁包中的名称（copy）
+	Base       string    `json:"base,omitempty"`        // 不为空时 Data 为增量，值为目标目录中该路径原有内容的摘要（copy）
+}
+
+// Options 导出选项
+type Options struct {
+	ToolVersion string // 写入清单的 file_syn 版本
+
+	// DeltaThreshold 修改的文件不小于该大小时只打包相对右侧文件的增量（为 0 时总是打包完整内容）
+	DeltaThreshold int64
+}
+
+// Export 根据对比结果生成把右侧目录变为左侧目录的补丁包并写出到 w
+//
+// 对比结果需要包含两侧目录的所有条目（按路径排序），unknown 状态的条目无法确定，不会导出，
+// 其路径记录在清单的 Skipped 中。
+func Export(w io.Writer, leftDir, rightDir string, results []*models.DiffResult, options Options) (*Manifest, error) {
+	m, err := Plan(leftDir, rightDir, results)
+	if err != nil {
+		return nil, err
+	}
+	m.ToolVersion = options.ToolVersion
+	if options.DeltaThreshold > 0 {
+		m.useDelta(options.DeltaThreshold)
+	}
+	if err := Write(w, leftDir, m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Plan 根据对比结果生成补丁包的清单，计算右侧文件的摘要作为前置条件
+//
+// 操作的顺序与单向镜像同步一致：先把重命名的文件移回左侧的路径，再逆序删除，
+// 然后顺序创建和更新条目，最后逆序设置目录的属性（避免被子项的写入覆盖）。
+func Plan(leftDir, rightDir string, results []*models.DiffResult) (*Manifest, error) {
+	p := &planner{
+		leftDir:  leftDir,
+		rightDir: rightDir,
+		m: &Manifest{
+			Version:   Version,
+			CreatedAt: time.Now().UTC(),
+			Source:    leftDir,
+			Base:      rightDir,
+			HashAlgo:  hasher.DefaultAlgorithm,
+		},
+	}
+	var renames, deletes, creates, dirAttrs []*Entry
+
+	for _, result := range results {
+		if result.Status == models.StatusUnknown {
+			p.m.Skipped = append(p.m.Skipped, result.Path)
+		}
+		if result.Status != models.StatusRenamed {
+			continue
+		}
+		if err := p.require(result.RightInfo); err != nil {
+			return nil, err
+		}
+		p.requireAbsent(result.OldPath)
+		renames = append(renames, &Entry{Op: models.OpRename, Path: result.OldPath, From: result.Path})
+		left, right := result.LeftInfo, result.RightInfo
+		if left.Digest == "" || right.Digest == "" {
+			// 没有摘要时只按大小和修改时间配对，内容不同时重命名后再写入左侧的内容
+			same, err := p.sameContent(left, right)
+			if err != nil {
+				return nil, err
+			}
+			if !same {
+				entry, err := p.create(left)
+				if err != nil {
+					return nil, err
+				}
+				creates = append(creates, entry)
+				continue
+			}
+		}
+		if left.Mode.Perm() != right.Mode.Perm() || !left.ModTime.Equal(right.ModTime) {
+			creates = append(creates, attrEntry(left))
+		}
+	}
+
+	for i := len(results) - 1; i >= 0; i-- {
+		result := results[i]
+		switch {
+		case result.Status == models.StatusAdded:
+			deletes = append(deletes, &Entry{Op: models.OpDelete, Path: result.Path})
+		case result.Status == models.StatusModified && result.LeftInfo.Type() != result.RightInfo.Type():
+			deletes = append(deletes, &Entry{Op: models.OpDelete, Path: result.Path})
+		}
+	}
+
+	for _, result := range results {
+		left, right := result.LeftInfo, result.RightInfo
+		switch result.Status {
+		case models.StatusAdded:
+			if err := p.require(right); err != nil {
+				return nil, err
+			}
+		case models.StatusDeleted:
+			p.requireAbsent(result.Path)
+			entry, err := p.create(left)
+			if err != nil {
+				return nil, err
+			}
+			creates = append(creates, entry)
+			if left.IsDir {
+				dirAttrs = append(dirAttrs, attrEntry(left))
+			}
+		case models.StatusModified, models.StatusTouched:
+			if err := p.require(right); err != nil {
+				return nil, err
+			}
+			switch {
+			case left.Type() != right.Type() || left.IsSymlink:
+				entry, err := p.create(left)
+				if err != nil {
+					return nil, err
+				}
+				creates = append(creates, entry)
+				if left.IsDir {
+					dirAttrs = append(dirAttrs, attrEntry(left))
+				}
+			case left.IsDir:
+				dirAttrs = append(dirAttrs, attrEntry(left))
+			default:
+				// 内容一致时只修改属性
+				same, err := p.sameContent(left, right)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					creates = append(creates, attrEntry(left))
+					break
+				}
+				entry, err := p.create(left)
+				if err != nil {
+					return nil, err
+				}
+				creates = append(creates, entry)
+			}
+		}
+	}
+
+	entries := make([]*Entry, 0, len(renames)+len(deletes)+len(creates)+len(dirAttrs))
+	entries = append(entries, renames...)
+	entries = append(entries, deletes...)
+	entries = append(entries, creates...)
+	for i := len(dirAttrs) - 1; i >= 0; i-- {
+		entries = append(entries, dirAttrs[i])
+	}
+	p.m.Entries = entries
+	return p.m, nil
+}
+
+// planner 生成清单时的状态
+type planner struct {
+	leftDir  string
+	rightDir string
+	m        *Manifest
+	data     int               // 已分配的文件内容数量
+	digests  map[string]string // 已计算的左侧文件摘要
+}
+
+// require 记录右侧条目 info 的当前状态作为前置条件
+func (p *planner) require(info *models.FileInfo) error {
+	pre := &Precondition{Path: info.Path, Exists: true, Type: info.Type(), LinkTarget: info.LinkTarget}
+	if pre.Type == models.FileTypeFile {
+		digest, err := hasher.HashFile(filepath.Join(p.rightDir, filepath.FromSlash(info.Path)), p.m.HashAlgo)
+		if err != nil {
+			return fmt.Errorf("无法计算 %s 的摘要: %v", info.Path, err)
+		}
+		pre.Digest = digest
+	}
+	p.m.Preconditions = append(p.m.Preconditions, pre)
+	return nil
+}
+
+// requireAbsent 记录路径在目标目录中不存在的前置条件
+func (p *planner) requireAbsent(relPath string) {
+	p.m.Preconditions = append(p.m.Preconditions, &Precondition{Path: relPath})
+}
+
+// create 生成在目标目录中创建左侧条目 info 的操作
+func (p *planner) create(info *models.FileInfo) (*Entry, error) {
+	switch {
+	case info.IsDir:
+		return &Entry{Op: models.OpMkdir, Path: info.Path, Mode: uint32(info.Mode.Perm()), ModTime: info.ModTime.UTC()}, nil
+	case info.IsSymlink:
+		return &Entry{Op: models.OpSymlink, Path: info.Path, LinkTarget: info.LinkTarget}, nil
+	}
+	digest, err := p.leftDigest(info)
+	if err != nil {
+		return nil, err
+	}
+	p.data++
+	return &Entry{
+		Op:      models.OpCopy,
+		Path:    info.Path,
+		Mode:    uint32(info.Mode.Perm()),
+		ModTime: info.ModTime.UTC(),
+		Size:    info.Size,
+		Digest:  digest,
+		Data:    fmt.Sprintf("%s%d", dataDir, p.data),
+	}, nil
+}
+
+// sameContent 判断左右两侧的普通文件内容是否一致
+func (p *planner) sameContent(left, right *models.FileInfo) (bool, error) {
+	if left.Size != right.Size {
+		return false, nil
+	}
+	digest, err := p.leftDigest(left)
+	if err != nil {
+		return false, err
+	}
+	// 右侧的摘要已作为前置条件计算
+	for i := len(p.m.Preconditions) - 1; i >= 0; i-- {
+		if pre := p.m.Preconditions[i]; pre.Path == right.Path {
+			return pre.Digest == digest, nil
+		}
+	}
+	return false, nil
+}
+
+// leftDigest 计算左侧文件的摘要
+func (p *planner) leftDigest(info *models.FileInfo) (string, error) {
+	if digest, ok := p.digests[info.Path]; ok {
+		return digest, nil
+	}
+	digest, err := hasher.HashFile(filepath.Join(p.leftDir, filepath.FromSlash(info.Path)), p.m.HashAlgo)
+	if err != nil {
+		return "", fmt.Errorf("无法计算 %s 的摘要: %v", info.Path, err)
+	}
+	if p.digests == nil {
+		p.digests = make(map[string]string)
+	}
+	p.digests[info.Path] = digest
+	return digest, nil
+}
+
+// attrEntry 生成把权限和修改时间设置为与左侧条目 info 一致的操作
+func attrEntry(info *models.FileInfo) *Entry {
+	return &Entry{Op: models.OpSetAttr, Path: info.Path, Mode: uint32(info.Mode.Perm()), ModTime: info.ModTime.UTC()}
+}
+
+// useDelta 把不小于 threshold 字节、且目标目录中同一路径原来是普通文件的 copy 操作改为打包增量
+func (m *Manifest) useDelta(threshold int64) {
+	digests := make(map[string]string)
+	for _, pre := range m.Preconditions {
+		if pre.Exists && pre.Type == models.FileTypeFile {
+			digests[pre.Path] = pre.Digest
+		}
+	}
+	for _, e := range m.Entries {
+		if e.Op == models.OpCopy && e.Size >= threshold {
+			e.Base = digests[e.Path]
+		}
+	}
+}
+
+// Write 以 tar.gz 格式写出清单和 sourceDir 中 copy 操作需要的文件内容
+//
+// 文件内容在写出时重新计算摘要，与清单不一致（导出过程中文件被修改）时返回错误。
+// 增量以 m.Base 目录中的原有文件为基准生成。
+func Write(w io.Writer, sourceDir string, m *Manifest) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法编码补丁包清单: %v", err)
+	}
+	data = append(data, '\n')
+	header := &tar.Header{Name: ManifestName, Mode: 0644, Size: int64(len(data)), ModTime: m.CreatedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("无法写出补丁包: %v", err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("无法写出补丁包: %v", err)
+	}
+
+	for _, e := range m.Entries {
+		if e.Data == "" {
+			continue
+		}
+		path := filepath.Join(sourceDir, filepath.FromSlash(e.Path))
+		if e.Base != "" {
+			err = writeDelta(tw, path, filepath.Join(m.Base, filepath.FromSlash(e.Path)), e, m.HashAlgo)
+		} else {
+			err = writeData(tw, path, e, m.HashAlgo)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("无法写出补丁包: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("无法写出补丁包: %v", err)
+	}
+	return nil
+}
+
+// errChanged 导出过程中文件发生了变化
+var errChanged = errors.New("文件在导出过程中发生变化，请重新导出")
+
+// writeData 把文件 path 的内容作为 e.Data 写入补丁包
+func writeData(tw *tar.Writer, path string, e *Entry, hashAlgo string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("无法读取 %s: %v", e.Path, err)
+	}
+	defer f.Close()
+
+	header := &tar.Header{Name: e.Data, Mode: 0644, Size: e.Size, ModTime: e.ModTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("无法写出补丁包: %v", err)
+	}
+	h, err := hasher.New(hashAlgo)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(io.MultiWriter(tw, h), f, e.Size); err != nil {
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", e.Path, errChanged)
+		}
+		return fmt.Errorf("无法写出 %s: %v", e.Path, err)
+	}
+	if n, _ := f.Read(make([]byte, 1)); n > 0 || fmt.Sprintf("%x", h.Sum(nil)) != e.Digest {
+		return fmt.Errorf("%s: %w", e.Path, errChanged)
+	}
+	return nil
+}
+
+// writeDelta 把文件 path 相对原有文件 basePath 的增量作为 e.Data 写入补丁包
+//
+// 增量先写入临时文件以确定大小；生成时同时校验两个文件的摘要。
+func writeDelta(tw *tar.Writer, path, basePath string, e *Entry, hashAlgo string) error {
+	base, err := os.Open(basePath)
+	if err != nil {
+		return fmt.Errorf("无法读取 %s: %v", e.Path, err)
+	}
+	defer base.Close()
+	baseHash, err := hasher.New(hashAlgo)
+	if err != nil {
+		return err
+	}
+	info, err := base.Stat()
+	if err != nil {
+		return fmt.Errorf("无法读取 %s: %v", e.Path, err)
+	}
+	sig, err := delta.Sign(io.TeeReader(bufio.NewReader(base), baseHash), delta.BlockSize(info.Size()))
+	if err != nil {
+		return fmt.Errorf("无法读取 %s: %v", e.Path, err)
+	}
+	if fmt.Sprintf("%x", baseHash.Sum(nil)) != e.Base {
+		return fmt.Errorf("%s: %w", e.Path, errChanged)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("无法读取 %s: %v", e.Path, err)
+	}
+	defer f.Close()
+	tmp, err := os.CreateTemp("", "file_syn-delta-*")
+	if err != nil {
+		return fmt.Errorf("无法创建临时文件: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h, err := hasher.New(hashAlgo)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	stats, err := delta.Diff(sig, io.TeeReader(f, h), w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		return fmt.Errorf("无法生成 %s 的增量: %v", e.Path, err)
+	}
+	if stats.Literal+stats.Matched != e.Size || fmt.Sprintf("%x", h.Sum(nil)) != e.Digest {
+		return fmt.Errorf("%s: %w", e.Path, errChanged)
+	}
+
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return fmt.Errorf("无法读取临时文件: %v", err)
+	}
+	header := &tar.Header{Name: e.Data, Mode: 0644, Size: size, ModTime: e.ModTime}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("无法写出补丁包: %v", err)
+	}
+	if _, err := io.Copy(tw, tmp); err != nil {
+		return fmt.Errorf("无法写出补丁包: %v", err)
+	}
+	return nil
+}
+
+// Read 读取补丁包开头的清单并验证其中的路径，返回的 tar 读取器用于继续读取文件内容
+func Read(r io.Reader) (*Manifest, *tar.Reader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("不是有效的补丁包: %v", err)
+	}
+	tr := tar.NewReader(zr)
+	header, err := tr.Next()
+	if err != nil {
+		return nil, nil, fmt.Errorf("不是有效的补丁包: %v", err)
+	}
+	if header.Name != ManifestName {
+		return nil, nil, fmt.Errorf("不是有效的补丁包: 第一个条目不是 %s", ManifestName)
+	}
+
+	var m Manifest
+	if err := json.NewDecoder(tr).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("无法解析补丁包清单: %v", err)
+	}
+	if m.Version > Version {
+		return nil, nil, fmt.Errorf("补丁包版本 %d 高于支持的版本 %d，请升级 file_syn", m.Version, Version)
+	}
+	if err := m.validate(); err != nil {
+		return nil, nil, err
+	}
+	return &m, tr, nil
+}
+
+// validate 检查清单中的路径都位于目标目录内，操作类型和文件内容名称有效
+func (m *Manifest) validate() error {
+	if _, err := hasher.New(m.HashAlgo); err != nil {
+		return err
+	}
+	for _, pre := range m.Preconditions {
+		if !validPath(pre.Path) {
+			return fmt.Errorf("补丁包中的路径无效: %q", pre.Path)
+		}
+	}
+	data := make(map[string]bool)
+	for _, e := range m.Entries {
+		if !validPath(e.Path) {
+			return fmt.Errorf("补丁包中的路径无效: %q", e.Path)
+		}
+		if e.Op == models.OpRename && !validPath(e.From) {
+			return fmt.Errorf("补丁包中的路径无效: %q", e.From)
+		}
+		switch e.Op {
+		case models.OpMkdir, models.OpSymlink, models.OpDelete, models.OpSetAttr, models.OpRename:
+		case models.OpCopy:
+			if !strings.HasPrefix(e.Data, dataDir) || data[e.Data] || e.Size < 0 {
+				return fmt.Errorf("补丁包中 %s 的文件内容无效: %q", e.Path, e.Data)
+			}
+			data[e.Data] = true
+		default:
+			return fmt.Errorf("补丁包中不支持的操作: %s", e.Op)
+		}
+	}
+	return nil
+}
+
+// validPath 判断相对路径是否规范且不会超出目标目录
+func validPath(p string) bool {
+	return p != "" && p != "." && !path.IsAbs(p) && path.Clean(p) == p &&
+		p != ".." && !strings.HasPrefix(p, "../") && !strings.Contains(p, `\`)
+}
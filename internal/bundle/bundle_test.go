@@ -0,0 +1,407 @@
+package bundle
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"file_syn/internal/diff"
+	"file_syn/pkg/models"
+)
+
+// writeTree 在 root 下创建文件（值为 nil 时创建目录）
+func writeTree(t *testing.T, root string, files map[string][]byte) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if content == nil {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatalf("无法创建目录: %v", err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+}
+
+// setupDirs 创建左右两个目录：右侧应用补丁包后应与左侧一致
+func setupDirs(t *testing.T) (string, string) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	writeTree(t, leftDir, map[string][]byte{
+		"same.txt":        []byte("same"),
+		"changed.txt":     []byte("new content"),
+		"new/nested.txt":  []byte("nested"),
+		"kind":            []byte("file on the left"),
+		"empty":           nil,
+		"renamed/to.dat":  []byte("moved content"),
+		"mode.sh":         []byte("#!/bin/sh\n"),
+		"binary.bin":      {0, 1, 2, 3},
+		"deep/a/b/c.txt":  []byte("deep"),
+		"touched.txt":     []byte("touched"),
+		"dir/keep.txt":    []byte("keep"),
+		"dir/replace.txt": []byte("left"),
+	})
+	writeTree(t, rightDir, map[string][]byte{
+		"same.txt":        []byte("same"),
+		"changed.txt":     []byte("old"),
+		"extra/old.txt":   []byte("extra"),
+		"kind/child.txt":  []byte("dir on the right"),
+		"from.dat":        []byte("moved content"),
+		"mode.sh":         []byte("#!/bin/sh\n"),
+		"binary.bin":      {0, 1, 2, 4},
+		"touched.txt":     []byte("touched"),
+		"dir/keep.txt":    []byte("keep"),
+		"dir/replace.txt": []byte("right"),
+	})
+	if err := os.Chmod(filepath.Join(leftDir, "mode.sh"), 0755); err != nil {
+		t.Fatalf("无法设置权限: %v", err)
+	}
+	if err := os.Symlink("same.txt", filepath.Join(leftDir, "link")); err != nil {
+		t.Fatalf("无法创建符号链接: %v", err)
+	}
+	if err := os.Symlink("changed.txt", filepath.Join(rightDir, "link")); err != nil {
+		t.Fatalf("无法创建符号链接: %v", err)
+	}
+
+	// 两侧相同的文件使用相同的修改时间，touched.txt 只有修改时间不同
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"same.txt", "mode.sh", "dir/keep.txt"} {
+		for _, root := range []string{leftDir, rightDir} {
+			os.Chtimes(filepath.Join(root, name), modTime, modTime)
+		}
+	}
+	os.Chtimes(filepath.Join(leftDir, "touched.txt"), modTime, modTime)
+	os.Chtimes(filepath.Join(leftDir, "renamed", "to.dat"), modTime, modTime)
+	os.Chtimes(filepath.Join(rightDir, "from.dat"), modTime, modTime)
+	return leftDir, rightDir
+}
+
+// compareDirs 对比两个目录
+func compareDirs(t *testing.T, leftDir, rightDir string, detectRenames bool) []*models.DiffResult {
+	t.Helper()
+	comparer := diff.NewComparerWithOptions(diff.Options{DetectRenames: detectRenames})
+	results, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	return results
+}
+
+// assertSame 检查两个目录完全一致
+func assertSame(t *testing.T, leftDir, rightDir string) {
+	t.Helper()
+	for _, result := range compareDirs(t, leftDir, rightDir, false) {
+		if result.Status != models.StatusUnchanged {
+			t.Errorf("%s 应用补丁包后状态为 %s: %+v", result.Path, result.Status, result.Differences)
+		}
+	}
+}
+
+func TestExportApply(t *testing.T) {
+	for _, detectRenames := range []bool{false, true} {
+		leftDir, rightDir := setupDirs(t)
+		results := compareDirs(t, leftDir, rightDir, detectRenames)
+
+		var buf bytes.Buffer
+		m, err := Export(&buf, leftDir, rightDir, results, Options{ToolVersion: "test"})
+		if err != nil {
+			t.Fatalf("导出失败: %v", err)
+		}
+		if m.Version != Version || len(m.Entries) == 0 || len(m.Preconditions) == 0 {
+			t.Fatalf("清单内容错误: %+v", m)
+		}
+
+		// 演练模式只返回计划，不修改目标目录
+		planned, err := Apply(bytes.NewReader(buf.Bytes()), rightDir, ApplyOptions{DryRun: true})
+		if err != nil || len(planned) != len(m.Entries) || !planned[0].DryRun {
+			t.Fatalf("演练失败: %d 个操作, %v", len(planned), err)
+		}
+		if data, _ := os.ReadFile(filepath.Join(rightDir, "changed.txt")); string(data) != "old" {
+			t.Fatal("演练模式不应修改目标目录")
+		}
+
+		applied, err := Apply(bytes.NewReader(buf.Bytes()), rightDir, ApplyOptions{})
+		if err != nil {
+			t.Fatalf("应用失败 (renames=%v): %v", detectRenames, err)
+		}
+		if len(applied) != len(m.Entries) {
+			t.Errorf("期望执行 %d 个操作，实际 %d 个", len(m.Entries), len(applied))
+		}
+		assertSame(t, leftDir, rightDir)
+
+		// 已应用后前置条件不再满足
+		_, err = Apply(bytes.NewReader(buf.Bytes()), rightDir, ApplyOptions{})
+		var preErr *PreconditionError
+		if !errors.As(err, &preErr) {
+			t.Errorf("重复应用应该返回前置条件错误: %v", err)
+		}
+	}
+}
+
+func TestExportApplyRenameWithoutDigest(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	// 大小和修改时间相同但内容不同，不计算摘要时会被配对为重命名
+	writeTree(t, leftDir, map[string][]byte{"docs/a.txt": []byte("left")})
+	writeTree(t, rightDir, map[string][]byte{"archive/a.txt": []byte("rght")})
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	os.Chtimes(filepath.Join(leftDir, "docs", "a.txt"), modTime, modTime)
+	os.Chtimes(filepath.Join(rightDir, "archive", "a.txt"), modTime, modTime)
+	results := compareDirs(t, leftDir, rightDir, true)
+
+	var buf bytes.Buffer
+	m, err := Export(&buf, leftDir, rightDir, results, Options{})
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	if m.Entries[0].Op != models.OpRename {
+		t.Fatalf("第一个操作应为重命名: %+v", m.Entries[0])
+	}
+	if _, err := Apply(&buf, rightDir, ApplyOptions{}); err != nil {
+		t.Fatalf("应用失败: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(rightDir, "docs", "a.txt")); err != nil || string(data) != "left" {
+		t.Errorf("重命名后内容应与左侧一致: %q, %v", data, err)
+	}
+}
+
+func TestExportApplyDelta(t *testing.T) {
+	leftDir, rightDir := setupDirs(t)
+	base := make([]byte, 512<<10)
+	rand.New(rand.NewSource(1)).Read(base)
+	changed := append(bytes.Clone(base[:1000]), base[5000:]...)
+	writeTree(t, leftDir, map[string][]byte{"large.bin": changed})
+	writeTree(t, rightDir, map[string][]byte{"large.bin": base})
+
+	var buf bytes.Buffer
+	m, err := Export(&buf, leftDir, rightDir, compareDirs(t, leftDir, rightDir, false), Options{DeltaThreshold: 64 << 10})
+	if err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+	var deltas int
+	for _, e := range m.Entries {
+		if e.Base != "" {
+			deltas++
+			if e.Path != "large.bin" {
+				t.Errorf("%s 小于阈值，不应打包增量", e.Path)
+			}
+		}
+	}
+	// 随机内容无法压缩，补丁包远小于文件大小说明只打包了增量
+	if deltas != 1 || buf.Len() > len(changed)/10 {
+		t.Fatalf("large.bin 应打包为增量: %d 个增量，补丁包 %d 字节", deltas, buf.Len())
+	}
+
+	results, err := Apply(&buf, rightDir, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("应用失败: %v", err)
+	}
+	for _, result := range results {
+		if result.Operation.Path == "large.bin" && (!result.Delta || result.Matched == 0 || result.Literal+result.Matched != int64(len(changed))) {
+			t.Errorf("large.bin 应由增量重建: %+v", result)
+		}
+	}
+	assertSame(t, leftDir, rightDir)
+}
+
+func TestApplyPreconditionFailed(t *testing.T) {
+	leftDir, rightDir := setupDirs(t)
+	var buf bytes.Buffer
+	if _, err := Export(&buf, leftDir, rightDir, compareDirs(t, leftDir, rightDir, false), Options{}); err != nil {
+		t.Fatalf("导出失败: %v", err)
+	}
+
+	// 导出后目标目录中的文件被修改
+	writeTree(t, rightDir, map[string][]byte{"dir/replace.txt": []byte("edited"), "new/nested.txt": []byte("x")})
+	_, err := Apply(&buf, rightDir, ApplyOptions{})
+	var preErr *PreconditionError
+	// new 目录和其中的文件都应不存在
+	if !errors.As(err, &preErr) || len(preErr.Mismatches) != 3 {
+		t.Fatalf("期望 3 处前置条件不一致，实际: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(rightDir, "changed.txt")); string(data) != "old" {
+		t.Error("前置条件不满足时不应修改目标目录")
+	}
+}
+
+func TestApplyRollback(t *testing.T) {
+	sourceDir, target := t.TempDir(), t.TempDir()
+	writeTree(t, sourceDir, map[string][]byte{"a.txt": []byte("new")})
+	writeTree(t, target, map[string][]byte{"a.txt": []byte("old"), "b.txt": []byte("b"), "sub/c.txt": []byte("c")})
+
+	// 最后一个操作失败（路径不存在），之前的操作都应撤销
+	m := &Manifest{
+		Version:  Version,
+		HashAlgo: "sha256",
+		Entries: []*Entry{
+			{Op: models.OpDelete, Path: "b.txt"},
+			{Op: models.OpCopy, Path: "a.txt", Mode: 0600, Size: 3, Digest: "11507a0e2f5e69d5dfa40a62a1bd7b6ee57e6bcd85c67c9b8431b36fff21c437", Data: "data/1"},
+			{Op: models.OpMkdir, Path: "new", Mode: 0755},
+			{Op: models.OpRename, Path: "new/c.txt", From: "sub/c.txt"},
+			{Op: models.OpSetAttr, Path: "missing", Mode: 0644},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, sourceDir, m); err != nil {
+		t.Fatalf("写出补丁包失败: %v", err)
+	}
+	results, err := Apply(&buf, target, ApplyOptions{})
+	if err == nil {
+		t.Fatal("操作失败时应该返回错误")
+	}
+	if len(results) != len(m.Entries) || results[len(results)-1].Error == nil {
+		t.Errorf("失败的操作应该带有错误: %+v", results)
+	}
+
+	for name, content := range map[string]string{"a.txt": "old", "b.txt": "b", "sub/c.txt": "c"} {
+		if data, err := os.ReadFile(filepath.Join(target, name)); err != nil || string(data) != content {
+			t.Errorf("%s 应该恢复原状: %q, %v", name, data, err)
+		}
+	}
+	entries, _ := os.ReadDir(target)
+	if len(entries) != 3 {
+		t.Errorf("撤销后应该只剩原有的条目（不含临时目录）: %v", entries)
+	}
+}
+
+func TestApplyRollbackSetAttr(t *testing.T) {
+	target := t.TempDir()
+	writeTree(t, target, map[string][]byte{"shared": nil, "a.txt": []byte("a")})
+	shared := filepath.Join(target, "shared")
+	if err := os.Chmod(shared, 0775|os.ModeSetgid|os.ModeSticky); err != nil {
+		t.Fatalf("无法设置权限: %v", err)
+	}
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"shared", "a.txt"} {
+		os.Chtimes(filepath.Join(target, name), modTime, modTime)
+	}
+	before := make(map[string]os.FileMode)
+	for _, name := range []string{"shared", "a.txt"} {
+		info, err := os.Lstat(filepath.Join(target, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		before[name] = info.Mode()
+	}
+	if before["shared"]&os.ModeSetgid == 0 {
+		t.Skip("当前文件系统不支持 setgid 位")
+	}
+
+	// setattr 之后的操作失败，权限位（含特殊位）和修改时间都应恢复
+	later := modTime.Add(time.Hour)
+	m := &Manifest{
+		Version:  Version,
+		HashAlgo: "sha256",
+		Entries: []*Entry{
+			{Op: models.OpSetAttr, Path: "shared", Mode: 0700, ModTime: later},
+			{Op: models.OpSetAttr, Path: "a.txt", Mode: 0600, ModTime: later},
+			{Op: models.OpSetAttr, Path: "missing", Mode: 0644},
+		},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, t.TempDir(), m); err != nil {
+		t.Fatalf("写出补丁包失败: %v", err)
+	}
+	if _, err := Apply(&buf, target, ApplyOptions{}); err == nil {
+		t.Fatal("操作失败时应该返回错误")
+	}
+
+	for name, mode := range before {
+		info, err := os.Lstat(filepath.Join(target, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode() != mode {
+			t.Errorf("%s 的权限应恢复为 %v，实际 %v", name, mode, info.Mode())
+		}
+		if !info.ModTime().Equal(modTime) {
+			t.Errorf("%s 的修改时间应恢复为 %v，实际 %v", name, modTime, info.ModTime())
+		}
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	sourceDir := t.TempDir()
+	for _, path := range []string{"../escape", "/abs", "a/../b", ""} {
+		m := &Manifest{Version: Version, HashAlgo: "sha256", Entries: []*Entry{{Op: models.OpDelete, Path: path}}}
+		var buf bytes.Buffer
+		if err := Write(&buf, sourceDir, m); err != nil {
+			t.Fatalf("写出补丁包失败: %v", err)
+		}
+		if _, _, err := Read(&buf); err == nil {
+			t.Errorf("路径 %q 应该被拒绝", path)
+		}
+	}
+
+	// 错误信息应包含无效的原路径
+	m := &Manifest{Version: Version, HashAlgo: "sha256", Entries: []*Entry{{Op: models.OpRename, Path: "to", From: "../from"}}}
+	var buf bytes.Buffer
+	if err := Write(&buf, sourceDir, m); err != nil {
+		t.Fatalf("写出补丁包失败: %v", err)
+	}
+	if _, _, err := Read(&buf); err == nil || !strings.Contains(err.Error(), "../from") {
+		t.Errorf("无效的原路径应该被拒绝并在错误中列出: %v", err)
+	}
+
+	if _, _, err := Read(bytes.NewReader([]byte("not a bundle"))); err == nil {
+		t.Error("无效的补丁包应该返回错误")
+	}
+}
+
+func TestPlanSkipsUnknown(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	writeTree(t, leftDir, map[string][]byte{"a.txt": []byte("a")})
+	results := []*models.DiffResult{
+		{Path: "a.txt", Status: models.StatusDeleted, LeftInfo: &models.FileInfo{Path: "a.txt", Size: 1, Mode: 0644}},
+		{Path: "secret", Status: models.StatusUnknown},
+	}
+	m, err := Plan(leftDir, rightDir, results)
+	if err != nil {
+		t.Fatalf("生成清单失败: %v", err)
+	}
+	if len(m.Skipped) != 1 || m.Skipped[0] != "secret" {
+		t.Errorf("无法读取的路径应记录在 Skipped 中: %v", m.Skipped)
+	}
+	if len(m.Entries) != 1 {
+		t.Errorf("期望 1 个操作，实际 %d 个", len(m.Entries))
+	}
+}
+
+func TestApplySetAttrSymlink(t *testing.T) {
+	target, outside := t.TempDir(), t.TempDir()
+	writeTree(t, outside, map[string][]byte{"secret.txt": []byte("secret")})
+	outsideFile := filepath.Join(outside, "secret.txt")
+	if err := os.Symlink(outsideFile, filepath.Join(target, "link")); err != nil {
+		t.Fatalf("无法创建符号链接: %v", err)
+	}
+
+	// 没有前置条件的 setattr 不应跟随符号链接修改目标目录之外的文件
+	m := &Manifest{
+		Version:  Version,
+		HashAlgo: "sha256",
+		Entries:  []*Entry{{Op: models.OpSetAttr, Path: "link", Mode: 0777, ModTime: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, t.TempDir(), m); err != nil {
+		t.Fatalf("写出补丁包失败: %v", err)
+	}
+	if _, err := Apply(&buf, target, ApplyOptions{}); err == nil {
+		t.Error("对符号链接设置属性应该失败")
+	}
+	info, err := os.Stat(outsideFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 || info.ModTime().Year() == 2000 {
+		t.Errorf("目标目录之外的文件被修改: %v %v", info.Mode(), info.ModTime())
+	}
+}
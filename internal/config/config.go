@@ -1,43 +1,205 @@
 package config
 
 import (
+	"crypto/ed25519"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
+
+	"file_syn/internal/delta"
+	"file_syn/internal/diff"
+	"file_syn/internal/hashcache"
+	"file_syn/internal/hasher"
+	"file_syn/internal/ignore"
+	"file_syn/internal/manifest"
+	"file_syn/internal/reporter"
+	"file_syn/internal/scanner"
+	"file_syn/internal/signing"
+	"file_syn/internal/syncer"
+	"file_syn/internal/textdiff"
+	"file_syn/pkg/models"
 )
 
 // Config 配置结构
 type Config struct {
-	LeftDir       string `json:"left_dir"`
-	RightDir      string `json:"right_dir"`
-	ShowUnchanged bool   `json:"show_unchanged"`
-	ConfigPath    string `json:"-"` // 实际使用的配置文件路径（不序列化）
+	LeftDir        string         `json:"left_dir"`
+	RightDir       string         `json:"right_dir"`
+	LeftCommand    string         `json:"left_command"`  // 启动远程 agent 的命令（如 ssh host file_syn agent），设置后 left_dir 为远程主机上的目录（仅 compare）
+	RightCommand   string         `json:"right_command"` // 同 left_command，用于右侧
+	ShowUnchanged  bool           `json:"show_unchanged"`
+	Format         string         `json:"format"`          // 输出格式：text（默认）、json、ndjson 或 patch
+	Language       string         `json:"language"`        // 表格中差异详情的语言：zh（默认）或 en
+	Hash           string         `json:"hash"`            // 内容校验使用的摘要算法（如 sha256，为空时只对比元数据）
+	HashCache      string         `json:"hash_cache"`      // 摘要缓存文件路径（为空时位于配置文件旁边，none 表示不使用缓存）
+	DetectRenames  bool           `json:"detect_renames"`  // 是否检测重命名和移动
+	Exclude        []string       `json:"exclude"`         // .gitignore 语法的排除规则
+	Include        []string       `json:"include"`         // 重新包含被排除路径的规则（优先级最高）
+	IgnoreFile     string         `json:"ignore_file"`     // 目录级忽略文件名（默认 .filesynignore，none 表示不读取）
+	FollowSymlinks bool           `json:"follow_symlinks"` // 是否跟随符号链接（默认对比链接本身的目标路径）
+	ScanWorkers    int            `json:"scan_workers"`    // 每侧目录并发扫描的工作协程数（默认为 CPU 核数，至少为 4）
+	Stream         bool           `json:"stream"`          // compare 是否流式对比（逐个输出结果，内存占用与目录树大小无关）
+	FailOn         []string       `json:"fail_on"`         // 视为失败（退出码 1）的差异状态，warning 表示扫描错误（退出码 3），为空时所有差异都视为失败
+	Compare        CompareConfig  `json:"compare"`         // 参与对比的属性和修改时间容差
+	Metadata       MetadataConfig `json:"metadata"`        // Linux 上额外对比和同步的元数据
+	ContentDiff    DiffConfig     `json:"content_diff"`    // 为修改的文本文件输出统一格式差异
+	VerifyKey      string         `json:"verify_key"`      // compare 的公钥文件路径，设置后作为一侧的清单必须带有该公钥的有效签名
+	Sync           SyncConfig     `json:"sync"`
+	ConfigPath     string         `json:"-"` // 实际使用的配置文件路径（不序列化）
 }
 
-// LoadConfig 从文件加载配置
-func LoadConfig(configPath string) (*Config, error) {
-	// 如果配置文件路径为空，使用默认路径
-	if configPath == "" {
-		// 尝试从当前目录查找 config.json
-		defaultPaths := []string{
-			"config/config.json",
-			"./config/config.json",
-			"config.json",
-		}
+// CompareConfig 对比规则配置
+type CompareConfig struct {
+	Attributes               []string `json:"attributes"`                   // 参与对比的属性（如 size、mtime、mode、content、owner），为空时对比所有属性
+	MtimeTolerance           string   `json:"mtime_tolerance"`              // 修改时间的容差，如 2s（默认 1s，0 表示必须完全相同）
+	IgnoreMtimeIfSameContent bool     `json:"ignore_mtime_if_same_content"` // 内容摘要一致时不对比修改时间（需要开启内容校验）
+}
 
-		for _, path := range defaultPaths {
-			if _, err := os.Stat(path); err == nil {
-				configPath = path
-				break
-			}
+// Rules 返回对比规则，配置需要已通过验证
+func (c CompareConfig) Rules() *diff.Rules {
+	tolerance := diff.DefaultMtimeTolerance
+	if c.MtimeTolerance != "" {
+		tolerance, _ = time.ParseDuration(c.MtimeTolerance)
+	}
+	var attributes []models.DifferenceKind
+	for _, attribute := range c.Attributes {
+		attributes = append(attributes, models.DifferenceKind(attribute))
+	}
+	return &diff.Rules{
+		Attributes:               attributes,
+		MtimeTolerance:           tolerance,
+		IgnoreMtimeIfSameContent: c.IgnoreMtimeIfSameContent,
+	}
+}
+
+// validate 验证对比规则配置
+func (c CompareConfig) validate() error {
+	for _, attribute := range c.Attributes {
+		if !slices.Contains(diff.Attributes, models.DifferenceKind(attribute)) {
+			return fmt.Errorf("compare.attributes 中不支持的属性: %s", attribute)
+		}
+	}
+	if c.MtimeTolerance != "" {
+		tolerance, err := time.ParseDuration(c.MtimeTolerance)
+		if err != nil {
+			return fmt.Errorf("无效的 compare.mtime_tolerance: %v", err)
+		}
+		if tolerance < 0 {
+			return fmt.Errorf("compare.mtime_tolerance 不能为负数: %s", c.MtimeTolerance)
 		}
+	}
+	return nil
+}
 
-		if configPath == "" {
-			return nil, fmt.Errorf("未找到配置文件，请指定配置文件路径或确保 config/config.json 存在")
+// DiffConfig 内容差异配置
+type DiffConfig struct {
+	Enabled bool  `json:"enabled"`  // 表格格式下是否为修改的文本文件输出统一格式差异（patch 格式始终输出）
+	Context *int  `json:"context"`  // 每个区块前后的上下文行数（默认 3）
+	MaxSize int64 `json:"max_size"` // 文件大小上限（字节），超过时只报告二进制文件不同（默认 1 MiB）
+}
+
+// ContentDiffOptions 返回报告器使用的内容差异选项，不输出内容差异时返回 nil
+func (c *Config) ContentDiffOptions() *textdiff.Options {
+	if !c.ContentDiff.Enabled && c.Format != reporter.FormatPatch {
+		return nil
+	}
+	options := &textdiff.Options{Context: textdiff.DefaultContext, MaxSize: c.ContentDiff.MaxSize}
+	if c.ContentDiff.Context != nil {
+		options.Context = *c.ContentDiff.Context
+	}
+	return options
+}
+
+// validate 验证内容差异配置
+func (c DiffConfig) validate() error {
+	if c.Context != nil && *c.Context < 0 {
+		return fmt.Errorf("content_diff.context 不能为负数: %d", *c.Context)
+	}
+	if c.MaxSize < 0 {
+		return fmt.Errorf("content_diff.max_size 不能为负数: %d", c.MaxSize)
+	}
+	return nil
+}
+
+// MetadataConfig 扩展元数据配置（仅 Linux，其他平台忽略）
+type MetadataConfig struct {
+	Owner       bool `json:"owner"`        // 对比和同步属主（uid/gid，同步时需要 root 权限）
+	SpecialBits bool `json:"special_bits"` // 对比和同步 setuid、setgid 和 sticky 位
+	Xattrs      bool `json:"xattrs"`       // 对比和同步扩展属性（不含 ACL）
+	ACLs        bool `json:"acls"`         // 对比和同步 POSIX ACL
+}
+
+// MetadataOptions 返回扫描和同步使用的元数据选项
+//
+// compare.attributes 中列出的扩展元数据即使没有在 metadata 中开启也会被收集和同步。
+func (c *Config) MetadataOptions() models.MetadataOptions {
+	attributes := c.Compare.Attributes
+	return models.MetadataOptions{
+		Owner:   c.Metadata.Owner || slices.Contains(attributes, string(models.DiffOwner)),
+		Special: c.Metadata.SpecialBits || slices.Contains(attributes, string(models.DiffSpecial)),
+		Xattrs:  c.Metadata.Xattrs || slices.Contains(attributes, string(models.DiffXattr)),
+		ACL:     c.Metadata.ACLs || slices.Contains(attributes, string(models.DiffACL)),
+	}
+}
+
+// SyncConfig 同步配置
+type SyncConfig struct {
+	Mode           string `json:"mode"`            // 同步模式：mirror（默认）或 bidirectional
+	DeleteExtra    bool   `json:"delete_extra"`    // 是否删除右侧目录中多余（左侧不存在）的文件（仅 mirror）
+	ConflictPolicy string `json:"conflict_policy"` // 冲突解决策略：newer, left, right, keep-both, skip（默认）
+	ConflictSuffix string `json:"conflict_suffix"` // keep-both 策略下另存版本的后缀（默认 .conflict）
+	StateFile      string `json:"state_file"`      // 双向同步基线文件路径（默认位于用户缓存目录）
+	DeltaThreshold int64  `json:"delta_threshold"` // 修改的文件不小于该大小（字节）时使用增量传输（默认 64 MiB，负数表示不使用）
+}
+
+// DeltaMinSize 返回同步和导出时使用增量传输的文件大小下限，0 表示不使用增量传输
+func (c SyncConfig) DeltaMinSize() int64 {
+	switch {
+	case c.DeltaThreshold < 0:
+		return 0
+	case c.DeltaThreshold == 0:
+		return delta.DefaultThreshold
+	default:
+		return c.DeltaThreshold
+	}
+}
+
+// HashCacheDisabled hash_cache 取该值时不使用摘要缓存
+const HashCacheDisabled = "none"
+
+// IgnoreFileDisabled ignore_file 取该值时不读取目录级忽略文件
+const IgnoreFileDisabled = "none"
+
+// FailOnWarning fail_on 包含该值时，扫描错误使程序以退出码 3 退出
+const FailOnWarning = "warning"
+
+// Sync modes
+const (
+	SyncModeMirror        = "mirror"
+	SyncModeBidirectional = "bidirectional"
+)
+
+// DefaultPaths 未指定配置文件时按顺序查找的路径
+var DefaultPaths = []string{
+	"config/config.json",
+	"./config/config.json",
+	"config.json",
+}
+
+// FindConfigFile 按默认顺序查找配置文件，未找到时返回空字符串
+func FindConfigFile() string {
+	for _, path := range DefaultPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
 		}
 	}
+	return ""
+}
 
+// ReadConfig 读取并解析配置文件（不验证）
+func ReadConfig(configPath string) (*Config, error) {
 	// 转换为绝对路径
 	absConfigPath, err := filepath.Abs(configPath)
 	if err != nil {
@@ -58,18 +220,44 @@ func LoadConfig(configPath string) (*Config, error) {
 
 	// 保存配置文件路径
 	config.ConfigPath = absConfigPath
+	return &config, nil
+}
 
+// LoadConfig 从文件加载配置
+func LoadConfig(configPath string) (*Config, error) {
+	// 如果配置文件路径为空，使用默认路径
+	if configPath == "" {
+		configPath = FindConfigFile()
+		if configPath == "" {
+			return nil, fmt.Errorf("未找到配置文件，请指定配置文件路径或确保 config/config.json 存在")
+		}
+	}
+
+	config, err := ReadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.Finish(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Finish 验证配置并将路径转换为绝对路径
+//
+// 命令行参数覆盖配置文件中的字段后需要调用 Finish。
+func (c *Config) Finish() error {
 	// 验证配置
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("配置验证失败: %v", err)
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("配置验证失败: %v", err)
 	}
 
 	// 转换为绝对路径
-	if err := config.NormalizePaths(); err != nil {
-		return nil, fmt.Errorf("路径规范化失败: %v", err)
+	if err := c.NormalizePaths(); err != nil {
+		return fmt.Errorf("路径规范化失败: %v", err)
 	}
-
-	return &config, nil
+	return nil
 }
 
 // Validate 验证配置
@@ -82,32 +270,218 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("right_dir 不能为空")
 	}
 
-	// 检查目录是否存在
-	if _, err := os.Stat(c.LeftDir); os.IsNotExist(err) {
+	// 检查目录是否存在（远程目录在连接 agent 后检查）
+	if _, err := os.Stat(c.LeftDir); os.IsNotExist(err) && c.LeftCommand == "" {
 		return fmt.Errorf("左侧目录不存在: %s", c.LeftDir)
 	}
 
-	if _, err := os.Stat(c.RightDir); os.IsNotExist(err) {
+	if _, err := os.Stat(c.RightDir); os.IsNotExist(err) && c.RightCommand == "" {
 		return fmt.Errorf("右侧目录不存在: %s", c.RightDir)
 	}
 
+	if c.Hash != "" {
+		if _, err := hasher.New(c.Hash); err != nil {
+			return err
+		}
+	}
+
+	if _, err := ignore.New(c.Exclude, c.Include); err != nil {
+		return fmt.Errorf("无效的排除规则: %v", err)
+	}
+
+	switch c.Format {
+	case "", reporter.FormatText, reporter.FormatJSON, reporter.FormatNDJSON, reporter.FormatPatch:
+	default:
+		return fmt.Errorf("不支持的输出格式: %s", c.Format)
+	}
+
+	switch c.Language {
+	case "", reporter.LanguageZH, reporter.LanguageEN:
+	default:
+		return fmt.Errorf("不支持的语言: %s", c.Language)
+	}
+
+	if c.ScanWorkers < 0 {
+		return fmt.Errorf("scan_workers 不能为负数: %d", c.ScanWorkers)
+	}
+
+	if err := c.Compare.validate(); err != nil {
+		return err
+	}
+	// 没有摘要时无法对比内容，以下配置不会生效
+	if c.Hash == "" {
+		if slices.Contains(c.Compare.Attributes, string(models.DiffContent)) {
+			return fmt.Errorf("compare.attributes 包含 content 时需要通过 hash 指定摘要算法")
+		}
+		if c.Compare.IgnoreMtimeIfSameContent {
+			return fmt.Errorf("compare.ignore_mtime_if_same_content 需要通过 hash 指定摘要算法")
+		}
+	}
+
+	if err := c.ContentDiff.validate(); err != nil {
+		return err
+	}
+
+	if c.Stream && c.DetectRenames {
+		return fmt.Errorf("流式对比不支持重命名检测，stream 和 detect_renames 不能同时开启")
+	}
+
+	for _, status := range c.FailOn {
+		switch status {
+		case models.StatusAdded, models.StatusDeleted, models.StatusModified, models.StatusTouched, models.StatusRenamed, models.StatusUnknown, FailOnWarning:
+		default:
+			return fmt.Errorf("fail_on 中不支持的状态: %s", status)
+		}
+	}
+
+	switch c.Sync.Mode {
+	case "", SyncModeMirror, SyncModeBidirectional:
+	default:
+		return fmt.Errorf("不支持的同步模式: %s", c.Sync.Mode)
+	}
+
+	switch c.Sync.ConflictPolicy {
+	case "", models.ConflictNewer, models.ConflictLeft, models.ConflictRight, models.ConflictKeepBoth, models.ConflictSkip:
+	default:
+		return fmt.Errorf("不支持的冲突解决策略: %s", c.Sync.ConflictPolicy)
+	}
+
 	return nil
 }
 
-// NormalizePaths 规范化路径为绝对路径
+// NormalizePaths 规范化路径为绝对路径（远程目录保持原样，由 agent 解释）
 func (c *Config) NormalizePaths() error {
-	leftAbs, err := filepath.Abs(c.LeftDir)
-	if err != nil {
-		return fmt.Errorf("无法获取左侧目录的绝对路径: %v", err)
+	if c.LeftCommand == "" {
+		leftAbs, err := filepath.Abs(c.LeftDir)
+		if err != nil {
+			return fmt.Errorf("无法获取左侧目录的绝对路径: %v", err)
+		}
+		c.LeftDir = leftAbs
 	}
 
-	rightAbs, err := filepath.Abs(c.RightDir)
-	if err != nil {
-		return fmt.Errorf("无法获取右侧目录的绝对路径: %v", err)
+	if c.RightCommand == "" {
+		rightAbs, err := filepath.Abs(c.RightDir)
+		if err != nil {
+			return fmt.Errorf("无法获取右侧目录的绝对路径: %v", err)
+		}
+		c.RightDir = rightAbs
 	}
 
-	c.LeftDir = leftAbs
-	c.RightDir = rightAbs
+	if c.HashCache != "" && c.HashCache != HashCacheDisabled {
+		cacheAbs, err := filepath.Abs(c.HashCache)
+		if err != nil {
+			return fmt.Errorf("无法获取摘要缓存的绝对路径: %v", err)
+		}
+		c.HashCache = cacheAbs
+	}
+
+	if c.VerifyKey != "" {
+		keyAbs, err := filepath.Abs(c.VerifyKey)
+		if err != nil {
+			return fmt.Errorf("无法获取公钥文件的绝对路径: %v", err)
+		}
+		c.VerifyKey = keyAbs
+	}
+
+	if c.Sync.StateFile != "" {
+		stateAbs, err := filepath.Abs(c.Sync.StateFile)
+		if err != nil {
+			return fmt.Errorf("无法获取基线文件的绝对路径: %v", err)
+		}
+		c.Sync.StateFile = stateAbs
+	}
 
 	return nil
 }
+
+// IsRemote 判断是否有一侧通过 agent 访问
+func (c *Config) IsRemote() bool {
+	return c.LeftCommand != "" || c.RightCommand != ""
+}
+
+// ManifestKey 读取验证清单签名的公钥，未配置 verify_key 时返回 nil
+//
+// 配置了公钥但两侧都不是清单时返回错误，避免要求验证签名的对比在没有验证的情况下通过。
+func (c *Config) ManifestKey() (ed25519.PublicKey, error) {
+	if c.VerifyKey == "" {
+		return nil, nil
+	}
+	if !manifest.IsManifest(c.LeftDir) && !manifest.IsManifest(c.RightDir) {
+		return nil, fmt.Errorf("指定了签名公钥 %s，但两侧都不是清单，没有可以验证的签名", c.VerifyKey)
+	}
+	return signing.LoadPublicKey(c.VerifyKey)
+}
+
+// HashCachePath 返回摘要缓存文件路径，禁用缓存时返回空字符串
+func (c *Config) HashCachePath() string {
+	switch c.HashCache {
+	case HashCacheDisabled:
+		return ""
+	case "":
+		return hashcache.DefaultPath(c.ConfigPath)
+	default:
+		return c.HashCache
+	}
+}
+
+// FailsOn 判断差异状态（或 warning）是否视为失败
+func (c *Config) FailsOn(status string) bool {
+	if len(c.FailOn) == 0 {
+		return status != models.StatusUnchanged && status != FailOnWarning
+	}
+	for _, s := range c.FailOn {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// IgnoreFileName 返回目录级忽略文件名，禁用时返回空字符串
+func (c *Config) IgnoreFileName() string {
+	switch c.IgnoreFile {
+	case IgnoreFileDisabled:
+		return ""
+	case "":
+		return ignore.DefaultFileName
+	default:
+		return c.IgnoreFile
+	}
+}
+
+// ScanOptions 根据配置生成扫描选项，cache 为使用的摘要缓存（可以为 nil）
+func (c *Config) ScanOptions(cache *hashcache.Cache) scanner.Options {
+	return scanner.Options{
+		HashAlgo:   c.Hash,
+		HashCache:  cache,
+		Exclude:    c.Exclude,
+		Include:    c.Include,
+		IgnoreFile: c.IgnoreFileName(),
+		Workers:    c.ScanWorkers,
+		Metadata:   c.MetadataOptions(),
+
+		FollowSymlinks: c.FollowSymlinks,
+	}
+}
+
+// SyncOptions 根据配置生成同步选项
+func (c *Config) SyncOptions(dryRun bool, cache *hashcache.Cache) syncer.Options {
+	return syncer.Options{
+		DryRun:         dryRun,
+		DeleteExtra:    c.Sync.DeleteExtra,
+		ConflictPolicy: c.Sync.ConflictPolicy,
+		ConflictSuffix: c.Sync.ConflictSuffix,
+		Metadata:       c.MetadataOptions(),
+		Rules:          c.Compare.Rules(),
+		Scan:           c.ScanOptions(cache),
+		DeltaThreshold: c.Sync.DeltaMinSize(),
+	}
+}
+
+// SyncStatePath 返回双向同步的基线文件路径，未配置 sync.state_file 时使用用户缓存目录下的默认路径
+func (c *Config) SyncStatePath() (string, error) {
+	if c.Sync.StateFile != "" {
+		return c.Sync.StateFile, nil
+	}
+	return syncer.DefaultStatePath(c.LeftDir, c.RightDir)
+}
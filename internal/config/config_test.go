@@ -4,6 +4,13 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"file_syn/internal/delta"
+	"file_syn/internal/reporter"
+	"file_syn/internal/signing"
+	"file_syn/internal/textdiff"
+	"file_syn/pkg/models"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -79,4 +86,190 @@ func TestConfigValidate(t *testing.T) {
 	if err := cfg.Validate(); err == nil {
 		t.Error("不存在的目录应该验证失败")
 	}
+
+	// 远程目录在连接 agent 后检查，且保持原样不转换为绝对路径
+	cfg = &Config{
+		LeftDir:      t.TempDir(),
+		RightDir:     "data/right",
+		RightCommand: "ssh host file_syn agent",
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("远程目录不应该检查是否存在: %v", err)
+	}
+	if err := cfg.NormalizePaths(); err != nil || cfg.RightDir != "data/right" {
+		t.Errorf("远程目录不应该被转换: %q, %v", cfg.RightDir, err)
+	}
+
+	// 差异详情的语言
+	cfg = &Config{LeftDir: t.TempDir(), RightDir: t.TempDir(), Language: reporter.LanguageEN}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("en 应该是支持的语言: %v", err)
+	}
+	cfg.Language = "fr"
+	if err := cfg.Validate(); err == nil {
+		t.Error("不支持的语言应该验证失败")
+	}
+}
+
+func TestReadConfigOverride(t *testing.T) {
+	tmpDir := t.TempDir()
+	leftDir := filepath.Join(tmpDir, "left")
+	if err := os.MkdirAll(leftDir, 0755); err != nil {
+		t.Fatalf("无法创建左侧目录: %v", err)
+	}
+
+	// 配置文件中的右侧目录不存在，读取时不验证
+	configPath := filepath.Join(tmpDir, "config.json")
+	configContent := `{"left_dir": "` + leftDir + `", "right_dir": "/nonexistent/right"}`
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("无法创建配置文件: %v", err)
+	}
+	cfg, err := ReadConfig(configPath)
+	if err != nil {
+		t.Fatalf("读取配置失败: %v", err)
+	}
+	if err := cfg.Finish(); err == nil {
+		t.Error("右侧目录不存在时应该验证失败")
+	}
+
+	// 命令行参数覆盖后验证通过
+	cfg.RightDir = tmpDir
+	if err := cfg.Finish(); err != nil {
+		t.Fatalf("覆盖右侧目录后验证失败: %v", err)
+	}
+	if cfg.ConfigPath != configPath {
+		t.Errorf("ConfigPath 应为 %s，实际 %s", configPath, cfg.ConfigPath)
+	}
+}
+
+func TestFailsOn(t *testing.T) {
+	// 未配置 fail_on 时所有差异都视为失败，扫描警告不视为失败
+	cfg := &Config{}
+	for _, status := range []string{models.StatusAdded, models.StatusDeleted, models.StatusModified, models.StatusTouched, models.StatusRenamed} {
+		if !cfg.FailsOn(status) {
+			t.Errorf("默认应将 %s 视为失败", status)
+		}
+	}
+	if cfg.FailsOn(models.StatusUnchanged) || cfg.FailsOn(FailOnWarning) {
+		t.Error("默认不应将 unchanged 或 warning 视为失败")
+	}
+
+	cfg.FailOn = []string{models.StatusDeleted, FailOnWarning}
+	if !cfg.FailsOn(models.StatusDeleted) || !cfg.FailsOn(FailOnWarning) {
+		t.Error("应将 fail_on 中列出的状态视为失败")
+	}
+	if cfg.FailsOn(models.StatusAdded) {
+		t.Error("不应将 fail_on 之外的状态视为失败")
+	}
+
+	tmpDir := t.TempDir()
+	cfg = &Config{LeftDir: tmpDir, RightDir: tmpDir, FailOn: []string{"unchanged"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("fail_on 中不支持的状态应该验证失败")
+	}
+}
+
+func TestCompareConfig(t *testing.T) {
+	// 未配置时使用默认规则
+	rules := (&Config{}).Compare.Rules()
+	if rules.Attributes != nil || rules.MtimeTolerance != time.Second || rules.IgnoreMtimeIfSameContent {
+		t.Errorf("默认规则不正确: %+v", rules)
+	}
+
+	cfg := &Config{Compare: CompareConfig{Attributes: []string{"size", "owner"}, MtimeTolerance: "2s", IgnoreMtimeIfSameContent: true}}
+	rules = cfg.Compare.Rules()
+	if len(rules.Attributes) != 2 || rules.MtimeTolerance != 2*time.Second || !rules.IgnoreMtimeIfSameContent {
+		t.Errorf("规则与配置不一致: %+v", rules)
+	}
+	if cfg.Compare.MtimeTolerance = "0s"; cfg.Compare.Rules().MtimeTolerance != 0 {
+		t.Error("mtime_tolerance 为 0 时应要求修改时间完全相同")
+	}
+
+	// compare.attributes 中的扩展元数据会被收集
+	cfg.Metadata.Xattrs = true
+	if got := cfg.MetadataOptions(); got != (models.MetadataOptions{Owner: true, Xattrs: true}) {
+		t.Errorf("期望收集属主和扩展属性，实际 %+v", got)
+	}
+
+	tmpDir := t.TempDir()
+	for _, compare := range []CompareConfig{
+		{Attributes: []string{"perm"}},
+		{MtimeTolerance: "1 second"},
+		{MtimeTolerance: "-1s"},
+		{Attributes: []string{"content"}},
+		{IgnoreMtimeIfSameContent: true},
+	} {
+		cfg := &Config{LeftDir: tmpDir, RightDir: tmpDir, Compare: compare}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("无效的对比配置 %+v 应该验证失败", compare)
+		}
+	}
+
+	// 指定摘要算法后可以对比内容
+	cfg = &Config{LeftDir: tmpDir, RightDir: tmpDir, Hash: "sha256", Compare: CompareConfig{Attributes: []string{"content"}, IgnoreMtimeIfSameContent: true}}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("开启内容校验时配置应该有效: %v", err)
+	}
+}
+
+func TestContentDiffOptions(t *testing.T) {
+	if (&Config{}).ContentDiffOptions() != nil {
+		t.Error("默认不应输出内容差异")
+	}
+
+	// patch 格式始终输出内容差异
+	options := (&Config{Format: reporter.FormatPatch}).ContentDiffOptions()
+	if options == nil || options.Context != textdiff.DefaultContext || options.MaxSize != 0 {
+		t.Errorf("patch 格式的默认选项不正确: %+v", options)
+	}
+
+	zero := 0
+	options = (&Config{ContentDiff: DiffConfig{Enabled: true, Context: &zero, MaxSize: 4096}}).ContentDiffOptions()
+	if options == nil || options.Context != 0 || options.MaxSize != 4096 {
+		t.Errorf("选项与配置不一致: %+v", options)
+	}
+
+	tmpDir := t.TempDir()
+	negative := -1
+	for _, contentDiff := range []DiffConfig{{Context: &negative}, {MaxSize: -1}} {
+		cfg := &Config{LeftDir: tmpDir, RightDir: tmpDir, ContentDiff: contentDiff}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("无效的内容差异配置 %+v 应该验证失败", contentDiff)
+		}
+	}
+}
+
+func TestDeltaMinSize(t *testing.T) {
+	for threshold, want := range map[int64]int64{0: delta.DefaultThreshold, -1: 0, 4096: 4096} {
+		if got := (SyncConfig{DeltaThreshold: threshold}).DeltaMinSize(); got != want {
+			t.Errorf("delta_threshold 为 %d 时期望 %d，实际 %d", threshold, want, got)
+		}
+	}
+}
+
+func TestManifestKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	keyPath := filepath.Join(tmpDir, "key.pub")
+	publicKey, _, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signing.WritePublicKey(keyPath, publicKey); err != nil {
+		t.Fatal(err)
+	}
+	manifestPath := filepath.Join(tmpDir, "snapshot.json")
+	if err := os.WriteFile(manifestPath, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if key, err := (&Config{LeftDir: tmpDir, RightDir: tmpDir}).ManifestKey(); key != nil || err != nil {
+		t.Errorf("未配置公钥时应返回 nil: %v", err)
+	}
+	if _, err := (&Config{LeftDir: tmpDir, RightDir: tmpDir, VerifyKey: keyPath}).ManifestKey(); err == nil {
+		t.Error("两侧都不是清单时指定公钥应该返回错误")
+	}
+	key, err := (&Config{LeftDir: manifestPath, RightDir: tmpDir, VerifyKey: keyPath}).ManifestKey()
+	if err != nil || !key.Equal(publicKey) {
+		t.Errorf("一侧是清单时应读取公钥: %v", err)
+	}
 }
@@ -0,0 +1,344 @@
+// Package delta 实现 rsync 式的增量传输
+//
+// 接收方把已有的旧文件（基准）按固定大小分块，为每块计算弱校验和（可滚动）与强摘要，
+// 得到签名；发送方在新文件上逐字节滑动窗口，用弱校验和快速查找、强摘要确认与基准相同的块，
+// 输出由“复制基准中的块”和“字面数据”组成的增量；接收方按增量从基准和字面数据重建新文件。
+// 新文件只有少量变化时，增量的大小远小于新文件。
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// DefaultThreshold 默认的增量传输文件大小下限，小于该大小的文件直接完整复制
+const DefaultThreshold = 64 << 20
+
+// 块大小的范围
+const (
+	MinBlockSize = 2 << 10
+	MaxBlockSize = 128 << 10
+)
+
+// magic 增量数据的开头
+const magic = "FSDELTA1"
+
+// 增量中的操作
+const (
+	opLiteral = 'L' // 字面数据：长度 + 数据
+	opCopy    = 'C' // 复制基准中连续的块：起始块号 + 块数
+	opEnd     = 'E' // 结束
+)
+
+// maxLiteral 连续的字面数据超过该长度时先输出，限制内存占用
+const maxLiteral = 1 << 20
+
+// Stats 增量传输的统计
+type Stats struct {
+	Literal int64 // 字面数据的字节数（需要传输的新数据）
+	Matched int64 // 从基准中复用的字节数
+}
+
+// BlockSize 按基准文件的大小选择块大小：约为大小的平方根，取 8 的倍数并限制在 [MinBlockSize, MaxBlockSize]
+func BlockSize(size int64) int {
+	n := int(math.Sqrt(float64(size))) &^ 7
+	return min(max(n, MinBlockSize), MaxBlockSize)
+}
+
+// Signature 基准文件的块签名
+type Signature struct {
+	BlockSize int
+	Size      int64               // 基准文件的大小
+	weak      map[uint32][]int    // 弱校验和到块号
+	strong    [][sha256.Size]byte // 每块的强摘要
+}
+
+// Sign 读取基准内容并计算块签名
+func Sign(r io.Reader, blockSize int) (*Signature, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("无效的块大小: %d", blockSize)
+	}
+	sig := &Signature{BlockSize: blockSize, weak: make(map[uint32][]int)}
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			var sum rollsum
+			sum.init(buf[:n])
+			index := len(sig.strong)
+			sig.weak[sum.digest()] = append(sig.weak[sum.digest()], index)
+			sig.strong = append(sig.strong, sha256.Sum256(buf[:n]))
+			sig.Size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sig, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Blocks 返回基准文件的块数
+func (s *Signature) Blocks() int {
+	return len(s.strong)
+}
+
+// blockLen 返回第 index 块的长度（最后一块可能不满）
+func (s *Signature) blockLen(index int) int {
+	if index == len(s.strong)-1 {
+		return int(s.Size - int64(index)*int64(s.BlockSize))
+	}
+	return s.BlockSize
+}
+
+// match 查找与 window 内容相同的块，弱校验和为 weak
+func (s *Signature) match(weak uint32, window []byte) (int, bool) {
+	candidates := s.weak[weak]
+	if len(candidates) == 0 {
+		return 0, false
+	}
+	var strong [sha256.Size]byte
+	computed := false
+	for _, index := range candidates {
+		if s.blockLen(index) != len(window) {
+			continue
+		}
+		if !computed {
+			strong = sha256.Sum256(window)
+			computed = true
+		}
+		if strong == s.strong[index] {
+			return index, true
+		}
+	}
+	return 0, false
+}
+
+// Diff 读取新内容 r，按基准的签名生成增量写出到 w
+func Diff(sig *Signature, r io.Reader, w io.Writer) (Stats, error) {
+	e := &encoder{w: bufio.NewWriter(w), blockSize: sig.BlockSize}
+	e.header()
+
+	size := sig.BlockSize
+	var (
+		buf     = make([]byte, 0, 2*size+maxLiteral) // buf[:pos] 为待输出的字面数据，buf[pos:] 从窗口开始
+		pos     int
+		eof     bool
+		rolling bool // sum 是否对应当前窗口
+		sum     rollsum
+	)
+	// fill 读取数据直到窗口满或读到结尾
+	fill := func() error {
+		for !eof && len(buf)-pos < size {
+			if len(buf) == cap(buf) {
+				grown := make([]byte, len(buf), 2*cap(buf))
+				copy(grown, buf)
+				buf = grown
+			}
+			n, err := r.Read(buf[len(buf):cap(buf)])
+			buf = buf[:len(buf)+n]
+			if err == io.EOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// consume 输出字面数据 buf[:pos]，丢弃 buf[:end]
+	consume := func(end int) {
+		e.literal(buf[:pos])
+		n := copy(buf, buf[end:])
+		buf = buf[:n]
+		pos = 0
+	}
+
+	for {
+		if err := fill(); err != nil {
+			return e.stats, err
+		}
+		window := buf[pos:min(pos+size, len(buf))]
+		if len(window) == 0 {
+			break
+		}
+		if !rolling {
+			sum.init(window)
+			rolling = true
+		}
+		if index, ok := sig.match(sum.digest(), window); ok {
+			n := len(window)
+			consume(pos + n)
+			e.copyBlock(index, n)
+			rolling = false
+			continue
+		}
+		if len(window) < size {
+			// 已到结尾且剩余数据不足一块，全部作为字面数据
+			pos = len(buf)
+			break
+		}
+
+		out := buf[pos]
+		pos++
+		if err := fill(); err != nil {
+			return e.stats, err
+		}
+		if pos+size <= len(buf) {
+			sum.roll(out, buf[pos+size-1])
+		} else {
+			rolling = false
+		}
+		if pos >= maxLiteral {
+			consume(pos)
+		}
+	}
+	consume(pos)
+	return e.stats, e.end()
+}
+
+// encoder 写出增量，合并连续的复制操作
+type encoder struct {
+	w         *bufio.Writer
+	blockSize int
+	stats     Stats
+	runStart  int // 尚未输出的连续复制的起始块号
+	runCount  int // 尚未输出的连续复制的块数
+	scratch   [binary.MaxVarintLen64]byte
+}
+
+func (e *encoder) header() {
+	e.w.WriteString(magic)
+	e.uvarint(uint64(e.blockSize))
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.scratch[:], v)
+	e.w.Write(e.scratch[:n])
+}
+
+func (e *encoder) literal(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	e.flushRun()
+	e.w.WriteByte(opLiteral)
+	e.uvarint(uint64(len(data)))
+	e.w.Write(data)
+	e.stats.Literal += int64(len(data))
+}
+
+func (e *encoder) copyBlock(index, n int) {
+	if e.runCount > 0 && index == e.runStart+e.runCount {
+		e.runCount++
+	} else {
+		e.flushRun()
+		e.runStart, e.runCount = index, 1
+	}
+	e.stats.Matched += int64(n)
+}
+
+func (e *encoder) flushRun() {
+	if e.runCount == 0 {
+		return
+	}
+	e.w.WriteByte(opCopy)
+	e.uvarint(uint64(e.runStart))
+	e.uvarint(uint64(e.runCount))
+	e.runCount = 0
+}
+
+func (e *encoder) end() error {
+	e.flushRun()
+	e.w.WriteByte(opEnd)
+	return e.w.Flush()
+}
+
+// ErrCorrupt 增量数据无效或与基准不匹配
+var ErrCorrupt = errors.New("增量数据无效")
+
+// Patch 按增量从基准 base 重建新内容并写出到 w
+func Patch(base io.ReaderAt, delta io.Reader, w io.Writer) (Stats, error) {
+	var stats Stats
+	r := bufio.NewReader(delta)
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(r, head); err != nil || string(head) != magic {
+		return stats, ErrCorrupt
+	}
+	blockSize, err := binary.ReadUvarint(r)
+	if err != nil || blockSize == 0 || blockSize > math.MaxInt32 {
+		return stats, ErrCorrupt
+	}
+
+	for {
+		op, err := r.ReadByte()
+		if err != nil {
+			return stats, fmt.Errorf("%w: 缺少结束标记", ErrCorrupt)
+		}
+		switch op {
+		case opLiteral:
+			n, err := binary.ReadUvarint(r)
+			if err != nil || n > math.MaxInt64 {
+				return stats, ErrCorrupt
+			}
+			written, err := io.CopyN(w, r, int64(n))
+			stats.Literal += written
+			if err != nil {
+				if err == io.EOF {
+					return stats, fmt.Errorf("%w: 字面数据不完整", ErrCorrupt)
+				}
+				return stats, err
+			}
+		case opCopy:
+			start, err1 := binary.ReadUvarint(r)
+			count, err2 := binary.ReadUvarint(r)
+			if err1 != nil || err2 != nil || count == 0 || start > math.MaxInt64/blockSize || count > math.MaxInt64/blockSize-start {
+				return stats, ErrCorrupt
+			}
+			offset, length := int64(start*blockSize), int64(count*blockSize)
+			copied, err := io.Copy(w, io.NewSectionReader(base, offset, length))
+			stats.Matched += copied
+			if err != nil {
+				return stats, err
+			}
+			// 只有最后一块可以不满
+			if copied <= length-int64(blockSize) {
+				return stats, fmt.Errorf("%w: 块超出基准文件", ErrCorrupt)
+			}
+		case opEnd:
+			return stats, nil
+		default:
+			return stats, fmt.Errorf("%w: 未知的操作 %q", ErrCorrupt, op)
+		}
+	}
+}
+
+// rollsum rsync 的弱校验和：a 为窗口内字节之和，b 为按距窗口末尾的距离加权的和，
+// 窗口滑动一个字节时可以在常数时间内更新（按 2^32 回绕，取低 16 位组合）
+type rollsum struct {
+	a, b uint32
+	n    uint32 // 窗口大小
+}
+
+func (s *rollsum) init(window []byte) {
+	s.a, s.b, s.n = 0, 0, uint32(len(window))
+	for i, c := range window {
+		s.a += uint32(c)
+		s.b += (s.n - uint32(i)) * uint32(c)
+	}
+}
+
+// roll 窗口向后滑动一个字节：移出 out，移入 in
+func (s *rollsum) roll(out, in byte) {
+	s.a += uint32(in) - uint32(out)
+	s.b += s.a - s.n*uint32(out)
+}
+
+func (s *rollsum) digest() uint32 {
+	return s.a&0xffff | s.b<<16
+}
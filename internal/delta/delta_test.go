@@ -0,0 +1,144 @@
+package delta
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+// roundTrip 生成增量并重建，检查结果与新内容一致，返回增量和统计
+func roundTrip(t *testing.T, base, target []byte, blockSize int) ([]byte, Stats) {
+	t.Helper()
+	sig, err := Sign(bytes.NewReader(base), blockSize)
+	if err != nil {
+		t.Fatalf("计算签名失败: %v", err)
+	}
+	var patch bytes.Buffer
+	stats, err := Diff(sig, bytes.NewReader(target), &patch)
+	if err != nil {
+		t.Fatalf("生成增量失败: %v", err)
+	}
+	if stats.Literal+stats.Matched != int64(len(target)) {
+		t.Errorf("统计 %+v 与新内容大小 %d 不符", stats, len(target))
+	}
+
+	var out bytes.Buffer
+	applied, err := Patch(bytes.NewReader(base), bytes.NewReader(patch.Bytes()), &out)
+	if err != nil {
+		t.Fatalf("应用增量失败: %v", err)
+	}
+	if !bytes.Equal(out.Bytes(), target) {
+		t.Fatalf("重建的内容与新内容不一致（%d 字节，期望 %d 字节）", out.Len(), len(target))
+	}
+	if applied != stats {
+		t.Errorf("应用时的统计 %+v 与生成时 %+v 不一致", applied, stats)
+	}
+	return patch.Bytes(), stats
+}
+
+func TestRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	random := func(n int) []byte {
+		b := make([]byte, n)
+		rng.Read(b)
+		return b
+	}
+	const blockSize = 64
+	base := random(64*100 + 17)
+
+	concat := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	tests := []struct {
+		name       string
+		target     []byte
+		maxLiteral int64
+	}{
+		{"相同", base, 0},
+		{"空文件", nil, 0},
+		{"开头插入", concat([]byte("inserted"), base), 8},
+		{"中间修改", concat(base[:3000], []byte("XXXX"), base[3004:]), blockSize*2 + 4},
+		{"删除一段", concat(base[:1000], base[2500:]), blockSize * 2},
+		{"末尾追加", concat(base, random(300)), 300 + 17}, // 基准最后不满一块的部分不再位于结尾，无法匹配
+		{"块重排", concat(base[640:1280], base[:640], base[1280:]), 0},
+		{"全新内容", random(5000), 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, stats := roundTrip(t, base, tt.target, blockSize)
+			if stats.Literal > tt.maxLiteral {
+				t.Errorf("字面数据 %d 字节，期望不超过 %d 字节", stats.Literal, tt.maxLiteral)
+			}
+		})
+	}
+
+	// 基准为空或比一块还小
+	roundTrip(t, nil, random(100), blockSize)
+	roundTrip(t, []byte("short"), []byte("a short one"), blockSize)
+}
+
+func TestLargeLiteral(t *testing.T) {
+	// 字面数据超过缓冲区上限时分段输出
+	rng := rand.New(rand.NewSource(2))
+	base := make([]byte, 4096)
+	target := make([]byte, 3*maxLiteral+100)
+	rng.Read(base)
+	rng.Read(target)
+	copy(target[maxLiteral+5:], base)
+	_, stats := roundTrip(t, base, target, 512)
+	if stats.Matched != int64(len(base)) {
+		t.Errorf("应该复用整个基准，实际复用 %d 字节", stats.Matched)
+	}
+}
+
+func TestRollsum(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(3)).Read(data)
+	const n = 100
+	var rolling rollsum
+	rolling.init(data[:n])
+	for i := 1; i+n <= len(data); i++ {
+		rolling.roll(data[i-1], data[i+n-1])
+		var fresh rollsum
+		fresh.init(data[i : i+n])
+		if rolling.digest() != fresh.digest() {
+			t.Fatalf("偏移 %d 处滚动校验和 %x 与重新计算的 %x 不一致", i, rolling.digest(), fresh.digest())
+		}
+	}
+}
+
+func TestPatchCorrupt(t *testing.T) {
+	base := bytes.Repeat([]byte("0123456789"), 100)
+	sig, _ := Sign(bytes.NewReader(base), 64)
+	var patch bytes.Buffer
+	if _, err := Diff(sig, bytes.NewReader(append([]byte("new"), base...)), &patch); err != nil {
+		t.Fatalf("生成增量失败: %v", err)
+	}
+	valid := patch.Bytes()
+
+	tests := map[string][]byte{
+		"无效开头":  append([]byte("XXXXXXXX"), valid[8:]...),
+		"截断":    valid[:len(valid)-1],
+		"块超出基准": append(append([]byte(magic), 64), opCopy, 100, 1, opEnd),
+		"未知操作":  append(append([]byte(magic), 64), 'Z'),
+	}
+	for name, data := range tests {
+		_, err := Patch(bytes.NewReader(base), bytes.NewReader(data), &bytes.Buffer{})
+		if !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: 期望 ErrCorrupt，实际 %v", name, err)
+		}
+	}
+
+	// 基准比签名时短
+	_, err := Patch(bytes.NewReader(base[:100]), bytes.NewReader(valid), &bytes.Buffer{})
+	if !errors.Is(err, ErrCorrupt) {
+		t.Errorf("基准不完整时期望 ErrCorrupt，实际 %v", err)
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	for size, want := range map[int64]int{0: MinBlockSize, 1 << 20: MinBlockSize, 1 << 30: 32768, 1 << 40: MaxBlockSize} {
+		if got := BlockSize(size); got != want {
+			t.Errorf("BlockSize(%d) = %d, 期望 %d", size, got, want)
+		}
+	}
+}
@@ -1,36 +1,139 @@
 package diff
 
 import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"fmt"
-	"sort"
+	"maps"
+	"slices"
+	"sync"
 	"time"
 
 	"file_syn/internal/scanner"
 	"file_syn/pkg/models"
 )
 
+// DefaultMtimeTolerance 默认的修改时间容差（不同文件系统的时间精度可能不同）
+const DefaultMtimeTolerance = time.Second
+
+// Attributes 可以参与对比的属性，名称与差异类型一致
+//
+// 文件类型总是参与对比。扩展元数据（owner、special、xattr、acl）只有两侧都收集了才会对比。
+var Attributes = []models.DifferenceKind{
+	models.DiffSize,
+	models.DiffModTime,
+	models.DiffMode,
+	models.DiffContent,
+	models.DiffTarget,
+	models.DiffOwner,
+	models.DiffSpecial,
+	models.DiffXattr,
+	models.DiffACL,
+}
+
+// Rules 对比规则：参与对比的属性和修改时间的容差
+type Rules struct {
+	Attributes               []models.DifferenceKind // 参与对比的属性（见 Attributes），为 nil 时对比所有属性
+	MtimeTolerance           time.Duration           // 修改时间相差不超过该值时视为一致，0 表示必须完全相同
+	IgnoreMtimeIfSameContent bool                    // 两侧内容摘要一致时不对比修改时间
+}
+
+// DefaultRules 默认的对比规则：对比所有属性，修改时间允许 1 秒的误差
+var DefaultRules = &Rules{MtimeTolerance: DefaultMtimeTolerance}
+
+// Options 对比选项
+type Options struct {
+	Scan          scanner.Options // 扫描两侧目录使用的选项（摘要算法、排除规则等）
+	Rules         *Rules          // 对比规则（为 nil 时使用 DefaultRules）
+	DetectRenames bool            // 将内容相同的左侧独有文件和右侧独有文件配对为重命名
+
+	// Remote 不通过本地文件系统访问的一侧（键为 models.SideLeft 或 models.SideRight），
+	// 如通过 agent 访问的远程目录：该侧的路径交给对应的 Opener 打开
+	Remote map[string]Opener
+
+	// ManifestKey 不为 nil 时，作为对比一侧的清单文件必须带有该公钥的有效签名，
+	// 没有签名或签名无效时对比失败
+	ManifestKey ed25519.PublicKey
+
+	Progress         func(scanner.Progress) // 扫描进度回调（两侧合计，为 nil 时不报告进度）
+	ProgressInterval time.Duration          // 进度回调的间隔（<= 0 时使用 scanner.DefaultProgressInterval）
+}
+
 // Comparer 目录对比器
-type Comparer struct{}
+type Comparer struct {
+	options Options
+	errors  []*models.ScanError
+}
 
 // NewComparer 创建新的对比器
 func NewComparer() *Comparer {
-	return &Comparer{}
+	return NewComparerWithOptions(Options{})
+}
+
+// NewComparerWithOptions 使用指定选项创建对比器
+func NewComparerWithOptions(options Options) *Comparer {
+	return &Comparer{options: options}
 }
 
 // Compare 对比两个目录
 func (c *Comparer) Compare(leftDir, rightDir string) ([]*models.DiffResult, error) {
-	// 扫描左侧目录
-	leftScanner := scanner.NewFileScanner(leftDir)
-	if err := leftScanner.Scan(); err != nil {
-		return nil, fmt.Errorf("扫描左侧目录失败: %v", err)
+	return c.CompareContext(context.Background(), leftDir, rightDir)
+}
+
+// CompareContext 对比两个目录，ctx 被取消时尽快停止并返回 ctx.Err()
+//
+// 任一侧也可以是 snapshot 保存的清单文件，这一侧使用清单中记录的扫描结果。
+func (c *Comparer) CompareContext(ctx context.Context, leftDir, rightDir string) ([]*models.DiffResult, error) {
+	leftScanner, rightScanner, tracker, err := c.openSources(leftDir, rightDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanSources(ctx, leftScanner, rightScanner, tracker); err != nil {
+		return nil, err
 	}
+	c.errors = collectErrors(leftScanner, rightScanner)
 
-	// 扫描右侧目录
-	rightScanner := scanner.NewFileScanner(rightDir)
-	if err := rightScanner.Scan(); err != nil {
-		return nil, fmt.Errorf("扫描右侧目录失败: %v", err)
+	rules := c.rules()
+	results := rules.compareAll(leftScanner, rightScanner)
+	if c.options.DetectRenames {
+		results = rules.detectRenames(results)
 	}
 
+	return results, nil
+}
+
+// scanSources 并发扫描两侧的数据源
+func scanSources(ctx context.Context, leftScanner, rightScanner Source, tracker *scanner.Tracker) error {
+	tracker.Start()
+	defer tracker.Stop()
+
+	var leftErr, rightErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		leftErr = leftScanner.ScanContext(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		rightErr = rightScanner.ScanContext(ctx)
+	}()
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if leftErr != nil {
+		return fmt.Errorf("扫描左侧目录失败: %v", leftErr)
+	}
+	if rightErr != nil {
+		return fmt.Errorf("扫描右侧目录失败: %v", rightErr)
+	}
+	return nil
+}
+
+// compareAll 对比两侧扫描到的全部条目，结果按 scanner.ComparePaths 的顺序排列（不含重命名配对）
+func (r *Rules) compareAll(leftScanner, rightScanner Source) []*models.DiffResult {
 	leftFiles := leftScanner.GetFiles()
 	rightFiles := rightScanner.GetFiles()
 
@@ -43,94 +146,274 @@ func (c *Comparer) Compare(leftDir, rightDir string) ([]*models.DiffResult, erro
 		allPaths[path] = true
 	}
 
-	// 转换为排序的切片
+	// 转换为排序的切片（与流式对比的顺序一致）
 	var sortedPaths []string
 	for path := range allPaths {
 		sortedPaths = append(sortedPaths, path)
 	}
-	sort.Strings(sortedPaths)
-
-	var results []*models.DiffResult
+	slices.SortFunc(sortedPaths, scanner.ComparePaths)
 
 	// 对比每个文件
+	results := make([]*models.DiffResult, 0, len(sortedPaths))
 	for _, path := range sortedPaths {
-		leftFile := leftFiles[path]
-		rightFile := rightFiles[path]
-
-		result := &models.DiffResult{
-			Path:        path,
-			LeftInfo:    leftFile,
-			RightInfo:   rightFile,
-			Differences: []string{},
-		}
+		results = append(results, r.compareEntry(path, leftFiles[path], rightFiles[path], leftScanner, rightScanner))
+	}
+	return results
+}
+
+// rules 返回对比使用的规则
+func (c *Comparer) rules() *Rules {
+	if c.options.Rules == nil {
+		return DefaultRules
+	}
+	return c.options.Rules
+}
 
-		if leftFile == nil {
-			// 文件只在右侧存在
-			result.Status = models.StatusAdded
-			result.Differences = []string{"文件仅存在于右侧目录"}
-		} else if rightFile == nil {
-			// 文件只在左侧存在
-			result.Status = models.StatusDeleted
-			result.Differences = []string{"文件仅存在于左侧目录"}
-		} else {
-			// 文件在两侧都存在，检查差异
-			diffs := compareFileInfo(leftFile, rightFile)
-			if len(diffs) > 0 {
-				result.Status = models.StatusModified
-				result.Differences = diffs
-			} else {
-				result.Status = models.StatusUnchanged
-			}
+// scanOptions 返回扫描两侧目录使用的选项，设置了进度回调时附带两侧共享的进度汇总器
+func (c *Comparer) scanOptions() (scanner.Options, *scanner.Tracker) {
+	options := c.options.Scan
+	if c.options.Progress != nil {
+		options.Tracker = scanner.NewTracker(c.options.Progress, c.options.ProgressInterval)
+	}
+	return options, options.Tracker
+}
+
+// compareEntry 对比同一路径在两侧的文件信息（不存在的一侧为 nil）
+//
+// 某一侧因扫描错误无法确定时（所在目录无法读取、无法访问或无法计算摘要），
+// 结果为 unknown，而不是新增、删除或未变更；两侧的元数据已经不同时仍为 modified。
+func (r *Rules) compareEntry(path string, leftFile, rightFile *models.FileInfo, leftScanner, rightScanner Source) *models.DiffResult {
+	result := &models.DiffResult{
+		Path:        path,
+		LeftInfo:    leftFile,
+		RightInfo:   rightFile,
+		Differences: []models.Difference{},
+	}
+	unknown := leftScanner.Unknown(path, leftFile != nil) || rightScanner.Unknown(path, rightFile != nil)
+
+	if unknown && (leftFile == nil || rightFile == nil) {
+		// 一侧没有扫描到，但可能只是无法读取
+		result.Status = models.StatusUnknown
+	} else if leftFile == nil {
+		// 文件只在右侧存在
+		result.Status = models.StatusAdded
+		result.Differences = []models.Difference{{Kind: models.DiffExists, Left: false, Right: true}}
+	} else if rightFile == nil {
+		// 文件只在左侧存在
+		result.Status = models.StatusDeleted
+		result.Differences = []models.Difference{{Kind: models.DiffExists, Left: true, Right: false}}
+	} else {
+		// 文件在两侧都存在，检查差异
+		diffs := r.Compare(leftFile, rightFile)
+		switch {
+		case len(diffs) == 0 && unknown:
+			// 元数据一致但无法校验内容
+			result.Status = models.StatusUnknown
+		case len(diffs) == 0:
+			result.Status = models.StatusUnchanged
+		case SameContent(leftFile, rightFile):
+			// 元数据不同但内容一致
+			result.Status = models.StatusTouched
+			result.Differences = diffs
+		default:
+			result.Status = models.StatusModified
+			result.Differences = diffs
 		}
+	}
+	return result
+}
 
-		results = append(results, result)
+// Errors 返回上一次对比扫描两侧目录时遇到的错误（先左侧后右侧，各自按路径排序）
+func (c *Comparer) Errors() []*models.ScanError {
+	return c.errors
+}
+
+// collectErrors 汇总两侧的扫描错误并标明所属的一侧
+func collectErrors(leftScanner, rightScanner Source) []*models.ScanError {
+	var errors []*models.ScanError
+	for _, err := range leftScanner.Errors() {
+		err.Side = models.SideLeft
+		errors = append(errors, err)
+	}
+	for _, err := range rightScanner.Errors() {
+		err.Side = models.SideRight
+		errors = append(errors, err)
 	}
+	return errors
+}
 
-	return results, nil
+// renameKey 用于配对重命名文件的键
+type renameKey struct {
+	digest  string
+	size    int64
+	modTime int64
 }
 
-// compareFileInfo 对比两个文件信息
-func compareFileInfo(left, right *models.FileInfo) []string {
-	var differences []string
+// detectRenames 将仅存在于左侧和仅存在于右侧的普通文件配对为重命名
+//
+// 两侧都有摘要时按摘要配对，否则退化为按 大小+修改时间（秒）配对。
+// 只有一一对应的候选才会被配对，存在多个相同候选时保持新增/删除状态。
+func (r *Rules) detectRenames(results []*models.DiffResult) []*models.DiffResult {
+	deleted := make(map[renameKey][]*models.DiffResult)
+	added := make(map[renameKey][]*models.DiffResult)
+	for _, result := range results {
+		switch {
+		case result.Status == models.StatusDeleted && result.LeftInfo.Type() == models.FileTypeFile:
+			key := newRenameKey(result.LeftInfo)
+			deleted[key] = append(deleted[key], result)
+		case result.Status == models.StatusAdded && result.RightInfo.Type() == models.FileTypeFile:
+			key := newRenameKey(result.RightInfo)
+			added[key] = append(added[key], result)
+		}
+	}
 
-	// 检查是否为目录
-	if left.IsDir != right.IsDir {
-		if left.IsDir {
-			differences = append(differences, "左侧是目录，右侧不是")
-		} else {
-			differences = append(differences, "右侧是目录，左侧不是")
+	paired := make(map[*models.DiffResult]*models.DiffResult)
+	for key, from := range deleted {
+		to := added[key]
+		if len(from) != 1 || len(to) != 1 {
+			continue
 		}
-		return differences
+		paired[to[0]] = from[0]
+		paired[from[0]] = nil
+	}
+	if len(paired) == 0 {
+		return results
 	}
 
-	// 如果是目录，只检查类型差异（已在上面检查）
-	if left.IsDir {
-		return differences
+	var renamed []*models.DiffResult
+	for _, result := range results {
+		from, ok := paired[result]
+		switch {
+		case !ok:
+			renamed = append(renamed, result)
+		case from != nil:
+			left, right := from.LeftInfo, result.RightInfo
+			differences := []models.Difference{{Kind: models.DiffPath, Left: left.Path, Right: right.Path}}
+			differences = append(differences, r.Compare(left, right)...)
+			renamed = append(renamed, &models.DiffResult{
+				Path:        right.Path,
+				OldPath:     left.Path,
+				Status:      models.StatusRenamed,
+				LeftInfo:    left,
+				RightInfo:   right,
+				Differences: differences,
+			})
+		}
 	}
+	return renamed
+}
 
-	// 对比文件大小
-	if left.Size != right.Size {
-		differences = append(differences, fmt.Sprintf("大小不同: 左侧=%d 字节, 右侧=%d 字节", left.Size, right.Size))
+// newRenameKey 生成文件的配对键
+func newRenameKey(info *models.FileInfo) renameKey {
+	if info.Digest != "" {
+		return renameKey{digest: info.Digest}
 	}
+	return renameKey{size: info.Size, modTime: info.ModTime.Unix()}
+}
+
+// CompareFileInfo 按默认规则对比两个文件信息，返回差异列表（两侧一致时为空）
+func CompareFileInfo(left, right *models.FileInfo) []models.Difference {
+	return DefaultRules.Compare(left, right)
+}
+
+// Compares 判断属性是否参与对比
+func (r *Rules) Compares(attribute models.DifferenceKind) bool {
+	return r.Attributes == nil || slices.Contains(r.Attributes, attribute)
+}
 
-	// 对比修改时间（允许1秒的误差，因为不同文件系统的时间精度可能不同）
+// SameModTime 判断两侧的修改时间在容差范围内是否一致（不对比修改时间时总是一致）
+func (r *Rules) SameModTime(left, right *models.FileInfo) bool {
+	if !r.Compares(models.DiffModTime) {
+		return true
+	}
 	timeDiff := left.ModTime.Sub(right.ModTime)
 	if timeDiff < 0 {
 		timeDiff = -timeDiff
 	}
-	if timeDiff > time.Second {
-		differences = append(differences, fmt.Sprintf("修改时间不同: 左侧=%s, 右侧=%s",
-			left.ModTime.Format("2006-01-02 15:04:05"),
-			right.ModTime.Format("2006-01-02 15:04:05")))
+	return timeDiff <= r.MtimeTolerance
+}
+
+// Compare 按规则对比两个文件信息，返回差异列表（两侧一致时为空）
+func (r *Rules) Compare(left, right *models.FileInfo) []models.Difference {
+	var differences []models.Difference
+
+	// 检查文件类型（普通文件、目录、符号链接）
+	if left.Type() != right.Type() {
+		return append(differences, models.Difference{Kind: models.DiffType, Left: left.Type(), Right: right.Type()})
 	}
 
-	// 对比文件权限（只对比基本权限位，忽略特殊位）
+	// 如果是目录，只检查类型差异（已在上面检查）和扩展元数据
+	if left.IsDir {
+		return r.compareMetadata(left, right)
+	}
+
+	// 符号链接只对比目标（链接本身的修改时间和权限无法可靠地同步）和属主
+	if left.IsSymlink {
+		if r.Compares(models.DiffTarget) && left.LinkTarget != right.LinkTarget {
+			differences = append(differences, models.Difference{Kind: models.DiffTarget, Left: left.LinkTarget, Right: right.LinkTarget})
+		}
+		return append(differences, r.compareMetadata(left, right)...)
+	}
+
+	// 对比文件大小
+	if r.Compares(models.DiffSize) && left.Size != right.Size {
+		differences = append(differences, models.Difference{Kind: models.DiffSize, Left: left.Size, Right: right.Size})
+	}
+
+	// 对比修改时间（允许配置的误差，内容一致时可以忽略）
+	if !r.SameModTime(left, right) && !(r.IgnoreMtimeIfSameContent && SameContent(left, right)) {
+		differences = append(differences, models.Difference{Kind: models.DiffModTime, Left: left.ModTime, Right: right.ModTime})
+	}
+
+	// 对比内容摘要（两侧都计算了摘要时）
+	if r.Compares(models.DiffContent) && left.Digest != "" && right.Digest != "" && left.Digest != right.Digest {
+		differences = append(differences, models.Difference{Kind: models.DiffContent, Left: left.Digest, Right: right.Digest})
+	}
+
+	// 对比文件权限（只对比基本权限位，特殊位由 special 对比）
 	leftPerm := left.Mode.Perm()
 	rightPerm := right.Mode.Perm()
-	if leftPerm != rightPerm {
-		differences = append(differences, fmt.Sprintf("权限不同: 左侧=%s, 右侧=%s",
-			leftPerm.String(), rightPerm.String()))
+	if r.Compares(models.DiffMode) && leftPerm != rightPerm {
+		differences = append(differences, models.Difference{Kind: models.DiffMode, Left: leftPerm, Right: rightPerm})
 	}
 
+	return append(differences, r.compareMetadata(left, right)...)
+}
+
+// compareMetadata 对比两侧都收集了的扩展元数据
+func (r *Rules) compareMetadata(left, right *models.FileInfo) []models.Difference {
+	if left.Meta == nil || right.Meta == nil {
+		return nil
+	}
+	l, m := left.Meta, right.Meta
+
+	var differences []models.Difference
+	if l.Collected.Owner && m.Collected.Owner && r.Compares(models.DiffOwner) && (l.UID != m.UID || l.GID != m.GID) {
+		differences = append(differences, models.Difference{
+			Kind:  models.DiffOwner,
+			Left:  fmt.Sprintf("%d:%d", l.UID, l.GID),
+			Right: fmt.Sprintf("%d:%d", m.UID, m.GID),
+		})
+	}
+	if l.Collected.Special && m.Collected.Special && r.Compares(models.DiffSpecial) {
+		leftBits, rightBits := left.Mode&models.SpecialBits, right.Mode&models.SpecialBits
+		if leftBits != rightBits {
+			differences = append(differences, models.Difference{Kind: models.DiffSpecial, Left: leftBits, Right: rightBits})
+		}
+	}
+	if l.Collected.Xattrs && m.Collected.Xattrs && r.Compares(models.DiffXattr) && !maps.EqualFunc(l.Xattrs, m.Xattrs, bytes.Equal) {
+		differences = append(differences, models.Difference{Kind: models.DiffXattr, Left: l.Xattrs, Right: m.Xattrs})
+	}
+	if l.Collected.ACL && m.Collected.ACL && r.Compares(models.DiffACL) && l.ACL != m.ACL {
+		differences = append(differences, models.Difference{Kind: models.DiffACL, Left: l.ACL, Right: m.ACL})
+	}
 	return differences
 }
+
+// SameContent 判断两个普通文件的内容摘要是否一致（任一侧未计算摘要时返回 false）
+func SameContent(left, right *models.FileInfo) bool {
+	if left.Type() != models.FileTypeFile || right.Type() != models.FileTypeFile {
+		return false
+	}
+	return left.Digest != "" && left.Digest == right.Digest
+}
@@ -1,9 +1,18 @@
 package diff
 
 import (
+	"context"
+	"errors"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
+	"time"
+
+	"file_syn/internal/manifest"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
 )
 
 func TestComparer(t *testing.T) {
@@ -91,3 +100,587 @@ func TestComparer(t *testing.T) {
 		t.Error("未找到 modified 状态的文件")
 	}
 }
+
+func TestCompareContent(t *testing.T) {
+	leftDir := t.TempDir()
+	rightDir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	files := []struct {
+		name    string
+		left    string
+		right   string
+		leftMod time.Time
+	}{
+		// 大小和修改时间相同，但内容不同
+		{"same_meta.txt", "aaaa", "bbbb", modTime},
+		// 内容相同，仅修改时间不同
+		{"touched.txt", "same", "same", modTime.Add(time.Hour)},
+		{"identical.txt", "same", "same", modTime},
+	}
+	for _, f := range files {
+		leftPath := filepath.Join(leftDir, f.name)
+		rightPath := filepath.Join(rightDir, f.name)
+		if err := os.WriteFile(leftPath, []byte(f.left), 0644); err != nil {
+			t.Fatalf("无法创建左侧文件: %v", err)
+		}
+		if err := os.WriteFile(rightPath, []byte(f.right), 0644); err != nil {
+			t.Fatalf("无法创建右侧文件: %v", err)
+		}
+		if err := os.Chtimes(leftPath, f.leftMod, f.leftMod); err != nil {
+			t.Fatalf("无法设置修改时间: %v", err)
+		}
+		if err := os.Chtimes(rightPath, modTime, modTime); err != nil {
+			t.Fatalf("无法设置修改时间: %v", err)
+		}
+	}
+
+	// 只对比元数据时无法发现同大小同时间的修改
+	results, err := NewComparer().Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	expected := map[string]string{
+		"same_meta.txt": models.StatusUnchanged,
+		"touched.txt":   models.StatusModified,
+		"identical.txt": models.StatusUnchanged,
+	}
+	for _, result := range results {
+		if result.Status != expected[result.Path] {
+			t.Errorf("元数据模式下 %s 应该是 %s 状态，实际是 %s", result.Path, expected[result.Path], result.Status)
+		}
+	}
+
+	// 开启内容校验
+	results, err = NewComparerWithOptions(Options{Scan: scanner.Options{HashAlgo: "sha256"}}).Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	expected = map[string]string{
+		"same_meta.txt": models.StatusModified,
+		"touched.txt":   models.StatusTouched,
+		"identical.txt": models.StatusUnchanged,
+	}
+	for _, result := range results {
+		if result.Status != expected[result.Path] {
+			t.Errorf("内容校验模式下 %s 应该是 %s 状态，实际是 %s", result.Path, expected[result.Path], result.Status)
+		}
+		if result.LeftInfo.Digest == "" || result.RightInfo.Digest == "" {
+			t.Errorf("%s 应该记录内容摘要", result.Path)
+		}
+		if result.Path == "same_meta.txt" {
+			if len(result.Differences) != 1 || result.Differences[0].Kind != models.DiffContent {
+				t.Errorf("same_meta.txt 应该只有内容差异，实际是 %v", result.Differences)
+			} else if result.Differences[0].Left != result.LeftInfo.Digest {
+				t.Errorf("内容差异的左侧值应为左侧摘要，实际是 %v", result.Differences[0].Left)
+			}
+		}
+	}
+
+	if _, err := NewComparerWithOptions(Options{Scan: scanner.Options{HashAlgo: "unknown"}}).Compare(leftDir, rightDir); err == nil {
+		t.Error("不支持的摘要算法应该返回错误")
+	}
+}
+
+func TestCompareRenames(t *testing.T) {
+	leftDir := t.TempDir()
+	rightDir := t.TempDir()
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	files := map[string]string{
+		filepath.Join(leftDir, "docs", "a.pdf"):     "pdf content",
+		filepath.Join(rightDir, "archive", "a.pdf"): "pdf content",
+		filepath.Join(leftDir, "old.txt"):           "unrelated",
+		filepath.Join(rightDir, "new.txt"):          "something else",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("无法设置修改时间: %v", err)
+		}
+	}
+
+	// 分别测试按摘要配对和按 大小+修改时间 配对
+	for _, hashAlgo := range []string{"sha256", ""} {
+		comparer := NewComparerWithOptions(Options{Scan: scanner.Options{HashAlgo: hashAlgo}, DetectRenames: true})
+		results, err := comparer.Compare(leftDir, rightDir)
+		if err != nil {
+			t.Fatalf("对比失败: %v", err)
+		}
+
+		statuses := make(map[string]string)
+		for _, result := range results {
+			statuses[result.Path] = result.Status
+			if result.Status == models.StatusRenamed && result.OldPath != "docs/a.pdf" {
+				t.Errorf("重命名的原路径应为 docs/a.pdf，实际是 %s", result.OldPath)
+			}
+		}
+		expected := map[string]string{
+			"archive":       models.StatusAdded,
+			"archive/a.pdf": models.StatusRenamed,
+			"docs":          models.StatusDeleted,
+			"new.txt":       models.StatusAdded,
+			"old.txt":       models.StatusDeleted,
+		}
+		if len(statuses) != len(expected) {
+			t.Errorf("[%s] 期望 %d 个结果，实际 %d 个: %v", hashAlgo, len(expected), len(statuses), statuses)
+		}
+		for path, status := range expected {
+			if statuses[path] != status {
+				t.Errorf("[%s] %s 应该是 %s 状态，实际是 %s", hashAlgo, path, status, statuses[path])
+			}
+		}
+	}
+}
+
+func TestCompareStream(t *testing.T) {
+	leftDir := t.TempDir()
+	rightDir := t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(leftDir, "a", "b", "same.txt"):  "same",
+		filepath.Join(rightDir, "a", "b", "same.txt"): "same",
+		filepath.Join(leftDir, "a", "changed.txt"):    "left",
+		filepath.Join(rightDir, "a", "changed.txt"):   "right!",
+		filepath.Join(leftDir, "a-b", "left.txt"):     "left only",
+		filepath.Join(rightDir, "a.txt"):              "right only",
+		filepath.Join(rightDir, "z", "deep", "x.txt"): "right only",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+
+	comparer := NewComparerWithOptions(Options{Scan: scanner.Options{HashAlgo: "sha256"}})
+	expected, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	results, err := comparer.CompareStream(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("流式对比失败: %v", err)
+	}
+
+	// 流式对比的结果和顺序应与 Compare 一致
+	i := 0
+	for result := range results {
+		if i >= len(expected) {
+			t.Fatalf("流式对比产出了多余的结果: %s", result.Path)
+		}
+		if result.Path != expected[i].Path || result.Status != expected[i].Status {
+			t.Errorf("第 %d 个结果期望 %s (%s)，实际 %s (%s)", i, expected[i].Path, expected[i].Status, result.Path, result.Status)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("期望 %d 个结果，实际 %d 个", len(expected), i)
+	}
+	if len(comparer.Errors()) != 0 {
+		t.Errorf("期望没有扫描错误，实际 %d 个", len(comparer.Errors()))
+	}
+
+	// 提前停止遍历
+	for range results {
+		break
+	}
+
+	// 流式对比不支持重命名检测
+	if _, err := NewComparerWithOptions(Options{DetectRenames: true}).CompareStream(leftDir, rightDir); err == nil {
+		t.Error("流式对比开启重命名检测应该返回错误")
+	}
+}
+
+func TestCompareContext(t *testing.T) {
+	leftDir := t.TempDir()
+	rightDir := t.TempDir()
+	for _, dir := range []string{leftDir, rightDir} {
+		if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+
+	// 进度回调汇总两侧的条目
+	var last scanner.Progress
+	comparer := NewComparerWithOptions(Options{Progress: func(p scanner.Progress) { last = p }})
+	if _, err := comparer.CompareContext(context.Background(), leftDir, rightDir); err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	if last.Entries != 2 {
+		t.Errorf("期望进度中有 2 个条目，实际 %d 个", last.Entries)
+	}
+
+	// 已取消的上下文
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := comparer.CompareContext(ctx, leftDir, rightDir); !errors.Is(err, context.Canceled) {
+		t.Errorf("期望返回 context.Canceled，实际 %v", err)
+	}
+	results, err := comparer.CompareStreamContext(ctx, leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("流式对比失败: %v", err)
+	}
+	for result := range results {
+		t.Errorf("取消后不应产出结果: %s", result.Path)
+	}
+}
+
+func TestCompareUnknown(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root 用户可以读取无权限的目录")
+	}
+	leftDir := t.TempDir()
+	rightDir := t.TempDir()
+	for _, dir := range []string{leftDir, rightDir} {
+		if err := os.MkdirAll(filepath.Join(dir, "locked"), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "locked", "a.txt"), []byte("a"), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+	locked := filepath.Join(rightDir, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatalf("无法修改权限: %v", err)
+	}
+	defer os.Chmod(locked, 0755)
+
+	// 无法读取的目录中的文件不能判定为删除
+	for _, stream := range []bool{false, true} {
+		comparer := NewComparer()
+		var results []*models.DiffResult
+		if stream {
+			seq, err := comparer.CompareStream(leftDir, rightDir)
+			if err != nil {
+				t.Fatalf("流式对比失败: %v", err)
+			}
+			for result := range seq {
+				results = append(results, result)
+			}
+		} else {
+			var err error
+			if results, err = comparer.Compare(leftDir, rightDir); err != nil {
+				t.Fatalf("对比失败: %v", err)
+			}
+		}
+
+		statuses := make(map[string]string)
+		for _, result := range results {
+			statuses[result.Path] = result.Status
+		}
+		if statuses["locked/a.txt"] != models.StatusUnknown {
+			t.Errorf("stream=%v: locked/a.txt 期望 unknown，实际 %s", stream, statuses["locked/a.txt"])
+		}
+		errs := comparer.Errors()
+		if len(errs) != 1 || errs[0].Side != models.SideRight || errs[0].Op != models.ScanOpReadDir || errs[0].Path != "locked" {
+			t.Errorf("stream=%v: 扫描错误不正确: %v", stream, errs)
+		}
+	}
+}
+
+func TestCompareSymlinks(t *testing.T) {
+	now := time.Now()
+	link := func(target string, modTime time.Time) *models.FileInfo {
+		return &models.FileInfo{Path: "link", IsSymlink: true, LinkTarget: target, Size: int64(len(target)), ModTime: modTime, Mode: os.ModeSymlink | 0777}
+	}
+	file := &models.FileInfo{Path: "link", Size: 3, ModTime: now, Mode: 0644, Digest: "abcd"}
+
+	// 目标相同的链接一致，链接本身的修改时间不参与对比
+	if diffs := CompareFileInfo(link("a.txt", now), link("a.txt", now.Add(time.Hour))); len(diffs) != 0 {
+		t.Errorf("目标相同的符号链接不应有差异: %v", diffs)
+	}
+
+	diffs := CompareFileInfo(link("a.txt", now), link("b.txt", now))
+	if len(diffs) != 1 || diffs[0].Kind != models.DiffTarget || diffs[0].Left != "a.txt" || diffs[0].Right != "b.txt" {
+		t.Errorf("期望链接目标差异，实际 %v", diffs)
+	}
+
+	// 一侧是符号链接、另一侧是普通文件时报告类型差异
+	diffs = CompareFileInfo(link("a.txt", now), file)
+	if len(diffs) != 1 || diffs[0].Kind != models.DiffType || diffs[0].Left != models.FileTypeSymlink || diffs[0].Right != models.FileTypeFile {
+		t.Errorf("期望类型差异，实际 %v", diffs)
+	}
+	if SameContent(link("a.txt", now), file) {
+		t.Error("符号链接和普通文件的内容不应视为一致")
+	}
+}
+
+func TestCompareMetadata(t *testing.T) {
+	now := time.Now()
+	all := models.MetadataOptions{Owner: true, Special: true, Xattrs: true, ACL: true}
+	file := func(mode os.FileMode, meta *models.Metadata) *models.FileInfo {
+		return &models.FileInfo{Path: "bin", Size: 3, ModTime: now, Mode: mode, Digest: "abcd", Meta: meta}
+	}
+	left := file(0755|os.ModeSetuid, &models.Metadata{
+		Collected: all, UID: 0, GID: 0,
+		Xattrs: map[string][]byte{"security.selinux": []byte("system_u:object_r:bin_t:s0\x00")},
+		ACL:    "user::rwx,group::r-x,other::r-x",
+	})
+
+	// 未收集扩展元数据时不参与对比
+	if diffs := CompareFileInfo(left, file(0755, nil)); len(diffs) != 0 {
+		t.Errorf("一侧未收集扩展元数据时不应有差异: %v", diffs)
+	}
+
+	right := file(0755, &models.Metadata{
+		Collected: all, UID: 1000, GID: 1000,
+		Xattrs: map[string][]byte{"security.selinux": []byte("unconfined_u:object_r:user_home_t:s0\x00")},
+		ACL:    "user::rwx,user:1000:rwx,group::r-x,mask::rwx,other::r-x",
+	})
+	diffs := CompareFileInfo(left, right)
+	kinds := make([]models.DifferenceKind, len(diffs))
+	for i, d := range diffs {
+		kinds[i] = d.Kind
+	}
+	want := []models.DifferenceKind{models.DiffOwner, models.DiffSpecial, models.DiffXattr, models.DiffACL}
+	if !slices.Equal(kinds, want) {
+		t.Fatalf("期望差异 %v，实际 %v", want, diffs)
+	}
+	if diffs[0].Left != "0:0" || diffs[0].Right != "1000:1000" {
+		t.Errorf("属主差异不正确: %v", diffs[0])
+	}
+	if diffs[1].Left != os.ModeSetuid || diffs[1].Right != os.FileMode(0) {
+		t.Errorf("特殊权限差异不正确: %v", diffs[1])
+	}
+
+	// 只对比两侧都收集了的属性
+	right.Meta.Collected = models.MetadataOptions{Xattrs: true}
+	diffs = CompareFileInfo(left, right)
+	if len(diffs) != 1 || diffs[0].Kind != models.DiffXattr {
+		t.Errorf("只应对比两侧都收集的扩展属性，实际 %v", diffs)
+	}
+
+	// 目录只对比扩展元数据
+	dir := func(meta *models.Metadata) *models.FileInfo {
+		return &models.FileInfo{Path: "dir", IsDir: true, ModTime: now, Mode: os.ModeDir | 0755, Meta: meta}
+	}
+	diffs = CompareFileInfo(dir(&models.Metadata{Collected: all}), dir(&models.Metadata{Collected: all, UID: 1}))
+	if len(diffs) != 1 || diffs[0].Kind != models.DiffOwner {
+		t.Errorf("期望目录属主差异，实际 %v", diffs)
+	}
+}
+
+func TestCompareRules(t *testing.T) {
+	now := time.Now()
+	left := &models.FileInfo{Path: "a.txt", Size: 3, ModTime: now, Mode: 0644, Digest: "abcd"}
+	right := &models.FileInfo{Path: "a.txt", Size: 3, ModTime: now.Add(1500 * time.Millisecond), Mode: 0600, Digest: "abcd"}
+	kinds := func(diffs []models.Difference) []models.DifferenceKind {
+		var kinds []models.DifferenceKind
+		for _, d := range diffs {
+			kinds = append(kinds, d.Kind)
+		}
+		return kinds
+	}
+
+	tests := []struct {
+		name  string
+		rules *Rules
+		want  []models.DifferenceKind
+	}{
+		{"默认规则", DefaultRules, []models.DifferenceKind{models.DiffModTime, models.DiffMode}},
+		{"FAT 的 2 秒精度", &Rules{MtimeTolerance: 2 * time.Second}, []models.DifferenceKind{models.DiffMode}},
+		{"只对比大小和内容", &Rules{Attributes: []models.DifferenceKind{models.DiffSize, models.DiffContent}}, nil},
+		{"内容一致时忽略修改时间", &Rules{IgnoreMtimeIfSameContent: true}, []models.DifferenceKind{models.DiffMode}},
+	}
+	for _, tt := range tests {
+		if got := kinds(tt.rules.Compare(left, right)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: 期望差异 %v，实际 %v", tt.name, tt.want, got)
+		}
+	}
+
+	// 内容不同时仍然对比修改时间
+	right.Digest = "ef01"
+	rules := &Rules{IgnoreMtimeIfSameContent: true}
+	if got, want := kinds(rules.Compare(left, right)), []models.DifferenceKind{models.DiffModTime, models.DiffContent, models.DiffMode}; !slices.Equal(got, want) {
+		t.Errorf("内容不同时期望差异 %v，实际 %v", want, got)
+	}
+
+	// 对比器使用配置的规则：修改时间不同但内容一致的文件视为未变更
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	for i, dir := range []string{leftDir, rightDir} {
+		path := filepath.Join(dir, "a.txt")
+		if err := os.WriteFile(path, []byte("same"), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+		modTime := now.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("无法设置修改时间: %v", err)
+		}
+	}
+	comparer := NewComparerWithOptions(Options{Scan: scanner.Options{HashAlgo: "sha256"}, Rules: rules})
+	results, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != models.StatusUnchanged {
+		t.Errorf("内容一致时应忽略修改时间，实际 %+v", results[0])
+	}
+}
+
+func TestCompareManifest(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/c.txt": "c"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+	s := scanner.NewFileScannerWithOptions(dir, scanner.Options{HashAlgo: "sha256"})
+	if err := s.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	manifestPath := filepath.Join(t.TempDir(), "snapshot.bin")
+	f, err := os.Create(manifestPath)
+	if err != nil {
+		t.Fatalf("无法创建清单文件: %v", err)
+	}
+	if err := manifest.New(dir, "sha256", s.GetFiles(), nil).WriteFormat(f, manifest.FormatBinary); err != nil {
+		t.Fatalf("写出清单失败: %v", err)
+	}
+	f.Close()
+
+	// 修改内容但保持大小和修改时间，只有摘要能发现
+	info, _ := os.Stat(filepath.Join(dir, "a.txt"))
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("A"), 0644); err != nil {
+		t.Fatalf("无法修改文件: %v", err)
+	}
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("无法设置修改时间: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "sub", "c.txt")); err != nil {
+		t.Fatalf("无法删除文件: %v", err)
+	}
+
+	// 未指定摘要算法时实时扫描的一侧使用清单的摘要算法；清单在左侧和右侧都可以
+	want := map[string]string{"a.txt": models.StatusModified, "sub": models.StatusUnchanged, "sub/b.txt": models.StatusUnchanged, "sub/c.txt": models.StatusDeleted}
+	comparer := NewComparer()
+	results, err := comparer.Compare(manifestPath, dir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	checkStatuses(t, "清单在左侧", results, want)
+
+	results, err = comparer.Compare(dir, manifestPath)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	want["sub/c.txt"] = models.StatusAdded
+	checkStatuses(t, "清单在右侧", results, want)
+
+	seq, err := comparer.CompareStream(dir, manifestPath)
+	if err != nil {
+		t.Fatalf("流式对比失败: %v", err)
+	}
+	results = slices.Collect(seq)
+	checkStatuses(t, "流式对比", results, want)
+
+	// 摘要算法不同时无法对比内容
+	comparer = NewComparerWithOptions(Options{Scan: scanner.Options{HashAlgo: "md5"}})
+	if _, err := comparer.Compare(manifestPath, dir); err == nil {
+		t.Error("摘要算法不同时应返回错误")
+	}
+}
+
+// checkStatuses 检查对比结果的路径和状态
+func checkStatuses(t *testing.T, name string, results []*models.DiffResult, want map[string]string) {
+	t.Helper()
+	if len(results) != len(want) {
+		t.Errorf("%s: 期望 %d 个结果，实际 %d 个", name, len(want), len(results))
+	}
+	for _, result := range results {
+		if result.Status != want[result.Path] {
+			t.Errorf("%s: %s 期望 %s，实际 %s %v", name, result.Path, want[result.Path], result.Status, result.Differences)
+		}
+	}
+}
+
+func TestViewRescan(t *testing.T) {
+	leftDir := t.TempDir()
+	rightDir := t.TempDir()
+	write := func(dir, name, content string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+	for _, dir := range []string{leftDir, rightDir} {
+		write(dir, "a.txt", "a")
+		write(dir, "sub/b.txt", "b")
+	}
+
+	for _, renames := range []bool{false, true} {
+		comparer := NewComparerWithOptions(Options{Scan: scanner.Options{HashAlgo: "sha256"}, DetectRenames: renames})
+		view, err := comparer.NewView(context.Background(), leftDir, rightDir)
+		if err != nil {
+			t.Fatalf("对比失败: %v", err)
+		}
+		checkStatuses(t, "初次对比", view.Results(), map[string]string{
+			"a.txt": models.StatusUnchanged, "sub": models.StatusUnchanged, "sub/b.txt": models.StatusUnchanged,
+		})
+
+		// 右侧修改 a.txt、把 sub 移动为 moved，左侧新增 c.txt
+		write(rightDir, "a.txt", "changed")
+		if err := os.Rename(filepath.Join(rightDir, "sub"), filepath.Join(rightDir, "moved")); err != nil {
+			t.Fatalf("无法移动目录: %v", err)
+		}
+		write(leftDir, "c.txt", "c")
+		changed, err := view.Rescan(context.Background(), []string{"c.txt"}, []string{"a.txt", "sub", "moved"})
+		if err != nil {
+			t.Fatalf("重新扫描失败: %v", err)
+		}
+		want := map[string]string{
+			"a.txt":       models.StatusModified,
+			"c.txt":       models.StatusDeleted,
+			"moved":       models.StatusAdded,
+			"moved/b.txt": models.StatusAdded,
+			"sub":         models.StatusDeleted,
+			"sub/b.txt":   models.StatusDeleted,
+		}
+		if renames {
+			delete(want, "sub/b.txt")
+			want["moved/b.txt"] = models.StatusRenamed
+		}
+		checkStatuses(t, "变化的结果", changed, want)
+
+		// 增量更新后的结果与重新完整对比一致
+		results, err := comparer.Compare(leftDir, rightDir)
+		if err != nil {
+			t.Fatalf("对比失败: %v", err)
+		}
+		if got, expected := indexResults(view.Results()), indexResults(results); !maps.Equal(got, expected) {
+			t.Errorf("增量更新的结果与完整对比不一致:\n%v\n%v", got, expected)
+		}
+
+		// 再次扫描没有变化的路径，不产生变化的结果
+		changed, err = view.Rescan(context.Background(), nil, []string{"a.txt"})
+		if err != nil {
+			t.Fatalf("重新扫描失败: %v", err)
+		}
+		if len(changed) != 0 {
+			t.Errorf("没有变化时不应返回结果: %v", changed)
+		}
+
+		// 恢复初始状态
+		write(rightDir, "a.txt", "a")
+		if err := os.Rename(filepath.Join(rightDir, "moved"), filepath.Join(rightDir, "sub")); err != nil {
+			t.Fatalf("无法移动目录: %v", err)
+		}
+		if err := os.Remove(filepath.Join(leftDir, "c.txt")); err != nil {
+			t.Fatalf("无法删除文件: %v", err)
+		}
+	}
+}
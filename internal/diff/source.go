@@ -0,0 +1,72 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"file_syn/internal/manifest"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// Source 对比的一侧：实时扫描的目录（*scanner.FileScanner）、快照清单（*manifest.Source）
+// 或通过 agent 访问的远程目录（*agent.Source）
+type Source interface {
+	ScanContext(ctx context.Context) error                               // 扫描（或载入）全部条目
+	GetFiles() map[string]*models.FileInfo                               // ScanContext 得到的条目（以相对路径为键）
+	WalkContext(ctx context.Context) (iter.Seq[*models.FileInfo], error) // 按 scanner.ComparePaths 的顺序逐个产出条目
+	Errors() []*models.ScanError                                         // 扫描错误，按路径排序
+	Unknown(path string, exists bool) bool                               // path 的状态是否因扫描错误而无法确定
+}
+
+// Opener 按路径和对比使用的扫描选项打开一侧的数据源
+type Opener func(path string, options scanner.Options) Source
+
+// openSources 打开两侧的数据源：目录按扫描选项实时扫描，普通文件按快照清单读取，
+// Options.Remote 中的一侧由对应的 Opener 打开
+//
+// 清单记录了摘要时，实时扫描的一侧使用清单的摘要算法；
+// 两侧的摘要算法不同时摘要无法比较，返回错误。
+func (c *Comparer) openSources(leftPath, rightPath string) (Source, Source, *scanner.Tracker, error) {
+	options, tracker := c.scanOptions()
+	sides := [2]string{models.SideLeft, models.SideRight}
+	var manifests [2]*manifest.Manifest
+	for i, path := range []string{leftPath, rightPath} {
+		if c.options.Remote[sides[i]] != nil || !manifest.IsManifest(path) {
+			continue
+		}
+		m, err := c.openManifest(path)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		manifests[i] = m
+		switch {
+		case m.HashAlgo == "" || m.HashAlgo == options.HashAlgo:
+		case options.HashAlgo == "":
+			options.HashAlgo = m.HashAlgo
+		default:
+			return nil, nil, nil, fmt.Errorf("清单 %s 的摘要算法 %s 与对比使用的 %s 不同", path, m.HashAlgo, options.HashAlgo)
+		}
+	}
+
+	var sources [2]Source
+	for i, path := range []string{leftPath, rightPath} {
+		if open := c.options.Remote[sides[i]]; open != nil {
+			sources[i] = open(path, options)
+		} else if manifests[i] != nil {
+			sources[i] = manifest.NewSource(manifests[i])
+		} else {
+			sources[i] = scanner.NewFileScannerWithOptions(path, options)
+		}
+	}
+	return sources[0], sources[1], tracker, nil
+}
+
+// openManifest 读取清单文件，设置了 ManifestKey 时同时验证签名
+func (c *Comparer) openManifest(path string) (*manifest.Manifest, error) {
+	if c.options.ManifestKey == nil {
+		return manifest.Open(path)
+	}
+	return manifest.OpenVerified(path, c.options.ManifestKey)
+}
@@ -0,0 +1,128 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"sync"
+
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// prefetchSize 流式对比时每侧预先读取的文件数量
+const prefetchSize = 1024
+
+// CompareStream 流式对比两个目录
+func (c *Comparer) CompareStream(leftDir, rightDir string) (iter.Seq[*models.DiffResult], error) {
+	return c.CompareStreamContext(context.Background(), leftDir, rightDir)
+}
+
+// CompareStreamContext 流式对比两个目录，ctx 被取消时提前结束遍历
+//
+// 两侧目录同时按 scanner.ComparePaths 的顺序遍历并归并，对比结果逐个产出，
+// 顺序与 Compare 一致。内存占用只与目录的扇出有关，与目录树的大小无关，
+// 适合无法一次性放入内存的大目录树。重命名检测需要完整的结果，流式对比不支持。
+//
+// 某一侧越过一个路径时，该路径之前的扫描错误都已记录，因此无法读取的目录中的条目
+// 同样会被标记为 unknown。遍历结束（或提前停止）后 Errors 返回本次对比的扫描错误；
+// 调用方需要检查 ctx.Err() 以区分正常结束和被取消。
+func (c *Comparer) CompareStreamContext(ctx context.Context, leftDir, rightDir string) (iter.Seq[*models.DiffResult], error) {
+	if c.options.DetectRenames {
+		return nil, fmt.Errorf("流式对比不支持重命名检测")
+	}
+
+	leftScanner, rightScanner, tracker, err := c.openSources(leftDir, rightDir)
+	if err != nil {
+		return nil, err
+	}
+	leftFiles, err := leftScanner.WalkContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("扫描左侧目录失败: %v", err)
+	}
+	rightFiles, err := rightScanner.WalkContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("扫描右侧目录失败: %v", err)
+	}
+
+	rules := c.rules()
+	return func(yield func(*models.DiffResult) bool) {
+		tracker.Start()
+		nextLeft, stopLeft := prefetch(leftFiles)
+		nextRight, stopRight := prefetch(rightFiles)
+		defer func() {
+			stopLeft()
+			stopRight()
+			tracker.Stop()
+			c.errors = collectErrors(leftScanner, rightScanner)
+		}()
+
+		left, hasLeft := nextLeft()
+		right, hasRight := nextRight()
+		for hasLeft || hasRight {
+			// 被取消的一侧会提前结束，不能把另一侧剩余的文件当作新增或删除
+			if ctx.Err() != nil {
+				return
+			}
+
+			var order int
+			switch {
+			case !hasRight:
+				order = -1
+			case !hasLeft:
+				order = 1
+			default:
+				order = scanner.ComparePaths(left.Path, right.Path)
+			}
+
+			var result *models.DiffResult
+			switch {
+			case order < 0:
+				result = rules.compareEntry(left.Path, left, nil, leftScanner, rightScanner)
+				left, hasLeft = nextLeft()
+			case order > 0:
+				result = rules.compareEntry(right.Path, nil, right, leftScanner, rightScanner)
+				right, hasRight = nextRight()
+			default:
+				result = rules.compareEntry(left.Path, left, right, leftScanner, rightScanner)
+				left, hasLeft = nextLeft()
+				right, hasRight = nextRight()
+			}
+			if !yield(result) {
+				return
+			}
+		}
+	}, nil
+}
+
+// prefetch 在单独的协程中遍历 files，最多预先读取 prefetchSize 个文件
+//
+// 返回读取下一个文件的函数和停止遍历的函数，停止函数返回时遍历协程已经退出。
+func prefetch(files iter.Seq[*models.FileInfo]) (func() (*models.FileInfo, bool), func()) {
+	ch := make(chan *models.FileInfo, prefetchSize)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for file := range files {
+			select {
+			case ch <- file:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	next := func() (*models.FileInfo, bool) {
+		file, ok := <-ch
+		return file, ok
+	}
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+			for range ch {
+			}
+		})
+	}
+	return next, stop
+}
@@ -0,0 +1,185 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// Rescanner 可以增量重新扫描的数据源（实时扫描的目录），见 scanner.FileScanner.RescanContext
+type Rescanner interface {
+	RescanContext(ctx context.Context, path string) error
+}
+
+// View 两侧对比结果的增量视图，用于持续监测
+//
+// 创建时完整对比一次，之后通过 Rescan 只重新扫描和对比发生变化的路径。
+// View 不是并发安全的，Rescan 和其他方法需要在同一个协程中调用。
+type View struct {
+	rules   *Rules
+	renames bool
+	paths   map[string]string // 两侧的路径（目录或清单文件）
+	sources map[string]Source // 两侧的数据源
+
+	results map[string]*models.DiffResult // 不含重命名配对的对比结果，以路径为键
+	index   map[string]string             // 当前结果（含重命名配对）的签名，以路径为键
+	errors  []*models.ScanError
+}
+
+// NewView 完整对比两个目录（或清单），返回可以增量更新的视图
+func (c *Comparer) NewView(ctx context.Context, leftPath, rightPath string) (*View, error) {
+	leftScanner, rightScanner, tracker, err := c.openSources(leftPath, rightPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := scanSources(ctx, leftScanner, rightScanner, tracker); err != nil {
+		return nil, err
+	}
+	c.errors = collectErrors(leftScanner, rightScanner)
+
+	v := &View{
+		rules:   c.rules(),
+		renames: c.options.DetectRenames,
+		paths:   map[string]string{models.SideLeft: leftPath, models.SideRight: rightPath},
+		sources: map[string]Source{models.SideLeft: leftScanner, models.SideRight: rightScanner},
+		results: make(map[string]*models.DiffResult),
+		errors:  c.errors,
+	}
+	for _, result := range v.rules.compareAll(leftScanner, rightScanner) {
+		v.results[result.Path] = result
+	}
+	v.index = indexResults(v.Results())
+	return v, nil
+}
+
+// Path 返回一侧（models.SideLeft 或 models.SideRight）的目录或清单文件路径
+func (v *View) Path(side string) string {
+	return v.paths[side]
+}
+
+// Files 返回一侧当前扫描到的条目（以相对路径为键），调用方不能修改
+func (v *View) Files(side string) map[string]*models.FileInfo {
+	return v.sources[side].GetFiles()
+}
+
+// Live 判断一侧是否是实时扫描的目录（清单文件不会变化，不需要监测）
+func (v *View) Live(side string) bool {
+	_, ok := v.sources[side].(Rescanner)
+	return ok
+}
+
+// Results 返回当前的对比结果，按 scanner.ComparePaths 的顺序排列
+func (v *View) Results() []*models.DiffResult {
+	paths := slices.SortedFunc(maps.Keys(v.results), scanner.ComparePaths)
+	results := make([]*models.DiffResult, 0, len(paths))
+	for _, path := range paths {
+		results = append(results, v.results[path])
+	}
+	if v.renames {
+		results = v.rules.detectRenames(results)
+	}
+	return results
+}
+
+// Errors 返回当前两侧的扫描错误（先左侧后右侧，各自按路径排序）
+func (v *View) Errors() []*models.ScanError {
+	return v.errors
+}
+
+// Rescan 重新扫描两侧发生变化的路径（相对路径，空字符串表示整个目录）并更新对比结果
+//
+// 返回状态或差异发生变化的结果（包括变为未变更的结果），按 scanner.ComparePaths 的顺序排列；
+// 两侧都已不存在的路径不在返回值中。检测重命名时配对可能涉及任意路径，
+// 需要重新配对全部新增和删除的文件，未检测重命名时只重新对比受影响的路径。
+func (v *View) Rescan(ctx context.Context, left, right []string) ([]*models.DiffResult, error) {
+	prefixes := make(map[string]bool)
+	for side, paths := range map[string][]string{models.SideLeft: left, models.SideRight: right} {
+		if len(paths) == 0 {
+			continue
+		}
+		rescanner, ok := v.sources[side].(Rescanner)
+		if !ok {
+			return nil, fmt.Errorf("%s 不是目录，无法重新扫描", v.paths[side])
+		}
+		for _, path := range paths {
+			if err := rescanner.RescanContext(ctx, path); err != nil {
+				return nil, err
+			}
+			prefixes[path] = true
+		}
+	}
+	leftScanner, rightScanner := v.sources[models.SideLeft], v.sources[models.SideRight]
+	v.errors = collectErrors(leftScanner, rightScanner)
+
+	// 受影响的路径：变化的路径之下原有的和现有的条目
+	leftFiles, rightFiles := leftScanner.GetFiles(), rightScanner.GetFiles()
+	affected := make(map[string]bool)
+	for _, paths := range []iter.Seq[string]{maps.Keys(v.results), maps.Keys(leftFiles), maps.Keys(rightFiles)} {
+		for path := range paths {
+			if !affected[path] && scanner.WithinAny(path, prefixes) {
+				affected[path] = true
+			}
+		}
+	}
+
+	for path := range affected {
+		leftFile, rightFile := leftFiles[path], rightFiles[path]
+		if leftFile == nil && rightFile == nil {
+			delete(v.results, path)
+			continue
+		}
+		v.results[path] = v.rules.compareEntry(path, leftFile, rightFile, leftScanner, rightScanner)
+	}
+
+	if v.renames {
+		results := v.Results()
+		index := indexResults(results)
+		changed := changedResults(v.index, index, results)
+		v.index = index
+		return changed, nil
+	}
+
+	var changed []*models.DiffResult
+	for _, path := range slices.SortedFunc(maps.Keys(affected), scanner.ComparePaths) {
+		result, ok := v.results[path]
+		if !ok {
+			delete(v.index, path)
+			continue
+		}
+		if signature := resultSignature(result); v.index[path] != signature {
+			v.index[path] = signature
+			changed = append(changed, result)
+		}
+	}
+	return changed, nil
+}
+
+// resultSignature 返回结果的签名（状态、原路径和差异），签名不同表示结果发生了变化
+func resultSignature(result *models.DiffResult) string {
+	return fmt.Sprintf("%s %s %v", result.Status, result.OldPath, result.Differences)
+}
+
+// indexResults 以路径为键记录每个结果的签名
+func indexResults(results []*models.DiffResult) map[string]string {
+	index := make(map[string]string, len(results))
+	for _, result := range results {
+		index[result.Path] = resultSignature(result)
+	}
+	return index
+}
+
+// changedResults 返回签名与 previous 中不同的结果
+func changedResults(previous, current map[string]string, results []*models.DiffResult) []*models.DiffResult {
+	var changed []*models.DiffResult
+	for _, result := range results {
+		if previous[result.Path] != current[result.Path] {
+			changed = append(changed, result)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,10 @@
+//go:build linux || openbsd || dragonfly || solaris || illumos
+
+package hashcache
+
+import "syscall"
+
+// changeTime 返回 inode 的变更时间（纳秒）
+func changeTime(st *syscall.Stat_t) int64 {
+	return st.Ctim.Nano()
+}
@@ -0,0 +1,10 @@
+//go:build darwin || ios || freebsd || netbsd
+
+package hashcache
+
+import "syscall"
+
+// changeTime 返回 inode 的变更时间（纳秒）
+func changeTime(st *syscall.Stat_t) int64 {
+	return st.Ctimespec.Nano()
+}
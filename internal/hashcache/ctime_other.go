@@ -0,0 +1,10 @@
+//go:build unix && !(linux || openbsd || dragonfly || solaris || illumos || darwin || ios || freebsd || netbsd)
+
+package hashcache
+
+import "syscall"
+
+// changeTime 当前平台无法获取 inode 的变更时间，缓存键只使用修改时间
+func changeTime(st *syscall.Stat_t) int64 {
+	return 0
+}
@@ -0,0 +1,275 @@
+package hashcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// cacheVersion 缓存文件格式版本（2 起缓存键包含 inode 的变更时间）
+const cacheVersion = 2
+
+// DefaultFileName 默认的缓存文件名（位于配置文件所在目录）
+const DefaultFileName = "file_syn.hashcache.json"
+
+// Entry 缓存条目：文件的 stat 信息与对应的内容摘要
+type Entry struct {
+	Path      string `json:"path"`     // 最近一次记录时的绝对路径（用于清理）
+	Dev       uint64 `json:"dev"`      // 设备号
+	Ino       uint64 `json:"ino"`      // inode 号
+	Size      int64  `json:"size"`     // 文件大小
+	ModTimeNs int64  `json:"mtime_ns"` // 修改时间（纳秒）
+	ChangeNs  int64  `json:"ctime_ns"` // inode 的变更时间（纳秒），改写内容后恢复修改时间也会使其变化
+	Algo      string `json:"algo"`     // 摘要算法
+	Digest    string `json:"digest"`   // 内容摘要
+}
+
+// cacheFile 缓存文件的磁盘格式
+type cacheFile struct {
+	Version int      `json:"version"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Cache 以 设备号+inode+大小+修改时间+变更时间 为键的持久化摘要缓存
+//
+// 同一进程内可以并发读写。写入磁盘时会对 <path>.lock 加排他锁，
+// 重新读取磁盘上的内容并与内存中的条目合并，再原子替换缓存文件，
+// 因此多个进程同时保存时不会互相覆盖对方新增的条目。
+type Cache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]*Entry
+	updated map[string]*Entry // 本次运行新增或更新的条目
+}
+
+// DefaultPath 返回配置文件旁边的默认缓存路径
+//
+// 没有配置文件时（只通过命令行参数运行）使用用户缓存目录下的 file_syn/ 目录。
+func DefaultPath(configPath string) string {
+	if configPath == "" {
+		cacheDir, err := os.UserCacheDir()
+		if err != nil {
+			return DefaultFileName
+		}
+		return filepath.Join(cacheDir, "file_syn", DefaultFileName)
+	}
+	return filepath.Join(filepath.Dir(configPath), DefaultFileName)
+}
+
+// Open 打开缓存文件，文件不存在时返回空缓存
+func Open(path string) (*Cache, error) {
+	c := &Cache{
+		path:    path,
+		entries: make(map[string]*Entry),
+		updated: make(map[string]*Entry),
+	}
+	entries, err := readEntries(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		c.entries[entry.key()] = entry
+	}
+	return c, nil
+}
+
+// Path 返回缓存文件路径
+func (c *Cache) Path() string {
+	return c.path
+}
+
+// Len 返回缓存条目数量
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Lookup 查找文件的缓存摘要，stat 信息发生变化时视为未命中
+func (c *Cache) Lookup(path string, info os.FileInfo, algo string) (string, bool) {
+	key := newEntry(path, info, algo, "").key()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	return entry.Digest, true
+}
+
+// Store 记录文件的摘要
+func (c *Cache) Store(path string, info os.FileInfo, algo, digest string) {
+	entry := newEntry(path, info, algo, digest)
+	key := entry.key()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	c.updated[key] = entry
+}
+
+// Save 将本次运行新增的条目合并写入缓存文件
+func (c *Cache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.updated) == 0 {
+		return nil
+	}
+
+	err := c.withLock(func(onDisk map[string]*Entry) (map[string]*Entry, error) {
+		for key, entry := range c.updated {
+			onDisk[key] = entry
+		}
+		return onDisk, nil
+	})
+	if err != nil {
+		return err
+	}
+	c.updated = make(map[string]*Entry)
+	return nil
+}
+
+// Prune 删除文件已不存在或 stat 信息已变化的条目，返回删除的条目数量
+func (c *Cache) Prune() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	err := c.withLock(func(onDisk map[string]*Entry) (map[string]*Entry, error) {
+		for key, entry := range c.updated {
+			onDisk[key] = entry
+		}
+		kept := make(map[string]*Entry, len(onDisk))
+		for key, entry := range onDisk {
+			info, err := os.Stat(entry.Path)
+			if err != nil || newEntry(entry.Path, info, entry.Algo, "").key() != key {
+				removed++
+				continue
+			}
+			kept[key] = entry
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	c.updated = make(map[string]*Entry)
+	return removed, nil
+}
+
+// withLock 在文件锁保护下读取磁盘上的缓存，交给 fn 修改后原子写回
+func (c *Cache) withLock(fn func(map[string]*Entry) (map[string]*Entry, error)) error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("无法创建缓存目录: %v", err)
+	}
+
+	lock, err := os.OpenFile(c.path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("无法打开缓存锁文件: %v", err)
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("无法锁定缓存文件: %v", err)
+	}
+	defer unlockFile(lock)
+
+	entries, err := readEntries(c.path)
+	if err != nil {
+		return err
+	}
+	onDisk := make(map[string]*Entry, len(entries))
+	for _, entry := range entries {
+		onDisk[entry.key()] = entry
+	}
+
+	merged, err := fn(onDisk)
+	if err != nil {
+		return err
+	}
+	if err := writeEntries(c.path, merged); err != nil {
+		return err
+	}
+	c.entries = merged
+	return nil
+}
+
+// newEntry 根据文件信息创建缓存条目
+func newEntry(path string, info os.FileInfo, algo, digest string) *Entry {
+	dev, ino, ctime, _ := fileID(info)
+	return &Entry{
+		Path:      path,
+		Dev:       dev,
+		Ino:       ino,
+		Size:      info.Size(),
+		ModTimeNs: info.ModTime().UnixNano(),
+		ChangeNs:  ctime,
+		Algo:      algo,
+		Digest:    digest,
+	}
+}
+
+// key 返回条目的缓存键，无法获取 inode 的平台使用路径代替
+func (e *Entry) key() string {
+	if e.Dev == 0 && e.Ino == 0 {
+		return fmt.Sprintf("%s:%s:%d:%d", e.Algo, e.Path, e.Size, e.ModTimeNs)
+	}
+	return fmt.Sprintf("%s:%d:%d:%d:%d:%d", e.Algo, e.Dev, e.Ino, e.Size, e.ModTimeNs, e.ChangeNs)
+}
+
+// readEntries 读取缓存文件中的所有条目，文件不存在时返回空列表
+func readEntries(path string) ([]*Entry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取缓存文件 %s: %v", path, err)
+	}
+
+	var file cacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("无法解析缓存文件 %s: %v", path, err)
+	}
+	if file.Version != cacheVersion {
+		// 版本不兼容时丢弃旧缓存，摘要会在下次扫描时重新计算
+		return nil, nil
+	}
+	return file.Entries, nil
+}
+
+// writeEntries 原子地写入缓存文件
+func writeEntries(path string, entries map[string]*Entry) error {
+	file := cacheFile{
+		Version: cacheVersion,
+		Entries: make([]*Entry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		file.Entries = append(file.Entries, entry)
+	}
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("无法序列化缓存: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".hashcache-*.tmp")
+	if err != nil {
+		return fmt.Errorf("无法创建临时文件: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入缓存文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入缓存文件失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("替换缓存文件失败: %v", err)
+	}
+	return nil
+}
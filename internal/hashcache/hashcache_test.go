@@ -0,0 +1,158 @@
+package hashcache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createFile 创建测试文件并返回其 stat 信息
+func createFile(t *testing.T, path, content string) os.FileInfo {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("无法创建测试文件: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("无法读取文件信息: %v", err)
+	}
+	return info
+}
+
+func TestCacheLookupAndSave(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, "cache", DefaultFileName)
+	filePath := filepath.Join(tmpDir, "data.txt")
+	info := createFile(t, filePath, "hello")
+
+	cache, err := Open(cachePath)
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	if _, ok := cache.Lookup(filePath, info, "sha256"); ok {
+		t.Error("空缓存不应命中")
+	}
+	cache.Store(filePath, info, "sha256", "digest-1")
+	if err := cache.Save(); err != nil {
+		t.Fatalf("保存缓存失败: %v", err)
+	}
+
+	// 重新打开后应命中
+	cache, err = Open(cachePath)
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	if digest, ok := cache.Lookup(filePath, info, "sha256"); !ok || digest != "digest-1" {
+		t.Errorf("期望命中 digest-1，实际 %q %v", digest, ok)
+	}
+	if _, ok := cache.Lookup(filePath, info, "sha512"); ok {
+		t.Error("不同算法不应命中")
+	}
+
+	// 修改时间变化后不应命中
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(filePath, later, later); err != nil {
+		t.Fatalf("无法设置修改时间: %v", err)
+	}
+	changed, _ := os.Stat(filePath)
+	if _, ok := cache.Lookup(filePath, changed, "sha256"); ok {
+		t.Error("修改时间变化后不应命中")
+	}
+}
+
+func TestCacheInPlaceRewrite(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "data.txt")
+	info := createFile(t, filePath, "hello")
+
+	cache, err := Open(filepath.Join(tmpDir, DefaultFileName))
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	cache.Store(filePath, info, "sha256", "digest-1")
+
+	// 原地改写为相同大小的内容并恢复修改时间，inode 的变更时间仍会变化
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(filePath, []byte("world"), 0644); err != nil {
+		t.Fatalf("无法改写文件: %v", err)
+	}
+	if err := os.Chtimes(filePath, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("无法设置修改时间: %v", err)
+	}
+	rewritten, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewritten.Size() != info.Size() || !rewritten.ModTime().Equal(info.ModTime()) {
+		t.Fatalf("大小或修改时间未恢复")
+	}
+	if _, _, _, ok := fileID(rewritten); !ok {
+		t.Skip("当前平台无法获取 inode 的变更时间")
+	}
+	if _, ok := cache.Lookup(filePath, rewritten, "sha256"); ok {
+		t.Error("原地改写后恢复修改时间不应命中")
+	}
+}
+
+func TestCacheConcurrentSave(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, DefaultFileName)
+	pathA := filepath.Join(tmpDir, "a.txt")
+	pathB := filepath.Join(tmpDir, "b.txt")
+	infoA := createFile(t, pathA, "a")
+	infoB := createFile(t, pathB, "b")
+
+	// 两个进程各自打开缓存并写入不同条目，后保存的一方不应覆盖前者
+	first, err := Open(cachePath)
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	second, err := Open(cachePath)
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	first.Store(pathA, infoA, "sha256", "digest-a")
+	second.Store(pathB, infoB, "sha256", "digest-b")
+	if err := first.Save(); err != nil {
+		t.Fatalf("保存缓存失败: %v", err)
+	}
+	if err := second.Save(); err != nil {
+		t.Fatalf("保存缓存失败: %v", err)
+	}
+
+	cache, err := Open(cachePath)
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	if cache.Len() != 2 {
+		t.Errorf("期望 2 个缓存条目，实际 %d 个", cache.Len())
+	}
+}
+
+func TestCachePrune(t *testing.T) {
+	tmpDir := t.TempDir()
+	cachePath := filepath.Join(tmpDir, DefaultFileName)
+	keepPath := filepath.Join(tmpDir, "keep.txt")
+	gonePath := filepath.Join(tmpDir, "gone.txt")
+
+	cache, err := Open(cachePath)
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	cache.Store(keepPath, createFile(t, keepPath, "keep"), "sha256", "digest-keep")
+	cache.Store(gonePath, createFile(t, gonePath, "gone"), "sha256", "digest-gone")
+	if err := cache.Save(); err != nil {
+		t.Fatalf("保存缓存失败: %v", err)
+	}
+	if err := os.Remove(gonePath); err != nil {
+		t.Fatalf("无法删除文件: %v", err)
+	}
+
+	removed, err := cache.Prune()
+	if err != nil {
+		t.Fatalf("清理缓存失败: %v", err)
+	}
+	if removed != 1 || cache.Len() != 1 {
+		t.Errorf("期望删除 1 个条目并保留 1 个，实际删除 %d 个，保留 %d 个", removed, cache.Len())
+	}
+}
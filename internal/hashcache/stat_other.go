@@ -0,0 +1,20 @@
+//go:build !unix
+
+package hashcache
+
+import "os"
+
+// fileID 当前平台无法获取 inode 和变更时间，缓存键退化为文件路径和修改时间
+func fileID(info os.FileInfo) (dev, ino uint64, ctimeNs int64, ok bool) {
+	return 0, 0, 0, false
+}
+
+// lockFile 当前平台不支持 flock，多个进程同时写入时以最后一次写入为准
+func lockFile(f *os.File) error {
+	return nil
+}
+
+// unlockFile 当前平台不支持 flock
+func unlockFile(f *os.File) error {
+	return nil
+}
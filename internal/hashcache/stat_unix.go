@@ -0,0 +1,27 @@
+//go:build unix
+
+package hashcache
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID 返回文件所在设备号、inode 号和 inode 的变更时间（纳秒）
+func fileID(info os.FileInfo) (dev, ino uint64, ctimeNs int64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), changeTime(st), true
+}
+
+// lockFile 对文件加排他锁（阻塞直到获得锁）
+func lockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+}
+
+// unlockFile 释放文件锁
+func unlockFile(f *os.File) error {
+	return syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+}
@@ -0,0 +1,80 @@
+package hasher
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// DefaultAlgorithm 默认的摘要算法
+const DefaultAlgorithm = "sha256"
+
+var (
+	mu         sync.RWMutex
+	algorithms = map[string]func() hash.Hash{
+		"md5":    md5.New,
+		"sha1":   sha1.New,
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+)
+
+// Register 注册摘要算法，已存在的同名算法会被覆盖
+func Register(name string, fn func() hash.Hash) {
+	mu.Lock()
+	defer mu.Unlock()
+	algorithms[name] = fn
+}
+
+// Algorithms 返回所有已注册的算法名称（已排序）
+func Algorithms() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(algorithms))
+	for name := range algorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New 根据算法名称创建哈希函数
+func New(algo string) (hash.Hash, error) {
+	mu.RLock()
+	fn, ok := algorithms[algo]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的摘要算法: %s（可选: %v）", algo, Algorithms())
+	}
+	return fn(), nil
+}
+
+// HashFile 计算文件内容的摘要，返回十六进制字符串
+func HashFile(path, algo string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return HashReader(f, algo)
+}
+
+// HashReader 计算读取到的全部内容的摘要，返回十六进制字符串
+func HashReader(r io.Reader, algo string) (string, error) {
+	h, err := New(algo)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,51 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "data.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatalf("无法创建测试文件: %v", err)
+	}
+
+	digest, err := HashFile(path, DefaultAlgorithm)
+	if err != nil {
+		t.Fatalf("计算摘要失败: %v", err)
+	}
+	expected := "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"
+	if digest != expected {
+		t.Errorf("sha256 摘要错误: 期望 %s，实际 %s", expected, digest)
+	}
+
+	if digest, err := HashReader(strings.NewReader("hello"), DefaultAlgorithm); err != nil || digest != expected {
+		t.Errorf("HashReader 摘要错误: %s, %v", digest, err)
+	}
+
+	if _, err := HashFile(path, "unknown"); err == nil {
+		t.Error("不支持的算法应该返回错误")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("custom", sha256.New224)
+	if _, err := New("custom"); err != nil {
+		t.Errorf("注册后的算法应该可用: %v", err)
+	}
+
+	found := false
+	for _, name := range Algorithms() {
+		if name == "custom" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Algorithms 应该包含已注册的算法")
+	}
+}
@@ -0,0 +1,250 @@
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// DefaultFileName 默认的目录级忽略文件名
+const DefaultFileName = ".filesynignore"
+
+// rule 单条忽略规则
+type rule struct {
+	pattern string         // 原始规则文本
+	base    string         // 规则所在目录（相对扫描根目录，根目录为空字符串）
+	negate  bool           // 以 ! 开头：重新包含之前被排除的路径
+	dirOnly bool           // 以 / 结尾：只匹配目录
+	re      *regexp.Regexp // 编译后的匹配表达式（匹配相对 base 的路径）
+}
+
+// Matcher 按照 .gitignore 语义匹配路径
+//
+// 规则按添加顺序求值，最后一条匹配的规则决定结果。Matcher 创建后不再修改，
+// WithFile/WithPatterns 返回包含新规则的副本，便于每个目录继承父目录的规则。
+type Matcher struct {
+	rules     []*rule
+	overrides []*rule // 始终最后求值的规则（配置中的 include）
+}
+
+// New 根据配置中的排除和包含规则创建匹配器
+//
+// exclude 中的每一项都是一行 .gitignore 规则（可以用 ! 取反）；
+// include 中的规则会重新包含被排除的路径，优先级高于所有目录级忽略文件。
+func New(exclude, include []string) (*Matcher, error) {
+	m := &Matcher{}
+	for _, line := range exclude {
+		r, err := parseRule(line, "")
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			m.rules = append(m.rules, r)
+		}
+	}
+	for _, line := range include {
+		r, err := parseRule(line, "")
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			r.negate = !r.negate
+			m.overrides = append(m.overrides, r)
+		}
+	}
+	return m, nil
+}
+
+// WithPatterns 返回追加了 base 目录下规则的新匹配器
+func (m *Matcher) WithPatterns(base string, lines []string) (*Matcher, error) {
+	var added []*rule
+	for _, line := range lines {
+		r, err := parseRule(line, base)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			added = append(added, r)
+		}
+	}
+	if len(added) == 0 {
+		return m, nil
+	}
+
+	rules := make([]*rule, 0, len(m.rules)+len(added))
+	rules = append(rules, m.rules...)
+	rules = append(rules, added...)
+	return &Matcher{rules: rules, overrides: m.overrides}, nil
+}
+
+// WithFile 读取目录下的忽略文件并返回追加了其规则的新匹配器，文件不存在时返回自身
+func (m *Matcher) WithFile(base, path string) (*Matcher, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return m, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return m, err
+	}
+
+	next, err := m.WithPatterns(base, lines)
+	if err != nil {
+		return m, fmt.Errorf("%s: %v", path, err)
+	}
+	return next, nil
+}
+
+// Match 判断相对路径（以 / 分隔）是否被排除
+func (m *Matcher) Match(relPath string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	excluded := false
+	for _, r := range m.rules {
+		if r.match(relPath, isDir) {
+			excluded = !r.negate
+		}
+	}
+	for _, r := range m.overrides {
+		if r.match(relPath, isDir) {
+			excluded = !r.negate
+		}
+	}
+	return excluded
+}
+
+// match 判断规则是否匹配路径
+func (r *rule) match(relPath string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(relPath, r.base+"/") {
+			return false
+		}
+		relPath = relPath[len(r.base)+1:]
+	}
+	return r.re.MatchString(relPath)
+}
+
+// parseRule 解析一行 .gitignore 规则，空行和注释返回 nil
+func parseRule(line, base string) (*rule, error) {
+	line = trimTrailingSpaces(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, nil
+	}
+
+	r := &rule{pattern: line, base: base}
+	if strings.HasPrefix(line, "!") {
+		r.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+
+	// 开头或中间包含 / 的规则相对 base 目录锚定，否则匹配任意层级
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	expr, err := globToRegexp(line)
+	if err != nil {
+		return nil, fmt.Errorf("无效的规则 %q: %v", r.pattern, err)
+	}
+	if anchored {
+		expr = "^" + expr + "$"
+	} else {
+		expr = "^(?:.*/)?" + expr + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的规则 %q: %v", r.pattern, err)
+	}
+	r.re = re
+	return r, nil
+}
+
+// globToRegexp 将 .gitignore 通配符转换为正则表达式
+//
+//	**/   匹配零个或多个目录
+//	/**   匹配目录下的所有内容
+//	*     匹配除 / 之外的任意字符
+//	?     匹配除 / 之外的单个字符
+//	[...] 字符集合（[!...] 表示取反）
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**") {
+				atStart := i == 0 || glob[i-1] == '/'
+				rest := glob[i+2:]
+				switch {
+				case atStart && strings.HasPrefix(rest, "/"):
+					b.WriteString("(?:.*/)?")
+					i += 2
+					continue
+				case atStart && rest == "":
+					b.WriteString(".*")
+					i++
+					continue
+				}
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("未闭合的 [")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
+
+// trimTrailingSpaces 去掉行尾未转义的空格
+func trimTrailingSpaces(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-2] + " "
+	}
+	return line
+}
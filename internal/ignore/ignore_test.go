@@ -0,0 +1,117 @@
+package ignore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		path     string
+		isDir    bool
+		excluded bool
+	}{
+		// 不含 / 的规则匹配任意层级
+		{[]string{"*.swp"}, "a.swp", false, true},
+		{[]string{"*.swp"}, "src/deep/.a.swp", false, true},
+		{[]string{"node_modules"}, "web/node_modules", true, true},
+		{[]string{"*.log"}, "logs/app.txt", false, false},
+
+		// 以 / 开头或中间含 / 的规则相对根目录锚定
+		{[]string{"/build"}, "build", true, true},
+		{[]string{"/build"}, "src/build", true, false},
+		{[]string{"doc/*.pdf"}, "doc/a.pdf", false, true},
+		{[]string{"doc/*.pdf"}, "x/doc/a.pdf", false, false},
+		{[]string{"doc/*.pdf"}, "doc/sub/a.pdf", false, false},
+
+		// 以 / 结尾的规则只匹配目录
+		{[]string{"out/"}, "out", true, true},
+		{[]string{"out/"}, "out", false, false},
+
+		// ** 通配
+		{[]string{"**/cache"}, "cache", true, true},
+		{[]string{"**/cache"}, "a/b/cache", true, true},
+		{[]string{"a/**/b"}, "a/b", false, true},
+		{[]string{"a/**/b"}, "a/x/y/b", false, true},
+		{[]string{"logs/**"}, "logs/2024/app.log", false, true},
+		{[]string{"logs/**"}, "logs", true, false},
+
+		// ! 取反，最后一条匹配的规则生效
+		{[]string{"*.log", "!keep.log"}, "keep.log", false, false},
+		{[]string{"*.log", "!keep.log"}, "drop.log", false, true},
+		{[]string{"!keep.log", "*.log"}, "keep.log", false, true},
+
+		// 注释、转义和字符集合
+		{[]string{"# comment"}, "# comment", false, false},
+		{[]string{`\#hash`}, "#hash", false, true},
+		{[]string{"file[0-9].txt"}, "file7.txt", false, true},
+		{[]string{"file[!0-9].txt"}, "file7.txt", false, false},
+		{[]string{"?.txt"}, "a.txt", false, true},
+		{[]string{"?.txt"}, "ab.txt", false, false},
+	}
+
+	for _, tt := range tests {
+		m, err := New(tt.patterns, nil)
+		if err != nil {
+			t.Fatalf("解析规则 %v 失败: %v", tt.patterns, err)
+		}
+		if got := m.Match(tt.path, tt.isDir); got != tt.excluded {
+			t.Errorf("规则 %v 匹配 %s (目录=%v): 期望 %v，实际 %v", tt.patterns, tt.path, tt.isDir, tt.excluded, got)
+		}
+	}
+}
+
+func TestIncludeOverrides(t *testing.T) {
+	m, err := New([]string{"*.log"}, []string{"important.log"})
+	if err != nil {
+		t.Fatalf("解析规则失败: %v", err)
+	}
+	// 目录级忽略文件中的规则也无法覆盖配置中的 include
+	m, err = m.WithPatterns("sub", []string{"important.log"})
+	if err != nil {
+		t.Fatalf("解析规则失败: %v", err)
+	}
+	if m.Match("sub/important.log", false) {
+		t.Error("include 规则应该重新包含 important.log")
+	}
+	if !m.Match("sub/other.log", false) {
+		t.Error("other.log 应该被排除")
+	}
+}
+
+func TestWithFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, DefaultFileName)
+	content := "# 子目录规则\n/local.txt\ntmp/\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("无法创建忽略文件: %v", err)
+	}
+
+	root, err := New(nil, nil)
+	if err != nil {
+		t.Fatalf("创建匹配器失败: %v", err)
+	}
+	m, err := root.WithFile("sub", path)
+	if err != nil {
+		t.Fatalf("读取忽略文件失败: %v", err)
+	}
+
+	// 规则相对所在目录锚定
+	if !m.Match("sub/local.txt", false) {
+		t.Error("sub/local.txt 应该被排除")
+	}
+	if m.Match("local.txt", false) || m.Match("other/local.txt", false) {
+		t.Error("子目录的规则不应影响其他目录")
+	}
+	if !m.Match("sub/a/tmp", true) {
+		t.Error("sub/a/tmp 应该被排除")
+	}
+
+	// 不存在的忽略文件不影响匹配器
+	same, err := root.WithFile("", filepath.Join(tmpDir, "missing"))
+	if err != nil || same != root {
+		t.Errorf("不存在的忽略文件应返回原匹配器: %v", err)
+	}
+}
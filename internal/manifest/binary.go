@@ -0,0 +1,337 @@
+package manifest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"time"
+
+	"file_syn/pkg/models"
+)
+
+// binaryMagic 二进制清单的开头
+//
+// 二进制清单的布局：magic、版本号（uvarint）、清单头（uvarint 长度 + 不含条目的 JSON）、
+// 条目数（uvarint）和各个条目。条目的路径只保存与前一个路径不同的后缀，
+// 摘要以原始字节保存，整数使用变长编码。
+var binaryMagic = []byte("FSMF")
+
+// 条目标志位
+const (
+	flagDir = 1 << iota
+	flagSymlink
+	flagDigest
+	flagMeta
+)
+
+// 扩展元数据的收集标志位
+const (
+	metaOwner = 1 << iota
+	metaSpecial
+	metaXattrs
+	metaACL
+)
+
+// maxFieldSize 单个字段的最大长度，防止损坏的清单导致分配过多内存
+const maxFieldSize = 64 << 20
+
+// binaryWriter 写出二进制字段，出错后忽略后续写入
+type binaryWriter struct {
+	w   *bufio.Writer
+	buf []byte
+	err error
+}
+
+func (bw *binaryWriter) write(p []byte) {
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(p)
+	}
+}
+
+func (bw *binaryWriter) uvarint(v uint64) {
+	bw.write(binary.AppendUvarint(bw.buf[:0], v))
+}
+
+func (bw *binaryWriter) varint(v int64) {
+	bw.write(binary.AppendVarint(bw.buf[:0], v))
+}
+
+func (bw *binaryWriter) bytes(p []byte) {
+	bw.uvarint(uint64(len(p)))
+	bw.write(p)
+}
+
+func (bw *binaryWriter) string(s string) {
+	bw.bytes([]byte(s))
+}
+
+// writeBinary 以二进制格式写出清单
+func (m *Manifest) writeBinary(w io.Writer) error {
+	header := *m
+	header.Entries = nil
+	headerJSON, err := json.Marshal(&header)
+	if err != nil {
+		return fmt.Errorf("无法写出清单: %v", err)
+	}
+
+	bw := &binaryWriter{w: bufio.NewWriter(w), buf: make([]byte, binary.MaxVarintLen64)}
+	bw.write(binaryMagic)
+	bw.uvarint(uint64(m.Version))
+	bw.bytes(headerJSON)
+	bw.uvarint(uint64(len(m.Entries)))
+	prev := ""
+	for _, e := range m.Entries {
+		if err := bw.entry(e, prev); err != nil {
+			return fmt.Errorf("无法写出清单条目 %s: %v", e.Path, err)
+		}
+		prev = e.Path
+	}
+	if bw.err == nil {
+		bw.err = bw.w.Flush()
+	}
+	if bw.err != nil {
+		return fmt.Errorf("无法写出清单: %v", bw.err)
+	}
+	return nil
+}
+
+// entry 写出一个条目，路径只保存与 prev 的公共前缀长度和不同的后缀
+func (bw *binaryWriter) entry(e *Entry, prev string) error {
+	shared := 0
+	for shared < len(prev) && shared < len(e.Path) && prev[shared] == e.Path[shared] {
+		shared++
+	}
+	var digest []byte
+	if e.Digest != "" {
+		var err error
+		if digest, err = hex.DecodeString(e.Digest); err != nil {
+			return fmt.Errorf("无效的摘要: %v", err)
+		}
+	}
+
+	var flags byte
+	if e.IsDir {
+		flags |= flagDir
+	}
+	if e.IsSymlink {
+		flags |= flagSymlink
+	}
+	if digest != nil {
+		flags |= flagDigest
+	}
+	if e.Meta != nil {
+		flags |= flagMeta
+	}
+
+	bw.uvarint(uint64(shared))
+	bw.string(e.Path[shared:])
+	bw.write([]byte{flags})
+	bw.uvarint(uint64(e.Mode))
+	bw.varint(e.Size)
+	bw.varint(e.ModTime.Unix())
+	bw.uvarint(uint64(e.ModTime.Nanosecond()))
+	if e.IsSymlink {
+		bw.string(e.LinkTarget)
+	}
+	if digest != nil {
+		bw.bytes(digest)
+	}
+	if e.Meta != nil {
+		bw.metadata(e.Meta)
+	}
+	return nil
+}
+
+// metadata 写出扩展元数据，只写出收集了的属性
+func (bw *binaryWriter) metadata(meta *models.Metadata) {
+	var collected byte
+	if meta.Collected.Owner {
+		collected |= metaOwner
+	}
+	if meta.Collected.Special {
+		collected |= metaSpecial
+	}
+	if meta.Collected.Xattrs {
+		collected |= metaXattrs
+	}
+	if meta.Collected.ACL {
+		collected |= metaACL
+	}
+	bw.write([]byte{collected})
+	if meta.Collected.Owner {
+		bw.uvarint(uint64(meta.UID))
+		bw.uvarint(uint64(meta.GID))
+	}
+	if meta.Collected.Xattrs {
+		bw.uvarint(uint64(len(meta.Xattrs)))
+		for _, name := range slices.Sorted(maps.Keys(meta.Xattrs)) {
+			bw.string(name)
+			bw.bytes(meta.Xattrs[name])
+		}
+	}
+	if meta.Collected.ACL {
+		bw.string(meta.ACL)
+	}
+}
+
+// binaryReader 读取二进制字段，出错后后续读取返回零值
+type binaryReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (br *binaryReader) fail(err error) {
+	if br.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		br.err = err
+	}
+}
+
+func (br *binaryReader) byte() byte {
+	if br.err != nil {
+		return 0
+	}
+	b, err := br.r.ReadByte()
+	br.fail(err)
+	return b
+}
+
+func (br *binaryReader) uvarint() uint64 {
+	if br.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(br.r)
+	br.fail(err)
+	return v
+}
+
+func (br *binaryReader) varint() int64 {
+	if br.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(br.r)
+	br.fail(err)
+	return v
+}
+
+func (br *binaryReader) bytes() []byte {
+	n := br.uvarint()
+	if br.err != nil {
+		return nil
+	}
+	if n > maxFieldSize {
+		br.fail(fmt.Errorf("字段长度 %d 超出限制", n))
+		return nil
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(br.r, p)
+	br.fail(err)
+	return p
+}
+
+func (br *binaryReader) string() string {
+	return string(br.bytes())
+}
+
+// readBinary 读取二进制格式的清单
+func readBinary(r *bufio.Reader) (*Manifest, error) {
+	br := &binaryReader{r: r}
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, err
+	}
+	if version := br.uvarint(); br.err == nil && version != Version {
+		return nil, fmt.Errorf("不支持的清单版本: %d", version)
+	}
+	headerJSON := br.bytes()
+	if br.err != nil {
+		return nil, br.err
+	}
+	var m Manifest
+	if err := json.Unmarshal(headerJSON, &m); err != nil {
+		return nil, fmt.Errorf("无效的清单头: %v", err)
+	}
+
+	count := br.uvarint()
+	if br.err != nil {
+		return nil, br.err
+	}
+	m.Entries = make([]*Entry, 0, min(count, 1<<20))
+	prev := ""
+	for i := uint64(0); i < count; i++ {
+		e := br.entry(prev)
+		if br.err != nil {
+			return nil, fmt.Errorf("第 %d 个条目: %v", i+1, br.err)
+		}
+		m.Entries = append(m.Entries, e)
+		prev = e.Path
+	}
+	return &m, nil
+}
+
+// entry 读取一个条目，prev 为前一个条目的路径
+func (br *binaryReader) entry(prev string) *Entry {
+	shared := br.uvarint()
+	if br.err == nil && shared > uint64(len(prev)) {
+		br.fail(errors.New("无效的路径前缀长度"))
+	}
+	if br.err != nil {
+		return nil
+	}
+	e := &Entry{Path: prev[:shared] + br.string()}
+	flags := br.byte()
+	e.IsDir = flags&flagDir != 0
+	e.IsSymlink = flags&flagSymlink != 0
+	e.Mode = uint32(br.uvarint())
+	e.Size = br.varint()
+	sec := br.varint()
+	nsec := br.uvarint()
+	e.ModTime = time.Unix(sec, int64(nsec)).UTC()
+	if e.IsSymlink {
+		e.LinkTarget = br.string()
+	}
+	if flags&flagDigest != 0 {
+		e.Digest = hex.EncodeToString(br.bytes())
+	}
+	if flags&flagMeta != 0 {
+		e.Meta = br.metadata()
+	}
+	return e
+}
+
+// metadata 读取扩展元数据
+func (br *binaryReader) metadata() *models.Metadata {
+	collected := br.byte()
+	meta := &models.Metadata{Collected: models.MetadataOptions{
+		Owner:   collected&metaOwner != 0,
+		Special: collected&metaSpecial != 0,
+		Xattrs:  collected&metaXattrs != 0,
+		ACL:     collected&metaACL != 0,
+	}}
+	if meta.Collected.Owner {
+		meta.UID = uint32(br.uvarint())
+		meta.GID = uint32(br.uvarint())
+	}
+	if meta.Collected.Xattrs {
+		n := br.uvarint()
+		for i := uint64(0); i < n && br.err == nil; i++ {
+			if meta.Xattrs == nil {
+				meta.Xattrs = make(map[string][]byte)
+			}
+			name := br.string()
+			meta.Xattrs[name] = br.bytes()
+		}
+	}
+	if meta.Collected.ACL {
+		meta.ACL = br.string()
+	}
+	return meta
+}
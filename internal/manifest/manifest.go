@@ -0,0 +1,252 @@
+package manifest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"time"
+
+	"file_syn/internal/scanner"
+	"file_syn/internal/signing"
+	"file_syn/pkg/models"
+)
+
+// Version 清单格式的版本号，字段发生不兼容变化时递增
+const Version = 1
+
+// Manifest formats
+const (
+	FormatJSON     = "json"    // 带缩进的 JSON（默认）
+	FormatJSONGzip = "json.gz" // gzip 压缩的 JSON
+	FormatBinary   = "binary"  // 紧凑的二进制格式
+)
+
+// Formats 支持的清单格式
+var Formats = []string{FormatJSON, FormatJSONGzip, FormatBinary}
+
+// gzipMagic gzip 数据的前两个字节
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Entry 清单中的一个文件
+type Entry struct {
+	Path       string           `json:"path"`
+	Size       int64            `json:"size"`
+	ModTime    time.Time        `json:"mod_time"` // RFC 3339
+	IsDir      bool             `json:"is_dir"`
+	IsSymlink  bool             `json:"is_symlink,omitempty"`
+	LinkTarget string           `json:"link_target,omitempty"` // 符号链接的目标（仅符号链接）
+	Mode       uint32           `json:"mode"`                  // os.FileMode 的数值
+	Digest     string           `json:"digest,omitempty"`
+	Meta       *models.Metadata `json:"meta,omitempty"` // 扩展元数据（仅收集时）
+}
+
+// ErrorEntry 清单中的一个扫描错误
+type ErrorEntry struct {
+	Path  string `json:"path"`
+	Op    string `json:"op"`
+	Error string `json:"error"`
+}
+
+// Manifest 一次扫描结果的快照
+type Manifest struct {
+	Version     int           `json:"version"`
+	Root        string        `json:"root"`                   // 扫描的根目录
+	Host        string        `json:"host,omitempty"`         // 扫描所在的主机名
+	ToolVersion string        `json:"tool_version,omitempty"` // 生成清单的 file_syn 版本
+	CreatedAt   time.Time     `json:"created_at"`             // 扫描时间
+	HashAlgo    string        `json:"hash,omitempty"`         // 摘要算法（未计算摘要时为空）
+	Entries     []*Entry      `json:"entries"`                // 按 scanner.ComparePaths 排序的文件列表
+	Errors      []*ErrorEntry `json:"errors,omitempty"`       // 扫描错误（对应的路径对比时为 unknown）
+}
+
+// New 根据扫描结果和扫描错误创建清单
+func New(root, hashAlgo string, files map[string]*models.FileInfo, scanErrors []*models.ScanError) *Manifest {
+	host, _ := os.Hostname()
+	m := &Manifest{
+		Version:   Version,
+		Root:      root,
+		Host:      host,
+		CreatedAt: time.Now().UTC(),
+		HashAlgo:  hashAlgo,
+		Entries:   make([]*Entry, 0, len(files)),
+	}
+	for _, info := range files {
+		m.Entries = append(m.Entries, NewEntry(info))
+	}
+	slices.SortFunc(m.Entries, func(a, b *Entry) int {
+		return scanner.ComparePaths(a.Path, b.Path)
+	})
+	for _, err := range scanErrors {
+		m.Errors = append(m.Errors, NewErrorEntry(err))
+	}
+	return m
+}
+
+// NewEntry 将文件信息转换为清单条目（不含绝对路径）
+func NewEntry(info *models.FileInfo) *Entry {
+	return &Entry{
+		Path:       info.Path,
+		Size:       info.Size,
+		ModTime:    info.ModTime.UTC(),
+		IsDir:      info.IsDir,
+		IsSymlink:  info.IsSymlink,
+		LinkTarget: info.LinkTarget,
+		Mode:       uint32(info.Mode),
+		Digest:     info.Digest,
+		Meta:       info.Meta,
+	}
+}
+
+// NewErrorEntry 将扫描错误转换为清单中的错误条目
+func NewErrorEntry(err *models.ScanError) *ErrorEntry {
+	return &ErrorEntry{Path: err.Path, Op: err.Op, Error: err.Err.Error()}
+}
+
+// Write 以 JSON 格式写出清单
+func (m *Manifest) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(m); err != nil {
+		return fmt.Errorf("无法写出清单: %v", err)
+	}
+	return nil
+}
+
+// WriteFormat 以指定格式写出清单
+func (m *Manifest) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON, "":
+		return m.Write(w)
+	case FormatJSONGzip:
+		zw := gzip.NewWriter(w)
+		if err := m.Write(zw); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("无法写出清单: %v", err)
+		}
+		return nil
+	case FormatBinary:
+		return m.writeBinary(w)
+	default:
+		return fmt.Errorf("不支持的清单格式: %s", format)
+	}
+}
+
+// Read 读取清单，自动识别 JSON、gzip 压缩和二进制格式
+func Read(r io.Reader) (*Manifest, error) {
+	br := bufio.NewReader(r)
+	if head, _ := br.Peek(len(gzipMagic)); bytes.Equal(head, gzipMagic) {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("无法解压清单: %v", err)
+		}
+		defer zr.Close()
+		br = bufio.NewReader(zr)
+	}
+
+	var m *Manifest
+	if head, _ := br.Peek(len(binaryMagic)); bytes.Equal(head, binaryMagic) {
+		var err error
+		if m, err = readBinary(br); err != nil {
+			return nil, fmt.Errorf("无法解析清单: %v", err)
+		}
+	} else {
+		m = &Manifest{}
+		if err := json.NewDecoder(br).Decode(m); err != nil {
+			return nil, fmt.Errorf("无法解析清单: %v", err)
+		}
+	}
+	if m.Version != Version {
+		return nil, fmt.Errorf("不支持的清单版本: %d", m.Version)
+	}
+	return m, nil
+}
+
+// Open 读取清单文件
+func Open(path string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开清单文件: %v", err)
+	}
+	defer f.Close()
+	m, err := Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// OpenVerified 读取清单文件并用 pub 验证其签名（清单路径加 signing.SignatureSuffix）
+//
+// 清单只读取一次，验证和解析使用同一份内容，验证之后文件被替换也不会影响结果。
+// 没有签名文件时返回的错误包装了 signing.ErrUnsigned。
+func OpenVerified(path string, pub ed25519.PublicKey) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开清单文件: %v", err)
+	}
+	sig, err := signing.ReadSignature(signing.SignatureFile(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := signing.Verify(bytes.NewReader(data), sig, pub); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m, err := Read(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return m, nil
+}
+
+// IsManifest 判断 path 是否是清单文件（普通文件），目录返回 false
+func IsManifest(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// Files 将清单转换为扫描结果（以相对路径为键）
+func (m *Manifest) Files() map[string]*models.FileInfo {
+	files := make(map[string]*models.FileInfo, len(m.Entries))
+	for _, e := range m.Entries {
+		files[e.Path] = e.FileInfo()
+	}
+	return files
+}
+
+// ScanErrors 将清单中的扫描错误转换为 models.ScanError
+func (m *Manifest) ScanErrors() []*models.ScanError {
+	scanErrors := make([]*models.ScanError, 0, len(m.Errors))
+	for _, e := range m.Errors {
+		scanErrors = append(scanErrors, e.ScanError())
+	}
+	return scanErrors
+}
+
+// ScanError 将错误条目转换为 models.ScanError
+func (e *ErrorEntry) ScanError() *models.ScanError {
+	return &models.ScanError{Path: e.Path, Op: e.Op, Err: errors.New(e.Error)}
+}
+
+// FileInfo 将清单条目转换为文件信息
+func (e *Entry) FileInfo() *models.FileInfo {
+	return &models.FileInfo{
+		Path:       e.Path,
+		Size:       e.Size,
+		ModTime:    e.ModTime,
+		IsDir:      e.IsDir,
+		IsSymlink:  e.IsSymlink,
+		LinkTarget: e.LinkTarget,
+		Mode:       os.FileMode(e.Mode),
+		Digest:     e.Digest,
+		Meta:       e.Meta,
+	}
+}
@@ -0,0 +1,193 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"file_syn/internal/signing"
+	"file_syn/pkg/models"
+)
+
+func TestManifestRoundTrip(t *testing.T) {
+	modTime := time.Date(2024, 5, 1, 8, 30, 0, 123, time.Local)
+	files := map[string]*models.FileInfo{
+		"sub":       {Path: "sub", IsDir: true, Mode: os.ModeDir | 0755, ModTime: modTime},
+		"sub/a.txt": {Path: "sub/a.txt", Size: 5, Mode: 0644, ModTime: modTime, Digest: "abcd"},
+		"sub-x":     {Path: "sub-x", Size: 1, Mode: 0600 | os.ModeSetuid, ModTime: modTime, Digest: "ef01"},
+		"link": {Path: "link", IsSymlink: true, LinkTarget: "sub/a.txt", Size: 9, Mode: os.ModeSymlink | 0777, ModTime: modTime,
+			Meta: &models.Metadata{Collected: models.MetadataOptions{Owner: true}, UID: 1000, GID: 100}},
+		"tool": {Path: "tool", Size: 2, Mode: 0755, ModTime: modTime.Add(-100 * 365 * 24 * time.Hour), Meta: &models.Metadata{
+			Collected: models.MetadataOptions{Owner: true, Special: true, Xattrs: true, ACL: true},
+			Xattrs:    map[string][]byte{"security.capability": {1, 0, 0, 2}, "user.label": []byte("blue")},
+			ACL:       "user::rwx,group::r-x,other::r-x",
+		}},
+	}
+	scanErrors := []*models.ScanError{{Path: "private", Op: models.ScanOpReadDir, Err: errors.New("permission denied")}}
+
+	for _, format := range Formats {
+		var buf bytes.Buffer
+		if err := New("/data", "sha256", files, scanErrors).WriteFormat(&buf, format); err != nil {
+			t.Fatalf("%s: 写出清单失败: %v", format, err)
+		}
+		m, err := Read(&buf)
+		if err != nil {
+			t.Fatalf("%s: 读取清单失败: %v", format, err)
+		}
+
+		if m.Root != "/data" || m.HashAlgo != "sha256" || m.CreatedAt.IsZero() || len(m.Entries) != len(files) {
+			t.Fatalf("%s: 清单元数据错误: %+v", format, m)
+		}
+		if len(m.Errors) != 1 || m.Errors[0].Path != "private" || m.Errors[0].Error != "permission denied" {
+			t.Errorf("%s: 扫描错误往返后不一致: %+v", format, m.Errors)
+		}
+		// 与扫描和对比的顺序一致：sub/a.txt 排在 sub-x 之前
+		paths := make([]string, len(m.Entries))
+		for i, e := range m.Entries {
+			paths[i] = e.Path
+		}
+		if want := []string{"link", "sub", "sub/a.txt", "sub-x", "tool"}; !slices.Equal(paths, want) {
+			t.Errorf("%s: 清单条目应按对比顺序排列: %v", format, paths)
+		}
+
+		restored := m.Files()
+		for path, want := range files {
+			got := restored[path]
+			if got == nil {
+				t.Errorf("%s: 缺少 %s", format, path)
+				continue
+			}
+			if got.Size != want.Size || !got.ModTime.Equal(want.ModTime) || got.IsDir != want.IsDir || got.IsSymlink != want.IsSymlink ||
+				got.LinkTarget != want.LinkTarget || got.Mode != want.Mode || got.Digest != want.Digest || !reflect.DeepEqual(got.Meta, want.Meta) {
+				t.Errorf("%s: %s 往返后不一致: %+v != %+v", format, path, got, want)
+			}
+		}
+	}
+}
+
+func TestBinaryIsCompact(t *testing.T) {
+	files := make(map[string]*models.FileInfo)
+	for i := range 1000 {
+		path := "project/src/module/file" + strings.Repeat("x", i%10) + string(rune('a'+i%26)) + ".go"
+		files[path] = &models.FileInfo{Path: path, Size: int64(i), Mode: 0644, ModTime: time.Now(),
+			Digest: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}
+	}
+	var jsonBuf, binaryBuf bytes.Buffer
+	m := New("/data", "sha256", files, nil)
+	if err := m.WriteFormat(&jsonBuf, FormatJSON); err != nil {
+		t.Fatalf("写出清单失败: %v", err)
+	}
+	if err := m.WriteFormat(&binaryBuf, FormatBinary); err != nil {
+		t.Fatalf("写出清单失败: %v", err)
+	}
+	if binaryBuf.Len()*3 > jsonBuf.Len() {
+		t.Errorf("二进制清单（%d 字节）应明显小于 JSON 清单（%d 字节）", binaryBuf.Len(), jsonBuf.Len())
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	if _, err := Read(strings.NewReader(`{"version": 99, "entries": []}`)); err == nil {
+		t.Error("不支持的清单版本应该返回错误")
+	}
+
+	var buf bytes.Buffer
+	files := map[string]*models.FileInfo{"a.txt": {Path: "a.txt", Size: 1, ModTime: time.Now()}}
+	if err := New("/data", "", files, nil).WriteFormat(&buf, FormatBinary); err != nil {
+		t.Fatalf("写出清单失败: %v", err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()[:buf.Len()-3])); err == nil {
+		t.Error("截断的二进制清单应该返回错误")
+	}
+	if err := New("/data", "", files, nil).WriteFormat(&buf, "xml"); err == nil {
+		t.Error("不支持的清单格式应该返回错误")
+	}
+}
+
+func TestSource(t *testing.T) {
+	modTime := time.Now()
+	files := map[string]*models.FileInfo{
+		"a.txt":     {Path: "a.txt", Size: 1, ModTime: modTime},
+		"dir":       {Path: "dir", IsDir: true, Mode: os.ModeDir | 0755, ModTime: modTime},
+		"dir/b.txt": {Path: "dir/b.txt", Size: 2, ModTime: modTime},
+	}
+	scanErrors := []*models.ScanError{{Path: "private", Op: models.ScanOpReadDir, Err: errors.New("permission denied")}}
+	source := NewSource(New("/data", "", files, scanErrors))
+
+	if err := source.ScanContext(context.Background()); err != nil {
+		t.Fatalf("载入清单失败: %v", err)
+	}
+	if got := slices.Sorted(maps.Keys(source.GetFiles())); !slices.Equal(got, []string{"a.txt", "dir", "dir/b.txt"}) {
+		t.Errorf("载入的条目不正确: %v", got)
+	}
+	seq, err := source.WalkContext(context.Background())
+	if err != nil {
+		t.Fatalf("遍历清单失败: %v", err)
+	}
+	var walked []string
+	for file := range seq {
+		walked = append(walked, file.Path)
+	}
+	if !slices.Equal(walked, []string{"a.txt", "dir", "dir/b.txt"}) {
+		t.Errorf("遍历顺序不正确: %v", walked)
+	}
+
+	// 扫描时无法读取的目录中的条目无法确定
+	if !source.Unknown("private/c.txt", false) || source.Unknown("a.txt", true) || source.Unknown("other.txt", false) {
+		t.Error("Unknown 应只对无法读取的目录中的条目返回 true")
+	}
+	if errs := source.Errors(); len(errs) != 1 || errs[0].Op != models.ScanOpReadDir || errs[0].Err.Error() != "permission denied" {
+		t.Errorf("扫描错误不正确: %v", errs)
+	}
+}
+
+func TestOpenVerified(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snapshot.json.gz")
+	files := map[string]*models.FileInfo{"a.txt": {Path: "a.txt", Size: 1, Mode: 0644, ModTime: time.Now()}}
+	var buf bytes.Buffer
+	if err := New("/data", "", files, nil).WriteFormat(&buf, FormatJSONGzip); err != nil {
+		t.Fatalf("写出清单失败: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("无法创建清单文件: %v", err)
+	}
+	pub, priv, err := signing.GenerateKey()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+
+	if _, err := OpenVerified(path, pub); !errors.Is(err, signing.ErrUnsigned) {
+		t.Errorf("没有签名时应返回 ErrUnsigned，实际为 %v", err)
+	}
+
+	sig, err := signing.Sign(bytes.NewReader(buf.Bytes()), priv)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	if err := sig.Write(signing.SignatureFile(path)); err != nil {
+		t.Fatalf("写出签名失败: %v", err)
+	}
+	m, err := OpenVerified(path, pub)
+	if err != nil {
+		t.Fatalf("验证有效签名失败: %v", err)
+	}
+	if len(m.Entries) != 1 || m.Entries[0].Path != "a.txt" {
+		t.Errorf("读取的清单内容错误: %+v", m.Entries)
+	}
+
+	// 清单被替换后签名不再有效
+	if err := os.WriteFile(path, append(buf.Bytes(), 0), 0644); err != nil {
+		t.Fatalf("无法修改清单文件: %v", err)
+	}
+	if _, err := OpenVerified(path, pub); err == nil {
+		t.Error("清单被修改后仍然通过验证")
+	}
+}
@@ -0,0 +1,74 @@
+package manifest
+
+import (
+	"context"
+	"iter"
+	"slices"
+
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// Source 以清单作为对比的一侧，提供与 scanner.FileScanner 相同的读取方法
+//
+// 清单中记录的扫描错误同样会使对应的路径在对比时被标记为 unknown。
+type Source struct {
+	manifest *Manifest
+	files    map[string]*models.FileInfo
+	index    *scanner.ErrorIndex
+}
+
+// NewSource 创建以清单为数据的对比来源
+func NewSource(m *Manifest) *Source {
+	index := scanner.NewErrorIndex()
+	for _, e := range m.Errors {
+		index.Add(e.Op, e.Path)
+	}
+	return &Source{manifest: m, index: index}
+}
+
+// Manifest 返回来源使用的清单
+func (s *Source) Manifest() *Manifest {
+	return s.manifest
+}
+
+// ScanContext 将清单中的条目载入内存（清单已经读取，不需要扫描）
+func (s *Source) ScanContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.files = s.manifest.Files()
+	return nil
+}
+
+// GetFiles 返回 ScanContext 载入的文件信息
+func (s *Source) GetFiles() map[string]*models.FileInfo {
+	return s.files
+}
+
+// WalkContext 按 scanner.ComparePaths 的顺序逐个产出清单中的条目
+func (s *Source) WalkContext(ctx context.Context) (iter.Seq[*models.FileInfo], error) {
+	entries := s.manifest.Entries
+	less := func(a, b *Entry) int { return scanner.ComparePaths(a.Path, b.Path) }
+	if !slices.IsSortedFunc(entries, less) {
+		// 旧版本的清单按字节序排序
+		entries = slices.SortedFunc(slices.Values(entries), less)
+	}
+	return func(yield func(*models.FileInfo) bool) {
+		for _, e := range entries {
+			if ctx.Err() != nil || !yield(e.FileInfo()) {
+				return
+			}
+		}
+	}, nil
+}
+
+// Errors 返回清单中记录的扫描错误
+func (s *Source) Errors() []*models.ScanError {
+	return s.manifest.ScanErrors()
+}
+
+// Unknown 判断 path 的状态是否因扫描时的错误而无法确定
+func (s *Source) Unknown(path string, exists bool) bool {
+	return s.index.Unknown(path, exists)
+}
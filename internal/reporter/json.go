@@ -0,0 +1,472 @@
+package reporter
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"file_syn/pkg/models"
+)
+
+// SchemaVersion JSON/NDJSON 输出格式的版本号，字段发生不兼容变化时递增
+const SchemaVersion = 2
+
+// fileJSON 文件信息的 JSON 表示
+type fileJSON struct {
+	Path       string        `json:"path"`
+	Size       int64         `json:"size"`
+	ModTime    string        `json:"mod_time"` // RFC 3339（UTC）
+	IsDir      bool          `json:"is_dir"`
+	IsSymlink  bool          `json:"is_symlink"`
+	LinkTarget string        `json:"link_target,omitempty"` // 符号链接的目标（仅符号链接）
+	Mode       string        `json:"mode"`                  // 八进制权限，如 0644
+	Digest     string        `json:"digest,omitempty"`
+	Metadata   *metadataJSON `json:"metadata,omitempty"` // 扩展元数据（仅收集时）
+}
+
+// metadataJSON 扩展元数据的 JSON 表示，只包含收集了的属性
+type metadataJSON struct {
+	UID     *uint32           `json:"uid,omitempty"`
+	GID     *uint32           `json:"gid,omitempty"`
+	Special string            `json:"special,omitempty"` // 八进制特殊权限位，如 4000
+	Xattrs  map[string]string `json:"xattrs,omitempty"`
+	ACL     string            `json:"acl,omitempty"` // 只有基本权限时为空
+}
+
+// resultJSON 对比结果的 JSON 表示
+type resultJSON struct {
+	Path        string            `json:"path"`
+	OldPath     string            `json:"old_path,omitempty"`
+	Status      string            `json:"status"`
+	Left        *fileJSON         `json:"left"`
+	Right       *fileJSON         `json:"right"`
+	Differences []*differenceJSON `json:"differences"`
+}
+
+// differenceJSON 属性差异的 JSON 表示
+//
+// left/right 的类型取决于 kind：exists 为布尔值，size 为字节数，
+// mtime 为 RFC 3339 时间，mode 为八进制权限，其余为字符串。
+type differenceJSON struct {
+	Kind  models.DifferenceKind `json:"kind"`
+	Left  any                   `json:"left"`
+	Right any                   `json:"right"`
+}
+
+// summaryJSON 统计信息的 JSON 表示
+type summaryJSON struct {
+	Added     int `json:"added"`
+	Deleted   int `json:"deleted"`
+	Modified  int `json:"modified"`
+	Touched   int `json:"touched"`
+	Renamed   int `json:"renamed"`
+	Unknown   int `json:"unknown"`
+	Unchanged int `json:"unchanged"`
+	Total     int `json:"total"`
+}
+
+// operationJSON 同步操作结果的 JSON 表示
+type operationJSON struct {
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target"`
+	Reason string `json:"reason"`
+	DryRun bool   `json:"dry_run"`
+	Error  string `json:"error,omitempty"`
+
+	LiteralBytes int64 `json:"literal_bytes,omitempty"` // 复制文件时写入的新数据字节数
+	MatchedBytes int64 `json:"matched_bytes,omitempty"` // 增量传输时复用的字节数
+	Delta        bool  `json:"delta,omitempty"`         // 是否使用增量传输
+}
+
+// conflictJSON 同步冲突的 JSON 表示
+type conflictJSON struct {
+	Path       string    `json:"path"`
+	Left       *fileJSON `json:"left"`
+	Right      *fileJSON `json:"right"`
+	Resolution string    `json:"resolution"`
+}
+
+// scanErrorJSON 扫描错误的 JSON 表示
+type scanErrorJSON struct {
+	Side  string `json:"side,omitempty"`
+	Path  string `json:"path"`
+	Op    string `json:"op"`
+	Errno int    `json:"errno,omitempty"` // 系统错误码（如 EACCES 为 13），不是系统调用错误时省略
+	Error string `json:"error"`
+}
+
+// documentJSON JSON 格式输出的顶层文档
+type documentJSON struct {
+	Version     int              `json:"version"`
+	GeneratedAt string           `json:"generated_at"`
+	Summary     *summaryJSON     `json:"summary"`
+	Results     []*resultJSON    `json:"results"`
+	Conflicts   []*conflictJSON  `json:"conflicts,omitempty"`
+	Operations  []*operationJSON `json:"operations,omitempty"`
+	Errors      []*scanErrorJSON `json:"errors"`
+}
+
+// formatTime 按 RFC 3339 格式化时间（统一为 UTC，保留纳秒）
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// newFileJSON 转换文件信息，nil 表示该侧不存在
+func newFileJSON(info *models.FileInfo) *fileJSON {
+	if info == nil {
+		return nil
+	}
+	return &fileJSON{
+		Path:       info.Path,
+		Size:       info.Size,
+		ModTime:    formatTime(info.ModTime),
+		IsDir:      info.IsDir,
+		IsSymlink:  info.IsSymlink,
+		LinkTarget: info.LinkTarget,
+		Mode:       formatMode(info.Mode),
+		Digest:     info.Digest,
+		Metadata:   newMetadataJSON(info),
+	}
+}
+
+// newMetadataJSON 转换扩展元数据，未收集时返回 nil
+func newMetadataJSON(info *models.FileInfo) *metadataJSON {
+	meta := info.Meta
+	if meta == nil || !meta.Collected.Any() {
+		return nil
+	}
+	m := &metadataJSON{}
+	if meta.Collected.Owner {
+		m.UID, m.GID = &meta.UID, &meta.GID
+	}
+	if meta.Collected.Special {
+		m.Special = formatSpecial(info.Mode)
+	}
+	if meta.Collected.Xattrs {
+		m.Xattrs = formatXattrs(meta.Xattrs)
+	}
+	if meta.Collected.ACL {
+		m.ACL = meta.ACL
+	}
+	return m
+}
+
+// formatSpecial 按八进制格式化 setuid（4000）、setgid（2000）和 sticky（1000）位
+func formatSpecial(mode os.FileMode) string {
+	var bits int
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// formatXattrs 转换扩展属性，可打印的值（如 SELinux 标签）按文本输出，其余按 0x 开头的十六进制输出
+func formatXattrs(xattrs map[string][]byte) map[string]string {
+	values := make(map[string]string, len(xattrs))
+	for name, value := range xattrs {
+		values[name] = formatXattrValue(value)
+	}
+	return values
+}
+
+// formatXattrValue 格式化单个扩展属性的值
+func formatXattrValue(value []byte) string {
+	text := strings.TrimSuffix(string(value), "\x00")
+	if utf8.ValidString(text) && !strings.ContainsFunc(text, unicode.IsControl) {
+		return text
+	}
+	return "0x" + hex.EncodeToString(value)
+}
+
+// formatMode 按八进制格式化权限，如 0644
+func formatMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// newDifferenceJSON 转换属性差异
+func newDifferenceJSON(d models.Difference) *differenceJSON {
+	if d.Kind == models.DiffSpecial {
+		left, _ := d.Left.(os.FileMode)
+		right, _ := d.Right.(os.FileMode)
+		return &differenceJSON{Kind: d.Kind, Left: formatSpecial(left), Right: formatSpecial(right)}
+	}
+	return &differenceJSON{Kind: d.Kind, Left: diffValueJSON(d.Left), Right: diffValueJSON(d.Right)}
+}
+
+// diffValueJSON 将差异值转换为稳定的 JSON 表示
+func diffValueJSON(value any) any {
+	switch v := value.(type) {
+	case time.Time:
+		return formatTime(v)
+	case os.FileMode:
+		return formatMode(v)
+	case map[string][]byte:
+		return formatXattrs(v)
+	default:
+		return v
+	}
+}
+
+// newResultJSON 转换对比结果
+func newResultJSON(result *models.DiffResult) *resultJSON {
+	differences := make([]*differenceJSON, 0, len(result.Differences))
+	for _, d := range result.Differences {
+		differences = append(differences, newDifferenceJSON(d))
+	}
+	return &resultJSON{
+		Path:        result.Path,
+		OldPath:     result.OldPath,
+		Status:      result.Status,
+		Left:        newFileJSON(result.LeftInfo),
+		Right:       newFileJSON(result.RightInfo),
+		Differences: differences,
+	}
+}
+
+// newOperationJSON 转换同步操作结果
+func newOperationJSON(result *models.SyncResult) *operationJSON {
+	op := result.Operation
+	j := &operationJSON{
+		Type:   op.Type,
+		Path:   op.Path,
+		Source: op.Source,
+		Target: op.Target,
+		Reason: op.Reason,
+		DryRun: result.DryRun,
+
+		LiteralBytes: result.Literal,
+		MatchedBytes: result.Matched,
+		Delta:        result.Delta,
+	}
+	if result.Error != nil {
+		j.Error = result.Error.Error()
+	}
+	return j
+}
+
+// newConflictJSON 转换同步冲突
+func newConflictJSON(conflict *models.SyncConflict) *conflictJSON {
+	return &conflictJSON{
+		Path:       conflict.Path,
+		Left:       newFileJSON(conflict.LeftInfo),
+		Right:      newFileJSON(conflict.RightInfo),
+		Resolution: conflict.Resolution,
+	}
+}
+
+// newScanErrorJSON 转换扫描错误
+func newScanErrorJSON(scanErr *models.ScanError) *scanErrorJSON {
+	return &scanErrorJSON{
+		Side:  scanErr.Side,
+		Path:  scanErr.Path,
+		Op:    scanErr.Op,
+		Errno: int(scanErr.Errno()),
+		Error: scanErr.Err.Error(),
+	}
+}
+
+// add 将一个结果计入统计（始终包含未变更的文件）
+func (s *summaryJSON) add(result *models.DiffResult) {
+	s.Total++
+	switch result.Status {
+	case models.StatusAdded:
+		s.Added++
+	case models.StatusDeleted:
+		s.Deleted++
+	case models.StatusModified:
+		s.Modified++
+	case models.StatusTouched:
+		s.Touched++
+	case models.StatusRenamed:
+		s.Renamed++
+	case models.StatusUnchanged:
+		s.Unchanged++
+	case models.StatusUnknown:
+		s.Unknown++
+	}
+}
+
+// JSONReporter 以单个 JSON 文档输出结果
+//
+// 对比结果、冲突和同步操作先在内存中收集，调用 Flush 时一次性写出，
+// 保证输出始终是一个完整的 JSON 文档。未变更的文件（除非要求显示）只计入统计，
+// 因此流式对比时内存占用与差异的数量有关，而与目录树的大小无关。
+type JSONReporter struct {
+	w             io.Writer
+	showUnchanged bool
+	doc           *documentJSON
+	summary       summaryJSON // 尚未输出到文档的统计
+}
+
+// NewJSONReporter 创建 JSON 报告器
+func NewJSONReporter(w io.Writer, showUnchanged bool) *JSONReporter {
+	return &JSONReporter{
+		w:             w,
+		showUnchanged: showUnchanged,
+		doc: &documentJSON{
+			Version: SchemaVersion,
+			Summary: &summaryJSON{},
+			Results: []*resultJSON{},
+			Errors:  []*scanErrorJSON{},
+		},
+	}
+}
+
+// PrintResults 收集对比结果
+func (r *JSONReporter) PrintResults(results []*models.DiffResult) {
+	for _, result := range results {
+		r.PrintResult(result)
+	}
+	r.PrintSummary()
+}
+
+// PrintResult 收集一个对比结果
+func (r *JSONReporter) PrintResult(result *models.DiffResult) {
+	r.summary.add(result)
+	if result.Status == models.StatusUnchanged && !r.showUnchanged {
+		return
+	}
+	r.doc.Results = append(r.doc.Results, newResultJSON(result))
+}
+
+// PrintSummary 记录已收集结果的统计信息
+func (r *JSONReporter) PrintSummary() {
+	summary := r.summary
+	r.doc.Summary = &summary
+	r.summary = summaryJSON{}
+}
+
+// PrintErrors 收集扫描错误
+func (r *JSONReporter) PrintErrors(errors []*models.ScanError) {
+	for _, scanErr := range errors {
+		r.doc.Errors = append(r.doc.Errors, newScanErrorJSON(scanErr))
+	}
+}
+
+// PrintConflicts 收集双向同步中的冲突
+func (r *JSONReporter) PrintConflicts(conflicts []*models.SyncConflict) {
+	for _, conflict := range conflicts {
+		r.doc.Conflicts = append(r.doc.Conflicts, newConflictJSON(conflict))
+	}
+}
+
+// PrintSyncResults 收集同步操作结果
+func (r *JSONReporter) PrintSyncResults(results []*models.SyncResult) {
+	for _, result := range results {
+		r.doc.Operations = append(r.doc.Operations, newOperationJSON(result))
+	}
+}
+
+// Flush 写出 JSON 文档
+func (r *JSONReporter) Flush() error {
+	r.doc.GeneratedAt = formatTime(time.Now())
+	encoder := json.NewEncoder(r.w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(r.doc); err != nil {
+		return fmt.Errorf("无法写出 JSON 报告: %v", err)
+	}
+	return nil
+}
+
+// NDJSONReporter 以 NDJSON（每行一个 JSON 对象）流式输出结果
+//
+// 每行都带有 kind 字段（result、summary、error、conflict 或 operation），
+// 对象本身位于与 kind 同名的字段中。summary 紧跟在所有 result 之后输出。
+type NDJSONReporter struct {
+	encoder       *json.Encoder
+	showUnchanged bool
+	summary       summaryJSON // 已输出结果的统计
+	err           error
+}
+
+// NewNDJSONReporter 创建 NDJSON 报告器
+func NewNDJSONReporter(w io.Writer, showUnchanged bool) *NDJSONReporter {
+	return &NDJSONReporter{
+		encoder:       json.NewEncoder(w),
+		showUnchanged: showUnchanged,
+	}
+}
+
+// ndjsonLine NDJSON 中的一行，kind 指明其中携带的是哪一种对象
+type ndjsonLine struct {
+	Kind      string         `json:"kind"`
+	Result    *resultJSON    `json:"result,omitempty"`
+	Conflict  *conflictJSON  `json:"conflict,omitempty"`
+	Operation *operationJSON `json:"operation,omitempty"`
+	Summary   *summaryJSON   `json:"summary,omitempty"`
+	Error     *scanErrorJSON `json:"error,omitempty"`
+}
+
+// write 写出一行，记录第一个错误
+func (r *NDJSONReporter) write(line *ndjsonLine) {
+	if r.err != nil {
+		return
+	}
+	if err := r.encoder.Encode(line); err != nil {
+		r.err = fmt.Errorf("无法写出 NDJSON 报告: %v", err)
+	}
+}
+
+// PrintResults 逐行输出对比结果，最后输出统计信息
+func (r *NDJSONReporter) PrintResults(results []*models.DiffResult) {
+	for _, result := range results {
+		r.PrintResult(result)
+	}
+	r.PrintSummary()
+}
+
+// PrintResult 输出一个对比结果
+func (r *NDJSONReporter) PrintResult(result *models.DiffResult) {
+	r.summary.add(result)
+	if result.Status == models.StatusUnchanged && !r.showUnchanged {
+		return
+	}
+	r.write(&ndjsonLine{Kind: "result", Result: newResultJSON(result)})
+}
+
+// PrintSummary 输出已输出结果的统计信息
+func (r *NDJSONReporter) PrintSummary() {
+	summary := r.summary
+	r.write(&ndjsonLine{Kind: "summary", Summary: &summary})
+	r.summary = summaryJSON{}
+}
+
+// PrintErrors 逐行输出扫描错误
+func (r *NDJSONReporter) PrintErrors(errors []*models.ScanError) {
+	for _, scanErr := range errors {
+		r.write(&ndjsonLine{Kind: "error", Error: newScanErrorJSON(scanErr)})
+	}
+}
+
+// PrintConflicts 逐行输出双向同步中的冲突
+func (r *NDJSONReporter) PrintConflicts(conflicts []*models.SyncConflict) {
+	for _, conflict := range conflicts {
+		r.write(&ndjsonLine{Kind: "conflict", Conflict: newConflictJSON(conflict)})
+	}
+}
+
+// PrintSyncResults 逐行输出同步操作结果
+func (r *NDJSONReporter) PrintSyncResults(results []*models.SyncResult) {
+	for _, result := range results {
+		r.write(&ndjsonLine{Kind: "operation", Operation: newOperationJSON(result)})
+	}
+}
+
+// Flush 返回输出过程中遇到的第一个错误
+func (r *NDJSONReporter) Flush() error {
+	return r.err
+}
@@ -0,0 +1,114 @@
+package reporter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"file_syn/internal/textdiff"
+	"file_syn/pkg/models"
+)
+
+// PatchReporter 只输出修改的文本文件的统一格式差异
+//
+// 在左侧目录中用 patch -p1 应用输出，修改的文本文件会变为右侧的版本。
+// 二进制文件和超过大小上限的文件只输出 "Binary files ... differ"；扫描错误、无法读取的文件和失败的同步操作作为警告输出到 warn。
+type PatchReporter struct {
+	w       *bufio.Writer
+	warn    io.Writer
+	options textdiff.Options
+	remote  map[string]ContentReader // 远程一侧读取文件内容的方式
+}
+
+// NewPatchReporter 创建 patch 格式的报告器
+func NewPatchReporter(w, warn io.Writer, options textdiff.Options) *PatchReporter {
+	return &PatchReporter{
+		w:       bufio.NewWriter(w),
+		warn:    warn,
+		options: options,
+	}
+}
+
+// PrintResults 输出所有修改的文本文件的差异
+func (r *PatchReporter) PrintResults(results []*models.DiffResult) {
+	for _, result := range results {
+		r.PrintResult(result)
+	}
+}
+
+// PrintResult 输出一个修改的文本文件的差异，其余结果不输出
+func (r *PatchReporter) PrintResult(result *models.DiffResult) {
+	patch, err := contentDiff(result, r.options, r.remote)
+	if err != nil {
+		fmt.Fprintf(r.warn, "警告: 无法生成 %s 的差异: %v\n", result.Path, err)
+		return
+	}
+	r.w.WriteString(patch)
+}
+
+// PrintSummary patch 格式不输出统计信息
+func (r *PatchReporter) PrintSummary() {}
+
+// PrintErrors 将扫描错误作为警告输出
+func (r *PatchReporter) PrintErrors(errors []*models.ScanError) {
+	for _, scanErr := range errors {
+		fmt.Fprintf(r.warn, "警告: %v\n", scanErr)
+	}
+}
+
+// PrintConflicts patch 格式不输出同步冲突
+func (r *PatchReporter) PrintConflicts(conflicts []*models.SyncConflict) {}
+
+// PrintSyncResults 将失败的同步操作作为警告输出
+func (r *PatchReporter) PrintSyncResults(results []*models.SyncResult) {
+	for _, result := range results {
+		if result.Error != nil {
+			fmt.Fprintf(r.warn, "警告: %s %s: %v\n", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+	}
+}
+
+// Flush 写出缓冲的差异
+func (r *PatchReporter) Flush() error {
+	if err := r.w.Flush(); err != nil {
+		return fmt.Errorf("无法写出差异: %v", err)
+	}
+	return nil
+}
+
+// contentDiff 生成修改的普通文件从左侧到右侧的统一格式差异，不需要生成时返回空字符串
+//
+// 只处理两侧都是普通文件的 modified 结果。没有本地路径的一侧通过 remote 中对应的
+// ContentReader 读取；清单中的条目没有文件内容，不生成差异。
+func contentDiff(result *models.DiffResult, options textdiff.Options, remote map[string]ContentReader) (string, error) {
+	left, right := result.LeftInfo, result.RightInfo
+	if result.Status != models.StatusModified || left == nil || right == nil ||
+		left.Type() != models.FileTypeFile || right.Type() != models.FileTypeFile {
+		return "", nil
+	}
+	if left.AbsPath != "" && right.AbsPath != "" {
+		return textdiff.Files("a/"+result.Path, "b/"+result.Path, left.AbsPath, right.AbsPath, options)
+	}
+
+	var readers [2]io.Reader
+	for i, side := range []struct {
+		name string
+		info *models.FileInfo
+	}{{models.SideLeft, left}, {models.SideRight, right}} {
+		switch {
+		case side.info.AbsPath != "":
+			f, err := os.Open(side.info.AbsPath)
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			readers[i] = f
+		case remote[side.name] != nil:
+			readers[i] = remote[side.name](side.info.Path)
+		default:
+			return "", nil
+		}
+	}
+	return textdiff.Readers("a/"+result.Path, "b/"+result.Path, readers[0], readers[1], options)
+}
@@ -1,16 +1,103 @@
 package reporter
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
+	"time"
+	"unicode"
 	"unicode/utf8"
 
+	"file_syn/internal/textdiff"
 	"file_syn/pkg/models"
 )
 
+// Output formats
+const (
+	FormatText   = "text"   // 带边框的表格（默认）
+	FormatJSON   = "json"   // 单个 JSON 文档
+	FormatNDJSON = "ndjson" // 每行一个 JSON 对象
+	FormatPatch  = "patch"  // 只输出修改的文件的统一格式差异，可以直接用于 patch -p1
+)
+
+// Languages of difference details in the text format
+const (
+	LanguageZH = "zh" // 中文（默认）
+	LanguageEN = "en" // 英文
+)
+
+// Printer 输出对比和同步结果
+//
+// PrintResults 等价于对每个结果调用 PrintResult 后再调用 PrintSummary；
+// 流式对比时逐个调用 PrintResult，结束后调用 PrintSummary 输出统计信息。
+type Printer interface {
+	PrintResults(results []*models.DiffResult)
+	PrintResult(result *models.DiffResult)
+	PrintSummary()
+	PrintErrors(errors []*models.ScanError)
+	PrintConflicts(conflicts []*models.SyncConflict)
+	PrintSyncResults(results []*models.SyncResult)
+	Flush() error // 写出缓冲的内容并返回输出过程中的错误
+}
+
+// Options 报告器选项
+type Options struct {
+	ShowUnchanged bool              // 是否输出未变更的文件
+	ContentDiff   *textdiff.Options // 为修改的文本文件输出统一格式差异（nil 表示不输出，仅表格和 patch 格式）
+	Language      string            // 表格中差异详情的语言：LanguageZH（默认）或 LanguageEN
+
+	// Remote 没有本地路径的一侧（键为 models.SideLeft 或 models.SideRight）读取文件内容的方式，
+	// 如通过 agent 访问的远程目录；用于生成内容差异
+	Remote map[string]ContentReader
+}
+
+// ContentReader 按相对路径读取一侧文件的内容
+type ContentReader func(relPath string) io.Reader
+
+// New 按照输出格式创建报告器，format 为空时使用表格格式
+func New(format string, w io.Writer, showUnchanged bool) (Printer, error) {
+	return NewWithOptions(format, w, Options{ShowUnchanged: showUnchanged})
+}
+
+// NewWithOptions 按照输出格式和选项创建报告器
+func NewWithOptions(format string, w io.Writer, options Options) (Printer, error) {
+	switch format {
+	case "", FormatText:
+		r := NewReporter(options.ShowUnchanged)
+		r.contentDiff = options.ContentDiff
+		r.remote = options.Remote
+		r.language = options.Language
+		return r, nil
+	case FormatJSON:
+		return NewJSONReporter(w, options.ShowUnchanged), nil
+	case FormatNDJSON:
+		return NewNDJSONReporter(w, options.ShowUnchanged), nil
+	case FormatPatch:
+		contentDiff := textdiff.Options{Context: textdiff.DefaultContext}
+		if options.ContentDiff != nil {
+			contentDiff = *options.ContentDiff
+		}
+		r := NewPatchReporter(w, os.Stderr, contentDiff)
+		r.remote = options.Remote
+		return r, nil
+	default:
+		return nil, fmt.Errorf("不支持的输出格式: %s", format)
+	}
+}
+
 // Reporter 结果报告器
 type Reporter struct {
 	showUnchanged bool
+	contentDiff   *textdiff.Options        // 内容差异选项（nil 表示不输出内容差异）
+	remote        map[string]ContentReader // 远程一侧读取文件内容的方式
+	language      string                   // 差异详情的语言
+	patches       []string                 // 在统计信息之前输出的内容差异
+	summary       summaryJSON              // 已输出结果的统计
+	started       bool                     // 是否已输出标题
+	rows          int                      // 表格中已输出的行数
 }
 
 // NewReporter 创建新的报告器
@@ -20,70 +107,64 @@ func NewReporter(showUnchanged bool) *Reporter {
 	}
 }
 
-// displayWidth 计算字符串的显示宽度（中文字符占2个宽度，emoji通常占2个宽度）
-func displayWidth(s string) int {
-	width := 0
-	runes := []rune(s)
-	for i := 0; i < len(runes); i++ {
-		r := runes[i]
-
-		// 检查是否是 emoji 或特殊符号（通常占2个宽度）
-		if r >= 0x1F300 && r <= 0x1F9FF { // Emoji range
-			width += 2
-			continue
-		}
-		if r >= 0x2600 && r <= 0x26FF { // Miscellaneous Symbols
-			width += 2
-			continue
-		}
-		if r >= 0x2700 && r <= 0x27BF { // Dingbats
-			width += 2
-			continue
-		}
-		if r >= 0xFE00 && r <= 0xFE0F { // Variation Selectors (emoji modifiers)
-			width += 0 // 这些是修饰符，不占宽度
-			continue
-		}
-		if r >= 0x200D { // Zero Width Joiner (emoji sequences)
-			// 检查是否是 emoji 序列的一部分
-			if i+1 < len(runes) && (runes[i+1] >= 0x1F300 && runes[i+1] <= 0x1F9FF) {
-				width += 0
-				continue
-			}
-		}
+// Flush 表格格式直接输出到标准输出，无需刷新
+func (r *Reporter) Flush() error {
+	return nil
+}
 
-		// 判断是否为全角字符（中文、日文、韩文等）
-		if r >= 0x1100 && (r <= 0x115F || // Hangul Jamo
-			r >= 0x2E80 && r <= 0x2EFF || // CJK Radicals Supplement
-			r >= 0x2F00 && r <= 0x2FDF || // Kangxi Radicals
-			r >= 0x3000 && r <= 0x303F || // CJK Symbols and Punctuation
-			r >= 0x3040 && r <= 0x309F || // Hiragana
-			r >= 0x30A0 && r <= 0x30FF || // Katakana
-			r >= 0x3100 && r <= 0x312F || // Bopomofo
-			r >= 0x3130 && r <= 0x318F || // Hangul Compatibility Jamo
-			r >= 0x3200 && r <= 0x32FF || // Enclosed CJK Letters and Months
-			r >= 0x3300 && r <= 0x33FF || // CJK Compatibility
-			r >= 0x3400 && r <= 0x4DBF || // CJK Unified Ideographs Extension A
-			r >= 0x4E00 && r <= 0x9FFF || // CJK Unified Ideographs
-			r >= 0xA000 && r <= 0xA48F || // Yi Syllables
-			r >= 0xA490 && r <= 0xA4CF || // Yi Radicals
-			r >= 0xAC00 && r <= 0xD7AF || // Hangul Syllables
-			r >= 0xF900 && r <= 0xFAFF || // CJK Compatibility Ideographs
-			r >= 0xFE30 && r <= 0xFE4F || // CJK Compatibility Forms
-			r >= 0xFF00 && r <= 0xFFEF) { // Halfwidth and Fullwidth Forms
-			width += 2
-		} else if r == utf8.RuneError {
-			width += 1
-		} else {
-			width += 1
-		}
+// DisplayWidth 计算字符串在终端中的显示宽度（中文字符和 emoji 占 2 个宽度，组合符号和零宽字符不占宽度）
+func DisplayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
 	}
 	return width
 }
 
+// runeWidth 计算单个字符的显示宽度
+func runeWidth(r rune) int {
+	switch {
+	case r == utf8.RuneError:
+		return 1
+	case r >= 0x200B && r <= 0x200F, // 零宽空格、零宽连接符（emoji 序列）和方向标记
+		r >= 0xFE00 && r <= 0xFE0F, // Variation Selectors (emoji modifiers)
+		r == 0xFEFF,                // 零宽不换行空格
+		unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf): // 组合符号和格式字符
+		return 0
+	case r >= 0x1F300 && r <= 0x1F9FF, // Emoji range
+		r >= 0x2600 && r <= 0x26FF, // Miscellaneous Symbols
+		r >= 0x2700 && r <= 0x27BF: // Dingbats
+		return 2
+	}
+
+	// 判断是否为全角字符（中文、日文、韩文等）
+	if r >= 0x1100 && (r <= 0x115F || // Hangul Jamo
+		r >= 0x2E80 && r <= 0x2EFF || // CJK Radicals Supplement
+		r >= 0x2F00 && r <= 0x2FDF || // Kangxi Radicals
+		r >= 0x3000 && r <= 0x303F || // CJK Symbols and Punctuation
+		r >= 0x3040 && r <= 0x309F || // Hiragana
+		r >= 0x30A0 && r <= 0x30FF || // Katakana
+		r >= 0x3100 && r <= 0x312F || // Bopomofo
+		r >= 0x3130 && r <= 0x318F || // Hangul Compatibility Jamo
+		r >= 0x3200 && r <= 0x32FF || // Enclosed CJK Letters and Months
+		r >= 0x3300 && r <= 0x33FF || // CJK Compatibility
+		r >= 0x3400 && r <= 0x4DBF || // CJK Unified Ideographs Extension A
+		r >= 0x4E00 && r <= 0x9FFF || // CJK Unified Ideographs
+		r >= 0xA000 && r <= 0xA48F || // Yi Syllables
+		r >= 0xA490 && r <= 0xA4CF || // Yi Radicals
+		r >= 0xAC00 && r <= 0xD7AF || // Hangul Syllables
+		r >= 0xF900 && r <= 0xFAFF || // CJK Compatibility Ideographs
+		r >= 0xFE30 && r <= 0xFE4F || // CJK Compatibility Forms
+		r >= 0xFF00 && r <= 0xFF60 || r >= 0xFFE0 && r <= 0xFFE6 || // Fullwidth Forms
+		r >= 0x20000 && r <= 0x3FFFD) { // CJK Unified Ideographs Extension B 及以后
+		return 2
+	}
+	return 1
+}
+
 // padString 填充字符串到指定显示宽度
 func padString(s string, width int, alignLeft bool) string {
-	currentWidth := displayWidth(s)
+	currentWidth := DisplayWidth(s)
 	if currentWidth >= width {
 		return s
 	}
@@ -95,21 +176,16 @@ func padString(s string, width int, alignLeft bool) string {
 	return strings.Repeat(" ", padding) + s
 }
 
-// truncateStringByWidth 按显示宽度截断字符串
-func truncateStringByWidth(s string, maxWidth int) string {
-	if displayWidth(s) <= maxWidth {
+// TruncateByWidth 按显示宽度截断字符串，超出时保留开头并以 ... 结尾
+func TruncateByWidth(s string, maxWidth int) string {
+	if DisplayWidth(s) <= maxWidth {
 		return s
 	}
 
 	width := 0
 	var result strings.Builder
 	for _, r := range s {
-		charWidth := 2
-		if r < 0x1100 || (r > 0x115F && r < 0x2E80) || (r > 0xFFEF) {
-			if r != utf8.RuneError {
-				charWidth = 1
-			}
-		}
+		charWidth := runeWidth(r)
 		if width+charWidth > maxWidth-3 {
 			result.WriteString("...")
 			break
@@ -120,8 +196,8 @@ func truncateStringByWidth(s string, maxWidth int) string {
 	return result.String()
 }
 
-// formatSize 格式化文件大小
-func formatSize(size int64) string {
+// FormatSize 格式化文件大小（如 1.5 MB）
+func FormatSize(size int64) string {
 	const unit = 1024
 	if size < unit {
 		return fmt.Sprintf("%d B", size)
@@ -144,15 +220,32 @@ func formatFileInfo(info *models.FileInfo) []string {
 	if info.IsDir {
 		lines = append(lines, fmt.Sprintf("📁 %s", info.Path))
 		lines = append(lines, "   [目录]")
+	} else if info.IsSymlink {
+		lines = append(lines, fmt.Sprintf("🔗 %s", info.Path))
+		lines = append(lines, fmt.Sprintf("   目标: %s", info.LinkTarget))
 	} else {
 		lines = append(lines, fmt.Sprintf("📄 %s", info.Path))
-		lines = append(lines, fmt.Sprintf("   大小: %s", formatSize(info.Size)))
+		lines = append(lines, fmt.Sprintf("   大小: %s", FormatSize(info.Size)))
 		lines = append(lines, fmt.Sprintf("   时间: %s", info.ModTime.Format("2006-01-02 15:04:05")))
 		lines = append(lines, fmt.Sprintf("   权限: %s", info.Mode.Perm().String()))
+		if info.Digest != "" {
+			lines = append(lines, fmt.Sprintf("   摘要: %s", shortDigest(info.Digest)))
+		}
+	}
+	if info.Meta != nil && info.Meta.Collected.Owner {
+		lines = append(lines, fmt.Sprintf("   属主: %d:%d", info.Meta.UID, info.Meta.GID))
 	}
 	return lines
 }
 
+// shortDigest 截取摘要前 8 位用于显示
+func shortDigest(digest string) string {
+	if len(digest) > 8 {
+		return digest[:8]
+	}
+	return digest
+}
+
 // getStatusDisplay 获取状态显示文本（带符号）
 func getStatusDisplay(status string) string {
 	var symbol, text string
@@ -166,9 +259,18 @@ func getStatusDisplay(status string) string {
 	case models.StatusModified:
 		symbol = "🔄"
 		text = "修改"
+	case models.StatusTouched:
+		symbol = "✎"
+		text = "仅属性变更"
+	case models.StatusRenamed:
+		symbol = "➜"
+		text = "重命名"
 	case models.StatusUnchanged:
 		symbol = "✓"
 		text = "未变更"
+	case models.StatusUnknown:
+		symbol = "?"
+		text = "无法确定"
 	default:
 		symbol = "?"
 		text = "未知"
@@ -178,7 +280,7 @@ func getStatusDisplay(status string) string {
 
 // wrapTextByWidth 按显示宽度换行文本
 func wrapTextByWidth(text string, width int) []string {
-	if displayWidth(text) <= width {
+	if DisplayWidth(text) <= width {
 		return []string{text}
 	}
 
@@ -187,13 +289,7 @@ func wrapTextByWidth(text string, width int) []string {
 	currentWidth := 0
 
 	for _, r := range text {
-		charWidth := 2
-		if r < 0x1100 || (r > 0x115F && r < 0x2E80) || (r > 0xFFEF) {
-			if r != utf8.RuneError {
-				charWidth = 1
-			}
-		}
-
+		charWidth := runeWidth(r)
 		if currentWidth+charWidth > width {
 			if currentLine != "" {
 				lines = append(lines, currentLine)
@@ -225,152 +321,150 @@ func maxInt(a, b int) int {
 	return b
 }
 
+// 表格的列宽度定义（显示宽度）
+const (
+	leftColWidth   = 50
+	rightColWidth  = 50
+	statusColWidth = 20
+)
+
+// tableSeparator 创建表格分隔线
+//
+// 每列格式：│ + 空格(1) + 内容(width) + 空格(1) = width + 2
+func tableSeparator(left, middle, right string) string {
+	return left + strings.Repeat("─", leftColWidth+2) + middle + strings.Repeat("─", rightColWidth+2) + middle + strings.Repeat("─", statusColWidth+2) + right
+}
+
 // PrintResults 打印对比结果（表格格式：左侧目录 | 右侧目录 | 状态）
 func (r *Reporter) PrintResults(results []*models.DiffResult) {
+	for _, result := range results {
+		r.PrintResult(result)
+	}
+	r.PrintSummary()
+}
+
+// printTitle 打印结果标题（只打印一次）
+func (r *Reporter) printTitle() {
+	if r.started {
+		return
+	}
+	r.started = true
 	fmt.Println()
 	fmt.Println("╔════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════╗")
 	fmt.Println("║                                                                  文件同步监测结果                                                                              ║")
 	fmt.Println("╚════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════════╝")
 	fmt.Println()
+}
 
-	// 统计信息
-	addedCount := 0
-	deletedCount := 0
-	modifiedCount := 0
-	unchangedCount := 0
-
-	// 过滤需要显示的结果
-	var displayResults []*models.DiffResult
-	for _, result := range results {
-		if result.Status == models.StatusUnchanged && !r.showUnchanged {
-			unchangedCount++
-			continue
+// PrintResult 打印一个对比结果（表格中的一行），第一行之前打印标题和表头
+func (r *Reporter) PrintResult(result *models.DiffResult) {
+	r.summary.add(result)
+	if r.contentDiff != nil {
+		patch, err := contentDiff(result, *r.contentDiff, r.remote)
+		if err != nil {
+			patch = fmt.Sprintf("无法生成 %s 的差异: %v\n", result.Path, err)
 		}
-		displayResults = append(displayResults, result)
-		switch result.Status {
-		case models.StatusAdded:
-			addedCount++
-		case models.StatusDeleted:
-			deletedCount++
-		case models.StatusModified:
-			modifiedCount++
-		case models.StatusUnchanged:
-			unchangedCount++
+		if patch != "" {
+			r.patches = append(r.patches, patch)
 		}
 	}
+	if result.Status == models.StatusUnchanged && !r.showUnchanged {
+		return
+	}
 
-	if len(displayResults) == 0 {
-		fmt.Println("  所有文件一致，无差异")
-		fmt.Println()
-	} else {
-		// 列宽度定义（显示宽度）
-		const leftColWidth = 50
-		const rightColWidth = 50
-		const statusColWidth = 20
-
-		// 计算分隔线的实际字符数
-		// 每列格式：│ + 空格(1) + 内容(width) + 空格(1) = width + 2
-		leftSeparatorLen := leftColWidth + 2
-		rightSeparatorLen := rightColWidth + 2
-		statusSeparatorLen := statusColWidth + 2
-
-		// 创建分隔线的辅助函数
-		createSeparator := func(left, middle, right string) string {
-			return left + strings.Repeat("─", leftSeparatorLen) + middle + strings.Repeat("─", rightSeparatorLen) + middle + strings.Repeat("─", statusSeparatorLen) + right
-		}
-
+	r.printTitle()
+	if r.rows == 0 {
 		// 打印表头
-		headerLine := createSeparator("┌", "┬", "┐")
-		fmt.Println(headerLine)
-
+		fmt.Println(tableSeparator("┌", "┬", "┐"))
 		leftHeader := padString("左侧目录", leftColWidth, true)
 		rightHeader := padString("右侧目录", rightColWidth, true)
 		statusHeader := padString("状态", statusColWidth, true)
 		fmt.Printf("│ %s │ %s │ %s │\n", leftHeader, rightHeader, statusHeader)
+	}
+	// 每一行之前添加分隔线
+	fmt.Println(tableSeparator("├", "┼", "┤"))
+	r.rows++
+
+	leftLines := formatFileInfo(result.LeftInfo)
+	rightLines := formatFileInfo(result.RightInfo)
+	status := getStatusDisplay(result.Status)
+
+	// 如果有差异详情，添加到状态列
+	statusLines := []string{status}
+	if len(result.Differences) > 0 {
+		for _, diff := range result.Differences {
+			// 格式化差异信息
+			diffLines := formatDiffDetails(diff, r.language)
+			statusLines = append(statusLines, diffLines...)
+		}
+	}
 
-		separatorLine := createSeparator("├", "┼", "┤")
-		fmt.Println(separatorLine)
-
-		// 打印表格内容
-		for i, result := range displayResults {
-			leftLines := formatFileInfo(result.LeftInfo)
-			rightLines := formatFileInfo(result.RightInfo)
-			status := getStatusDisplay(result.Status)
-
-			// 如果有差异详情，添加到状态列
-			statusLines := []string{status}
-			if len(result.Differences) > 0 {
-				for _, diff := range result.Differences {
-					// 格式化差异信息
-					diffLines := formatDiffDetails(diff, result)
-					statusLines = append(statusLines, diffLines...)
-				}
-			}
+	// 计算需要多少行
+	maxLines := maxInt(len(leftLines), len(rightLines))
+	maxLines = maxInt(maxLines, len(statusLines))
 
-			// 计算需要多少行
-			maxLines := maxInt(len(leftLines), len(rightLines))
-			maxLines = maxInt(maxLines, len(statusLines))
-
-			// 打印每一行
-			for lineIdx := 0; lineIdx < maxLines; lineIdx++ {
-				var leftText, rightText, statusText string
-
-				if lineIdx < len(leftLines) {
-					leftText = leftLines[lineIdx]
-				}
-				if lineIdx < len(rightLines) {
-					rightText = rightLines[lineIdx]
-				}
-				if lineIdx < len(statusLines) {
-					statusText = statusLines[lineIdx]
-				}
-
-				// 按显示宽度换行
-				leftWrapped := wrapTextByWidth(leftText, leftColWidth)
-				rightWrapped := wrapTextByWidth(rightText, rightColWidth)
-				statusWrapped := wrapTextByWidth(statusText, statusColWidth)
-
-				// 计算需要多少行来显示（考虑换行）
-				wrappedMaxLines := maxInt(len(leftWrapped), len(rightWrapped))
-				wrappedMaxLines = maxInt(wrappedMaxLines, len(statusWrapped))
-
-				// 打印换行后的内容
-				for wrapIdx := 0; wrapIdx < wrappedMaxLines; wrapIdx++ {
-					var leftWrap, rightWrap, statusWrap string
-					if wrapIdx < len(leftWrapped) {
-						leftWrap = leftWrapped[wrapIdx]
-					}
-					if wrapIdx < len(rightWrapped) {
-						rightWrap = rightWrapped[wrapIdx]
-					}
-					if wrapIdx < len(statusWrapped) {
-						statusWrap = statusWrapped[wrapIdx]
-					}
-
-					// 按显示宽度截断并填充
-					leftDisplay := truncateStringByWidth(leftWrap, leftColWidth)
-					rightDisplay := truncateStringByWidth(rightWrap, rightColWidth)
-					statusDisplay := truncateStringByWidth(statusWrap, statusColWidth)
-
-					// 填充到指定宽度
-					leftPadded := padString(leftDisplay, leftColWidth, true)
-					rightPadded := padString(rightDisplay, rightColWidth, true)
-					statusPadded := padString(statusDisplay, statusColWidth, true)
-
-					fmt.Printf("│ %s │ %s │ %s │\n", leftPadded, rightPadded, statusPadded)
-				}
-			}
+	// 打印每一行
+	for lineIdx := 0; lineIdx < maxLines; lineIdx++ {
+		var leftText, rightText, statusText string
 
-			// 添加分隔线（最后一个不添加）
-			if i < len(displayResults)-1 {
-				fmt.Println(separatorLine)
+		if lineIdx < len(leftLines) {
+			leftText = leftLines[lineIdx]
+		}
+		if lineIdx < len(rightLines) {
+			rightText = rightLines[lineIdx]
+		}
+		if lineIdx < len(statusLines) {
+			statusText = statusLines[lineIdx]
+		}
+
+		// 按显示宽度换行
+		leftWrapped := wrapTextByWidth(leftText, leftColWidth)
+		rightWrapped := wrapTextByWidth(rightText, rightColWidth)
+		statusWrapped := wrapTextByWidth(statusText, statusColWidth)
+
+		// 计算需要多少行来显示（考虑换行）
+		wrappedMaxLines := maxInt(len(leftWrapped), len(rightWrapped))
+		wrappedMaxLines = maxInt(wrappedMaxLines, len(statusWrapped))
+
+		// 打印换行后的内容
+		for wrapIdx := 0; wrapIdx < wrappedMaxLines; wrapIdx++ {
+			var leftWrap, rightWrap, statusWrap string
+			if wrapIdx < len(leftWrapped) {
+				leftWrap = leftWrapped[wrapIdx]
+			}
+			if wrapIdx < len(rightWrapped) {
+				rightWrap = rightWrapped[wrapIdx]
+			}
+			if wrapIdx < len(statusWrapped) {
+				statusWrap = statusWrapped[wrapIdx]
 			}
+
+			// 按显示宽度截断并填充
+			leftDisplay := TruncateByWidth(leftWrap, leftColWidth)
+			rightDisplay := TruncateByWidth(rightWrap, rightColWidth)
+			statusDisplay := TruncateByWidth(statusWrap, statusColWidth)
+
+			// 填充到指定宽度
+			leftPadded := padString(leftDisplay, leftColWidth, true)
+			rightPadded := padString(rightDisplay, rightColWidth, true)
+			statusPadded := padString(statusDisplay, statusColWidth, true)
+
+			fmt.Printf("│ %s │ %s │ %s │\n", leftPadded, rightPadded, statusPadded)
 		}
+	}
+}
 
-		footerLine := createSeparator("└", "┴", "┘")
-		fmt.Println(footerLine)
+// PrintSummary 结束表格并打印统计信息
+func (r *Reporter) PrintSummary() {
+	r.printTitle()
+	if r.rows == 0 {
+		fmt.Println("  所有文件一致，无差异")
+		fmt.Println()
+	} else {
+		fmt.Println(tableSeparator("└", "┴", "┘"))
 		fmt.Println()
 	}
+	r.printPatches()
 
 	// 打印统计信息表格
 	fmt.Println("╔════════════════════════════════════════════════════════════════════════════╗")
@@ -379,52 +473,364 @@ func (r *Reporter) PrintResults(results []*models.DiffResult) {
 	fmt.Println()
 
 	fmt.Println("┌──────────────────┬────────┐")
-	fmt.Printf("│ %-16s │ %6d │\n", "新增文件", addedCount)
+	fmt.Printf("│ %-16s │ %6d │\n", "新增文件", r.summary.Added)
 	fmt.Println("├──────────────────┼────────┤")
-	fmt.Printf("│ %-16s │ %6d │\n", "删除文件", deletedCount)
+	fmt.Printf("│ %-16s │ %6d │\n", "删除文件", r.summary.Deleted)
 	fmt.Println("├──────────────────┼────────┤")
-	fmt.Printf("│ %-16s │ %6d │\n", "修改文件", modifiedCount)
+	fmt.Printf("│ %-16s │ %6d │\n", "修改文件", r.summary.Modified)
+	if r.summary.Touched > 0 {
+		fmt.Println("├──────────────────┼────────┤")
+		fmt.Printf("│ %-16s │ %6d │\n", "仅属性变更", r.summary.Touched)
+	}
+	if r.summary.Renamed > 0 {
+		fmt.Println("├──────────────────┼────────┤")
+		fmt.Printf("│ %-16s │ %6d │\n", "重命名文件", r.summary.Renamed)
+	}
+	if r.summary.Unknown > 0 {
+		fmt.Println("├──────────────────┼────────┤")
+		fmt.Printf("│ %-16s │ %6d │\n", "无法确定", r.summary.Unknown)
+	}
 	if r.showUnchanged {
 		fmt.Println("├──────────────────┼────────┤")
-		fmt.Printf("│ %-16s │ %6d │\n", "未变更文件", unchangedCount)
+		fmt.Printf("│ %-16s │ %6d │\n", "未变更文件", r.summary.Unchanged)
 	}
 	fmt.Println("├──────────────────┼────────┤")
-	fmt.Printf("│ %-16s │ %6d │\n", "总计", len(results))
+	fmt.Printf("│ %-16s │ %6d │\n", "总计", r.summary.Total)
 	fmt.Println("└──────────────────┴────────┘")
+
+	// 重置状态，之后的结果作为新的一组输出
+	r.patches = nil
+	r.summary = summaryJSON{}
+	r.started = false
+	r.rows = 0
 }
 
-// formatDiffDetails 格式化差异详情
-func formatDiffDetails(diff string, result *models.DiffResult) []string {
-	var lines []string
+// printPatches 打印表格中修改的文本文件的内容差异，没有时不输出
+func (r *Reporter) printPatches() {
+	if len(r.patches) == 0 {
+		return
+	}
+
+	fmt.Println("╔════════════════════════════════════════════════════════════════════════════╗")
+	fmt.Println("║                              内容差异                                       ║")
+	fmt.Println("╚════════════════════════════════════════════════════════════════════════════╝")
+	fmt.Println()
 
-	// 解析差异信息
-	if strings.Contains(diff, "大小不同") {
-		if result.LeftInfo != nil && result.RightInfo != nil {
-			leftSize := formatSize(result.LeftInfo.Size)
-			rightSize := formatSize(result.RightInfo.Size)
-			lines = append(lines, fmt.Sprintf("大小: %s→%s", leftSize, rightSize))
+	for _, patch := range r.patches {
+		fmt.Print(patch)
+		fmt.Println()
+	}
+}
+
+// detailText 差异详情中使用的文字
+type detailText struct {
+	onlyLeft, onlyRight string
+	labels              map[models.DifferenceKind]string // 各差异类型的名称
+	contentDiffers      string
+	aclDiffers          string
+	fileTypes           map[string]string // 文件类型的显示文本
+}
+
+// detailTexts 各语言的差异详情文字
+var detailTexts = map[string]*detailText{
+	LanguageZH: {
+		onlyLeft:  "仅左侧存在",
+		onlyRight: "仅右侧存在",
+		labels: map[models.DifferenceKind]string{
+			models.DiffType:    "类型",
+			models.DiffSize:    "大小",
+			models.DiffModTime: "时间",
+			models.DiffMode:    "权限",
+			models.DiffTarget:  "链接目标",
+			models.DiffOwner:   "属主",
+			models.DiffSpecial: "特殊权限",
+			models.DiffXattr:   "扩展属性",
+			models.DiffPath:    "原路径",
+		},
+		contentDiffers: "内容: 摘要不同",
+		aclDiffers:     "ACL: 不同",
+		fileTypes: map[string]string{
+			models.FileTypeDir:     "目录",
+			models.FileTypeFile:    "文件",
+			models.FileTypeSymlink: "符号链接",
+		},
+	},
+	LanguageEN: {
+		onlyLeft:  "only on left",
+		onlyRight: "only on right",
+		labels: map[models.DifferenceKind]string{
+			models.DiffType:    "type",
+			models.DiffSize:    "size",
+			models.DiffModTime: "mtime",
+			models.DiffMode:    "mode",
+			models.DiffTarget:  "link target",
+			models.DiffOwner:   "owner",
+			models.DiffSpecial: "special bits",
+			models.DiffXattr:   "xattrs",
+			models.DiffPath:    "renamed from",
+		},
+		contentDiffers: "content: digests differ",
+		aclDiffers:     "ACL: differs",
+		fileTypes: map[string]string{
+			models.FileTypeDir:     "directory",
+			models.FileTypeFile:    "file",
+			models.FileTypeSymlink: "symlink",
+		},
+	},
+}
+
+// formatDiffDetails 按语言（LanguageZH 或 LanguageEN，其他值按中文）格式化差异详情
+func formatDiffDetails(d models.Difference, language string) []string {
+	text, ok := detailTexts[language]
+	if !ok {
+		text = detailTexts[LanguageZH]
+	}
+	label := text.labels[d.Kind]
+	switch d.Kind {
+	case models.DiffExists:
+		if exists, _ := d.Left.(bool); exists {
+			return []string{text.onlyLeft}
 		}
-	} else if strings.Contains(diff, "修改时间不同") {
-		if result.LeftInfo != nil && result.RightInfo != nil {
-			leftTime := result.LeftInfo.ModTime.Format("2006-01-02 15:04:05")
-			rightTime := result.RightInfo.ModTime.Format("2006-01-02 15:04:05")
-			lines = append(lines, fmt.Sprintf("时间: %s→%s", leftTime, rightTime))
+		return []string{text.onlyRight}
+	case models.DiffType:
+		return []string{fmt.Sprintf("%s: %s→%s", label, text.fileType(d.Left), text.fileType(d.Right))}
+	case models.DiffSize:
+		left, _ := d.Left.(int64)
+		right, _ := d.Right.(int64)
+		return []string{fmt.Sprintf("%s: %s→%s", label, FormatSize(left), FormatSize(right))}
+	case models.DiffModTime:
+		left, _ := d.Left.(time.Time)
+		right, _ := d.Right.(time.Time)
+		return []string{fmt.Sprintf("%s: %s→%s", label, left.Format("2006-01-02 15:04:05"), right.Format("2006-01-02 15:04:05"))}
+	case models.DiffMode, models.DiffTarget, models.DiffOwner:
+		return []string{fmt.Sprintf("%s: %v→%v", label, d.Left, d.Right)}
+	case models.DiffContent:
+		return []string{text.contentDiffers}
+	case models.DiffSpecial:
+		left, _ := d.Left.(os.FileMode)
+		right, _ := d.Right.(os.FileMode)
+		return []string{fmt.Sprintf("%s: %s→%s", label, formatSpecial(left), formatSpecial(right))}
+	case models.DiffXattr:
+		left, _ := d.Left.(map[string][]byte)
+		right, _ := d.Right.(map[string][]byte)
+		return []string{label + ": " + strings.Join(changedXattrs(left, right), ", ")}
+	case models.DiffACL:
+		return []string{text.aclDiffers}
+	case models.DiffPath:
+		return []string{fmt.Sprintf("%s: %v", label, d.Left)}
+	default:
+		return []string{fmt.Sprintf("%s: %v→%v", d.Kind, d.Left, d.Right)}
+	}
+}
+
+// fileType 返回文件类型的显示文本
+func (t *detailText) fileType(fileType any) string {
+	if name, ok := fileType.(string); ok && t.fileTypes[name] != "" {
+		return t.fileTypes[name]
+	}
+	return fmt.Sprint(fileType)
+}
+
+// changedXattrs 返回两侧值不同（或只存在于一侧）的扩展属性名称
+func changedXattrs(left, right map[string][]byte) []string {
+	var names []string
+	for name, value := range left {
+		if other, ok := right[name]; !ok || !bytes.Equal(value, other) {
+			names = append(names, name)
 		}
-	} else if strings.Contains(diff, "权限不同") {
-		if result.LeftInfo != nil && result.RightInfo != nil {
-			leftPerm := result.LeftInfo.Mode.Perm().String()
-			rightPerm := result.RightInfo.Mode.Perm().String()
-			lines = append(lines, fmt.Sprintf("权限: %s→%s", leftPerm, rightPerm))
+	}
+	for name := range right {
+		if _, ok := left[name]; !ok {
+			names = append(names, name)
 		}
-	} else if strings.Contains(diff, "仅存在于") {
-		if strings.Contains(diff, "左侧") {
-			lines = append(lines, "仅左侧存在")
-		} else {
-			lines = append(lines, "仅右侧存在")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getOperationDisplay 获取同步操作的显示文本
+func getOperationDisplay(opType string) string {
+	switch opType {
+	case models.OpMkdir:
+		return "创建目录"
+	case models.OpCopy:
+		return "复制文件"
+	case models.OpSymlink:
+		return "创建链接"
+	case models.OpDelete:
+		return "删除"
+	case models.OpSetAttr:
+		return "设置属性"
+	case models.OpRename:
+		return "重命名"
+	default:
+		return opType
+	}
+}
+
+// PrintSyncResults 打印同步操作结果
+func (r *Reporter) PrintSyncResults(results []*models.SyncResult) {
+	fmt.Println()
+	fmt.Println("╔════════════════════════════════════════════════════════════════════════════╗")
+	fmt.Println("║                              同步操作                                       ║")
+	fmt.Println("╚════════════════════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	if len(results) == 0 {
+		fmt.Println("  无需同步，两侧目录已一致")
+		fmt.Println()
+		return
+	}
+
+	succeeded := 0
+	failed := 0
+	planned := 0
+	var literal, matched int64
+	for _, result := range results {
+		op := result.Operation
+		opText := padString(getOperationDisplay(op.Type), 10, true)
+		literal += result.Literal
+		matched += result.Matched
+		switch {
+		case result.DryRun:
+			planned++
+			fmt.Printf("  [计划] %s %s（%s）\n", opText, op.Path, op.Reason)
+		case result.Error != nil:
+			failed++
+			fmt.Printf("  ✗ %s %s: %v\n", opText, op.Path, result.Error)
+		case result.Delta:
+			succeeded++
+			fmt.Printf("  ✓ %s %s（增量传输: 写入 %s，复用 %s）\n", opText, op.Path, FormatSize(result.Literal), FormatSize(result.Matched))
+		default:
+			succeeded++
+			fmt.Printf("  ✓ %s %s\n", opText, op.Path)
 		}
+	}
+	fmt.Println()
+
+	fmt.Println("┌──────────────────┬────────────┐")
+	if planned > 0 {
+		fmt.Printf("│ %-16s │ %10d │\n", "计划操作", planned)
 	} else {
-		lines = append(lines, diff)
+		fmt.Printf("│ %-16s │ %10d │\n", "成功操作", succeeded)
+		fmt.Println("├──────────────────┼────────────┤")
+		fmt.Printf("│ %-16s │ %10d │\n", "失败操作", failed)
+	}
+	// 写入的新数据与增量传输时从目标原有内容复用的数据
+	if literal > 0 || matched > 0 {
+		fmt.Println("├──────────────────┼────────────┤")
+		fmt.Printf("│ %-16s │ %10s │\n", "写入数据", FormatSize(literal))
+		fmt.Println("├──────────────────┼────────────┤")
+		fmt.Printf("│ %-16s │ %10s │\n", "复用数据", FormatSize(matched))
 	}
+	fmt.Println("└──────────────────┴────────────┘")
+}
 
-	return lines
+// getResolutionDisplay 获取冲突解决策略的显示文本
+func getResolutionDisplay(resolution string) string {
+	switch resolution {
+	case models.ConflictNewer:
+		return "较新的一侧获胜"
+	case models.ConflictLeft:
+		return "左侧获胜"
+	case models.ConflictRight:
+		return "右侧获胜"
+	case models.ConflictKeepBoth:
+		return "保留两侧版本"
+	case models.ConflictSkip:
+		return "已跳过"
+	default:
+		return resolution
+	}
+}
+
+// describeConflictSide 描述冲突中一侧的状态
+func describeConflictSide(info *models.FileInfo) string {
+	switch {
+	case info == nil:
+		return "已删除"
+	case info.IsDir:
+		return "目录"
+	case info.IsSymlink:
+		return fmt.Sprintf("符号链接 → %s", info.LinkTarget)
+	default:
+		return fmt.Sprintf("%s, %s", FormatSize(info.Size), info.ModTime.Format("2006-01-02 15:04:05"))
+	}
+}
+
+// PrintConflicts 打印双向同步中的冲突
+func (r *Reporter) PrintConflicts(conflicts []*models.SyncConflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("╔════════════════════════════════════════════════════════════════════════════╗")
+	fmt.Println("║                              同步冲突                                       ║")
+	fmt.Println("╚════════════════════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	for _, conflict := range conflicts {
+		fmt.Printf("  ⚠ %s\n", conflict.Path)
+		fmt.Printf("      左侧: %s\n", describeConflictSide(conflict.LeftInfo))
+		fmt.Printf("      右侧: %s\n", describeConflictSide(conflict.RightInfo))
+		fmt.Printf("      处理: %s\n", getResolutionDisplay(conflict.Resolution))
+	}
+}
+
+// getSideDisplay 获取一侧的显示文本
+func getSideDisplay(side string) string {
+	switch side {
+	case models.SideLeft:
+		return "左侧"
+	case models.SideRight:
+		return "右侧"
+	default:
+		return side
+	}
+}
+
+// getScanOpDisplay 获取扫描操作的显示文本
+func getScanOpDisplay(op string) string {
+	switch op {
+	case models.ScanOpReadDir:
+		return "无法读取目录"
+	case models.ScanOpLstat:
+		return "无法访问"
+	case models.ScanOpReadlink:
+		return "无法读取链接"
+	case models.ScanOpMetadata:
+		return "无法读取元数据"
+	case models.ScanOpSymlinkLoop:
+		return "符号链接循环"
+	case models.ScanOpHash:
+		return "无法计算摘要"
+	case models.ScanOpIgnoreFile:
+		return "无法读取忽略文件"
+	default:
+		return op
+	}
+}
+
+// PrintErrors 打印扫描错误（跳过的路径），没有错误时不输出
+func (r *Reporter) PrintErrors(errors []*models.ScanError) {
+	if len(errors) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("╔════════════════════════════════════════════════════════════════════════════╗")
+	fmt.Println("║                              扫描错误                                       ║")
+	fmt.Println("╚════════════════════════════════════════════════════════════════════════════╝")
+	fmt.Println()
+
+	for _, scanErr := range errors {
+		path := scanErr.Path
+		if path == "" {
+			path = "."
+		}
+		fmt.Printf("  ✗ [%s] %s %s: %v\n", getSideDisplay(scanErr.Side), getScanOpDisplay(scanErr.Op), path, scanErr.Err)
+	}
+	fmt.Println()
+	fmt.Println("  无法读取的目录中的条目标记为“无法确定”，而不是新增或删除")
 }
@@ -0,0 +1,294 @@
+package reporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"file_syn/internal/textdiff"
+	"file_syn/pkg/models"
+)
+
+// sampleResults 构造用于测试的对比结果
+func sampleResults() []*models.DiffResult {
+	modTime := time.Date(2024, 5, 1, 8, 30, 0, 0, time.FixedZone("CST", 8*3600))
+	left := &models.FileInfo{Path: "a.txt", Size: 5, ModTime: modTime, Mode: 0644, Digest: "abcd"}
+	right := &models.FileInfo{Path: "a.txt", Size: 7, ModTime: modTime, Mode: 0600}
+	return []*models.DiffResult{
+		{Path: "a.txt", Status: models.StatusModified, LeftInfo: left, RightInfo: right, Differences: []models.Difference{
+			{Kind: models.DiffSize, Left: int64(5), Right: int64(7)},
+			{Kind: models.DiffMode, Left: os.FileMode(0644), Right: os.FileMode(0600)},
+		}},
+		{Path: "b.txt", Status: models.StatusAdded, RightInfo: right},
+		{Path: "c.txt", Status: models.StatusUnchanged, LeftInfo: left, RightInfo: left},
+	}
+}
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSONReporter(&buf, false)
+	r.PrintResults(sampleResults())
+	r.PrintErrors([]*models.ScanError{{
+		Side: models.SideRight, Path: "locked", Op: models.ScanOpReadDir,
+		Err: &os.PathError{Op: "open", Path: "/r/locked", Err: syscall.EACCES},
+	}})
+	r.PrintSyncResults([]*models.SyncResult{{
+		Operation: &models.SyncOperation{Type: models.OpCopy, Path: "a.txt", Target: "/r/a.txt"},
+		Error:     errors.New("磁盘已满"),
+	}})
+	if err := r.Flush(); err != nil {
+		t.Fatalf("写出报告失败: %v", err)
+	}
+
+	var doc struct {
+		Version     int    `json:"version"`
+		GeneratedAt string `json:"generated_at"`
+		Summary     struct {
+			Modified  int `json:"modified"`
+			Added     int `json:"added"`
+			Unchanged int `json:"unchanged"`
+			Total     int `json:"total"`
+		} `json:"summary"`
+		Results []struct {
+			Path   string `json:"path"`
+			Status string `json:"status"`
+			Left   *struct {
+				ModTime string `json:"mod_time"`
+				Mode    string `json:"mode"`
+				Digest  string `json:"digest"`
+			} `json:"left"`
+			Differences []struct {
+				Kind  models.DifferenceKind `json:"kind"`
+				Left  any                   `json:"left"`
+				Right any                   `json:"right"`
+			} `json:"differences"`
+		} `json:"results"`
+		Errors []struct {
+			Side  string `json:"side"`
+			Path  string `json:"path"`
+			Op    string `json:"op"`
+			Errno int    `json:"errno"`
+			Error string `json:"error"`
+		} `json:"errors"`
+		Operations []struct {
+			Type  string `json:"type"`
+			Error string `json:"error"`
+		} `json:"operations"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("输出不是合法的 JSON: %v\n%s", err, buf.String())
+	}
+
+	if doc.Version != SchemaVersion {
+		t.Errorf("期望版本 %d，实际 %d", SchemaVersion, doc.Version)
+	}
+	if _, err := time.Parse(time.RFC3339, doc.GeneratedAt); err != nil {
+		t.Errorf("generated_at 不是 RFC 3339 格式: %q", doc.GeneratedAt)
+	}
+	if doc.Summary.Modified != 1 || doc.Summary.Added != 1 || doc.Summary.Unchanged != 1 || doc.Summary.Total != 3 {
+		t.Errorf("统计信息错误: %+v", doc.Summary)
+	}
+	// 未开启 show_unchanged 时结果列表不包含未变更的文件
+	if len(doc.Results) != 2 {
+		t.Fatalf("期望 2 条结果，实际 %d 条", len(doc.Results))
+	}
+	first := doc.Results[0]
+	if first.Path != "a.txt" || first.Status != models.StatusModified || len(first.Differences) != 2 {
+		t.Fatalf("结果字段错误: %+v", first)
+	}
+	if d := first.Differences[0]; d.Kind != models.DiffSize || d.Left != float64(5) || d.Right != float64(7) {
+		t.Errorf("大小差异字段错误: %+v", d)
+	}
+	if d := first.Differences[1]; d.Kind != models.DiffMode || d.Left != "0644" || d.Right != "0600" {
+		t.Errorf("权限差异字段错误: %+v", d)
+	}
+	if first.Left == nil || first.Left.ModTime != "2024-05-01T00:30:00Z" || first.Left.Mode != "0644" || first.Left.Digest != "abcd" {
+		t.Errorf("文件信息字段错误: %+v", first.Left)
+	}
+	if doc.Results[1].Left != nil || doc.Results[1].Differences == nil {
+		t.Errorf("新增文件的 left 应为 null，differences 应为空数组: %+v", doc.Results[1])
+	}
+	if len(doc.Errors) != 1 || doc.Errors[0].Side != models.SideRight || doc.Errors[0].Path != "locked" ||
+		doc.Errors[0].Op != models.ScanOpReadDir || doc.Errors[0].Errno != int(syscall.EACCES) || doc.Errors[0].Error == "" {
+		t.Errorf("扫描错误字段错误: %+v", doc.Errors)
+	}
+	if len(doc.Operations) != 1 || doc.Operations[0].Type != models.OpCopy || doc.Operations[0].Error != "磁盘已满" {
+		t.Errorf("同步操作字段错误: %+v", doc.Operations)
+	}
+}
+
+func TestNDJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewNDJSONReporter(&buf, true)
+	r.PrintResults(sampleResults())
+	if err := r.Flush(); err != nil {
+		t.Fatalf("写出报告失败: %v", err)
+	}
+
+	var kinds []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var line map[string]json.RawMessage
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("第 %d 行不是合法的 JSON: %v", len(kinds)+1, err)
+		}
+		var kind string
+		json.Unmarshal(line["kind"], &kind)
+		if _, ok := line[kind]; !ok {
+			t.Errorf("第 %d 行缺少 %s 字段: %s", len(kinds)+1, kind, scanner.Text())
+		}
+		kinds = append(kinds, kind)
+	}
+
+	// 开启 show_unchanged 时输出全部 3 条结果，最后是统计信息
+	expected := []string{"result", "result", "result", "summary"}
+	if len(kinds) != len(expected) {
+		t.Fatalf("期望 %v，实际 %v", expected, kinds)
+	}
+	for i := range expected {
+		if kinds[i] != expected[i] {
+			t.Errorf("期望 %v，实际 %v", expected, kinds)
+			break
+		}
+	}
+
+	// 逐个输出结果（流式对比）与一次性输出的内容一致
+	var batch, stream bytes.Buffer
+	NewNDJSONReporter(&batch, false).PrintResults(sampleResults())
+	streamer := NewNDJSONReporter(&stream, false)
+	for _, result := range sampleResults() {
+		streamer.PrintResult(result)
+	}
+	streamer.PrintSummary()
+	if batch.String() != stream.String() {
+		t.Errorf("逐个输出的内容与一次性输出不一致:\n%s\n%s", batch.String(), stream.String())
+	}
+}
+
+func TestPatchReporter(t *testing.T) {
+	dir := t.TempDir()
+	file := func(side, name, content string) *models.FileInfo {
+		path := filepath.Join(dir, side, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建测试文件: %v", err)
+		}
+		return &models.FileInfo{Path: name, Size: int64(len(content)), AbsPath: path, Mode: 0644}
+	}
+	results := []*models.DiffResult{
+		{Path: "conf.ini", Status: models.StatusModified, LeftInfo: file("l", "conf.ini", "a=1\nb=2\n"), RightInfo: file("r", "conf.ini", "a=1\nb=3\n")},
+		{Path: "logo.png", Status: models.StatusModified, LeftInfo: file("l", "logo.png", "\x89PNG\x00"), RightInfo: file("r", "logo.png", "\x89PNG\x00\x01")},
+		{Path: "new.txt", Status: models.StatusAdded, RightInfo: file("r", "new.txt", "x\n")},
+		// 清单中的条目没有文件内容
+		{Path: "m.txt", Status: models.StatusModified, LeftInfo: &models.FileInfo{Path: "m.txt"}, RightInfo: file("r", "m.txt", "x\n")},
+		// 远程一侧通过 ContentReader 读取
+		{Path: "remote.txt", Status: models.StatusModified, LeftInfo: file("l", "remote.txt", "x\n"), RightInfo: &models.FileInfo{Path: "remote.txt"}},
+	}
+
+	var out, warn bytes.Buffer
+	r := NewPatchReporter(&out, &warn, textdiff.Options{Context: 1})
+	r.remote = map[string]ContentReader{models.SideRight: func(relPath string) io.Reader {
+		return strings.NewReader("remote " + relPath + "\n")
+	}}
+	r.PrintResults(results)
+	r.PrintErrors([]*models.ScanError{{Side: models.SideLeft, Path: "locked", Op: models.ScanOpReadDir, Err: errors.New("permission denied")}})
+	if err := r.Flush(); err != nil {
+		t.Fatalf("写出报告失败: %v", err)
+	}
+
+	expected := "--- a/conf.ini\n+++ b/conf.ini\n@@ -1,2 +1,2 @@\n a=1\n-b=2\n+b=3\n" +
+		"Binary files a/logo.png and b/logo.png differ\n" +
+		"--- a/remote.txt\n+++ b/remote.txt\n@@ -1 +1 @@\n-x\n+remote remote.txt\n"
+	if out.String() != expected {
+		t.Errorf("patch 输出错误:\n%s", out.String())
+	}
+	if warn.String() != "警告: left: readdir locked: permission denied\n" {
+		t.Errorf("扫描错误应该作为警告输出: %q", warn.String())
+	}
+}
+
+func TestFormatDiffDetails(t *testing.T) {
+	modTime := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		diff   models.Difference
+		zh, en string
+	}{
+		{models.Difference{Kind: models.DiffExists, Left: true, Right: false}, "仅左侧存在", "only on left"},
+		{models.Difference{Kind: models.DiffExists, Left: false, Right: true}, "仅右侧存在", "only on right"},
+		{models.Difference{Kind: models.DiffType, Left: models.FileTypeFile, Right: models.FileTypeDir}, "类型: 文件→目录", "type: file→directory"},
+		{models.Difference{Kind: models.DiffSize, Left: int64(1024), Right: int64(2048)}, "大小: 1.0 KB→2.0 KB", "size: 1.0 KB→2.0 KB"},
+		{models.Difference{Kind: models.DiffModTime, Left: modTime, Right: modTime.Add(time.Hour)}, "时间: 2024-01-01 10:00:00→2024-01-01 11:00:00", "mtime: 2024-01-01 10:00:00→2024-01-01 11:00:00"},
+		{models.Difference{Kind: models.DiffMode, Left: os.FileMode(0644), Right: os.FileMode(0600)}, "权限: -rw-r--r--→-rw-------", "mode: -rw-r--r--→-rw-------"},
+		{models.Difference{Kind: models.DiffContent, Left: "ab", Right: "cd"}, "内容: 摘要不同", "content: digests differ"},
+		{models.Difference{Kind: models.DiffTarget, Left: "a", Right: "b"}, "链接目标: a→b", "link target: a→b"},
+		{models.Difference{Kind: models.DiffPath, Left: "old.txt", Right: "new.txt"}, "原路径: old.txt", "renamed from: old.txt"},
+		{models.Difference{Kind: models.DiffOwner, Left: "0:0", Right: "1000:1000"}, "属主: 0:0→1000:1000", "owner: 0:0→1000:1000"},
+		{models.Difference{Kind: models.DiffSpecial, Left: os.ModeSetuid | os.ModeSticky, Right: os.FileMode(0)}, "特殊权限: 5000→0000", "special bits: 5000→0000"},
+		{models.Difference{Kind: models.DiffXattr, Left: map[string][]byte{"user.a": {1}, "user.b": {2}}, Right: map[string][]byte{"user.b": {2}, "user.c": {3}}}, "扩展属性: user.a, user.c", "xattrs: user.a, user.c"},
+		{models.Difference{Kind: models.DiffACL, Left: "a", Right: "b"}, "ACL: 不同", "ACL: differs"},
+	}
+	for _, tt := range tests {
+		for language, expected := range map[string]string{"": tt.zh, LanguageZH: tt.zh, LanguageEN: tt.en} {
+			lines := formatDiffDetails(tt.diff, language)
+			if len(lines) != 1 || lines[0] != expected {
+				t.Errorf("%s 差异（语言 %q）: 期望 %q，实际 %q", tt.diff.Kind, language, expected, lines)
+			}
+		}
+	}
+}
+
+func TestFormatXattrValue(t *testing.T) {
+	tests := map[string]string{
+		"system_u:object_r:bin_t:s0\x00": "system_u:object_r:bin_t:s0",
+		"\x01\x00\x00\x02":               "0x01000002",
+		"":                               "",
+	}
+	for value, expected := range tests {
+		if got := formatXattrValue([]byte(value)); got != expected {
+			t.Errorf("%q: 期望 %q，实际 %q", value, expected, got)
+		}
+	}
+}
+
+func TestNewFormat(t *testing.T) {
+	for _, format := range []string{"", FormatText, FormatJSON, FormatNDJSON, FormatPatch} {
+		if _, err := New(format, &bytes.Buffer{}, false); err != nil {
+			t.Errorf("格式 %q 应该受支持: %v", format, err)
+		}
+	}
+	if _, err := New("xml", &bytes.Buffer{}, false); err == nil {
+		t.Error("不支持的格式应该返回错误")
+	}
+}
+
+func TestDisplayWidth(t *testing.T) {
+	for s, want := range map[string]int{
+		"abc":                        3,
+		"中文":                         4,
+		"e\u0301":                    1, // e 加组合重音符
+		"a\u200bb":                   2, // 零宽空格
+		"\U0001F44D\uFE0F":           2, // emoji 加变体选择符
+		"\U0001F468\u200D\U0001F4BB": 4, // 零宽连接符连接的两个 emoji
+		"\uFF71":                     1, // 半角片假名
+		"→":                          1,
+	} {
+		if got := DisplayWidth(s); got != want {
+			t.Errorf("%q 的显示宽度期望 %d，实际 %d", s, want, got)
+		}
+	}
+
+	if got := TruncateByWidth("目录/文件名.txt", 10); got != "目录/文..." {
+		t.Errorf("截断结果不正确: %q", got)
+	}
+	if got := TruncateByWidth("short", 10); got != "short" {
+		t.Errorf("未超出宽度时不应截断: %q", got)
+	}
+}
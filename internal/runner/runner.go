@@ -0,0 +1,153 @@
+// Package runner 提供 CLI 子命令和 serve 任务共用的对比、同步步骤：
+// 打开和保存摘要缓存、为远程目录启动 agent、对比完成后按同步模式同步。
+package runner
+
+import (
+	"errors"
+	"io"
+
+	"file_syn/internal/agent"
+	"file_syn/internal/config"
+	"file_syn/internal/diff"
+	"file_syn/internal/hashcache"
+	"file_syn/internal/reporter"
+	"file_syn/internal/scanner"
+	"file_syn/internal/syncer"
+	"file_syn/pkg/models"
+)
+
+// ErrSyncFailed 部分同步操作失败（失败的操作已输出到报告中）
+var ErrSyncFailed = errors.New("部分同步操作失败")
+
+// Logf 输出一行提示或警告信息（不含换行符）
+type Logf func(format string, args ...any)
+
+// OpenHashCache 开启内容校验时打开摘要缓存，失败时输出警告并不使用缓存
+func OpenHashCache(cfg *config.Config, logf Logf) *hashcache.Cache {
+	cachePath := cfg.HashCachePath()
+	if cfg.Hash == "" || cachePath == "" {
+		return nil
+	}
+	cache, err := hashcache.Open(cachePath)
+	if err != nil {
+		logf("警告: %v，本次不使用摘要缓存", err)
+		return nil
+	}
+	return cache
+}
+
+// SaveHashCache 保存摘要缓存（cache 为 nil 时不做任何事），失败时输出警告
+func SaveHashCache(cache *hashcache.Cache, logf Logf) {
+	if cache == nil {
+		return
+	}
+	if err := cache.Save(); err != nil {
+		logf("警告: 保存摘要缓存失败: %v", err)
+	}
+}
+
+// Remote 为配置了 left_command 或 right_command 的一侧启动的 agent 连接
+//
+// 方法可以在 nil 上调用（两侧都是本地目录）。
+type Remote struct {
+	clients map[string]*agent.Client // 键为 models.SideLeft 或 models.SideRight
+	roots   map[string]string        // 该侧在远程主机上的目录
+}
+
+// StartRemote 为配置了 left_command 或 right_command 的一侧启动 agent，两侧都是本地目录时返回 nil
+func StartRemote(cfg *config.Config, logf Logf) (*Remote, error) {
+	if !cfg.IsRemote() {
+		return nil, nil
+	}
+	r := &Remote{clients: make(map[string]*agent.Client), roots: make(map[string]string)}
+	for _, side := range []struct{ name, display, command, root string }{
+		{models.SideLeft, "左侧", cfg.LeftCommand, cfg.LeftDir},
+		{models.SideRight, "右侧", cfg.RightCommand, cfg.RightDir},
+	} {
+		if side.command == "" {
+			continue
+		}
+		client, err := agent.Start(side.command)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.clients[side.name] = client
+		r.roots[side.name] = side.root
+		logf("%s已连接 agent: %s（file_syn %s）", side.display, client.Host(), client.ToolVersion())
+	}
+	return r, nil
+}
+
+// Openers 返回对比使用的远程数据源（diff.Options.Remote）
+func (r *Remote) Openers() map[string]diff.Opener {
+	if r == nil {
+		return nil
+	}
+	openers := make(map[string]diff.Opener, len(r.clients))
+	for side, client := range r.clients {
+		openers[side] = func(path string, options scanner.Options) diff.Source {
+			return client.Source(path, options)
+		}
+	}
+	return openers
+}
+
+// Readers 返回生成内容差异时读取远程文件的方式（reporter.Options.Remote）
+func (r *Remote) Readers() map[string]reporter.ContentReader {
+	if r == nil {
+		return nil
+	}
+	readers := make(map[string]reporter.ContentReader, len(r.clients))
+	for side, client := range r.clients {
+		root := r.roots[side]
+		readers[side] = func(relPath string) io.Reader {
+			return client.Open(root, relPath)
+		}
+	}
+	return readers
+}
+
+// Close 关闭所有 agent 连接
+func (r *Remote) Close() {
+	if r == nil {
+		return
+	}
+	for _, client := range r.clients {
+		client.Close()
+	}
+}
+
+// Sync 按配置的同步模式同步对比结果，冲突和同步结果输出到 printer
+//
+// 部分操作失败时返回 ErrSyncFailed；双向同步读取或保存基线失败时返回对应的错误，
+// 保存基线失败时已执行的操作仍会输出，且有操作失败时返回的错误同时包含 ErrSyncFailed。
+func Sync(cfg *config.Config, dryRun bool, cache *hashcache.Cache, results []*models.DiffResult, printer reporter.Printer) error {
+	options := cfg.SyncOptions(dryRun, cache)
+	var syncResults []*models.SyncResult
+	var syncErr error
+	if cfg.Sync.Mode == config.SyncModeBidirectional {
+		statePath, err := cfg.SyncStatePath()
+		if err != nil {
+			return err
+		}
+		var conflicts []*models.SyncConflict
+		syncResults, conflicts, syncErr = syncer.NewBidirectional(cfg.LeftDir, cfg.RightDir, statePath, options).Sync(results)
+		printer.PrintConflicts(conflicts)
+	} else {
+		syncResults = syncer.NewSyncer(cfg.LeftDir, cfg.RightDir, options).Sync(results)
+	}
+	if syncErr == nil || syncResults != nil {
+		printer.PrintSyncResults(syncResults)
+	}
+
+	for _, result := range syncResults {
+		if result.Error != nil && syncErr != nil {
+			return errors.Join(syncErr, ErrSyncFailed)
+		}
+		if result.Error != nil {
+			return ErrSyncFailed
+		}
+	}
+	return syncErr
+}
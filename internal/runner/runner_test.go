@@ -0,0 +1,144 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"file_syn/internal/config"
+	"file_syn/internal/diff"
+	"file_syn/internal/reporter"
+)
+
+// newConfig 创建对比两个临时目录的配置
+func newConfig(t *testing.T) *config.Config {
+	cfg := &config.Config{LeftDir: t.TempDir(), RightDir: t.TempDir(), HashCache: config.HashCacheDisabled}
+	if err := cfg.Finish(); err != nil {
+		t.Fatalf("配置无效: %v", err)
+	}
+	return cfg
+}
+
+// compareAndSync 对比配置中的两个目录并同步
+func compareAndSync(t *testing.T, cfg *config.Config, dryRun bool) error {
+	results, err := diff.NewComparer().Compare(cfg.LeftDir, cfg.RightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	printer, err := reporter.NewWithOptions(reporter.FormatJSON, io.Discard, reporter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Sync(cfg, dryRun, nil, results, printer)
+}
+
+func TestSyncModes(t *testing.T) {
+	cfg := newConfig(t)
+	if err := os.WriteFile(filepath.Join(cfg.LeftDir, "a.txt"), []byte("left"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := compareAndSync(t, cfg, true); err != nil {
+		t.Fatalf("演练失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.RightDir, "a.txt")); !os.IsNotExist(err) {
+		t.Fatal("演练模式不应修改右侧目录")
+	}
+	if err := compareAndSync(t, cfg, false); err != nil {
+		t.Fatalf("镜像同步失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.RightDir, "a.txt")); err != nil {
+		t.Errorf("a.txt 未复制到右侧: %v", err)
+	}
+
+	// 双向同步：右侧新建的文件复制到左侧，并写入基线文件
+	cfg.Sync.Mode = config.SyncModeBidirectional
+	cfg.Sync.StateFile = filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(filepath.Join(cfg.RightDir, "b.txt"), []byte("right"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := compareAndSync(t, cfg, false); err != nil {
+		t.Fatalf("双向同步失败: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.LeftDir, "b.txt")); err != nil {
+		t.Errorf("b.txt 未复制到左侧: %v", err)
+	}
+	if _, err := os.Stat(cfg.Sync.StateFile); err != nil {
+		t.Errorf("未写入基线文件: %v", err)
+	}
+}
+
+func TestSyncFailed(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root 用户可以写入只读目录")
+	}
+	cfg := newConfig(t)
+	if err := os.WriteFile(filepath.Join(cfg.LeftDir, "a.txt"), []byte("left"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(cfg.RightDir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(cfg.RightDir, 0755)
+
+	if err := compareAndSync(t, cfg, false); !errors.Is(err, ErrSyncFailed) {
+		t.Errorf("期望 ErrSyncFailed，实际 %v", err)
+	}
+}
+
+func TestSyncSaveStateFailed(t *testing.T) {
+	cfg := newConfig(t)
+	cfg.Sync.Mode = config.SyncModeBidirectional
+	// 同步把左侧的普通文件 state 复制到右侧后，无法再在其中创建基线文件
+	cfg.Sync.StateFile = filepath.Join(cfg.RightDir, "state", "state.json")
+	if err := os.WriteFile(filepath.Join(cfg.LeftDir, "state"), []byte("left"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := diff.NewComparer().Compare(cfg.LeftDir, cfg.RightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	var buf bytes.Buffer
+	printer, err := reporter.NewWithOptions(reporter.FormatJSON, &buf, reporter.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Sync(cfg, false, nil, results, printer)
+	if err == nil || errors.Is(err, ErrSyncFailed) {
+		t.Fatalf("期望保存基线失败的错误，实际 %v", err)
+	}
+	if err := printer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Operations []json.RawMessage `json:"operations"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("无法解析报告: %v", err)
+	}
+	if len(report.Operations) != 1 {
+		t.Errorf("保存基线失败时仍应输出已执行的操作: %s", buf.Bytes())
+	}
+}
+
+func TestLocalPair(t *testing.T) {
+	cfg := newConfig(t)
+	if cache := OpenHashCache(cfg, t.Logf); cache != nil {
+		t.Error("未开启内容校验时不应打开摘要缓存")
+	}
+	SaveHashCache(nil, t.Logf)
+
+	remote, err := StartRemote(cfg, t.Logf)
+	if err != nil || remote != nil {
+		t.Errorf("本地目录不应启动 agent: %v %v", remote, err)
+	}
+	if remote.Openers() != nil || remote.Readers() != nil {
+		t.Error("本地目录不应有远程数据源")
+	}
+	remote.Close()
+}
@@ -0,0 +1,79 @@
+//go:build linux
+
+package scanner
+
+import (
+	"os"
+	"strings"
+	"syscall"
+
+	"file_syn/internal/xattr"
+	"file_syn/pkg/models"
+)
+
+// readMetadata 按选项读取扩展元数据
+//
+// path 为符号链接（未跟随）时只收集属主，扩展属性和 ACL 不适用于链接本身。
+func readMetadata(path string, info os.FileInfo, options models.MetadataOptions) (*models.Metadata, error) {
+	meta := &models.Metadata{Collected: options}
+	if options.Owner {
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			meta.UID, meta.GID = st.Uid, st.Gid
+		} else {
+			meta.Collected.Owner = false
+		}
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		meta.Collected.Xattrs = false
+		meta.Collected.ACL = false
+		return meta, nil
+	}
+
+	if options.Xattrs {
+		names, err := xattr.List(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			if xattr.IsACL(name) {
+				continue
+			}
+			value, err := xattr.Get(path, name)
+			if xattr.IsNotExist(err) {
+				// 列出后被删除
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if meta.Xattrs == nil {
+				meta.Xattrs = make(map[string][]byte)
+			}
+			meta.Xattrs[name] = value
+		}
+	}
+
+	if options.ACL {
+		var parts []string
+		for _, name := range xattr.ACLNames(info.IsDir()) {
+			data, err := xattr.Get(path, name)
+			if xattr.IsNotExist(err) {
+				// 只有基本权限，没有扩展 ACL
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			text, err := xattr.FormatACL(data)
+			if err != nil {
+				return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+			}
+			if name == xattr.ACLDefault {
+				text = "default:" + strings.ReplaceAll(text, ",", ",default:")
+			}
+			parts = append(parts, text)
+		}
+		meta.ACL = strings.Join(parts, ",")
+	}
+	return meta, nil
+}
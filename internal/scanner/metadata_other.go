@@ -0,0 +1,14 @@
+//go:build !linux
+
+package scanner
+
+import (
+	"os"
+
+	"file_syn/pkg/models"
+)
+
+// readMetadata 当前平台不收集扩展元数据
+func readMetadata(path string, info os.FileInfo, options models.MetadataOptions) (*models.Metadata, error) {
+	return nil, nil
+}
@@ -0,0 +1,149 @@
+package scanner
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultProgressInterval 默认的进度报告间隔
+const DefaultProgressInterval = 200 * time.Millisecond
+
+// Progress 扫描进度
+type Progress struct {
+	Entries     int64         // 已扫描的条目数
+	HashedBytes int64         // 已计算摘要的字节数（摘要缓存命中的文件也计入）
+	TotalBytes  int64         // 目前已发现的需要计算摘要的字节数
+	Path        string        // 最近扫描的路径（相对路径）
+	Elapsed     time.Duration // 已用时间
+	ETA         time.Duration // 按摘要速度估算的剩余时间（未开启内容校验或无法估计时为 0）
+}
+
+// Tracker 汇总扫描进度并定期通过回调函数报告
+//
+// 多个扫描器可以共享同一个 Tracker（如对比时的两侧目录）。回调函数只在
+// Tracker 的报告协程中调用，不会并发执行；Stop 返回后不再调用。
+// 所有方法都可以在 nil 上调用（不统计进度）。
+type Tracker struct {
+	fn       func(Progress)
+	interval time.Duration
+	start    time.Time
+
+	entries     atomic.Int64
+	hashedBytes atomic.Int64
+	totalBytes  atomic.Int64
+	path        atomic.Value // string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewTracker 创建进度汇总器，interval <= 0 时使用 DefaultProgressInterval
+func NewTracker(fn func(Progress), interval time.Duration) *Tracker {
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	return &Tracker{fn: fn, interval: interval}
+}
+
+// Start 开始计时并启动报告协程
+func (t *Tracker) Start() {
+	if t == nil {
+		return
+	}
+	t.start = time.Now()
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.fn(t.Progress())
+			case <-t.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止报告协程，并以最终进度调用一次回调函数
+func (t *Tracker) Stop() {
+	if t == nil || t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	t.stop = nil
+	t.fn(t.Progress())
+}
+
+// Progress 返回当前的进度
+func (t *Tracker) Progress() Progress {
+	if t == nil {
+		return Progress{}
+	}
+	p := Progress{
+		Entries:     t.entries.Load(),
+		HashedBytes: t.hashedBytes.Load(),
+		TotalBytes:  t.totalBytes.Load(),
+		Elapsed:     time.Since(t.start),
+	}
+	p.Path, _ = t.path.Load().(string)
+
+	// 按已完成的摘要速度估算剩余的摘要时间
+	if p.HashedBytes > 0 && p.TotalBytes > p.HashedBytes {
+		rate := float64(p.HashedBytes) / p.Elapsed.Seconds()
+		p.ETA = time.Duration(float64(p.TotalBytes-p.HashedBytes) / rate * float64(time.Second))
+	}
+	return p
+}
+
+// addEntry 记录扫描到的条目
+func (t *Tracker) addEntry(path string) {
+	if t == nil {
+		return
+	}
+	t.entries.Add(1)
+	t.path.Store(path)
+}
+
+// setPath 记录正在处理的路径（如正在计算摘要的文件）
+func (t *Tracker) setPath(path string) {
+	if t != nil {
+		t.path.Store(path)
+	}
+}
+
+// addPending 记录发现的需要计算摘要的字节数
+func (t *Tracker) addPending(n int64) {
+	if t != nil {
+		t.totalBytes.Add(n)
+	}
+}
+
+// addHashed 记录已计算摘要的字节数
+func (t *Tracker) addHashed(n int64) {
+	if t != nil {
+		t.hashedBytes.Add(n)
+	}
+}
+
+// contextReader 读取时检查上下文并统计读取的字节数
+type contextReader struct {
+	ctx     context.Context
+	r       io.Reader
+	tracker *Tracker
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	r.tracker.addHashed(int64(n))
+	return n, err
+}
@@ -1,62 +1,524 @@
 package scanner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 
+	"file_syn/internal/hashcache"
+	"file_syn/internal/hasher"
+	"file_syn/internal/ignore"
 	"file_syn/pkg/models"
 )
 
+// Options 扫描选项
+type Options struct {
+	HashAlgo  string           // 内容摘要算法（为空时不计算摘要）
+	HashCache *hashcache.Cache // 摘要缓存（为 nil 时每次都重新计算）
+
+	Exclude    []string // .gitignore 语法的排除规则
+	Include    []string // 重新包含被排除路径的规则（优先级最高）
+	IgnoreFile string   // 目录级忽略文件名（如 .filesynignore，为空时不读取）
+
+	FollowSymlinks bool                   // 跟随符号链接，按链接目标记录（悬空和形成循环的链接仍按符号链接记录）
+	Metadata       models.MetadataOptions // 收集的扩展元数据（仅 Linux）
+
+	Workers int      // 并发读取目录和计算摘要的工作协程数（<= 0 时使用 DefaultWorkers）
+	Tracker *Tracker // 扫描进度汇总（为 nil 时不统计进度）
+}
+
 // FileScanner 文件扫描器
 type FileScanner struct {
 	rootPath string
+	options  Options
 	files    map[string]*models.FileInfo
+
+	errors []*models.ScanError // 扫描过程中遇到的错误
+	index  *ErrorIndex         // 按路径索引的扫描错误
+
+	mu sync.Mutex // 保护 files 和错误记录（扫描时由多个工作协程写入）
 }
 
 // NewFileScanner 创建新的文件扫描器
 func NewFileScanner(rootPath string) *FileScanner {
+	return NewFileScannerWithOptions(rootPath, Options{})
+}
+
+// NewFileScannerWithOptions 使用指定选项创建文件扫描器
+func NewFileScannerWithOptions(rootPath string, options Options) *FileScanner {
 	return &FileScanner{
 		rootPath: rootPath,
+		options:  options,
 		files:    make(map[string]*models.FileInfo),
+		index:    NewErrorIndex(),
 	}
 }
 
 // Scan 扫描目录
 func (fs *FileScanner) Scan() error {
-	return filepath.Walk(fs.rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			// 如果无法访问某个文件，记录错误但继续扫描
-			fmt.Fprintf(os.Stderr, "警告: 无法访问 %s: %v\n", path, err)
-			return nil
+	return fs.ScanContext(context.Background())
+}
+
+// ScanContext 扫描目录，ctx 被取消时尽快停止并返回 ctx.Err()
+//
+// 目录的读取和文件摘要的计算由 Options.Workers 个工作协程并发执行，
+// 扫描结果与并发数无关。
+func (fs *FileScanner) ScanContext(ctx context.Context) error {
+	rootMatcher, err := fs.prepare()
+	if err != nil {
+		return err
+	}
+
+	w := newWalker(ctx, fs, fs.workers())
+	w.enqueue(&job{
+		absPath:   fs.rootPath,
+		matcher:   fs.loadIgnoreFile(rootMatcher, "", fs.rootPath),
+		ancestors: fs.rootAncestors(),
+	})
+	w.wait()
+	return ctx.Err()
+}
+
+// RescanContext 重新扫描 path（相对路径）及其下的全部条目，path 为空字符串时重新扫描整个目录
+//
+// 上一次扫描中 path 及其下的条目和扫描错误被替换为本次扫描的结果，其他条目不变，
+// 用于监测目录变化时增量更新扫描结果。path 的上级目录没有扫描到（不存在或被排除）时
+// 只删除旧的结果；path 已不存在时同样只删除旧的结果。
+func (fs *FileScanner) RescanContext(ctx context.Context, path string) error {
+	rootMatcher, err := fs.prepare()
+	if err != nil {
+		return err
+	}
+	fs.forget(path)
+	if path == "" {
+		return fs.ScanContext(ctx)
+	}
+
+	parentRel, name := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		parentRel, name = path[:i], path[i+1:]
+	}
+	parent, ok := fs.parentJob(rootMatcher, parentRel)
+	if !ok {
+		return nil
+	}
+	info, err := os.Lstat(filepath.Join(parent.absPath, name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fs.fail(models.ScanOpLstat, path, err)
 		}
+		return nil
+	}
 
-		// 计算相对路径
-		relPath, err := filepath.Rel(fs.rootPath, path)
-		if err != nil {
-			relPath = path
+	w := newWalker(ctx, fs, fs.workers())
+	fs.scanEntry(w, parent, iofs.FileInfoToDirEntry(info))
+	w.wait()
+	return ctx.Err()
+}
+
+// parentJob 重建读取目录 relDir 时使用的排除规则和上级目录，relDir 没有作为目录扫描到时返回 false
+//
+// 各级目录的忽略文件在上一次扫描时已经读取过，读取失败的错误已经记录，这里不再重复记录。
+func (fs *FileScanner) parentJob(rootMatcher *ignore.Matcher, relDir string) (*job, bool) {
+	dir := &job{absPath: fs.rootPath, ancestors: fs.rootAncestors()}
+	dir.matcher = fs.reloadIgnoreFile(rootMatcher, "", fs.rootPath)
+	if relDir == "" {
+		return dir, true
+	}
+	for _, name := range strings.Split(relDir, "/") {
+		relPath := name
+		if dir.relPath != "" {
+			relPath = dir.relPath + "/" + name
+		}
+		fs.mu.Lock()
+		fileInfo := fs.files[relPath]
+		fs.mu.Unlock()
+		if fileInfo == nil || !fileInfo.IsDir {
+			return nil, false
 		}
+		next := &job{relPath: relPath, absPath: filepath.Join(dir.absPath, name)}
+		next.matcher = fs.reloadIgnoreFile(dir.matcher, relPath, next.absPath)
+		if fs.options.FollowSymlinks {
+			info, err := os.Stat(next.absPath)
+			if err != nil {
+				return nil, false
+			}
+			next.ancestors = fs.childAncestors(dir.ancestors, info)
+		}
+		dir = next
+	}
+	return dir, true
+}
 
-		// 统一路径分隔符为 /
-		relPath = filepath.ToSlash(relPath)
+// reloadIgnoreFile 与 loadIgnoreFile 相同，但不记录读取失败的错误
+func (fs *FileScanner) reloadIgnoreFile(parent *ignore.Matcher, relDir, absDir string) *ignore.Matcher {
+	if fs.options.IgnoreFile == "" {
+		return parent
+	}
+	matcher, _ := parent.WithFile(relDir, filepath.Join(absDir, fs.options.IgnoreFile))
+	return matcher
+}
 
-		// 跳过根目录本身
-		if relPath == "." {
-			return nil
+// forget 删除 path 及其下的条目和扫描错误，path 为空字符串时删除全部
+func (fs *FileScanner) forget(path string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	for p := range fs.files {
+		if Within(p, path) {
+			delete(fs.files, p)
 		}
+	}
+	fs.errors = slices.DeleteFunc(fs.errors, func(e *models.ScanError) bool {
+		return Within(e.Path, path)
+	})
+	fs.index = NewErrorIndex()
+	for _, e := range fs.errors {
+		fs.index.Add(e.Op, e.Path)
+	}
+}
+
+// Within 判断相对路径 path 是否是 dir 本身或位于 dir 之下（dir 为空字符串表示根目录）
+func Within(path, dir string) bool {
+	return dir == "" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// WithinAny 判断相对路径 path 是否是 dirs 中某个目录本身或位于其下，耗时只与 path 的深度有关
+func WithinAny(path string, dirs map[string]bool) bool {
+	for {
+		if dirs[path] {
+			return true
+		}
+		if path == "" {
+			return false
+		}
+		if i := strings.LastIndex(path, "/"); i >= 0 {
+			path = path[:i]
+		} else {
+			path = ""
+		}
+	}
+}
+
+// workers 返回扫描使用的工作协程数
+func (fs *FileScanner) workers() int {
+	if fs.options.Workers <= 0 {
+		return DefaultWorkers()
+	}
+	return fs.options.Workers
+}
 
-		fileInfo := &models.FileInfo{
-			Path:    relPath,
-			Size:    info.Size(),
-			ModTime: info.ModTime(),
-			IsDir:   info.IsDir(),
-			Mode:    info.Mode(),
-			AbsPath: path,
+// prepare 检查扫描选项并创建根目录的排除规则匹配器
+func (fs *FileScanner) prepare() (*ignore.Matcher, error) {
+	if fs.options.HashAlgo != "" {
+		if _, err := hasher.New(fs.options.HashAlgo); err != nil {
+			return nil, err
 		}
+	}
+
+	rootMatcher, err := ignore.New(fs.options.Exclude, fs.options.Include)
+	if err != nil {
+		return nil, fmt.Errorf("无效的排除规则: %v", err)
+	}
+	return rootMatcher, nil
+}
 
-		fs.files[relPath] = fileInfo
+// scanDir 读取目录中的条目，记录未被排除的文件并提交子目录和摘要任务
+func (fs *FileScanner) scanDir(w *walker, dir *job) {
+	if w.ctx.Err() != nil {
+		return
+	}
+	for _, entry := range fs.readDir(dir.relPath, dir.absPath) {
+		if w.ctx.Err() != nil {
+			return
+		}
+		fs.scanEntry(w, dir, entry)
+	}
+}
+
+// scanEntry 记录目录 dir 中的一个条目（未被排除时），并提交子目录或摘要任务
+func (fs *FileScanner) scanEntry(w *walker, dir *job, entry os.DirEntry) {
+	fileInfo, info := fs.entryInfo(dir.matcher, dir.relPath, dir.absPath, dir.ancestors, entry)
+	if fileInfo == nil {
+		return
+	}
+	fs.store(fileInfo)
+
+	switch {
+	case info.IsDir():
+		w.enqueue(&job{
+			relPath:   fileInfo.Path,
+			absPath:   fileInfo.AbsPath,
+			matcher:   fs.loadIgnoreFile(dir.matcher, fileInfo.Path, fileInfo.AbsPath),
+			ancestors: fs.childAncestors(dir.ancestors, info),
+		})
+	case fs.options.HashAlgo != "" && info.Mode().IsRegular():
+		// 计算普通文件的内容摘要
+		fs.options.Tracker.addPending(info.Size())
+		w.enqueue(&job{file: fileInfo, info: info})
+	}
+}
+
+// readDir 读取目录中按名称排序的条目
+func (fs *FileScanner) readDir(relDir, absDir string) []os.DirEntry {
+	entries, err := os.ReadDir(absDir)
+	if err != nil {
+		// 如果无法访问某个目录，记录错误但继续扫描已读取的条目
+		fs.fail(models.ScanOpReadDir, relDir, err)
+	}
+	return entries
+}
+
+// entryInfo 读取目录条目的文件信息，条目被排除或无法访问时返回 nil
+//
+// ancestors 为条目所在目录及其各级上级目录，跟随符号链接时用于检测循环。
+func (fs *FileScanner) entryInfo(matcher *ignore.Matcher, relDir, absDir string, ancestors []os.FileInfo, entry os.DirEntry) (*models.FileInfo, os.FileInfo) {
+	path := filepath.Join(absDir, entry.Name())
+	relPath := entry.Name()
+	if relDir != "" {
+		relPath = relDir + "/" + relPath
+	}
+
+	info, err := entry.Info()
+	if err != nil {
+		fs.fail(models.ScanOpLstat, relPath, err)
+		return nil, nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 && fs.options.FollowSymlinks {
+		if target := fs.follow(relPath, path, ancestors); target != nil {
+			info = target
+		}
+	}
+
+	// 按照所在目录的规则判断是否排除，被排除的目录直接剪枝不再遍历
+	if matcher.Match(relPath, info.IsDir()) {
+		return nil, nil
+	}
+
+	fileInfo := &models.FileInfo{
+		Path:    relPath,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+		Mode:    info.Mode(),
+		AbsPath: path,
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(path)
+		if err != nil {
+			fs.fail(models.ScanOpReadlink, relPath, err)
+			return nil, nil
+		}
+		fileInfo.IsSymlink = true
+		fileInfo.LinkTarget = target
+	}
+	if fs.options.Metadata.Any() {
+		meta, err := readMetadata(path, info, fs.options.Metadata)
+		if err != nil {
+			// 元数据不完整，该条目的对比结果为无法确定
+			fs.fail(models.ScanOpMetadata, relPath, err)
+		}
+		fileInfo.Meta = meta
+	}
+	fs.options.Tracker.addEntry(relPath)
+	return fileInfo, info
+}
+
+// follow 跟随符号链接，返回链接目标的文件信息
+//
+// 目标不存在（悬空链接）时返回 nil；目标是 ancestors 中的某个目录时，
+// 进入该链接会形成循环，记录扫描错误并返回 nil。返回 nil 时条目按符号链接记录。
+func (fs *FileScanner) follow(relPath, path string, ancestors []os.FileInfo) os.FileInfo {
+	info, err := os.Stat(path)
+	if err != nil {
 		return nil
+	}
+	if info.IsDir() {
+		for _, ancestor := range ancestors {
+			if os.SameFile(info, ancestor) {
+				fs.fail(models.ScanOpSymlinkLoop, relPath, errSymlinkLoop)
+				return nil
+			}
+		}
+	}
+	return info
+}
+
+// errSymlinkLoop 符号链接指向自身所在的目录或其上级目录
+var errSymlinkLoop = errors.New("符号链接指向上级目录，跟随会形成循环")
+
+// rootAncestors 返回根目录作为循环检测的起点，不跟随符号链接时返回 nil
+func (fs *FileScanner) rootAncestors() []os.FileInfo {
+	if !fs.options.FollowSymlinks {
+		return nil
+	}
+	info, err := os.Stat(fs.rootPath)
+	if err != nil {
+		return nil
+	}
+	return []os.FileInfo{info}
+}
+
+// childAncestors 返回子目录 dir 的各级上级目录（含自身），不跟随符号链接时返回 nil
+func (fs *FileScanner) childAncestors(ancestors []os.FileInfo, dir os.FileInfo) []os.FileInfo {
+	if !fs.options.FollowSymlinks {
+		return nil
+	}
+	return append(slices.Clip(ancestors), dir)
+}
+
+// hashFile 计算文件的内容摘要
+func (fs *FileScanner) hashFile(ctx context.Context, fileInfo *models.FileInfo, info os.FileInfo) {
+	if ctx.Err() != nil {
+		return
+	}
+	fs.options.Tracker.setPath(fileInfo.Path)
+	digest, err := fs.digest(ctx, fileInfo.AbsPath, info)
+	if err != nil {
+		if ctx.Err() != nil {
+			// 扫描被取消，不视为扫描错误
+			return
+		}
+		fs.fail(models.ScanOpHash, fileInfo.Path, err)
+		return
+	}
+	fileInfo.Digest = digest
+}
+
+// store 记录扫描到的文件
+func (fs *FileScanner) store(fileInfo *models.FileInfo) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.files[fileInfo.Path] = fileInfo
+}
+
+// fail 记录扫描错误
+func (fs *FileScanner) fail(op, relPath string, err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.errors = append(fs.errors, &models.ScanError{Path: relPath, Op: op, Err: err})
+	fs.index.Add(op, relPath)
+}
+
+// loadIgnoreFile 读取目录下的忽略文件，返回该目录使用的匹配器
+func (fs *FileScanner) loadIgnoreFile(parent *ignore.Matcher, relDir, absDir string) *ignore.Matcher {
+	if fs.options.IgnoreFile == "" {
+		return parent
+	}
+	path := filepath.Join(absDir, fs.options.IgnoreFile)
+	matcher, err := parent.WithFile(relDir, path)
+	if err != nil {
+		// 目录本身无法访问时只记录读取目录的错误
+		if _, statErr := os.Lstat(path); statErr != nil && !os.IsNotExist(statErr) {
+			return matcher
+		}
+		relPath := fs.options.IgnoreFile
+		if relDir != "" {
+			relPath = relDir + "/" + relPath
+		}
+		fs.fail(models.ScanOpIgnoreFile, relPath, err)
+	}
+	return matcher
+}
+
+// digest 计算文件摘要，stat 信息未变化时复用缓存中的摘要
+func (fs *FileScanner) digest(ctx context.Context, path string, info os.FileInfo) (string, error) {
+	cache := fs.options.HashCache
+	if cache != nil {
+		if digest, ok := cache.Lookup(path, info, fs.options.HashAlgo); ok {
+			fs.options.Tracker.addHashed(info.Size())
+			return digest, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	digest, err := hasher.HashReader(&contextReader{ctx: ctx, r: f, tracker: fs.options.Tracker}, fs.options.HashAlgo)
+	if err != nil {
+		return "", err
+	}
+	if cache != nil {
+		cache.Store(path, info, fs.options.HashAlgo, digest)
+	}
+	return digest, nil
+}
+
+// Errors 返回扫描过程中遇到的错误，按路径排序
+func (fs *FileScanner) Errors() []*models.ScanError {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	errors := slices.Clone(fs.errors)
+	slices.SortStableFunc(errors, func(a, b *models.ScanError) int {
+		return ComparePaths(a.Path, b.Path)
 	})
+	return errors
+}
+
+// Unknown 判断 path 在本侧的状态是否因扫描错误而无法确定，见 ErrorIndex.Unknown
+func (fs *FileScanner) Unknown(path string, exists bool) bool {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.index.Unknown(path, exists)
+}
+
+// ErrorIndex 按路径索引扫描错误，用于判断路径的状态是否因扫描错误而无法确定
+type ErrorIndex struct {
+	dirs  map[string]bool // 无法读取的目录（其中的条目没有扫描到）
+	paths map[string]bool // 无法访问或无法计算摘要的路径
+}
+
+// NewErrorIndex 创建空的扫描错误索引
+func NewErrorIndex() *ErrorIndex {
+	return &ErrorIndex{
+		dirs:  make(map[string]bool),
+		paths: make(map[string]bool),
+	}
+}
+
+// Add 记录在 path 上执行 op 时发生的扫描错误（不影响条目状态的错误被忽略）
+func (x *ErrorIndex) Add(op, path string) {
+	switch op {
+	case models.ScanOpReadDir:
+		x.dirs[path] = true
+	case models.ScanOpLstat, models.ScanOpReadlink, models.ScanOpMetadata, models.ScanOpHash:
+		x.paths[path] = true
+	}
+}
+
+// Unknown 判断 path 的状态是否因扫描错误而无法确定
+//
+// exists 表示 path 是否被扫描到：扫描到时只检查 path 本身的错误（如无法计算摘要）；
+// 没有扫描到时还检查 path 是否无法访问、所在的各级目录是否无法读取，
+// 这种情况下 path 可能存在，只是没有扫描到。
+func (x *ErrorIndex) Unknown(path string, exists bool) bool {
+	if len(x.dirs) == 0 && len(x.paths) == 0 {
+		return false
+	}
+	if x.paths[path] {
+		return true
+	}
+	if exists {
+		return false
+	}
+	for dir := path; dir != ""; {
+		if i := strings.LastIndex(dir, "/"); i >= 0 {
+			dir = dir[:i]
+		} else {
+			dir = ""
+		}
+		if x.dirs[dir] {
+			return true
+		}
+	}
+	return false
 }
 
 // GetFiles 获取所有文件信息
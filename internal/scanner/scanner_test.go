@@ -1,9 +1,20 @@
 package scanner
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"file_syn/internal/hashcache"
+	"file_syn/internal/xattr"
+	"file_syn/pkg/models"
 )
 
 func TestFileScanner(t *testing.T) {
@@ -59,3 +70,586 @@ func TestFileScanner(t *testing.T) {
 		t.Error("未找到 subdir/subfile.txt")
 	}
 }
+
+func TestFileScannerHashCache(t *testing.T) {
+	tmpDir := t.TempDir()
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test content"), 0644); err != nil {
+		t.Fatalf("无法创建测试文件: %v", err)
+	}
+	info, err := os.Lstat(testFile)
+	if err != nil {
+		t.Fatalf("无法读取文件信息: %v", err)
+	}
+
+	cache, err := hashcache.Open(filepath.Join(t.TempDir(), hashcache.DefaultFileName))
+	if err != nil {
+		t.Fatalf("打开缓存失败: %v", err)
+	}
+	// 预先写入一个伪造的摘要：stat 信息未变化时扫描器应直接复用
+	cache.Store(testFile, info, "sha256", "cached-digest")
+
+	scanner := NewFileScannerWithOptions(tmpDir, Options{HashAlgo: "sha256", HashCache: cache})
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if digest := scanner.GetFiles()["test.txt"].Digest; digest != "cached-digest" {
+		t.Errorf("期望复用缓存摘要，实际 %s", digest)
+	}
+
+	// 文件变化后应重新计算摘要
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(testFile, later, later); err != nil {
+		t.Fatalf("无法设置修改时间: %v", err)
+	}
+	scanner = NewFileScannerWithOptions(tmpDir, Options{HashAlgo: "sha256", HashCache: cache})
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if digest := scanner.GetFiles()["test.txt"].Digest; digest == "cached-digest" || digest == "" {
+		t.Errorf("文件变化后应重新计算摘要，实际 %s", digest)
+	}
+}
+
+func TestFileScannerIgnore(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":                 "package main",
+		"main.go.swp":             "swap",
+		".git/HEAD":               "ref",
+		"web/node_modules/x/a.js": "js",
+		"web/app.js":              "js",
+		"logs/app.log":            "log",
+		"logs/keep.log":           "log",
+		"sub/.filesynignore":      "local.txt\n!*.swp\n",
+		"sub/local.txt":           "local",
+		"sub/b.swp":               "swap",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建测试文件: %v", err)
+		}
+	}
+
+	scanner := NewFileScannerWithOptions(tmpDir, Options{
+		Exclude:    []string{".git/", "node_modules/", "*.swp", "*.log"},
+		Include:    []string{"keep.log"},
+		IgnoreFile: ".filesynignore",
+	})
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+
+	expected := []string{
+		"main.go",
+		"web", "web/app.js",
+		"logs", "logs/keep.log",
+		"sub", "sub/.filesynignore", "sub/b.swp",
+	}
+	found := scanner.GetFiles()
+	if len(found) != len(expected) {
+		var got []string
+		for path := range found {
+			got = append(got, path)
+		}
+		t.Errorf("期望 %d 个文件，实际 %d 个: %v", len(expected), len(found), got)
+	}
+	for _, path := range expected {
+		if _, exists := found[path]; !exists {
+			t.Errorf("未找到 %s", path)
+		}
+	}
+}
+
+func TestFileScannerErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	// 与忽略文件同名的目录无法作为忽略文件读取，扫描继续但记录扫描错误
+	if err := os.MkdirAll(filepath.Join(tmpDir, "sub", ".filesynignore"), 0755); err != nil {
+		t.Fatalf("无法创建目录: %v", err)
+	}
+
+	scanner := NewFileScannerWithOptions(tmpDir, Options{IgnoreFile: ".filesynignore"})
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	errors := scanner.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("期望 1 个扫描错误，实际 %d 个", len(errors))
+	}
+	if errors[0].Op != models.ScanOpIgnoreFile || errors[0].Path != "sub/.filesynignore" {
+		t.Errorf("扫描错误不正确: %+v", errors[0])
+	}
+	if _, exists := scanner.GetFiles()["sub"]; !exists {
+		t.Error("出现扫描错误后应继续扫描")
+	}
+	if scanner.Unknown("sub", true) {
+		t.Error("忽略文件读取失败不应使目录状态无法确定")
+	}
+}
+
+func TestFileScannerWalk(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"a", "a/b", "a-b", "c"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, dir), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+	}
+	for _, file := range []string{"a/x.txt", "a/b/y.txt", "a-b/z.txt", "a.txt", "c/skip.log"} {
+		if err := os.WriteFile(filepath.Join(tmpDir, file), []byte(file), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+
+	options := Options{HashAlgo: "sha256", Exclude: []string{"*.log"}}
+	scanner := NewFileScannerWithOptions(tmpDir, options)
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	files, err := NewFileScannerWithOptions(tmpDir, options).Walk()
+	if err != nil {
+		t.Fatalf("流式扫描失败: %v", err)
+	}
+
+	// 流式扫描按路径分量的顺序产出，与 Scan 的结果一致
+	want := []string{"a", "a/b", "a/b/y.txt", "a/x.txt", "a-b", "a-b/z.txt", "a.txt", "c"}
+	var got []string
+	for file := range files {
+		got = append(got, file.Path)
+		scanned := scanner.GetFiles()[file.Path]
+		if scanned == nil || scanned.Digest != file.Digest || scanned.Size != file.Size {
+			t.Errorf("%s 的流式扫描结果与 Scan 不一致", file.Path)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("期望顺序 %v，实际 %v", want, got)
+	}
+
+	// 提前停止遍历
+	count := 0
+	for range files {
+		count++
+		if count == 2 {
+			break
+		}
+	}
+	if count != 2 {
+		t.Errorf("提前停止后期望遍历 2 个条目，实际 %d 个", count)
+	}
+}
+
+func TestFileScannerContext(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTree(t, tmpDir, 500)
+
+	// 已取消的上下文：扫描立即停止并返回 context.Canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := NewFileScanner(tmpDir).ScanContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("期望返回 context.Canceled，实际 %v", err)
+	}
+	files, err := NewFileScanner(tmpDir).WalkContext(ctx)
+	if err != nil {
+		t.Fatalf("流式扫描失败: %v", err)
+	}
+	for file := range files {
+		t.Errorf("取消后不应产出文件: %s", file.Path)
+	}
+
+	// 进度统计：条目数和摘要字节数与扫描结果一致
+	var calls []Progress
+	tracker := NewTracker(func(p Progress) { calls = append(calls, p) }, time.Hour)
+	scanner := NewFileScannerWithOptions(tmpDir, Options{HashAlgo: "sha256", Tracker: tracker})
+	tracker.Start()
+	if err := scanner.ScanContext(context.Background()); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	tracker.Stop()
+
+	var size int64
+	for _, file := range scanner.GetFiles() {
+		if !file.IsDir {
+			size += file.Size
+		}
+	}
+	if len(calls) != 1 {
+		t.Fatalf("Stop 应该以最终进度调用一次回调，实际调用 %d 次", len(calls))
+	}
+	final := calls[0]
+	if final.Entries != 500 || final.HashedBytes != size || final.TotalBytes != size || final.ETA != 0 {
+		t.Errorf("最终进度错误: %+v（期望 500 个条目，%d 字节）", final, size)
+	}
+}
+
+func TestComparePaths(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"a", "a", 0},
+		{"a", "b", -1},
+		{"a", "a/b", -1},
+		{"a/b", "a-b", -1},
+		{"a-b", "a/b", 1},
+		{"a/z", "a.txt", -1},
+		{"ab", "a/b", 1},
+	}
+	for _, tt := range tests {
+		if got := ComparePaths(tt.a, tt.b); got != tt.want {
+			t.Errorf("ComparePaths(%q, %q) = %d，期望 %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// createTree 在 root 下创建恰好 entries 个条目的目录树（每个目录 100 个文件、10 个子目录，最多 3 层）
+func createTree(tb testing.TB, root string, entries int) {
+	created := 0
+	var fill func(dir string, depth int)
+	fill = func(dir string, depth int) {
+		for i := 0; i < 100 && created < entries; i++ {
+			path := filepath.Join(dir, fmt.Sprintf("file%03d.txt", i))
+			if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+				tb.Fatalf("无法创建文件: %v", err)
+			}
+			created++
+		}
+		for i := 0; i < 10 && depth < 3 && created < entries; i++ {
+			sub := filepath.Join(dir, fmt.Sprintf("dir%d", i))
+			if err := os.Mkdir(sub, 0755); err != nil {
+				tb.Fatalf("无法创建目录: %v", err)
+			}
+			created++
+			fill(sub, depth+1)
+		}
+	}
+	for created < entries {
+		sub := filepath.Join(root, fmt.Sprintf("top%d", created))
+		if err := os.Mkdir(sub, 0755); err != nil {
+			tb.Fatalf("无法创建目录: %v", err)
+		}
+		created++
+		fill(sub, 0)
+	}
+}
+
+func TestFileScannerWorkers(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTree(t, tmpDir, 3000)
+
+	// 不同的并发数应得到完全相同的结果
+	var baseline map[string]*models.FileInfo
+	for _, workers := range []int{1, 2, 16} {
+		scanner := NewFileScannerWithOptions(tmpDir, Options{HashAlgo: "sha256", Workers: workers})
+		if err := scanner.Scan(); err != nil {
+			t.Fatalf("扫描失败: %v", err)
+		}
+		files := scanner.GetFiles()
+		if baseline == nil {
+			baseline = files
+			if len(files) != 3000 {
+				t.Fatalf("期望 3000 个条目，实际 %d 个", len(files))
+			}
+			continue
+		}
+		if len(files) != len(baseline) {
+			t.Fatalf("并发数 %d: 期望 %d 个条目，实际 %d 个", workers, len(baseline), len(files))
+		}
+		for path, want := range baseline {
+			got := files[path]
+			if got == nil || got.Digest != want.Digest || got.Size != want.Size || got.IsDir != want.IsDir {
+				t.Errorf("并发数 %d: %s 的扫描结果不一致", workers, path)
+			}
+		}
+	}
+}
+
+// BenchmarkScan 扫描目录树的性能
+//
+// 默认使用 1 万个条目，可以通过环境变量调整：
+//
+//	FILE_SYN_BENCH_ENTRIES=1000000  目录树的条目数
+//	FILE_SYN_BENCH_DIR=/path/to/dir 复用已有的目录树（不存在时在该目录下创建）
+func BenchmarkScan(b *testing.B) {
+	entries := 10000
+	if v := os.Getenv("FILE_SYN_BENCH_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			b.Fatalf("无效的 FILE_SYN_BENCH_ENTRIES: %v", err)
+		}
+		entries = n
+	}
+	root := os.Getenv("FILE_SYN_BENCH_DIR")
+	if root == "" {
+		root = b.TempDir()
+	}
+	root = filepath.Join(root, fmt.Sprintf("tree-%d", entries))
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			b.Fatalf("无法创建目录: %v", err)
+		}
+		createTree(b, root, entries)
+	}
+
+	for _, workers := range []int{1, 4, 16, 64} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				scanner := NewFileScannerWithOptions(root, Options{Workers: workers})
+				if err := scanner.Scan(); err != nil {
+					b.Fatalf("扫描失败: %v", err)
+				}
+				if len(scanner.GetFiles()) != entries {
+					b.Fatalf("期望 %d 个条目，实际 %d 个", entries, len(scanner.GetFiles()))
+				}
+			}
+			b.ReportMetric(float64(entries)*float64(b.N)/b.Elapsed().Seconds(), "entries/s")
+		})
+	}
+}
+
+func TestFileScannerUnknown(t *testing.T) {
+	scanner := NewFileScanner(t.TempDir())
+	scanner.fail(models.ScanOpReadDir, "locked", errors.New("permission denied"))
+	scanner.fail(models.ScanOpHash, "big.bin", errors.New("input/output error"))
+
+	tests := []struct {
+		path    string
+		exists  bool
+		unknown bool
+	}{
+		{"locked", true, false},
+		{"locked/a.txt", false, true},
+		{"locked/sub/b.txt", false, true},
+		{"locked-b.txt", false, false},
+		{"big.bin", true, true},
+		{"other.txt", false, false},
+	}
+	for _, tt := range tests {
+		if got := scanner.Unknown(tt.path, tt.exists); got != tt.unknown {
+			t.Errorf("Unknown(%q, %v) = %v，期望 %v", tt.path, tt.exists, got, tt.unknown)
+		}
+	}
+
+	// 根目录无法读取时所有未扫描到的路径都无法确定
+	scanner.fail(models.ScanOpReadDir, "", errors.New("permission denied"))
+	if !scanner.Unknown("other.txt", false) {
+		t.Error("根目录无法读取时 other.txt 应无法确定")
+	}
+}
+
+func TestFileScannerSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(tmpDir, "dir", "sub"), 0755); err != nil {
+		t.Fatalf("无法创建目录: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "dir", "file.txt"), []byte("content"), 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	links := map[string]string{
+		"file_link":    "dir/file.txt",
+		"dir_link":     "dir",
+		"dangling":     "missing.txt",
+		"dir/sub/loop": "../..",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(tmpDir, link)); err != nil {
+			t.Fatalf("无法创建符号链接: %v", err)
+		}
+	}
+
+	// 默认记录链接本身，不进入链接指向的目录
+	scanner := NewFileScannerWithOptions(tmpDir, Options{HashAlgo: "sha256"})
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	files := scanner.GetFiles()
+	for link, target := range links {
+		info := files[link]
+		if info == nil || !info.IsSymlink || info.IsDir || info.LinkTarget != target || info.Digest != "" {
+			t.Errorf("%s 应记录为指向 %s 的符号链接: %+v", link, target, info)
+		}
+	}
+	if _, exists := files["dir_link/file.txt"]; exists {
+		t.Error("不跟随符号链接时不应进入链接指向的目录")
+	}
+
+	// 跟随符号链接：按目标记录，悬空和形成循环的链接仍按符号链接记录
+	options := Options{HashAlgo: "sha256", FollowSymlinks: true}
+	scanner = NewFileScannerWithOptions(tmpDir, options)
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	files = scanner.GetFiles()
+	if info := files["file_link"]; info == nil || info.IsSymlink || info.Digest != files["dir/file.txt"].Digest {
+		t.Errorf("file_link 应按目标文件记录: %+v", info)
+	}
+	if info := files["dir_link"]; info == nil || !info.IsDir {
+		t.Errorf("dir_link 应按目录记录: %+v", info)
+	}
+	if _, exists := files["dir_link/file.txt"]; !exists {
+		t.Error("跟随符号链接时应进入链接指向的目录")
+	}
+	for _, link := range []string{"dangling", "dir/sub/loop", "dir_link/sub/loop"} {
+		if info := files[link]; info == nil || !info.IsSymlink {
+			t.Errorf("%s 应按符号链接记录: %+v", link, info)
+		}
+	}
+	errs := scanner.Errors()
+	if len(errs) != 2 || errs[0].Op != models.ScanOpSymlinkLoop || errs[0].Path != "dir/sub/loop" || errs[1].Path != "dir_link/sub/loop" {
+		t.Errorf("期望 2 个符号链接循环错误，实际 %v", errs)
+	}
+
+	// 流式扫描的结果与 Scan 一致
+	walker := NewFileScannerWithOptions(tmpDir, options)
+	seq, err := walker.Walk()
+	if err != nil {
+		t.Fatalf("流式扫描失败: %v", err)
+	}
+	count := 0
+	for file := range seq {
+		count++
+		scanned := files[file.Path]
+		if scanned == nil || scanned.IsSymlink != file.IsSymlink || scanned.IsDir != file.IsDir || scanned.Digest != file.Digest {
+			t.Errorf("%s 的流式扫描结果与 Scan 不一致", file.Path)
+		}
+	}
+	if count != len(files) || len(walker.Errors()) != 2 {
+		t.Errorf("流式扫描期望 %d 个条目和 2 个错误，实际 %d 个条目和 %d 个错误", len(files), count, len(walker.Errors()))
+	}
+}
+
+func TestFileScannerMetadata(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("扩展元数据仅在 Linux 上收集")
+	}
+	tmpDir := t.TempDir()
+	path := filepath.Join(tmpDir, "file.txt")
+	if err := os.WriteFile(path, []byte("content"), 0755); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	if err := xattr.Set(path, "user.label", []byte("blue")); err != nil {
+		t.Skipf("不支持扩展属性: %v", err)
+	}
+	// user::rwx,user:1000:r--,group::r-x,mask::r-x,other::r-x
+	acl := []byte{
+		2, 0, 0, 0,
+		0x01, 0, 7, 0, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0, 4, 0, 0xe8, 0x03, 0, 0,
+		0x04, 0, 5, 0, 0xff, 0xff, 0xff, 0xff,
+		0x10, 0, 5, 0, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0, 5, 0, 0xff, 0xff, 0xff, 0xff,
+	}
+	if err := xattr.Set(path, xattr.ACLAccess, acl); err != nil {
+		t.Skipf("不支持 ACL: %v", err)
+	}
+	if err := os.Symlink("file.txt", filepath.Join(tmpDir, "link")); err != nil {
+		t.Fatalf("无法创建符号链接: %v", err)
+	}
+
+	// 默认不收集扩展元数据
+	scanner := NewFileScanner(tmpDir)
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if meta := scanner.GetFiles()["file.txt"].Meta; meta != nil {
+		t.Errorf("未开启时不应收集扩展元数据: %+v", meta)
+	}
+
+	options := models.MetadataOptions{Owner: true, Special: true, Xattrs: true, ACL: true}
+	scanner = NewFileScannerWithOptions(tmpDir, Options{Metadata: options})
+	if err := scanner.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	files := scanner.GetFiles()
+	meta := files["file.txt"].Meta
+	if meta == nil || meta.Collected != options {
+		t.Fatalf("期望收集所有扩展元数据，实际 %+v", meta)
+	}
+	if meta.UID != uint32(os.Getuid()) || meta.GID != uint32(os.Getgid()) {
+		t.Errorf("期望属主 %d:%d，实际 %d:%d", os.Getuid(), os.Getgid(), meta.UID, meta.GID)
+	}
+	if len(meta.Xattrs) != 1 || string(meta.Xattrs["user.label"]) != "blue" {
+		t.Errorf("扩展属性应只包含 user.label（不含 ACL），实际 %v", meta.Xattrs)
+	}
+	if want := "user::rwx,user:1000:r--,group::r-x,mask::r-x,other::r-x"; meta.ACL != want {
+		t.Errorf("期望 ACL %s，实际 %s", want, meta.ACL)
+	}
+
+	// 符号链接只收集属主
+	link := files["link"].Meta
+	if link == nil || !link.Collected.Owner || link.Collected.Xattrs || link.Collected.ACL {
+		t.Errorf("符号链接应只收集属主: %+v", link)
+	}
+}
+
+func TestFileScannerRescan(t *testing.T) {
+	tmpDir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建测试文件: %v", err)
+		}
+	}
+	for name, content := range map[string]string{
+		"x.txt":              "x",
+		"sub/a.txt":          "a",
+		"sub/.filesynignore": "local*.txt\n",
+		"sub/deep/b.txt":     "b",
+		"other/c.txt":        "c",
+	} {
+		write(name, content)
+	}
+	// 与忽略文件同名的目录产生扫描错误，删除后重新扫描时错误应一并消失
+	if err := os.MkdirAll(filepath.Join(tmpDir, "other", ".filesynignore"), 0755); err != nil {
+		t.Fatalf("无法创建目录: %v", err)
+	}
+
+	options := Options{HashAlgo: "sha256", IgnoreFile: ".filesynignore"}
+	s := NewFileScannerWithOptions(tmpDir, options)
+	if err := s.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	if len(s.Errors()) != 1 {
+		t.Fatalf("期望 1 个扫描错误，实际 %v", s.Errors())
+	}
+
+	write("sub/a.txt", "changed")
+	write("sub/deep/new/d.txt", "d")
+	write("sub/local.txt", "excluded")
+	if err := os.Remove(filepath.Join(tmpDir, "x.txt")); err != nil {
+		t.Fatalf("无法删除文件: %v", err)
+	}
+	if err := os.Remove(filepath.Join(tmpDir, "other", ".filesynignore")); err != nil {
+		t.Fatalf("无法删除目录: %v", err)
+	}
+	for _, path := range []string{"sub/a.txt", "sub/deep/new", "sub/local.txt", "x.txt", "other", "missing/e.txt"} {
+		if err := s.RescanContext(context.Background(), path); err != nil {
+			t.Fatalf("重新扫描 %s 失败: %v", path, err)
+		}
+	}
+
+	// 增量扫描的结果与重新完整扫描一致
+	full := NewFileScannerWithOptions(tmpDir, options)
+	if err := full.Scan(); err != nil {
+		t.Fatalf("扫描失败: %v", err)
+	}
+	got, want := s.GetFiles(), full.GetFiles()
+	if len(got) != len(want) {
+		t.Errorf("期望 %d 个条目，实际 %d 个", len(want), len(got))
+	}
+	for path, file := range want {
+		if got[path] == nil {
+			t.Errorf("重新扫描后缺少 %s", path)
+		} else if got[path].Digest != file.Digest {
+			t.Errorf("%s 的摘要未更新", path)
+		}
+	}
+	if len(s.Errors()) != 0 {
+		t.Errorf("重新扫描后扫描错误应消失: %v", s.Errors())
+	}
+}
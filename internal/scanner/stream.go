@@ -0,0 +1,95 @@
+package scanner
+
+import (
+	"context"
+	"iter"
+	"os"
+
+	"file_syn/internal/ignore"
+	"file_syn/pkg/models"
+)
+
+// Walk 按路径顺序逐个产出扫描到的文件（流式扫描）
+func (fs *FileScanner) Walk() (iter.Seq[*models.FileInfo], error) {
+	return fs.WalkContext(context.Background())
+}
+
+// WalkContext 按路径顺序逐个产出扫描到的文件，ctx 被取消时提前结束
+//
+// 与 Scan 不同，Walk 不在内存中保存整棵目录树：目录按深度优先顺序遍历，
+// 同一目录下的条目按名称排序，内存占用只与当前路径上各级目录的条目数有关。
+// 产出顺序与 ComparePaths 一致。摘要在遍历时依次计算，GetFiles 不包含流式扫描的文件。
+func (fs *FileScanner) WalkContext(ctx context.Context) (iter.Seq[*models.FileInfo], error) {
+	rootMatcher, err := fs.prepare()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(yield func(*models.FileInfo) bool) {
+		matcher := fs.loadIgnoreFile(rootMatcher, "", fs.rootPath)
+		fs.walkDir(ctx, matcher, "", fs.rootPath, fs.rootAncestors(), yield)
+	}, nil
+}
+
+// walkDir 深度优先遍历目录，yield 返回 false 或 ctx 被取消时停止并返回 false
+func (fs *FileScanner) walkDir(ctx context.Context, matcher *ignore.Matcher, relDir, absDir string, ancestors []os.FileInfo, yield func(*models.FileInfo) bool) bool {
+	for _, entry := range fs.readDir(relDir, absDir) {
+		if ctx.Err() != nil {
+			return false
+		}
+		fileInfo, info := fs.entryInfo(matcher, relDir, absDir, ancestors, entry)
+		if fileInfo == nil {
+			continue
+		}
+		if fs.options.HashAlgo != "" && info.Mode().IsRegular() {
+			fs.options.Tracker.addPending(info.Size())
+			fs.hashFile(ctx, fileInfo, info)
+			if ctx.Err() != nil {
+				// 取消时摘要不完整，不再产出
+				return false
+			}
+		}
+		if !yield(fileInfo) {
+			return false
+		}
+
+		if info.IsDir() {
+			childMatcher := fs.loadIgnoreFile(matcher, fileInfo.Path, fileInfo.AbsPath)
+			if !fs.walkDir(ctx, childMatcher, fileInfo.Path, fileInfo.AbsPath, fs.childAncestors(ancestors, info), yield) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ComparePaths 按路径分量比较两个相对路径，返回 -1、0 或 1
+//
+// 这是深度优先遍历的顺序：目录之后紧跟其中的条目，然后才是同级的下一个条目
+// （如 a、a/b、a-b）。与逐字节比较的区别仅在于把 / 视为最小的字符。
+func ComparePaths(a, b string) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		ca, cb := a[i], b[i]
+		if ca == cb {
+			continue
+		}
+		switch {
+		case ca == '/':
+			return -1
+		case cb == '/':
+			return 1
+		case ca < cb:
+			return -1
+		default:
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
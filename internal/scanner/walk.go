@@ -0,0 +1,93 @@
+package scanner
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync"
+
+	"file_syn/internal/ignore"
+	"file_syn/pkg/models"
+)
+
+// DefaultWorkers 默认的工作协程数：CPU 核数，至少为 4
+//
+// 扫描主要受 I/O 延迟限制（尤其是网络文件系统），因此即使只有一个核，
+// 多个协程同时等待 lstat 和 read 也能提高吞吐量。
+func DefaultWorkers() int {
+	if n := runtime.NumCPU(); n > 4 {
+		return n
+	}
+	return 4
+}
+
+// job 扫描任务：读取一个目录，或计算一个文件的摘要
+type job struct {
+	// 目录任务
+	relPath string          // 目录相对根目录的路径（根目录为空字符串）
+	absPath string          // 目录的绝对路径
+	matcher *ignore.Matcher // 目录使用的排除规则（继承父目录并追加本目录忽略文件中的规则）
+
+	ancestors []os.FileInfo // 从根目录到该目录的各级目录（仅跟随符号链接时记录，用于检测循环）
+
+	// 摘要任务
+	file *models.FileInfo
+	info os.FileInfo
+}
+
+// walker 固定数量工作协程组成的扫描任务池
+type walker struct {
+	ctx     context.Context
+	fs      *FileScanner
+	jobs    chan *job
+	pending sync.WaitGroup // 已提交但尚未完成的任务
+	workers sync.WaitGroup
+}
+
+// newWalker 创建任务池并启动工作协程
+func newWalker(ctx context.Context, fs *FileScanner, workers int) *walker {
+	w := &walker{
+		ctx:  ctx,
+		fs:   fs,
+		jobs: make(chan *job, workers*64),
+	}
+	w.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer w.workers.Done()
+			for j := range w.jobs {
+				w.run(j)
+			}
+		}()
+	}
+	return w
+}
+
+// enqueue 提交任务
+//
+// 队列已满时直接在当前协程中执行，避免所有工作协程都阻塞在提交子任务上而死锁。
+func (w *walker) enqueue(j *job) {
+	w.pending.Add(1)
+	select {
+	case w.jobs <- j:
+	default:
+		w.run(j)
+	}
+}
+
+// run 执行任务
+func (w *walker) run(j *job) {
+	defer w.pending.Done()
+	if j.file != nil {
+		w.fs.hashFile(w.ctx, j.file, j.info)
+		return
+	}
+	w.fs.scanDir(w, j)
+}
+
+// wait 等待所有任务完成并停止工作协程
+func (w *walker) wait() {
+	w.pending.Wait()
+	close(w.jobs)
+	w.workers.Wait()
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"file_syn/internal/diff"
+	"file_syn/internal/reporter"
+	"file_syn/internal/runner"
+	"file_syn/pkg/models"
+)
+
+// 任务类型
+const (
+	JobCompare = "compare"
+	JobSync    = "sync"
+)
+
+// 任务状态
+const (
+	JobQueued    = "queued"    // 等待运行
+	JobRunning   = "running"   // 正在运行
+	JobSucceeded = "succeeded" // 已完成
+	JobFailed    = "failed"    // 运行失败（或部分同步操作失败）
+	JobCanceled  = "canceled"  // 被取消（包括服务关闭时尚未完成的任务）
+)
+
+// Job 一个对比或同步任务
+//
+// 任务运行时把 NDJSON 格式的结果追加到日志中，可以边运行边读取；
+// 完成对比后另外生成 JSON 格式的报告。
+type Job struct {
+	id      string
+	pair    *pair
+	kind    string
+	dryRun  bool
+	created time.Time
+	ctx     context.Context // 取消任务或强制关闭服务时取消
+	cancel  context.CancelFunc
+
+	mu       sync.Mutex
+	status   string
+	err      error
+	started  time.Time
+	finished time.Time
+	summary  jobSummary
+	log      []byte        // NDJSON 格式的结果
+	changed  chan struct{} // 日志追加或任务结束时关闭并替换
+	report   []byte        // JSON 格式的报告（完成对比后生成）
+}
+
+// jobSummary 任务结果的统计
+type jobSummary struct {
+	Results          int `json:"results"`           // 对比的条目数
+	Differences      int `json:"differences"`       // 状态不是 unchanged 的条目数
+	ScanErrors       int `json:"scan_errors"`       // 扫描错误数
+	Conflicts        int `json:"conflicts"`         // 双向同步的冲突数
+	Operations       int `json:"operations"`        // 同步操作数
+	FailedOperations int `json:"failed_operations"` // 失败的同步操作数
+}
+
+// jobJSON 任务状态的 JSON 表示
+type jobJSON struct {
+	ID         string      `json:"id"`
+	Pair       string      `json:"pair"`
+	Type       string      `json:"type"`
+	DryRun     bool        `json:"dry_run,omitempty"`
+	Status     string      `json:"status"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  string      `json:"created_at"`
+	StartedAt  string      `json:"started_at,omitempty"`
+	FinishedAt string      `json:"finished_at,omitempty"`
+	Summary    *jobSummary `json:"summary,omitempty"` // 开始运行后才有
+}
+
+// formatTime 按 RFC 3339 格式化时间（统一为 UTC），零值返回空字符串
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// json 返回任务状态的 JSON 表示
+func (j *Job) json() *jobJSON {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	v := &jobJSON{
+		ID:         j.id,
+		Pair:       j.pair.name,
+		Type:       j.kind,
+		DryRun:     j.dryRun,
+		Status:     j.status,
+		CreatedAt:  formatTime(j.created),
+		StartedAt:  formatTime(j.started),
+		FinishedAt: formatTime(j.finished),
+	}
+	if j.err != nil {
+		v.Error = j.err.Error()
+	}
+	if j.status != JobQueued {
+		summary := j.summary
+		v.Summary = &summary
+	}
+	return v
+}
+
+// Write 把 NDJSON 报告器的输出追加到日志中
+func (j *Job) Write(p []byte) (int, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.log = append(j.log, p...)
+	j.notify()
+	return len(p), nil
+}
+
+// notify 唤醒等待日志的读取方（调用方持有 j.mu）
+func (j *Job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// done 判断任务是否已结束（调用方持有 j.mu）
+func (j *Job) done() bool {
+	return j.status != JobQueued && j.status != JobRunning
+}
+
+// ended 判断任务是否已结束
+func (j *Job) ended() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.done()
+}
+
+// tail 返回日志中 offset 之后的内容、任务是否已结束，以及日志追加或任务结束时关闭的通道
+func (j *Job) tail(offset int) ([]byte, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.log[offset:], j.done(), j.changed
+}
+
+// start 标记任务开始运行
+func (j *Job) start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = JobRunning
+	j.started = time.Now()
+}
+
+// finish 按运行结果标记任务结束
+func (j *Job) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	switch {
+	case err == nil:
+		j.status = JobSucceeded
+	case errors.Is(err, context.Canceled):
+		j.status = JobCanceled
+	default:
+		j.status = JobFailed
+	}
+	j.err = err
+	j.finished = time.Now()
+	j.notify()
+}
+
+// lastReport 返回任务的 JSON 报告和 NDJSON 日志（尚未完成对比时报告为 nil）
+func (j *Job) lastReport() ([]byte, []byte) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.report, j.log
+}
+
+// jobPrinter 把结果同时交给 NDJSON 报告器（写入任务日志）和 JSON 报告器（生成报告），并更新任务的统计
+type jobPrinter struct {
+	job    *Job
+	ndjson *reporter.NDJSONReporter
+	json   *reporter.JSONReporter
+	report bytes.Buffer
+}
+
+func newJobPrinter(job *Job, showUnchanged bool) *jobPrinter {
+	p := &jobPrinter{job: job, ndjson: reporter.NewNDJSONReporter(job, showUnchanged)}
+	p.json = reporter.NewJSONReporter(&p.report, showUnchanged)
+	return p
+}
+
+// count 在持有任务锁时更新统计
+func (p *jobPrinter) count(update func(summary *jobSummary)) {
+	p.job.mu.Lock()
+	defer p.job.mu.Unlock()
+	update(&p.job.summary)
+}
+
+func (p *jobPrinter) PrintResults(results []*models.DiffResult) {
+	for _, result := range results {
+		p.PrintResult(result)
+	}
+	p.PrintSummary()
+}
+
+func (p *jobPrinter) PrintResult(result *models.DiffResult) {
+	p.count(func(summary *jobSummary) {
+		summary.Results++
+		if result.Status != models.StatusUnchanged {
+			summary.Differences++
+		}
+	})
+	p.ndjson.PrintResult(result)
+	p.json.PrintResult(result)
+}
+
+func (p *jobPrinter) PrintSummary() {
+	p.ndjson.PrintSummary()
+	p.json.PrintSummary()
+}
+
+func (p *jobPrinter) PrintErrors(errors []*models.ScanError) {
+	p.count(func(summary *jobSummary) { summary.ScanErrors += len(errors) })
+	p.ndjson.PrintErrors(errors)
+	p.json.PrintErrors(errors)
+}
+
+func (p *jobPrinter) PrintConflicts(conflicts []*models.SyncConflict) {
+	p.count(func(summary *jobSummary) { summary.Conflicts += len(conflicts) })
+	p.ndjson.PrintConflicts(conflicts)
+	p.json.PrintConflicts(conflicts)
+}
+
+func (p *jobPrinter) PrintSyncResults(results []*models.SyncResult) {
+	p.count(func(summary *jobSummary) {
+		summary.Operations += len(results)
+		for _, result := range results {
+			if result.Error != nil {
+				summary.FailedOperations++
+			}
+		}
+	})
+	p.ndjson.PrintSyncResults(results)
+	p.json.PrintSyncResults(results)
+}
+
+// Flush 生成 JSON 报告并保存到任务中
+func (p *jobPrinter) Flush() error {
+	if err := p.ndjson.Flush(); err != nil {
+		return err
+	}
+	if err := p.json.Flush(); err != nil {
+		return err
+	}
+	p.job.mu.Lock()
+	defer p.job.mu.Unlock()
+	p.job.report = p.report.Bytes()
+	return nil
+}
+
+// run 运行任务：对比配置中的两个目录，同步任务接着按同步模式同步
+//
+// 与 compare 和 sync 子命令的行为一致：配置了 stream 时对比任务流式输出结果，
+// 对比完成后才被取消时不再开始同步（同步开始后会执行完所有操作）。
+func (j *Job) run(ctx context.Context, logf func(format string, args ...any)) error {
+	cfg := j.pair.cfg
+	jobLogf := func(format string, args ...any) {
+		logf("%s"+format, append([]any{j}, args...)...)
+	}
+	cache := runner.OpenHashCache(cfg, jobLogf)
+	defer runner.SaveHashCache(cache, jobLogf)
+
+	remote, err := runner.StartRemote(cfg, jobLogf)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+
+	stream := cfg.Stream && j.kind == JobCompare
+	comparer := diff.NewComparerWithOptions(diff.Options{
+		Scan:          cfg.ScanOptions(cache),
+		Rules:         cfg.Compare.Rules(),
+		DetectRenames: cfg.DetectRenames && !stream,
+		ManifestKey:   j.pair.manifestKey,
+		Remote:        remote.Openers(),
+	})
+	printer := newJobPrinter(j, cfg.ShowUnchanged)
+
+	var results []*models.DiffResult
+	if stream {
+		streamed, err := comparer.CompareStreamContext(ctx, cfg.LeftDir, cfg.RightDir)
+		if err != nil {
+			return err
+		}
+		for result := range streamed {
+			printer.PrintResult(result)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		printer.PrintSummary()
+	} else {
+		if results, err = comparer.CompareContext(ctx, cfg.LeftDir, cfg.RightDir); err != nil {
+			return err
+		}
+		printer.PrintResults(results)
+	}
+	printer.PrintErrors(comparer.Errors())
+
+	var syncErr error
+	if j.kind == JobSync {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		syncErr = runner.Sync(cfg, j.dryRun, cache, results, printer)
+	}
+	if err := printer.Flush(); err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// String 返回用于日志的任务描述，如 任务 3（backup sync）
+func (j *Job) String() string {
+	kind := j.kind
+	if j.dryRun {
+		kind += " --dry-run"
+	}
+	return fmt.Sprintf("任务 %s（%s %s）", j.id, j.pair.name, kind)
+}
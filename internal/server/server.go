@@ -0,0 +1,510 @@
+// Package server 以 HTTP 接口提供对比和同步任务（file_syn serve）
+//
+// 每个配置文件定义一个目录对（pair）。请求启动的任务进入队列，同时运行的任务数有上限，
+// 同一个目录对的任务依次运行。任务复用 diff.Comparer、syncer 和 NDJSON/JSON 报告器，
+// 结果与 compare、sync 子命令的 --format ndjson/json 输出一致。
+package server
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"file_syn/internal/config"
+	"file_syn/internal/manifest"
+	"file_syn/internal/reporter"
+)
+
+// 默认值
+const (
+	DefaultMaxJobs    = 2   // 同时运行的任务数
+	DefaultMaxQueued  = 100 // 等待运行的任务数
+	DefaultMaxHistory = 100 // 保留的已结束任务数
+)
+
+// errShuttingDown 服务正在关闭
+var errShuttingDown = errors.New("服务正在关闭")
+
+// pairName 目录对名称的格式（用于 URL）
+var pairName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Options 服务选项
+type Options struct {
+	Token      string // 访问令牌，请求必须带有 Authorization: Bearer <令牌>（不能为空）
+	MaxJobs    int    // 同时运行的任务数上限（为 0 时使用 DefaultMaxJobs）
+	MaxQueued  int    // 等待运行的任务数上限，队列已满时拒绝新任务（为 0 时使用 DefaultMaxQueued）
+	MaxHistory int    // 保留的已结束任务数，超过时删除最早的任务（为 0 时使用 DefaultMaxHistory）
+
+	Log io.Writer // 任务开始和结束的日志（为 nil 时不输出）
+}
+
+// pair 一个配置的目录对
+type pair struct {
+	name        string
+	cfg         *config.Config
+	manifestKey ed25519.PublicKey // 作为一侧的清单必须带有的签名公钥
+	syncErr     error             // 不能同步的原因（一侧是清单或远程目录）
+
+	busy bool // 有任务正在运行（持有 Server.mu）
+	last *Job // 最近一个完成对比的任务（持有 Server.mu）
+}
+
+// Server HTTP 服务，实现 http.Handler
+type Server struct {
+	options Options
+	pairs   map[string]*pair
+	names   []string // 排序后的目录对名称
+	handler http.Handler
+	execute func(job *Job) error // 运行任务（测试中替换）
+
+	ctx    context.Context // 所有任务的上级 context，强制关闭时取消
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // 正在运行的任务
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	history []*Job // 按创建顺序排列的所有任务
+	queue   []*Job // 等待运行的任务
+	running int
+	nextID  int
+	closed  bool
+}
+
+// New 创建服务，pairs 为目录对名称到已验证配置的映射
+func New(pairs map[string]*config.Config, options Options) (*Server, error) {
+	if options.Token == "" {
+		return nil, fmt.Errorf("必须设置访问令牌")
+	}
+	if len(pairs) == 0 {
+		return nil, fmt.Errorf("至少需要一个目录对")
+	}
+	if options.MaxJobs <= 0 {
+		options.MaxJobs = DefaultMaxJobs
+	}
+	if options.MaxQueued <= 0 {
+		options.MaxQueued = DefaultMaxQueued
+	}
+	if options.MaxHistory <= 0 {
+		options.MaxHistory = DefaultMaxHistory
+	}
+	if options.Log == nil {
+		options.Log = io.Discard
+	}
+
+	s := &Server{
+		options: options,
+		pairs:   make(map[string]*pair),
+		jobs:    make(map[string]*Job),
+	}
+	for name, cfg := range pairs {
+		p, err := newPair(name, cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.pairs[name] = p
+		s.names = append(s.names, name)
+	}
+	slices.Sort(s.names)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.execute = func(job *Job) error { return job.run(job.ctx, s.logf) }
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/pairs", s.handleListPairs)
+	mux.HandleFunc("POST /v1/pairs/{name}/{type}", s.handleStartJob)
+	mux.HandleFunc("GET /v1/pairs/{name}/report", s.handleReport)
+	mux.HandleFunc("GET /v1/jobs", s.handleListJobs)
+	mux.HandleFunc("GET /v1/jobs/{id}", s.handleGetJob)
+	mux.HandleFunc("DELETE /v1/jobs/{id}", s.handleCancelJob)
+	mux.HandleFunc("GET /v1/jobs/{id}/results", s.handleResults)
+	s.handler = s.authenticate(mux)
+	return s, nil
+}
+
+// newPair 检查目录对的名称，读取清单签名公钥
+func newPair(name string, cfg *config.Config) (*pair, error) {
+	if !pairName.MatchString(name) {
+		return nil, fmt.Errorf("无效的目录对名称 %q（只能包含字母、数字、.、_ 和 -）", name)
+	}
+	p := &pair{name: name, cfg: cfg}
+	leftManifest, rightManifest := manifest.IsManifest(cfg.LeftDir), manifest.IsManifest(cfg.RightDir)
+	key, err := cfg.ManifestKey()
+	if err != nil {
+		return nil, fmt.Errorf("目录对 %s: %v", name, err)
+	}
+	p.manifestKey = key
+	switch {
+	case cfg.IsRemote():
+		p.syncErr = fmt.Errorf("目录对 %s 的一侧是远程目录，不支持同步", name)
+	case leftManifest || rightManifest:
+		p.syncErr = fmt.Errorf("目录对 %s 的一侧是清单文件，不支持同步", name)
+	}
+	return p, nil
+}
+
+// ServeHTTP 处理请求
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// authenticate 检查请求的访问令牌
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.options.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="file_syn"`)
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("缺少或无效的访问令牌"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// logf 输出一行日志
+func (s *Server) logf(format string, args ...any) {
+	fmt.Fprintf(s.options.Log, "%s %s\n", time.Now().Format(time.DateTime), fmt.Sprintf(format, args...))
+}
+
+// Submit 为目录对 name 创建任务并加入队列
+func (s *Server) Submit(name, kind string, dryRun bool) (*Job, error) {
+	p, ok := s.pairs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errNoPair, name)
+	}
+	switch kind {
+	case JobCompare:
+		dryRun = false
+	case JobSync:
+		if p.syncErr != nil {
+			return nil, p.syncErr
+		}
+	default:
+		return nil, fmt.Errorf("不支持的任务类型: %s", kind)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errShuttingDown
+	}
+	if len(s.queue) >= s.options.MaxQueued {
+		return nil, errQueueFull
+	}
+	s.nextID++
+	job := &Job{
+		id:      strconv.Itoa(s.nextID),
+		pair:    p,
+		kind:    kind,
+		dryRun:  dryRun,
+		created: time.Now(),
+		status:  JobQueued,
+		changed: make(chan struct{}),
+	}
+	job.ctx, job.cancel = context.WithCancel(s.ctx)
+	s.jobs[job.id] = job
+	s.history = append(s.history, job)
+	s.queue = append(s.queue, job)
+	s.logf("%s已加入队列", job)
+	s.schedule()
+	return job, nil
+}
+
+// 提交任务失败的原因
+var (
+	errNoPair    = errors.New("目录对不存在")
+	errQueueFull = errors.New("任务队列已满")
+)
+
+// schedule 按提交顺序启动可以运行的任务：运行中的任务数未达到上限，且同一个目录对没有正在运行的任务
+//
+// 调用方持有 s.mu。
+func (s *Server) schedule() {
+	for i := 0; i < len(s.queue) && s.running < s.options.MaxJobs; {
+		job := s.queue[i]
+		if job.pair.busy {
+			i++
+			continue
+		}
+		s.queue = slices.Delete(s.queue, i, i+1)
+		s.running++
+		job.pair.busy = true
+		job.start()
+		s.wg.Add(1)
+		go s.run(job)
+	}
+}
+
+// run 运行任务，结束后启动队列中的下一个任务
+func (s *Server) run(job *Job) {
+	defer s.wg.Done()
+	s.logf("%s开始运行", job)
+	err := s.execute(job)
+	job.cancel()
+	if err != nil {
+		s.logf("%s失败: %v", job, err)
+	} else {
+		s.logf("%s已完成", job)
+	}
+
+	// 在更新目录对的状态时结束任务，任务结束后立即可以获取报告
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.finish(err)
+	s.running--
+	job.pair.busy = false
+	if report, _ := job.lastReport(); report != nil {
+		job.pair.last = job
+	}
+	s.trimHistory()
+	s.schedule()
+}
+
+// trimHistory 已结束的任务超过 MaxHistory 时删除最早的任务（调用方持有 s.mu）
+//
+// 目录对最近一次的报告所属的任务不会被删除。
+func (s *Server) trimHistory() {
+	finished := 0
+	for _, job := range s.history {
+		if job.ended() {
+			finished++
+		}
+	}
+	s.history = slices.DeleteFunc(s.history, func(job *Job) bool {
+		if finished <= s.options.MaxHistory || !job.ended() || job.pair.last == job {
+			return false
+		}
+		finished--
+		delete(s.jobs, job.id)
+		return true
+	})
+}
+
+// Cancel 取消任务：等待运行的任务直接结束，正在运行的任务在对比阶段停止（同步开始后会执行完所有操作）
+func (s *Server) Cancel(id string) (*Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, errNoJob
+	}
+	s.cancelLocked(job, context.Canceled)
+	return job, nil
+}
+
+// errNoJob 任务不存在
+var errNoJob = errors.New("任务不存在")
+
+// cancelLocked 取消任务（调用方持有 s.mu）
+func (s *Server) cancelLocked(job *Job, reason error) {
+	if i := slices.Index(s.queue, job); i >= 0 {
+		s.queue = slices.Delete(s.queue, i, i+1)
+		job.finish(reason)
+		s.logf("%s已取消", job)
+	}
+	job.cancel()
+}
+
+// Shutdown 停止接受新任务，取消等待运行的任务，并等待正在运行的任务结束
+//
+// ctx 结束时取消正在运行的任务，等待它们停止后返回 ctx 的错误。
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	for _, job := range slices.Clone(s.queue) {
+		s.cancelLocked(job, fmt.Errorf("%w: %w", context.Canceled, errShuttingDown))
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// lookupJob 返回 id 对应的任务
+func (s *Server) lookupJob(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	return job, ok
+}
+
+// pairJSON 目录对的 JSON 表示
+type pairJSON struct {
+	Name     string   `json:"name"`
+	LeftDir  string   `json:"left_dir"`
+	RightDir string   `json:"right_dir"`
+	Sync     bool     `json:"sync"`               // 是否支持同步任务
+	LastJob  *jobJSON `json:"last_job,omitempty"` // 最近一个完成对比的任务
+}
+
+func (s *Server) handleListPairs(w http.ResponseWriter, r *http.Request) {
+	pairs := make([]*pairJSON, 0, len(s.names))
+	s.mu.Lock()
+	lasts := make([]*Job, len(s.names))
+	for i, name := range s.names {
+		lasts[i] = s.pairs[name].last
+	}
+	s.mu.Unlock()
+	for i, name := range s.names {
+		p := s.pairs[name]
+		v := &pairJSON{Name: name, LeftDir: p.cfg.LeftDir, RightDir: p.cfg.RightDir, Sync: p.syncErr == nil}
+		if lasts[i] != nil {
+			v.LastJob = lasts[i].json()
+		}
+		pairs = append(pairs, v)
+	}
+	writeJSON(w, http.StatusOK, pairs)
+}
+
+func (s *Server) handleStartJob(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if value := r.URL.Query().Get("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("无效的 dry_run: %s", value))
+			return
+		}
+	}
+	job, err := s.Submit(r.PathValue("name"), r.PathValue("type"), dryRun)
+	switch {
+	case errors.Is(err, errNoPair):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, errQueueFull), errors.Is(err, errShuttingDown):
+		writeError(w, http.StatusServiceUnavailable, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		w.Header().Set("Location", "/v1/jobs/"+job.id)
+		writeJSON(w, http.StatusAccepted, job.json())
+	}
+}
+
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	p, ok := s.pairs[r.PathValue("name")]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%w: %s", errNoPair, r.PathValue("name")))
+		return
+	}
+	s.mu.Lock()
+	last := p.last
+	s.mu.Unlock()
+	if last == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("目录对 %s 还没有完成过对比", p.name))
+		return
+	}
+
+	report, log := last.lastReport()
+	w.Header().Set("X-File-Syn-Job", last.id)
+	switch format := r.URL.Query().Get("format"); format {
+	case "", reporter.FormatJSON:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(report)
+	case reporter.FormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Write(log)
+	default:
+		writeError(w, http.StatusBadRequest, fmt.Errorf("不支持的报告格式: %s（可选 json 或 ndjson）", format))
+	}
+}
+
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	history := slices.Clone(s.history)
+	s.mu.Unlock()
+	jobs := make([]*jobJSON, 0, len(history))
+	for _, job := range history {
+		jobs = append(jobs, job.json())
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errNoJob)
+		return
+	}
+	writeJSON(w, http.StatusOK, job.json())
+}
+
+func (s *Server) handleCancelJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.Cancel(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, job.json())
+}
+
+// handleResults 以 NDJSON 流式输出任务的结果，直到任务结束或客户端断开
+func (s *Server) handleResults(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.lookupJob(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errNoJob)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+
+	offset := 0
+	for {
+		data, done, changed := job.tail(offset)
+		if len(data) > 0 {
+			if _, err := w.Write(data); err != nil {
+				return
+			}
+			offset += len(data)
+			controller.Flush()
+		}
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// errorJSON 错误响应
+type errorJSON struct {
+	Error string `json:"error"`
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(v)
+}
+
+// writeError 输出错误响应
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorJSON{Error: err.Error()})
+}
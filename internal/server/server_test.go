@@ -0,0 +1,386 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"file_syn/internal/config"
+)
+
+const testToken = "secret"
+
+// newPairConfig 创建左右两个目录并返回对应的配置
+func newPairConfig(t *testing.T) *config.Config {
+	t.Helper()
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	for name, content := range map[string]string{"a.txt": "left", "dir/b.txt": "nested"} {
+		path := filepath.Join(leftDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(rightDir, "a.txt"), []byte("right side"), 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	cfg := &config.Config{LeftDir: leftDir, RightDir: rightDir, HashCache: config.HashCacheDisabled}
+	if err := cfg.Finish(); err != nil {
+		t.Fatalf("配置无效: %v", err)
+	}
+	return cfg
+}
+
+// testClient 带访问令牌访问测试服务
+type testClient struct {
+	t   *testing.T
+	url string
+}
+
+func newTestServer(t *testing.T, pairs map[string]*config.Config, options Options) (*Server, *testClient) {
+	t.Helper()
+	options.Token = testToken
+	s, err := New(pairs, options)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Shutdown(context.Background())
+		ts.Close()
+	})
+	return s, &testClient{t: t, url: ts.URL}
+}
+
+// do 发送请求，返回状态码和响应内容
+func (c *testClient) do(method, path string) (int, []byte) {
+	c.t.Helper()
+	req, _ := http.NewRequest(method, c.url+path, nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s 失败: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, body
+}
+
+// start 启动任务并返回任务状态
+func (c *testClient) start(path string) *jobJSON {
+	c.t.Helper()
+	status, body := c.do("POST", path)
+	if status != http.StatusAccepted {
+		c.t.Fatalf("POST %s: %d %s", path, status, body)
+	}
+	var job jobJSON
+	json.Unmarshal(body, &job)
+	return &job
+}
+
+// results 读取任务的 NDJSON 结果流直到任务结束，返回每行的 kind
+func (c *testClient) results(id string) ([]string, []byte) {
+	c.t.Helper()
+	status, body := c.do("GET", "/v1/jobs/"+id+"/results")
+	if status != http.StatusOK {
+		c.t.Fatalf("读取结果失败: %d %s", status, body)
+	}
+	var kinds []string
+	scanner := bufio.NewScanner(strings.NewReader(string(body)))
+	for scanner.Scan() {
+		var line struct{ Kind string }
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			c.t.Fatalf("无效的 NDJSON 行 %q: %v", scanner.Text(), err)
+		}
+		kinds = append(kinds, line.Kind)
+	}
+	return kinds, body
+}
+
+// job 返回任务状态
+func (c *testClient) job(id string) *jobJSON {
+	c.t.Helper()
+	status, body := c.do("GET", "/v1/jobs/"+id)
+	if status != http.StatusOK {
+		c.t.Fatalf("读取任务失败: %d %s", status, body)
+	}
+	var job jobJSON
+	json.Unmarshal(body, &job)
+	return &job
+}
+
+func TestAuth(t *testing.T) {
+	_, c := newTestServer(t, map[string]*config.Config{"data": newPairConfig(t)}, Options{})
+	for _, header := range []string{"", "Bearer wrong", testToken} {
+		req, _ := http.NewRequest("GET", c.url+"/v1/pairs", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q 应该返回 401: %d", header, resp.StatusCode)
+		}
+	}
+	if status, body := c.do("GET", "/v1/pairs"); status != http.StatusOK || !strings.Contains(string(body), `"name": "data"`) {
+		t.Errorf("带有令牌的请求失败: %d %s", status, body)
+	}
+
+	if _, err := New(map[string]*config.Config{"data": newPairConfig(t)}, Options{}); err == nil {
+		t.Error("没有访问令牌时应该返回错误")
+	}
+	if _, err := New(map[string]*config.Config{"a/b": newPairConfig(t)}, Options{Token: testToken}); err == nil {
+		t.Error("无效的目录对名称应该返回错误")
+	}
+}
+
+func TestCompareAndSync(t *testing.T) {
+	cfg := newPairConfig(t)
+	remote := *cfg
+	remote.RightCommand = "file_syn agent"
+	_, c := newTestServer(t, map[string]*config.Config{"data": cfg, "remote": &remote}, Options{})
+
+	if status, _ := c.do("GET", "/v1/pairs/data/report"); status != http.StatusNotFound {
+		t.Errorf("还没有对比时报告应该返回 404: %d", status)
+	}
+
+	job := c.start("/v1/pairs/data/compare")
+	kinds, stream := c.results(job.ID)
+	if strings.Join(kinds, ",") != "result,result,result,summary" {
+		t.Errorf("结果流不正确: %v", kinds)
+	}
+	job = c.job(job.ID)
+	if job.Status != JobSucceeded || job.Summary == nil || job.Summary.Differences != 3 {
+		t.Errorf("任务状态不正确: %+v %+v", job, job.Summary)
+	}
+
+	// 最近一次的报告
+	status, body := c.do("GET", "/v1/pairs/data/report")
+	var report struct {
+		Summary struct{ Total int }
+		Results []json.RawMessage
+	}
+	if err := json.Unmarshal(body, &report); status != http.StatusOK || err != nil || report.Summary.Total != 3 || len(report.Results) != 3 {
+		t.Errorf("JSON 报告不正确: %d %s", status, body)
+	}
+	if _, body := c.do("GET", "/v1/pairs/data/report?format=ndjson"); string(body) != string(stream) {
+		t.Errorf("NDJSON 报告应与结果流一致:\n%s\n%s", body, stream)
+	}
+
+	// 演练不修改文件，同步后两侧一致
+	job = c.start("/v1/pairs/data/sync?dry_run=true")
+	c.results(job.ID)
+	if job = c.job(job.ID); !job.DryRun || job.Status != JobSucceeded || job.Summary.Operations == 0 {
+		t.Errorf("演练任务不正确: %+v %+v", job, job.Summary)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.RightDir, "dir", "b.txt")); err == nil {
+		t.Error("演练不应该修改文件")
+	}
+	job = c.start("/v1/pairs/data/sync")
+	if kinds, _ := c.results(job.ID); kinds[len(kinds)-1] != "operation" {
+		t.Errorf("同步任务应该输出操作结果: %v", kinds)
+	}
+	job = c.start("/v1/pairs/data/compare")
+	c.results(job.ID)
+	if job = c.job(job.ID); job.Summary.Differences != 0 {
+		t.Errorf("同步后两侧应该一致: %+v", job.Summary)
+	}
+
+	for path, want := range map[string]int{
+		"/v1/pairs/missing/compare":     http.StatusNotFound,
+		"/v1/pairs/data/restore":        http.StatusBadRequest,
+		"/v1/pairs/data/sync?dry_run=x": http.StatusBadRequest,
+		"/v1/pairs/remote/sync":         http.StatusBadRequest,
+	} {
+		if status, body := c.do("POST", path); status != want {
+			t.Errorf("POST %s 应该返回 %d: %d %s", path, want, status, body)
+		}
+	}
+	if status, _ := c.do("GET", "/v1/jobs/999"); status != http.StatusNotFound {
+		t.Errorf("不存在的任务应该返回 404: %d", status)
+	}
+}
+
+// blocker 使任务阻塞到被放行（或被取消）
+type blocker struct {
+	mu       sync.Mutex
+	channels map[*Job]chan struct{}
+	all      bool // 放行所有任务
+}
+
+// channel 返回任务被放行时关闭的通道
+func (b *blocker) channel(job *Job) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch, ok := b.channels[job]
+	if !ok {
+		ch = make(chan struct{})
+		b.channels[job] = ch
+		if b.all {
+			close(ch)
+		}
+	}
+	return ch
+}
+
+// release 放行一个任务
+func (b *blocker) release(job *Job) {
+	close(b.channel(job))
+}
+
+// releaseAll 放行所有任务（包括之后开始运行的任务）
+func (b *blocker) releaseAll() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.all = true
+	for _, ch := range b.channels {
+		close(ch)
+	}
+}
+
+// blockingServer 创建任务阻塞到被放行的服务，started 收到开始运行的任务
+func blockingServer(t *testing.T, options Options, names ...string) (*Server, chan *Job, *blocker) {
+	pairs := make(map[string]*config.Config)
+	for _, name := range names {
+		pairs[name] = newPairConfig(t)
+	}
+	options.Token = testToken
+	s, err := New(pairs, options)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	started, b := make(chan *Job, 10), &blocker{channels: make(map[*Job]chan struct{})}
+	s.execute = func(job *Job) error {
+		started <- job
+		select {
+		case <-b.channel(job):
+			return nil
+		case <-job.ctx.Done():
+			return job.ctx.Err()
+		}
+	}
+	return s, started, b
+}
+
+// status 返回任务的状态
+func status(job *Job) string {
+	return job.json().Status
+}
+
+// waitStarted 等待 started 收到 want 对应的任务
+func waitStarted(t *testing.T, started chan *Job, want ...*Job) {
+	t.Helper()
+	for range want {
+		select {
+		case job := <-started:
+			found := false
+			for _, w := range want {
+				found = found || w == job
+			}
+			if !found {
+				t.Fatalf("%s 不应该开始运行", job)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("等待任务开始运行超时")
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	s, started, b := blockingServer(t, Options{MaxJobs: 2, MaxQueued: 2}, "a", "b", "c")
+	a1, _ := s.Submit("a", JobCompare, false)
+	a2, _ := s.Submit("a", JobSync, true)
+	b1, _ := s.Submit("b", JobCompare, false)
+	c1, _ := s.Submit("c", JobCompare, false)
+	waitStarted(t, started, a1, b1)
+
+	// 同一个目录对的任务依次运行，同时运行的任务数不超过 MaxJobs
+	if status(a2) != JobQueued || status(c1) != JobQueued {
+		t.Errorf("a2 和 c1 应该在等待: %s %s", status(a2), status(c1))
+	}
+	if _, err := s.Submit("c", JobCompare, false); !errors.Is(err, errQueueFull) {
+		t.Errorf("队列已满时应该拒绝新任务: %v", err)
+	}
+
+	// 取消等待中的任务后，a1 结束时启动 c1
+	if _, err := s.Cancel(a2.id); err != nil || status(a2) != JobCanceled {
+		t.Errorf("取消等待中的任务失败: %s, %v", status(a2), err)
+	}
+	b.release(a1)
+	waitStarted(t, started, c1)
+
+	// 强制关闭时取消正在运行的任务
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("超时后应该返回 context.DeadlineExceeded: %v", err)
+	}
+	for _, job := range []*Job{b1, c1} {
+		if status(job) != JobCanceled {
+			t.Errorf("%s 应该被取消: %s", job, status(job))
+		}
+	}
+	if status(a1) != JobSucceeded {
+		t.Errorf("a1 应该已完成: %s", status(a1))
+	}
+	if _, err := s.Submit("a", JobCompare, false); !errors.Is(err, errShuttingDown) {
+		t.Errorf("关闭后应该拒绝新任务: %v", err)
+	}
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	s, started, b := blockingServer(t, Options{MaxJobs: 1}, "a")
+	running, _ := s.Submit("a", JobCompare, false)
+	queued, _ := s.Submit("a", JobCompare, false)
+	waitStarted(t, started, running)
+
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+	time.Sleep(20 * time.Millisecond)
+	select {
+	case err := <-done:
+		t.Fatalf("正在运行的任务结束前不应该返回: %v", err)
+	default:
+	}
+	b.releaseAll()
+	if err := <-done; err != nil {
+		t.Errorf("正常关闭失败: %v", err)
+	}
+	if status(running) != JobSucceeded || status(queued) != JobCanceled {
+		t.Errorf("正在运行的任务应该完成，等待中的任务应该被取消: %s %s", status(running), status(queued))
+	}
+}
+
+func TestHistory(t *testing.T) {
+	s, _, b := blockingServer(t, Options{MaxHistory: 2}, "a")
+	b.releaseAll()
+	for range 5 {
+		job, err := s.Submit("a", JobCompare, false)
+		if err != nil {
+			t.Fatalf("提交任务失败: %v", err)
+		}
+		for status(job) != JobSucceeded {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.history) != 2 || len(s.jobs) != 2 || s.history[1].id != "5" {
+		t.Errorf("应该只保留最近的 2 个任务: %d %d", len(s.history), len(s.jobs))
+	}
+}
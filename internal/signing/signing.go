@@ -0,0 +1,224 @@
+// Package signing 使用 ed25519 对快照清单签名和验证签名
+//
+// 签名采用 Ed25519ph（先计算 SHA-512 摘要再签名），并带有固定的上下文字符串，
+// 签名只能用于验证 file_syn 清单。签名保存在清单旁边的 .sig 文件中，
+// 覆盖清单文件的全部字节，因此与清单格式（JSON、gzip、二进制）无关。
+// 密钥以 PEM 格式保存（私钥为 PKCS #8，公钥为 PKIX），可以用 openssl 等工具查看。
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Algorithm 签名算法
+const Algorithm = "ed25519ph"
+
+// SignatureSuffix 签名文件相对于清单文件的后缀
+const SignatureSuffix = ".sig"
+
+// signContext Ed25519ph 的上下文字符串，防止签名被用于其他用途
+const signContext = "file_syn manifest"
+
+// ErrUnsigned 清单没有签名文件
+var ErrUnsigned = errors.New("清单没有签名")
+
+// Signature 清单的签名
+type Signature struct {
+	Algorithm string    `json:"algorithm"` // 签名算法，见 Algorithm
+	KeyID     string    `json:"key_id"`    // 签名公钥的标识，见 KeyID
+	SignedAt  time.Time `json:"signed_at"` // 签名时间（仅供参考，不受签名保护）
+	Signature []byte    `json:"signature"` // 签名（base64）
+}
+
+// GenerateKey 生成新的 ed25519 密钥对
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("无法生成密钥: %v", err)
+	}
+	return pub, priv, nil
+}
+
+// KeyID 返回公钥的标识（公钥 SHA-256 的前 8 个字节，十六进制）
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// WritePrivateKey 以 PEM 格式写出私钥（权限 0600），文件已存在时返回错误
+func WritePrivateKey(path string, key ed25519.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("无法编码私钥: %v", err)
+	}
+	return writePEM(path, &pem.Block{Type: "PRIVATE KEY", Bytes: der}, 0600)
+}
+
+// WritePublicKey 以 PEM 格式写出公钥，文件已存在时返回错误
+func WritePublicKey(path string, key ed25519.PublicKey) error {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return fmt.Errorf("无法编码公钥: %v", err)
+	}
+	return writePEM(path, &pem.Block{Type: "PUBLIC KEY", Bytes: der}, 0644)
+}
+
+// writePEM 创建新文件并写出 PEM 块
+func writePEM(path string, block *pem.Block, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("无法创建密钥文件: %v", err)
+	}
+	err = pem.Encode(f, block)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return fmt.Errorf("无法写出密钥文件: %v", err)
+	}
+	return nil
+}
+
+// readPEM 读取 PEM 文件中类型为 blockType 的第一个块
+func readPEM(path, blockType string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("无法读取密钥文件: %v", err)
+	}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s 中没有 %s", path, blockType)
+		}
+		if block.Type == blockType {
+			return block.Bytes, nil
+		}
+	}
+}
+
+// LoadPrivateKey 读取 PEM 格式的 ed25519 私钥
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	der, err := readPEM(path, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析私钥 %s: %v", path, err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s 不是 ed25519 私钥", path)
+	}
+	return priv, nil
+}
+
+// LoadPublicKey 读取 PEM 格式的 ed25519 公钥
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	der, err := readPEM(path, "PUBLIC KEY")
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("无法解析公钥 %s: %v", path, err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s 不是 ed25519 公钥", path)
+	}
+	return pub, nil
+}
+
+// digest 计算 r 中全部内容的 SHA-512 摘要
+func digest(r io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, fmt.Errorf("无法读取清单: %v", err)
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign 对 r 中的全部内容签名
+func Sign(r io.Reader, key ed25519.PrivateKey) (*Signature, error) {
+	sum, err := digest(r)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := key.Sign(nil, sum, &ed25519.Options{Hash: crypto.SHA512, Context: signContext})
+	if err != nil {
+		return nil, fmt.Errorf("签名失败: %v", err)
+	}
+	return &Signature{
+		Algorithm: Algorithm,
+		KeyID:     KeyID(key.Public().(ed25519.PublicKey)),
+		SignedAt:  time.Now().UTC(),
+		Signature: sig,
+	}, nil
+}
+
+// Verify 验证 sig 是否是 pub 对应的私钥对 r 中全部内容的有效签名
+func Verify(r io.Reader, sig *Signature, pub ed25519.PublicKey) error {
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("不支持的签名算法: %s", sig.Algorithm)
+	}
+	if id := KeyID(pub); sig.KeyID != id {
+		return fmt.Errorf("签名使用的密钥 %s 与公钥 %s 不一致", sig.KeyID, id)
+	}
+	sum, err := digest(r)
+	if err != nil {
+		return err
+	}
+	if err := ed25519.VerifyWithOptions(pub, sum, sig.Signature, &ed25519.Options{Hash: crypto.SHA512, Context: signContext}); err != nil {
+		return errors.New("签名无效，清单可能已被修改")
+	}
+	return nil
+}
+
+// SignatureFile 返回清单的签名文件路径
+func SignatureFile(manifestPath string) string {
+	return manifestPath + SignatureSuffix
+}
+
+// ReadSignature 读取签名文件，文件不存在时返回 ErrUnsigned
+func ReadSignature(path string) (*Signature, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrUnsigned
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取签名文件: %v", err)
+	}
+	var sig Signature
+	if err := json.Unmarshal(data, &sig); err != nil {
+		return nil, fmt.Errorf("无法解析签名文件 %s: %v", path, err)
+	}
+	return &sig, nil
+}
+
+// Write 写出签名文件
+func (s *Signature) Write(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法编码签名: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("无法写出签名文件: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package signing
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	data := []byte(`{"version":1,"entries":[]}`)
+	sig, err := Sign(bytes.NewReader(data), priv)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	if sig.Algorithm != Algorithm || sig.KeyID != KeyID(pub) {
+		t.Errorf("签名的算法或密钥标识错误: %+v", sig)
+	}
+	if err := Verify(bytes.NewReader(data), sig, pub); err != nil {
+		t.Errorf("有效签名验证失败: %v", err)
+	}
+
+	// 内容被修改
+	tampered := bytes.Replace(data, []byte("1"), []byte("2"), 1)
+	if err := Verify(bytes.NewReader(tampered), sig, pub); err == nil {
+		t.Error("内容被修改后签名仍然有效")
+	}
+
+	// 签名被修改
+	bad := *sig
+	bad.Signature = bytes.Clone(sig.Signature)
+	bad.Signature[0] ^= 1
+	if err := Verify(bytes.NewReader(data), &bad, pub); err == nil {
+		t.Error("签名被修改后仍然有效")
+	}
+
+	// 其他密钥
+	otherPub, _, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	if err := Verify(bytes.NewReader(data), sig, otherPub); err == nil || !strings.Contains(err.Error(), "不一致") {
+		t.Errorf("使用其他公钥验证应报告密钥不一致，实际为 %v", err)
+	}
+
+	// 不支持的算法
+	bad = *sig
+	bad.Algorithm = "rsa"
+	if err := Verify(bytes.NewReader(data), &bad, pub); err == nil {
+		t.Error("不支持的签名算法应返回错误")
+	}
+}
+
+func TestKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	privPath := filepath.Join(dir, "key")
+	pubPath := filepath.Join(dir, "key.pub")
+	if err := WritePrivateKey(privPath, priv); err != nil {
+		t.Fatalf("写出私钥失败: %v", err)
+	}
+	if err := WritePublicKey(pubPath, pub); err != nil {
+		t.Fatalf("写出公钥失败: %v", err)
+	}
+	if err := WritePrivateKey(privPath, priv); err == nil {
+		t.Error("私钥文件已存在时应返回错误")
+	}
+	if info, err := os.Stat(privPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("私钥文件的权限应为 0600: %v %v", info.Mode(), err)
+	}
+
+	loadedPriv, err := LoadPrivateKey(privPath)
+	if err != nil {
+		t.Fatalf("读取私钥失败: %v", err)
+	}
+	if !loadedPriv.Equal(priv) {
+		t.Error("读取的私钥与写出的不一致")
+	}
+	loadedPub, err := LoadPublicKey(pubPath)
+	if err != nil {
+		t.Fatalf("读取公钥失败: %v", err)
+	}
+	if !loadedPub.Equal(pub) {
+		t.Error("读取的公钥与写出的不一致")
+	}
+	if _, err := LoadPublicKey(privPath); err == nil {
+		t.Error("把私钥文件当作公钥读取应返回错误")
+	}
+}
+
+func TestSignatureFile(t *testing.T) {
+	dir := t.TempDir()
+	_, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	path := SignatureFile(filepath.Join(dir, "snapshot.json"))
+	if _, err := ReadSignature(path); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("签名文件不存在时应返回 ErrUnsigned，实际为 %v", err)
+	}
+
+	sig, err := Sign(strings.NewReader("manifest"), priv)
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+	if err := sig.Write(path); err != nil {
+		t.Fatalf("写出签名文件失败: %v", err)
+	}
+	loaded, err := ReadSignature(path)
+	if err != nil {
+		t.Fatalf("读取签名文件失败: %v", err)
+	}
+	if loaded.KeyID != sig.KeyID || !bytes.Equal(loaded.Signature, sig.Signature) || !loaded.SignedAt.Equal(sig.SignedAt) {
+		t.Errorf("读取的签名与写出的不一致: %+v", loaded)
+	}
+}
@@ -0,0 +1,448 @@
+package syncer
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"file_syn/internal/diff"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// defaultConflictSuffix keep-both 策略默认使用的后缀
+const defaultConflictSuffix = ".conflict"
+
+// action 双向同步中单个路径需要执行的动作
+type action int
+
+const (
+	actionNone     action = iota // 无需处理
+	actionToRight                // 将左侧状态传播到右侧
+	actionToLeft                 // 将右侧状态传播到左侧
+	actionKeepBoth               // 冲突：保留两侧版本
+	actionSkip                   // 冲突：跳过
+)
+
+// plan 双向同步的操作计划
+type plan struct {
+	ops       []*models.SyncOperation
+	conflicts []*models.SyncConflict
+	skipped   map[string]bool // 未处理的路径，保留旧的基线条目
+
+	// left、right 所有操作成功后两侧应有的状态，用于生成新的基线
+	left  map[string]*models.FileInfo
+	right map[string]*models.FileInfo
+}
+
+// Bidirectional 双向同步器
+//
+// 同步器保存上次成功同步后两侧的状态作为基线，下次同步时通过与基线对比
+// 判断每个变化来自左侧、右侧还是两侧。只有一侧变化的路径直接传播到另一侧，
+// 两侧都变化且结果不同的路径视为冲突，按照配置的策略解决。
+type Bidirectional struct {
+	leftDir   string
+	rightDir  string
+	statePath string
+	options   Options
+}
+
+// NewBidirectional 创建新的双向同步器
+func NewBidirectional(leftDir, rightDir, statePath string, options Options) *Bidirectional {
+	if options.ConflictPolicy == "" {
+		options.ConflictPolicy = models.ConflictSkip
+	}
+	if options.ConflictSuffix == "" {
+		options.ConflictSuffix = defaultConflictSuffix
+	}
+	return &Bidirectional{
+		leftDir:   leftDir,
+		rightDir:  rightDir,
+		statePath: statePath,
+		options:   options,
+	}
+}
+
+// Sync 根据对比结果执行双向同步，成功后更新基线
+func (b *Bidirectional) Sync(results []*models.DiffResult) ([]*models.SyncResult, []*models.SyncConflict, error) {
+	base, err := LoadState(b.statePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if base != nil && (base.LeftDir != b.leftDir || base.RightDir != b.rightDir) {
+		return nil, nil, fmt.Errorf("基线文件 %s 属于其他目录对: %s <-> %s", b.statePath, base.LeftDir, base.RightDir)
+	}
+
+	pl := b.plan(results, base)
+	syncResults := apply(pl.ops, b.options)
+	if b.options.DryRun {
+		return syncResults, pl.conflicts, nil
+	}
+
+	// 未能同步的路径保留旧的基线，下次同步时会再次被识别为变化
+	for _, result := range syncResults {
+		if result.Error != nil {
+			pl.skipped[result.Operation.Path] = true
+		}
+	}
+	if err := b.saveState(base, pl); err != nil {
+		return syncResults, pl.conflicts, err
+	}
+	return syncResults, pl.conflicts, nil
+}
+
+// Plan 根据对比结果和基线生成同步操作，同时返回冲突列表和未处理的路径集合
+//
+// base 为 nil 表示首次同步：仅存在于一侧的条目会复制到另一侧，
+// 两侧都存在但不一致的条目视为冲突。
+func (b *Bidirectional) Plan(results []*models.DiffResult, base *State) ([]*models.SyncOperation, []*models.SyncConflict, map[string]bool) {
+	pl := b.plan(results, base)
+	return pl.ops, pl.conflicts, pl.skipped
+}
+
+// plan 生成同步操作，并记录所有操作成功后两侧应有的状态
+func (b *Bidirectional) plan(results []*models.DiffResult, base *State) *plan {
+	left := make(map[string]*models.FileInfo)
+	right := make(map[string]*models.FileInfo)
+	unknown := make(map[string]bool)
+	allPaths := make(map[string]bool)
+	for _, result := range results {
+		if result.Status == models.StatusUnknown {
+			unknown[result.Path] = true
+		}
+		// 重命名结果两侧的路径不同，按各自的路径拆分为删除和新增处理
+		if result.LeftInfo != nil {
+			left[result.LeftInfo.Path] = result.LeftInfo
+			allPaths[result.LeftInfo.Path] = true
+		}
+		if result.RightInfo != nil {
+			right[result.RightInfo.Path] = result.RightInfo
+			allPaths[result.RightInfo.Path] = true
+		}
+	}
+
+	baseLeft := make(map[string]*stateEntry)
+	baseRight := make(map[string]*stateEntry)
+	if base != nil {
+		baseLeft, baseRight = base.Left, base.Right
+		for path := range baseLeft {
+			allPaths[path] = true
+		}
+		for path := range baseRight {
+			allPaths[path] = true
+		}
+	}
+
+	var sortedPaths []string
+	for path := range allPaths {
+		sortedPaths = append(sortedPaths, path)
+	}
+	sort.Strings(sortedPaths)
+
+	// 第一步：判断每个路径的变化来源
+	rules := b.options.rules()
+	actions := make(map[string]action, len(sortedPaths))
+	skipped := make(map[string]bool)
+	var conflicts []*models.SyncConflict
+	for _, p := range sortedPaths {
+		l, r := left[p], right[p]
+		lChanged := !sameEntry(l, baseLeft[p].fileInfo(p), rules)
+		rChanged := !sameEntry(r, baseRight[p].fileInfo(p), rules)
+
+		switch {
+		case unknown[p]:
+			// 因扫描错误无法确定某一侧的状态，不能当作删除或修改处理
+			actions[p] = actionSkip
+			skipped[p] = true
+		case sameEntry(l, r, rules):
+			actions[p] = actionNone
+		case lChanged && !rChanged:
+			actions[p] = actionToRight
+		case rChanged && !lChanged:
+			actions[p] = actionToLeft
+		case !lChanged && !rChanged:
+			// 两侧都与基线一致但彼此不同，只可能是基线被保留的未解决冲突
+			actions[p] = actionSkip
+			skipped[p] = true
+		default:
+			act, resolution := b.resolve(l, r)
+			actions[p] = act
+			if act == actionSkip {
+				skipped[p] = true
+			}
+			conflicts = append(conflicts, &models.SyncConflict{
+				Path:       p,
+				LeftInfo:   l,
+				RightInfo:  r,
+				Resolution: resolution,
+			})
+		}
+	}
+
+	// 第二步：删除目录前确认其子项都会被删除，否则保留该目录
+	for i := len(sortedPaths) - 1; i >= 0; i-- {
+		p := sortedPaths[i]
+		switch {
+		case actions[p] == actionToRight && deletesDir(left[p], right[p]):
+			actions[p] = b.reviseDirDelete(p, right, sortedPaths, actions, actionToRight, actionToLeft, left[p] == nil)
+		case actions[p] == actionToLeft && deletesDir(right[p], left[p]):
+			actions[p] = b.reviseDirDelete(p, left, sortedPaths, actions, actionToLeft, actionToRight, right[p] == nil)
+		default:
+			continue
+		}
+		if actions[p] == actionSkip {
+			skipped[p] = true
+		}
+	}
+
+	// 第三步：生成操作（先逆序删除，再顺序创建，最后逆序恢复目录属性）
+	var deletes, creates, dirAttrs []*models.SyncOperation
+	for i := len(sortedPaths) - 1; i >= 0; i-- {
+		p := sortedPaths[i]
+		switch actions[p] {
+		case actionToRight:
+			deletes = appendDelete(deletes, b.leftDir, b.rightDir, p, left[p], right[p])
+		case actionToLeft:
+			deletes = appendDelete(deletes, b.rightDir, b.leftDir, p, right[p], left[p])
+		}
+	}
+	for _, p := range sortedPaths {
+		switch actions[p] {
+		case actionToRight:
+			creates = appendCreate(creates, b.leftDir, b.rightDir, p, left[p], right[p], rules)
+		case actionToLeft:
+			creates = appendCreate(creates, b.rightDir, b.leftDir, p, right[p], left[p], rules)
+		case actionKeepBoth:
+			// 右侧版本另存为带后缀的文件（两侧各一份），左侧版本占用原路径
+			renamed := conflictPath(p, b.options.ConflictSuffix)
+			creates = append(creates,
+				newOperation(models.OpCopy, b.rightDir, p, b.rightDir, renamed, "冲突：保留右侧版本"),
+				newOperation(models.OpCopy, b.rightDir, p, b.leftDir, renamed, "冲突：保留右侧版本"),
+				newOperation(models.OpCopy, b.leftDir, p, b.rightDir, p, "冲突：采用左侧版本"),
+			)
+		}
+	}
+	for i := len(creates) - 1; i >= 0; i-- {
+		if creates[i].Type == models.OpMkdir {
+			op := *creates[i]
+			op.Type = models.OpSetAttr
+			op.Reason = "恢复目录属性"
+			dirAttrs = append(dirAttrs, &op)
+		}
+	}
+
+	ops := make([]*models.SyncOperation, 0, len(deletes)+len(creates)+len(dirAttrs))
+	ops = append(ops, deletes...)
+	ops = append(ops, creates...)
+	ops = append(ops, dirAttrs...)
+
+	// 第四步：记录同步后两侧应有的状态（跳过的路径不记录，保留旧的基线条目）
+	pl := &plan{
+		ops:       ops,
+		conflicts: conflicts,
+		skipped:   skipped,
+		left:      make(map[string]*models.FileInfo),
+		right:     make(map[string]*models.FileInfo),
+	}
+	for _, p := range sortedPaths {
+		switch actions[p] {
+		case actionNone:
+			pl.expect(p, left[p], right[p])
+		case actionToRight:
+			pl.expect(p, left[p], left[p])
+		case actionToLeft:
+			pl.expect(p, right[p], right[p])
+		case actionKeepBoth:
+			pl.expect(p, left[p], left[p])
+			renamed := conflictPath(p, b.options.ConflictSuffix)
+			pl.expect(renamed, right[p], right[p])
+		}
+	}
+	return pl
+}
+
+// expect 记录路径在同步后两侧应有的状态，nil 表示不存在
+func (pl *plan) expect(p string, l, r *models.FileInfo) {
+	delete(pl.left, p)
+	delete(pl.right, p)
+	if l != nil {
+		pl.left[p] = l
+	}
+	if r != nil {
+		pl.right[p] = r
+	}
+}
+
+// resolve 按照冲突策略决定冲突路径的动作，返回动作和实际采用的策略
+func (b *Bidirectional) resolve(l, r *models.FileInfo) (action, string) {
+	switch b.options.ConflictPolicy {
+	case models.ConflictLeft:
+		return actionToRight, models.ConflictLeft
+	case models.ConflictRight:
+		return actionToLeft, models.ConflictRight
+	case models.ConflictNewer:
+		// 删除视为较旧的变化，保留仍然存在的一侧
+		switch {
+		case l == nil:
+			return actionToLeft, models.ConflictNewer
+		case r == nil:
+			return actionToRight, models.ConflictNewer
+		case l.ModTime.After(r.ModTime):
+			return actionToRight, models.ConflictNewer
+		case r.ModTime.After(l.ModTime):
+			return actionToLeft, models.ConflictNewer
+		}
+	case models.ConflictKeepBoth:
+		// 只有两侧都是普通文件时才能同时保留
+		if l != nil && r != nil && l.Type() == models.FileTypeFile && r.Type() == models.FileTypeFile {
+			return actionKeepBoth, models.ConflictKeepBoth
+		}
+	}
+	return actionSkip, models.ConflictSkip
+}
+
+// reviseDirDelete 检查即将在一侧删除的目录下是否还有需要保留的子项
+//
+// 所有子项都会被删除时维持原动作；有子项需要传播到另一侧时改为反向传播
+// （在另一侧重建该目录）；否则跳过该目录。
+func (b *Bidirectional) reviseDirDelete(p string, files map[string]*models.FileInfo, sortedPaths []string, actions map[string]action, deleteAct, reverseAct action, pureDelete bool) action {
+	prefix := p + "/"
+	keep := false
+	restore := false
+	start := sort.SearchStrings(sortedPaths, prefix)
+	for _, q := range sortedPaths[start:] {
+		if !strings.HasPrefix(q, prefix) {
+			break
+		}
+		if files[q] == nil || actions[q] == deleteAct {
+			continue
+		}
+		keep = true
+		if actions[q] == reverseAct {
+			restore = true
+		}
+	}
+
+	switch {
+	case !keep:
+		return deleteAct
+	case restore && pureDelete:
+		return reverseAct
+	default:
+		return actionSkip
+	}
+}
+
+// saveState 根据同步计划保存基线，重新扫描两侧目录用于校验
+//
+// 基线记录的是对比时看到并实际应用的状态，而不是同步后扫描到的状态：
+// 否则同步期间对任意一侧的修改会被当作基线，下次同步时被识别为未变化而丢失。
+// 重新扫描的结果与计划不一致的路径（同步期间被修改），以及 skipped 中的路径，
+// 在该侧保留旧的基线条目，下次同步时会再次被识别为变化。
+func (b *Bidirectional) saveState(base *State, pl *plan) error {
+	leftScanner := scanner.NewFileScannerWithOptions(b.leftDir, b.options.Scan)
+	if err := leftScanner.Scan(); err != nil {
+		return fmt.Errorf("扫描左侧目录失败: %v", err)
+	}
+	rightScanner := scanner.NewFileScannerWithOptions(b.rightDir, b.options.Scan)
+	if err := rightScanner.Scan(); err != nil {
+		return fmt.Errorf("扫描右侧目录失败: %v", err)
+	}
+
+	st := NewState(b.leftDir, b.rightDir, nil, nil)
+	var baseLeft, baseRight map[string]*stateEntry
+	if base != nil {
+		baseLeft, baseRight = base.Left, base.Right
+	}
+	rules := b.options.rules()
+	verifyState(st.Left, baseLeft, pl.left, leftScanner, pl.skipped, rules)
+	verifyState(st.Right, baseRight, pl.right, rightScanner, pl.skipped, rules)
+	return st.Save(b.statePath)
+}
+
+// verifyState 生成一侧的基线条目
+//
+// 重新扫描的结果与计划一致的路径记录计划中的状态，其余路径保留旧的基线条目。
+// 因扫描错误无法确定的路径同样保留旧的基线条目，否则无法读取的目录中的条目
+// 会从基线中消失，下次同步时被当作已删除。
+func verifyState(entries, baseEntries map[string]*stateEntry, expected map[string]*models.FileInfo, s *scanner.FileScanner, skipped map[string]bool, rules *diff.Rules) {
+	scanned := s.GetFiles()
+	paths := make(map[string]bool, len(expected)+len(scanned)+len(baseEntries))
+	for p := range expected {
+		paths[p] = true
+	}
+	for p := range scanned {
+		paths[p] = true
+	}
+	for p := range baseEntries {
+		paths[p] = true
+	}
+
+	for p := range paths {
+		info, exists := scanned[p]
+		keep := skipped[p] || s.Unknown(p, exists) || !sameEntry(info, expected[p], rules)
+		switch {
+		case keep:
+			if entry, ok := baseEntries[p]; ok {
+				entries[p] = entry
+			}
+		case expected[p] != nil:
+			entries[p] = newStateEntry(expected[p])
+		}
+	}
+}
+
+// sameEntry 按对比规则判断两个条目是否一致（都不存在也视为一致）
+func sameEntry(a, b *models.FileInfo, rules *diff.Rules) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return len(rules.Compare(a, b)) == 0
+}
+
+// deletesDir 判断将 src 的状态传播到 dst 时是否需要删除 dst 上的目录
+func deletesDir(src, dst *models.FileInfo) bool {
+	return dst != nil && dst.IsDir && (src == nil || !src.IsDir)
+}
+
+// appendDelete 将 src 的状态传播到 dst 时，追加需要先删除 dst 条目的操作
+func appendDelete(ops []*models.SyncOperation, srcRoot, dstRoot, p string, src, dst *models.FileInfo) []*models.SyncOperation {
+	switch {
+	case dst == nil:
+		return ops
+	case src == nil:
+		return append(ops, newOperation(models.OpDelete, srcRoot, p, dstRoot, p, "另一侧已删除"))
+	case src.IsDir != dst.IsDir:
+		return append(ops, newOperation(models.OpDelete, srcRoot, p, dstRoot, p, "文件类型不同"))
+	}
+	return ops
+}
+
+// appendCreate 将 src 的状态传播到 dst 时，追加创建或更新 dst 条目的操作
+func appendCreate(ops []*models.SyncOperation, srcRoot, dstRoot, p string, src, dst *models.FileInfo, rules *diff.Rules) []*models.SyncOperation {
+	switch {
+	case src == nil:
+		return ops
+	case dst == nil || src.Type() != dst.Type():
+		return append(ops, newOperation(createType(src), srcRoot, p, dstRoot, p, "另一侧已变更"))
+	case src.IsDir:
+		// 目录只有扩展元数据可能不同
+		return append(ops, newOperation(models.OpSetAttr, srcRoot, p, dstRoot, p, "另一侧属性已变更"))
+	case src.IsSymlink:
+		return append(ops, newOperation(models.OpSymlink, srcRoot, p, dstRoot, p, "另一侧链接已变更"))
+	case contentDiffers(src, dst, rules):
+		return append(ops, newOperation(models.OpCopy, srcRoot, p, dstRoot, p, "另一侧已变更"))
+	default:
+		return append(ops, newOperation(models.OpSetAttr, srcRoot, p, dstRoot, p, "另一侧属性已变更"))
+	}
+}
+
+// conflictPath 在文件扩展名前插入冲突后缀，例如 a/b.txt -> a/b.conflict.txt
+func conflictPath(p, suffix string) string {
+	ext := path.Ext(p)
+	if strings.HasPrefix(path.Base(p), ".") && ext == path.Base(p) {
+		ext = ""
+	}
+	return strings.TrimSuffix(p, ext) + suffix + ext
+}
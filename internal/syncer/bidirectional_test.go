@@ -0,0 +1,263 @@
+package syncer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"file_syn/internal/diff"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// writeFile 写入测试文件并设置修改时间
+func writeFile(t *testing.T, path, content string, modTime time.Time) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("无法创建目录: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("无法设置修改时间: %v", err)
+	}
+}
+
+// runBidirectional 对比两侧目录并执行一次双向同步
+func runBidirectional(t *testing.T, leftDir, rightDir, statePath, policy string) []*models.SyncConflict {
+	results, err := diff.NewComparer().Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	b := NewBidirectional(leftDir, rightDir, statePath, Options{ConflictPolicy: policy})
+	syncResults, conflicts, err := b.Sync(results)
+	if err != nil {
+		t.Fatalf("双向同步失败: %v", err)
+	}
+	for _, result := range syncResults {
+		if result.Error != nil {
+			t.Errorf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+	}
+	return conflicts
+}
+
+// readFile 读取文件内容，文件不存在时返回空字符串
+func readFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func TestBidirectionalSync(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(leftDir, "shared.txt"), "v1", base)
+	writeFile(t, filepath.Join(rightDir, "shared.txt"), "v1", base)
+	writeFile(t, filepath.Join(leftDir, "from_left.txt"), "left", base)
+	writeFile(t, filepath.Join(rightDir, "dir", "from_right.txt"), "right", base)
+
+	// 首次同步：仅存在于一侧的文件复制到另一侧
+	if conflicts := runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip); len(conflicts) != 0 {
+		t.Errorf("首次同步不应有冲突: %+v", conflicts)
+	}
+	if readFile(filepath.Join(rightDir, "from_left.txt")) != "left" {
+		t.Error("from_left.txt 未复制到右侧")
+	}
+	if readFile(filepath.Join(leftDir, "dir", "from_right.txt")) != "right" {
+		t.Error("dir/from_right.txt 未复制到左侧")
+	}
+
+	// 第二次同步：左侧修改、右侧删除，各自传播到另一侧
+	writeFile(t, filepath.Join(leftDir, "shared.txt"), "v2 from left", base.Add(time.Minute))
+	if err := os.RemoveAll(filepath.Join(rightDir, "dir")); err != nil {
+		t.Fatalf("无法删除目录: %v", err)
+	}
+	if conflicts := runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip); len(conflicts) != 0 {
+		t.Errorf("单侧变化不应产生冲突: %+v", conflicts)
+	}
+	if readFile(filepath.Join(rightDir, "shared.txt")) != "v2 from left" {
+		t.Error("左侧修改未传播到右侧")
+	}
+	if _, err := os.Stat(filepath.Join(leftDir, "dir")); !os.IsNotExist(err) {
+		t.Error("右侧删除未传播到左侧")
+	}
+}
+
+func TestBidirectionalConflicts(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(leftDir, "doc.txt"), "base", base)
+	writeFile(t, filepath.Join(rightDir, "doc.txt"), "base", base)
+	runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip)
+
+	// 两侧同时修改
+	writeFile(t, filepath.Join(leftDir, "doc.txt"), "left edit", base.Add(time.Minute))
+	writeFile(t, filepath.Join(rightDir, "doc.txt"), "right edit, newer", base.Add(2*time.Minute))
+
+	// skip 策略：报告冲突但不修改任何一侧，下次同步仍然是冲突
+	for i := 0; i < 2; i++ {
+		conflicts := runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip)
+		if len(conflicts) != 1 || conflicts[0].Path != "doc.txt" || conflicts[0].Resolution != models.ConflictSkip {
+			t.Fatalf("第 %d 次同步期望 doc.txt 冲突被跳过，实际: %+v", i+1, conflicts)
+		}
+	}
+	if readFile(filepath.Join(leftDir, "doc.txt")) != "left edit" {
+		t.Error("skip 策略不应修改左侧文件")
+	}
+
+	// keep-both 策略：左侧版本占用原路径，右侧版本加后缀另存
+	conflicts := runBidirectional(t, leftDir, rightDir, statePath, models.ConflictKeepBoth)
+	if len(conflicts) != 1 || conflicts[0].Resolution != models.ConflictKeepBoth {
+		t.Fatalf("期望 keep-both 解决冲突，实际: %+v", conflicts)
+	}
+	for _, dir := range []string{leftDir, rightDir} {
+		if readFile(filepath.Join(dir, "doc.txt")) != "left edit" {
+			t.Errorf("%s/doc.txt 应为左侧版本", dir)
+		}
+		if readFile(filepath.Join(dir, "doc.conflict.txt")) != "right edit, newer" {
+			t.Errorf("%s/doc.conflict.txt 应为右侧版本", dir)
+		}
+	}
+}
+
+func TestBidirectionalNewerWins(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(leftDir, "doc.txt"), "left", base)
+	writeFile(t, filepath.Join(rightDir, "doc.txt"), "right, newer", base.Add(time.Minute))
+
+	conflicts := runBidirectional(t, leftDir, rightDir, statePath, models.ConflictNewer)
+	if len(conflicts) != 1 || conflicts[0].Resolution != models.ConflictNewer {
+		t.Fatalf("期望 newer 解决冲突，实际: %+v", conflicts)
+	}
+	if readFile(filepath.Join(leftDir, "doc.txt")) != "right, newer" {
+		t.Error("较新的右侧版本应覆盖左侧")
+	}
+}
+
+func TestBidirectionalUnknown(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root 用户可以读取无权限的目录")
+	}
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(leftDir, "locked", "a.txt"), "v1", base)
+	writeFile(t, filepath.Join(rightDir, "locked", "a.txt"), "v1", base)
+	runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip)
+
+	// 右侧目录无法读取时，其中的文件状态无法确定，不能当作右侧删除传播到左侧
+	locked := filepath.Join(rightDir, "locked")
+	if err := os.Chmod(locked, 0); err != nil {
+		t.Fatalf("无法修改权限: %v", err)
+	}
+	defer os.Chmod(locked, 0755)
+	runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip)
+	if readFile(filepath.Join(leftDir, "locked", "a.txt")) != "v1" {
+		t.Fatal("无法确定的文件不应被删除")
+	}
+
+	// 基线保留了无法读取的条目，恢复权限后右侧的删除仍能正确传播
+	if err := os.Chmod(locked, 0755); err != nil {
+		t.Fatalf("无法修改权限: %v", err)
+	}
+	if err := os.Remove(filepath.Join(locked, "a.txt")); err != nil {
+		t.Fatalf("无法删除文件: %v", err)
+	}
+	runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip)
+	if _, err := os.Stat(filepath.Join(leftDir, "locked", "a.txt")); !os.IsNotExist(err) {
+		t.Error("右侧删除未传播到左侧")
+	}
+}
+
+func TestBidirectionalRules(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	writeFile(t, filepath.Join(leftDir, "shared.txt"), "v1", base)
+	writeFile(t, filepath.Join(rightDir, "shared.txt"), "v1", base)
+
+	rules := &diff.Rules{Attributes: []models.DifferenceKind{models.DiffSize, models.DiffContent}}
+	scan := scanner.Options{HashAlgo: "sha256"}
+	comparer := diff.NewComparerWithOptions(diff.Options{Scan: scan, Rules: rules})
+	b := NewBidirectional(leftDir, rightDir, statePath, Options{Rules: rules, Scan: scan})
+	sync := func() ([]*models.SyncOperation, []*models.SyncConflict) {
+		results, err := comparer.Compare(leftDir, rightDir)
+		if err != nil {
+			t.Fatalf("对比失败: %v", err)
+		}
+		st, err := LoadState(statePath)
+		if err != nil {
+			t.Fatalf("加载基线失败: %v", err)
+		}
+		ops, conflicts, _ := b.Plan(results, st)
+		if _, _, err := b.Sync(results); err != nil {
+			t.Fatalf("双向同步失败: %v", err)
+		}
+		return ops, conflicts
+	}
+	sync()
+
+	// 两侧只有修改时间变化，不参与对比时既不是冲突也不需要同步
+	writeFile(t, filepath.Join(leftDir, "shared.txt"), "v1", base.Add(time.Minute))
+	writeFile(t, filepath.Join(rightDir, "shared.txt"), "v1", base.Add(2*time.Minute))
+	if ops, conflicts := sync(); len(ops) != 0 || len(conflicts) != 0 {
+		t.Errorf("只有修改时间变化时不应有操作或冲突: %v %v", ops, conflicts)
+	}
+
+	// 内容变化照常传播
+	writeFile(t, filepath.Join(leftDir, "shared.txt"), "v2", base.Add(3*time.Minute))
+	sync()
+	if readFile(filepath.Join(rightDir, "shared.txt")) != "v2" {
+		t.Error("左侧的修改未传播到右侧")
+	}
+}
+
+func TestBidirectionalEditDuringSync(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	writeFile(t, filepath.Join(leftDir, "stable.txt"), "v1", base)
+	writeFile(t, filepath.Join(rightDir, "stable.txt"), "v1", base)
+	writeFile(t, filepath.Join(leftDir, "new.txt"), "new", base)
+	runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip)
+
+	// 对比之后、同步完成之前修改右侧未变化的文件，并在左侧新建文件
+	writeFile(t, filepath.Join(leftDir, "new.txt"), "new v2", base.Add(time.Minute))
+	results, err := diff.NewComparer().Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	writeFile(t, filepath.Join(rightDir, "stable.txt"), "edited during sync", base.Add(2*time.Minute))
+	writeFile(t, filepath.Join(leftDir, "late.txt"), "late", base.Add(2*time.Minute))
+	b := NewBidirectional(leftDir, rightDir, statePath, Options{})
+	if _, _, err := b.Sync(results); err != nil {
+		t.Fatalf("双向同步失败: %v", err)
+	}
+	if readFile(filepath.Join(rightDir, "new.txt")) != "new v2" {
+		t.Error("左侧的修改未传播到右侧")
+	}
+
+	// 同步期间的修改不能进入基线，下次同步时应正常传播
+	if conflicts := runBidirectional(t, leftDir, rightDir, statePath, models.ConflictSkip); len(conflicts) != 0 {
+		t.Errorf("同步期间的单侧修改不应产生冲突: %+v", conflicts)
+	}
+	if readFile(filepath.Join(leftDir, "stable.txt")) != "edited during sync" {
+		t.Error("同步期间右侧的修改未传播到左侧")
+	}
+	if readFile(filepath.Join(rightDir, "late.txt")) != "late" {
+		t.Error("同步期间左侧新建的文件未传播到右侧")
+	}
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package syncer
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"file_syn/internal/xattr"
+	"file_syn/pkg/models"
+)
+
+// copyMetadata 按选项将 src 的属主、扩展属性和 POSIX ACL 复制到 dst
+//
+// info 为 src 的文件信息。dst 为符号链接时只设置链接本身的属主。
+// 特殊权限位随权限位一起由 setAttributes 设置。
+func copyMetadata(src, dst string, info os.FileInfo, options models.MetadataOptions) error {
+	if options.Owner {
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			if err := os.Lchown(dst, int(st.Uid), int(st.Gid)); err != nil {
+				return fmt.Errorf("设置属主失败: %v", err)
+			}
+		}
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	if options.Xattrs {
+		if err := copyXattrs(src, dst); err != nil {
+			return fmt.Errorf("设置扩展属性失败: %v", err)
+		}
+	}
+	if options.ACL {
+		for _, name := range xattr.ACLNames(info.IsDir()) {
+			data, err := xattr.Get(src, name)
+			switch {
+			case xattr.IsNotExist(err):
+				err = xattr.Remove(dst, name)
+			case err == nil:
+				err = xattr.Set(dst, name, data)
+			}
+			if err != nil && !xattr.IsNotExist(err) {
+				return fmt.Errorf("设置 ACL 失败: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+// copyXattrs 使 dst 的扩展属性（不含 POSIX ACL）与 src 一致
+func copyXattrs(src, dst string) error {
+	names, err := xattr.List(src)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		if xattr.IsACL(name) {
+			continue
+		}
+		value, err := xattr.Get(src, name)
+		if xattr.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := xattr.Set(dst, name, value); err != nil {
+			return err
+		}
+		keep[name] = true
+	}
+
+	// 删除源文件没有的扩展属性
+	existing, err := xattr.List(dst)
+	if err != nil {
+		return err
+	}
+	for _, name := range existing {
+		if !keep[name] && !xattr.IsACL(name) {
+			if err := xattr.Remove(dst, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package syncer
+
+import (
+	"os"
+
+	"file_syn/pkg/models"
+)
+
+// copyMetadata 当前平台不同步扩展元数据
+func copyMetadata(src, dst string, info os.FileInfo, options models.MetadataOptions) error {
+	return nil
+}
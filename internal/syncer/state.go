@@ -0,0 +1,151 @@
+package syncer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"file_syn/pkg/models"
+)
+
+// stateVersion 基线文件格式版本
+const stateVersion = 1
+
+// State 上次成功同步后两侧目录的状态（基线）
+type State struct {
+	Version  int                    `json:"version"`
+	LeftDir  string                 `json:"left_dir"`
+	RightDir string                 `json:"right_dir"`
+	SyncedAt time.Time              `json:"synced_at"`
+	Left     map[string]*stateEntry `json:"left"`
+	Right    map[string]*stateEntry `json:"right"`
+}
+
+// stateEntry 基线中单个条目的元数据
+type stateEntry struct {
+	Size       int64            `json:"size"`
+	ModTime    time.Time        `json:"mtime"`
+	IsDir      bool             `json:"is_dir"`
+	IsSymlink  bool             `json:"is_symlink,omitempty"`
+	LinkTarget string           `json:"link_target,omitempty"`
+	Mode       os.FileMode      `json:"mode"`
+	Digest     string           `json:"digest,omitempty"`
+	Meta       *models.Metadata `json:"meta,omitempty"`
+}
+
+// NewState 根据两侧当前的文件列表创建基线
+func NewState(leftDir, rightDir string, left, right map[string]*models.FileInfo) *State {
+	st := &State{
+		Version:  stateVersion,
+		LeftDir:  leftDir,
+		RightDir: rightDir,
+		SyncedAt: time.Now(),
+		Left:     make(map[string]*stateEntry, len(left)),
+		Right:    make(map[string]*stateEntry, len(right)),
+	}
+	for path, info := range left {
+		st.Left[path] = newStateEntry(info)
+	}
+	for path, info := range right {
+		st.Right[path] = newStateEntry(info)
+	}
+	return st
+}
+
+// newStateEntry 从文件信息创建基线条目
+func newStateEntry(info *models.FileInfo) *stateEntry {
+	return &stateEntry{
+		Size:       info.Size,
+		ModTime:    info.ModTime,
+		IsDir:      info.IsDir,
+		IsSymlink:  info.IsSymlink,
+		LinkTarget: info.LinkTarget,
+		Mode:       info.Mode,
+		Digest:     info.Digest,
+		Meta:       info.Meta,
+	}
+}
+
+// fileInfo 将基线条目还原为文件信息，条目不存在时返回 nil
+func (e *stateEntry) fileInfo(path string) *models.FileInfo {
+	if e == nil {
+		return nil
+	}
+	return &models.FileInfo{
+		Path:       path,
+		Size:       e.Size,
+		ModTime:    e.ModTime,
+		IsDir:      e.IsDir,
+		IsSymlink:  e.IsSymlink,
+		LinkTarget: e.LinkTarget,
+		Mode:       e.Mode,
+		Digest:     e.Digest,
+		Meta:       e.Meta,
+	}
+}
+
+// DefaultStatePath 返回目录对默认的基线文件路径（位于用户缓存目录下）
+func DefaultStatePath(leftDir, rightDir string) (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("无法获取用户缓存目录: %v", err)
+	}
+	sum := sha256.Sum256([]byte(leftDir + "\x00" + rightDir))
+	name := "state-" + hex.EncodeToString(sum[:8]) + ".json"
+	return filepath.Join(cacheDir, "file_syn", name), nil
+}
+
+// LoadState 加载基线文件，文件不存在时返回 nil（表示首次同步）
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取基线文件 %s: %v", path, err)
+	}
+
+	var st State
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("无法解析基线文件 %s: %v", path, err)
+	}
+	if st.Version != stateVersion {
+		return nil, fmt.Errorf("不支持的基线文件版本 %d: %s", st.Version, path)
+	}
+	return &st, nil
+}
+
+// Save 原子地写入基线文件
+func (st *State) Save(path string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("无法序列化基线: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("无法创建基线目录: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*.tmp")
+	if err != nil {
+		return fmt.Errorf("无法创建临时文件: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入基线文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入基线文件失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("替换基线文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,385 @@
+package syncer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"file_syn/internal/delta"
+	"file_syn/internal/diff"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// Options 同步选项
+type Options struct {
+	DryRun         bool   // 演练模式：只生成操作计划，不修改任何文件
+	DeleteExtra    bool   // 删除右侧目录中多余（左侧不存在）的文件（仅单向镜像）
+	ConflictPolicy string // 冲突解决策略（仅双向同步），见 models.Conflict* 常量
+	ConflictSuffix string // keep-both 策略下另存版本使用的后缀（仅双向同步）
+
+	Metadata models.MetadataOptions // 同步时保留的扩展元数据（仅 Linux，修改属主需要 root 权限）
+	Rules    *diff.Rules            // 判断条目是否一致使用的对比规则（为 nil 时使用 diff.DefaultRules）
+
+	Scan scanner.Options // 同步完成后重新扫描目录校验结果时使用的扫描选项（仅双向同步）
+
+	// DeltaThreshold 目标文件已存在且源文件不小于该大小时使用增量传输，
+	// 只写入变化的部分（为 0 时总是完整复制）
+	DeltaThreshold int64
+}
+
+// Syncer 单向镜像同步器，使右侧目录与左侧目录保持一致
+type Syncer struct {
+	leftDir  string
+	rightDir string
+	options  Options
+}
+
+// NewSyncer 创建新的同步器
+func NewSyncer(leftDir, rightDir string, options Options) *Syncer {
+	return &Syncer{
+		leftDir:  leftDir,
+		rightDir: rightDir,
+		options:  options,
+	}
+}
+
+// Sync 根据对比结果生成操作计划并执行
+func (s *Syncer) Sync(results []*models.DiffResult) []*models.SyncResult {
+	return s.Apply(s.Plan(results))
+}
+
+// Plan 根据对比结果生成同步操作列表
+//
+// 对比结果按路径排序，父目录总是排在子项之前。操作分四个阶段生成：
+//  1. 在右侧将重命名的文件移回左侧的路径（在删除前执行，避免所在目录被删除），
+//     没有摘要的重命名配对在第 3 阶段从左侧重新复制内容
+//  2. 逆序删除右侧多余的文件（先删子项再删目录）
+//  3. 顺序创建目录、复制文件、修正属性
+//  4. 逆序恢复新建目录的权限和修改时间（避免被子项写入覆盖）
+func (s *Syncer) Plan(results []*models.DiffResult) []*models.SyncOperation {
+	var renames, deletes, creates, dirAttrs []*models.SyncOperation
+
+	for _, result := range results {
+		if result.Status != models.StatusRenamed {
+			continue
+		}
+		op := newOperation(models.OpRename, s.rightDir, result.Path, s.rightDir, result.OldPath, "文件已重命名")
+		renames = append(renames, op)
+		switch {
+		case result.LeftInfo.Digest == "" || result.RightInfo.Digest == "":
+			// 没有摘要时只按大小和修改时间配对，内容不一定相同，重命名后再从左侧复制
+			creates = append(creates, s.newOp(models.OpCopy, result.OldPath, "重命名的文件内容未经校验"))
+		case len(s.options.rules().Compare(result.LeftInfo, result.RightInfo)) > 0:
+			creates = append(creates, s.newOp(models.OpSetAttr, result.OldPath, "文件属性不同"))
+		}
+	}
+
+	for i := len(results) - 1; i >= 0; i-- {
+		result := results[i]
+		switch {
+		case result.Status == models.StatusAdded && s.options.DeleteExtra:
+			deletes = append(deletes, s.newOp(models.OpDelete, result.Path, "左侧不存在"))
+		case result.Status == models.StatusModified && result.LeftInfo.IsDir != result.RightInfo.IsDir:
+			// 类型不同（文件/目录）时必须先删除右侧再重新创建
+			deletes = append(deletes, s.newOp(models.OpDelete, result.Path, "文件类型不同"))
+		}
+	}
+
+	for _, result := range results {
+		switch result.Status {
+		case models.StatusDeleted:
+			creates = append(creates, s.createOp(result.LeftInfo, "右侧不存在"))
+		case models.StatusModified:
+			left, right := result.LeftInfo, result.RightInfo
+			switch {
+			case left.Type() != right.Type():
+				// 普通文件和符号链接之间的替换由创建操作原子地完成，无需先删除
+				creates = append(creates, s.createOp(left, "文件类型不同"))
+			case left.IsDir:
+				// 目录只有扩展元数据可能不同
+				creates = append(creates, s.newOp(models.OpSetAttr, left.Path, "目录属性不同"))
+			case left.IsSymlink:
+				creates = append(creates, s.newOp(models.OpSymlink, left.Path, "链接不同"))
+			case contentDiffers(left, right, s.options.rules()):
+				creates = append(creates, s.newOp(models.OpCopy, left.Path, "文件内容可能不同"))
+			default:
+				creates = append(creates, s.newOp(models.OpSetAttr, left.Path, "文件属性不同"))
+			}
+		case models.StatusTouched:
+			creates = append(creates, s.newOp(models.OpSetAttr, result.Path, "文件内容一致，属性不同"))
+		}
+	}
+
+	// 新建目录的属性在所有子项写入完成后再设置
+	for i := len(creates) - 1; i >= 0; i-- {
+		if creates[i].Type == models.OpMkdir {
+			dirAttrs = append(dirAttrs, s.newOp(models.OpSetAttr, creates[i].Path, "恢复目录属性"))
+		}
+	}
+
+	ops := make([]*models.SyncOperation, 0, len(renames)+len(deletes)+len(creates)+len(dirAttrs))
+	ops = append(ops, renames...)
+	ops = append(ops, deletes...)
+	ops = append(ops, creates...)
+	ops = append(ops, dirAttrs...)
+	return ops
+}
+
+// Apply 依次执行同步操作，单个操作失败不会中断整个同步
+func (s *Syncer) Apply(ops []*models.SyncOperation) []*models.SyncResult {
+	return apply(ops, s.options)
+}
+
+// apply 依次执行同步操作并收集每个操作的结果
+func apply(ops []*models.SyncOperation, options Options) []*models.SyncResult {
+	results := make([]*models.SyncResult, 0, len(ops))
+	for _, op := range ops {
+		result := &models.SyncResult{
+			Operation: op,
+			DryRun:    options.DryRun,
+		}
+		if !options.DryRun {
+			result.Error = execute(result, options)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// createOp 生成在右侧创建左侧条目的操作
+func (s *Syncer) createOp(info *models.FileInfo, reason string) *models.SyncOperation {
+	return s.newOp(createType(info), info.Path, reason)
+}
+
+// createType 返回创建条目使用的操作类型：目录为 mkdir，符号链接为 symlink（重建链接而不是复制目标），其余为 copy
+func createType(info *models.FileInfo) string {
+	switch {
+	case info.IsDir:
+		return models.OpMkdir
+	case info.IsSymlink:
+		return models.OpSymlink
+	default:
+		return models.OpCopy
+	}
+}
+
+// newOp 创建同步操作，源路径位于左侧目录，目标路径位于右侧目录
+func (s *Syncer) newOp(opType, relPath, reason string) *models.SyncOperation {
+	return newOperation(opType, s.leftDir, relPath, s.rightDir, relPath, reason)
+}
+
+// newOperation 创建从 srcRoot/srcRel 到 dstRoot/dstRel 的同步操作
+func newOperation(opType, srcRoot, srcRel, dstRoot, dstRel, reason string) *models.SyncOperation {
+	return &models.SyncOperation{
+		Type:   opType,
+		Path:   dstRel,
+		Source: filepath.Join(srcRoot, filepath.FromSlash(srcRel)),
+		Target: filepath.Join(dstRoot, filepath.FromSlash(dstRel)),
+		Reason: reason,
+	}
+}
+
+// rules 返回判断条目是否一致使用的对比规则
+func (o Options) rules() *diff.Rules {
+	if o.Rules == nil {
+		return diff.DefaultRules
+	}
+	return o.Rules
+}
+
+// contentDiffers 判断两个普通文件的内容是否可能不同，需要复制
+//
+// 两侧都有摘要时以摘要为准，否则大小不同或修改时间超出容差即视为内容可能不同。
+func contentDiffers(src, dst *models.FileInfo, rules *diff.Rules) bool {
+	if src.Digest != "" && dst.Digest != "" {
+		return src.Digest != dst.Digest
+	}
+	return src.Size != dst.Size || !rules.SameModTime(src, dst)
+}
+
+// execute 执行单个同步操作，创建和更新条目时按 options.Metadata 保留扩展元数据，
+// 复制文件时在 result 中记录写入和复用的字节数
+func execute(result *models.SyncResult, options Options) error {
+	op, metadata := result.Operation, options.Metadata
+	switch op.Type {
+	case models.OpDelete:
+		if err := os.RemoveAll(op.Target); err != nil {
+			return fmt.Errorf("删除失败: %v", err)
+		}
+		return nil
+	case models.OpMkdir:
+		info, err := os.Stat(op.Source)
+		if err != nil {
+			return fmt.Errorf("无法读取源目录: %v", err)
+		}
+		if err := os.Mkdir(op.Target, info.Mode().Perm()|0700); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		return nil
+	case models.OpCopy:
+		stats, useDelta, err := copyFile(op.Source, op.Target, options)
+		result.Literal, result.Matched, result.Delta = stats.Literal, stats.Matched, useDelta
+		return err
+	case models.OpSymlink:
+		return copySymlink(op.Source, op.Target, metadata)
+	case models.OpRename:
+		if err := os.MkdirAll(filepath.Dir(op.Target), 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %v", err)
+		}
+		if err := os.Rename(op.Source, op.Target); err != nil {
+			return fmt.Errorf("重命名失败: %v", err)
+		}
+		return nil
+	case models.OpSetAttr:
+		info, err := os.Stat(op.Source)
+		if err != nil {
+			return fmt.Errorf("无法读取源文件: %v", err)
+		}
+		return setAttributes(op.Target, op.Source, info, metadata)
+	default:
+		return fmt.Errorf("未知的操作类型: %s", op.Type)
+	}
+}
+
+// copyFile 复制文件内容并保留权限和修改时间，返回写入和复用的字节数以及是否使用了增量传输
+//
+// 内容先写入目标目录下的临时文件，完成后再重命名覆盖目标文件，
+// 避免中途失败时留下不完整的目标文件。目标文件已存在且源文件不小于
+// options.DeltaThreshold 时，临时文件由目标文件原有的内容和增量重建。
+func copyFile(src, dst string, options Options) (delta.Stats, bool, error) {
+	var stats delta.Stats
+	in, err := os.Open(src)
+	if err != nil {
+		return stats, false, fmt.Errorf("无法打开源文件: %v", err)
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return stats, false, fmt.Errorf("无法读取源文件信息: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".file_syn-*.tmp")
+	if err != nil {
+		return stats, false, fmt.Errorf("无法创建临时文件: %v", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	useDelta := options.DeltaThreshold > 0 && info.Size() >= options.DeltaThreshold && isRegular(dst)
+	if useDelta {
+		stats, err = deltaCopy(in, dst, tmp)
+	} else {
+		stats.Literal, err = io.Copy(tmp, in)
+	}
+	if err != nil {
+		tmp.Close()
+		return stats, useDelta, fmt.Errorf("复制内容失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return stats, useDelta, fmt.Errorf("写入临时文件失败: %v", err)
+	}
+
+	if err := setAttributes(tmpPath, src, info, options.Metadata); err != nil {
+		return stats, useDelta, err
+	}
+
+	if err := os.Rename(tmpPath, dst); err != nil {
+		return stats, useDelta, fmt.Errorf("替换目标文件失败: %v", err)
+	}
+	return stats, useDelta, nil
+}
+
+// isRegular 判断 path 是否为已存在的普通文件（不跟随符号链接）
+func isRegular(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// deltaCopy 以目标文件 base 原有的内容为基准，把源内容 in 通过增量重建到 out
+//
+// 增量在一个 goroutine 中生成，经管道直接交给重建过程，不在内存或磁盘中保存完整的增量。
+func deltaCopy(in io.Reader, base string, out io.Writer) (delta.Stats, error) {
+	f, err := os.Open(base)
+	if err != nil {
+		return delta.Stats{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return delta.Stats{}, err
+	}
+	sig, err := delta.Sign(bufio.NewReader(f), delta.BlockSize(info.Size()))
+	if err != nil {
+		return delta.Stats{}, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := delta.Diff(sig, in, pw)
+		pw.CloseWithError(err)
+	}()
+	stats, err := delta.Patch(f, pr, out)
+	// 重建失败时结束生成增量的 goroutine
+	pr.CloseWithError(err)
+	return stats, err
+}
+
+// copySymlink 在目标位置创建与源符号链接目标相同的链接（不复制链接指向的内容）
+//
+// 链接先以临时名称创建，再重命名覆盖目标，目标原来是普通文件或符号链接时同样适用。
+func copySymlink(src, dst string, metadata models.MetadataOptions) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("无法读取源链接: %v", err)
+	}
+	target, err := os.Readlink(src)
+	if err != nil {
+		return fmt.Errorf("无法读取源链接: %v", err)
+	}
+
+	// 借助 CreateTemp 生成不冲突的临时名称
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".file_syn-*.tmp")
+	if err != nil {
+		return fmt.Errorf("无法创建临时文件: %v", err)
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	os.Remove(tmpPath)
+
+	if err := os.Symlink(target, tmpPath); err != nil {
+		return fmt.Errorf("创建符号链接失败: %v", err)
+	}
+	if err := copyMetadata(src, tmpPath, info, metadata); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dst); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("替换目标文件失败: %v", err)
+	}
+	return nil
+}
+
+// setAttributes 将权限位和修改时间设置为与源文件 src 一致，并按 metadata 复制扩展元数据
+//
+// 修改属主会清除 setuid 和 setgid 位，设置 ACL 会改变权限位，因此最后设置权限位。
+func setAttributes(path, src string, info os.FileInfo, metadata models.MetadataOptions) error {
+	if err := copyMetadata(src, path, info, metadata); err != nil {
+		return err
+	}
+	mode := info.Mode().Perm()
+	if metadata.Special {
+		mode |= info.Mode() & models.SpecialBits
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("设置权限失败: %v", err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		return fmt.Errorf("设置修改时间失败: %v", err)
+	}
+	return nil
+}
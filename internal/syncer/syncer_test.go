@@ -0,0 +1,416 @@
+package syncer
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"file_syn/internal/delta"
+	"file_syn/internal/diff"
+	"file_syn/internal/scanner"
+	"file_syn/internal/xattr"
+	"file_syn/pkg/models"
+)
+
+// setupDirs 创建用于同步测试的左右目录
+func setupDirs(t *testing.T) (string, string) {
+	leftDir, err := os.MkdirTemp("", "file_syn_sync_left_*")
+	if err != nil {
+		t.Fatalf("无法创建左侧临时目录: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(leftDir) })
+
+	rightDir, err := os.MkdirTemp("", "file_syn_sync_right_*")
+	if err != nil {
+		t.Fatalf("无法创建右侧临时目录: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(rightDir) })
+
+	files := map[string]string{
+		filepath.Join(leftDir, "common.txt"):         "left content",
+		filepath.Join(rightDir, "common.txt"):        "right content, longer",
+		filepath.Join(leftDir, "sub", "nested.txt"):  "nested",
+		filepath.Join(rightDir, "extra", "old.txt"):  "extra",
+		filepath.Join(leftDir, "kind"):               "file on the left",
+		filepath.Join(rightDir, "kind", "child.txt"): "dir on the right",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(leftDir, "sub", "nested.txt"), 0600); err != nil {
+		t.Fatalf("无法设置权限: %v", err)
+	}
+
+	return leftDir, rightDir
+}
+
+func TestSyncMirror(t *testing.T) {
+	leftDir, rightDir := setupDirs(t)
+
+	comparer := diff.NewComparer()
+	results, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+
+	syncer := NewSyncer(leftDir, rightDir, Options{DeleteExtra: true})
+	for _, result := range syncer.Sync(results) {
+		if result.Error != nil {
+			t.Errorf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+	}
+
+	// 同步后两侧应完全一致
+	results, err = comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	for _, result := range results {
+		if result.Status != models.StatusUnchanged {
+			t.Errorf("%s 同步后应为 unchanged，实际是 %s %v", result.Path, result.Status, result.Differences)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(rightDir, "common.txt"))
+	if err != nil || string(data) != "left content" {
+		t.Errorf("common.txt 内容未同步: %q, %v", data, err)
+	}
+}
+
+func TestSyncKeepExtra(t *testing.T) {
+	leftDir, rightDir := setupDirs(t)
+
+	results, err := diff.NewComparer().Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+
+	syncer := NewSyncer(leftDir, rightDir, Options{})
+	for _, result := range syncer.Sync(results) {
+		if result.Error != nil {
+			t.Errorf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(rightDir, "extra", "old.txt")); err != nil {
+		t.Errorf("未开启删除时应保留右侧多余文件: %v", err)
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	leftDir, rightDir := setupDirs(t)
+
+	results, err := diff.NewComparer().Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+
+	syncer := NewSyncer(leftDir, rightDir, Options{DryRun: true, DeleteExtra: true})
+	syncResults := syncer.Sync(results)
+	if len(syncResults) == 0 {
+		t.Fatal("演练模式应该生成操作计划")
+	}
+	for _, result := range syncResults {
+		if !result.DryRun || result.Error != nil {
+			t.Errorf("演练模式不应执行操作: %+v", result)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(rightDir, "sub")); !os.IsNotExist(err) {
+		t.Error("演练模式不应创建目录")
+	}
+	if _, err := os.Stat(filepath.Join(rightDir, "extra")); err != nil {
+		t.Error("演练模式不应删除文件")
+	}
+}
+
+func TestSyncDelta(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	base := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(base)
+	changed := append([]byte("inserted"), base...)
+	changed[100000] ^= 0xff
+	files := map[string][]byte{
+		filepath.Join(leftDir, "large.bin"):  changed,
+		filepath.Join(rightDir, "large.bin"): base,
+		filepath.Join(leftDir, "small.txt"):  []byte("small"),
+		filepath.Join(rightDir, "small.txt"): []byte("old"),
+		filepath.Join(leftDir, "added.bin"):  base,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+
+	results, err := diff.NewComparer().Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	syncResults := NewSyncer(leftDir, rightDir, Options{DeltaThreshold: 1024}).Sync(results)
+	byPath := make(map[string]*models.SyncResult)
+	for _, result := range syncResults {
+		if result.Error != nil {
+			t.Fatalf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+		byPath[result.Operation.Path] = result
+	}
+
+	// 大文件只传输插入和修改的部分，小文件和新增文件完整复制
+	large := byPath["large.bin"]
+	if !large.Delta || large.Literal+large.Matched != int64(len(changed)) || large.Literal > 3*delta.MinBlockSize {
+		t.Errorf("large.bin 应使用增量传输: delta=%v literal=%d matched=%d", large.Delta, large.Literal, large.Matched)
+	}
+	for name, size := range map[string]int64{"small.txt": 5, "added.bin": int64(len(base))} {
+		if result := byPath[name]; result.Delta || result.Literal != size || result.Matched != 0 {
+			t.Errorf("%s 应完整复制: %+v", name, result)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(rightDir, "large.bin")); err != nil || !bytes.Equal(data, changed) {
+		t.Errorf("large.bin 内容未同步: %v", err)
+	}
+}
+
+func TestSyncRename(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	content := "large file content"
+	for _, path := range []string{
+		filepath.Join(leftDir, "docs", "a.pdf"),
+		filepath.Join(rightDir, "archive", "a.pdf"),
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+
+	comparer := diff.NewComparerWithOptions(diff.Options{Scan: scanner.Options{HashAlgo: "sha256"}, DetectRenames: true})
+	results, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+
+	syncer := NewSyncer(leftDir, rightDir, Options{DeleteExtra: true})
+	renamed := false
+	for _, result := range syncer.Sync(results) {
+		if result.Error != nil {
+			t.Errorf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+		switch result.Operation.Type {
+		case models.OpRename:
+			renamed = true
+		case models.OpCopy:
+			t.Errorf("重命名的文件不应重新复制: %s", result.Operation.Path)
+		}
+	}
+	if !renamed {
+		t.Error("应该执行重命名操作")
+	}
+
+	results, err = comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	for _, result := range results {
+		if result.Status != models.StatusUnchanged {
+			t.Errorf("%s 同步后应为 unchanged，实际是 %s %v", result.Path, result.Status, result.Differences)
+		}
+	}
+}
+
+func TestSyncRenameWithoutDigest(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	// 大小和修改时间相同但内容不同，不计算摘要时会被配对为重命名
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for path, content := range map[string]string{
+		filepath.Join(leftDir, "docs", "a.txt"):     "left",
+		filepath.Join(rightDir, "archive", "a.txt"): "rght",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	comparer := diff.NewComparerWithOptions(diff.Options{DetectRenames: true})
+	results, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	renamed := false
+	for _, result := range results {
+		renamed = renamed || result.Status == models.StatusRenamed
+	}
+	if !renamed {
+		t.Fatal("应该按大小和修改时间配对为重命名")
+	}
+
+	for _, result := range NewSyncer(leftDir, rightDir, Options{DeleteExtra: true}).Sync(results) {
+		if result.Error != nil {
+			t.Errorf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(rightDir, "docs", "a.txt")); err != nil || string(data) != "left" {
+		t.Errorf("重命名后内容应与左侧一致: %q, %v", data, err)
+	}
+	if _, err := os.Lstat(filepath.Join(rightDir, "archive", "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("原路径应已不存在: %v", err)
+	}
+}
+
+func TestSyncSymlinks(t *testing.T) {
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	for _, dir := range []string{leftDir, rightDir} {
+		if err := os.WriteFile(filepath.Join(dir, "target.txt"), []byte("target"), 0644); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+	}
+	// new_link 只在左侧，changed 的目标不同，was_file 在右侧是普通文件，was_dir 在右侧是目录
+	links := map[string]string{
+		filepath.Join(leftDir, "new_link"): "target.txt",
+		filepath.Join(leftDir, "changed"):  "target.txt",
+		filepath.Join(rightDir, "changed"): "old.txt",
+		filepath.Join(leftDir, "was_file"): "target.txt",
+		filepath.Join(leftDir, "was_dir"):  "target.txt",
+		filepath.Join(leftDir, "dangling"): "missing.txt",
+		filepath.Join(rightDir, "to_file"): "target.txt",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatalf("无法创建符号链接: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(rightDir, "was_file"), []byte("regular"), 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(rightDir, "was_dir", "child"), 0755); err != nil {
+		t.Fatalf("无法创建目录: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(leftDir, "to_file"), []byte("regular"), 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+
+	comparer := diff.NewComparerWithOptions(diff.Options{Scan: scanner.Options{HashAlgo: "sha256"}})
+	results, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	for _, result := range NewSyncer(leftDir, rightDir, Options{}).Sync(results) {
+		if result.Error != nil {
+			t.Errorf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+	}
+
+	// 同步重建链接本身，而不是复制链接指向的内容
+	for _, name := range []string{"new_link", "changed", "was_file", "was_dir", "dangling"} {
+		want, _ := os.Readlink(filepath.Join(leftDir, name))
+		if got, err := os.Readlink(filepath.Join(rightDir, name)); err != nil || got != want {
+			t.Errorf("右侧 %s 应为指向 %s 的符号链接，实际 %q (%v)", name, want, got, err)
+		}
+	}
+	if info, err := os.Lstat(filepath.Join(rightDir, "to_file")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("右侧 to_file 应被替换为普通文件: %v", err)
+	}
+
+	results, err = comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	for _, result := range results {
+		if result.Status != models.StatusUnchanged {
+			t.Errorf("%s 同步后应为 unchanged，实际是 %s %v", result.Path, result.Status, result.Differences)
+		}
+	}
+}
+
+func TestSyncMetadata(t *testing.T) {
+	if runtime.GOOS != "linux" || os.Geteuid() != 0 {
+		t.Skip("同步属主需要 Linux 和 root 权限")
+	}
+	leftDir, rightDir := t.TempDir(), t.TempDir()
+	for _, dir := range []string{leftDir, rightDir} {
+		if err := os.WriteFile(filepath.Join(dir, "tool"), []byte("binary"), 0755); err != nil {
+			t.Fatalf("无法创建文件: %v", err)
+		}
+		if err := os.Mkdir(filepath.Join(dir, "shared"), 0755); err != nil {
+			t.Fatalf("无法创建目录: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(leftDir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	// 右侧 tool 有左侧没有的扩展属性，同步后应被删除
+	if err := xattr.Set(filepath.Join(rightDir, "tool"), "user.stale", []byte("1")); err != nil {
+		t.Skipf("不支持扩展属性: %v", err)
+	}
+	for _, name := range []string{"tool", "new.txt", "shared"} {
+		path := filepath.Join(leftDir, name)
+		if err := os.Chown(path, 1234, 5678); err != nil {
+			t.Fatalf("无法设置属主: %v", err)
+		}
+		if err := xattr.Set(path, "user.label", []byte(name)); err != nil {
+			t.Fatalf("无法设置扩展属性: %v", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(leftDir, "tool"), 0755|os.ModeSetuid); err != nil {
+		t.Fatalf("无法设置权限: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(leftDir, "shared"), 0755|os.ModeSticky); err != nil {
+		t.Fatalf("无法设置权限: %v", err)
+	}
+	// user::rwx,user:1000:r-x,group::r-x,mask::r-x,other::r-x
+	acl := []byte{
+		2, 0, 0, 0,
+		0x01, 0, 7, 0, 0xff, 0xff, 0xff, 0xff,
+		0x02, 0, 5, 0, 0xe8, 0x03, 0, 0,
+		0x04, 0, 5, 0, 0xff, 0xff, 0xff, 0xff,
+		0x10, 0, 5, 0, 0xff, 0xff, 0xff, 0xff,
+		0x20, 0, 5, 0, 0xff, 0xff, 0xff, 0xff,
+	}
+	if err := xattr.Set(filepath.Join(leftDir, "shared"), xattr.ACLDefault, acl); err != nil {
+		t.Skipf("不支持 ACL: %v", err)
+	}
+
+	metadata := models.MetadataOptions{Owner: true, Special: true, Xattrs: true, ACL: true}
+	comparer := diff.NewComparerWithOptions(diff.Options{Scan: scanner.Options{HashAlgo: "sha256", Metadata: metadata}})
+	results, err := comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	for _, result := range NewSyncer(leftDir, rightDir, Options{Metadata: metadata}).Sync(results) {
+		if result.Error != nil {
+			t.Errorf("操作 %s %s 失败: %v", result.Operation.Type, result.Operation.Path, result.Error)
+		}
+	}
+
+	results, err = comparer.Compare(leftDir, rightDir)
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	for _, result := range results {
+		if result.Status != models.StatusUnchanged {
+			t.Errorf("%s 同步后应为 unchanged，实际是 %s %v", result.Path, result.Status, result.Differences)
+		}
+	}
+	info, err := os.Stat(filepath.Join(rightDir, "tool"))
+	if err != nil || info.Mode()&os.ModeSetuid == 0 {
+		t.Errorf("右侧 tool 应保留 setuid 位: %v", err)
+	}
+	if _, err := xattr.Get(filepath.Join(rightDir, "tool"), "user.stale"); !xattr.IsNotExist(err) {
+		t.Errorf("右侧多余的扩展属性应被删除: %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+// Package textdiff 按行对比两个文本并生成统一格式（diff -u）的差异
+//
+// 使用 Myers 的 O(ND) 差异算法的线性空间版本（每次寻找中间蛇形并递归），
+// 内存占用与行数成正比，与差异的多少无关。
+package textdiff
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// DefaultContext 默认的上下文行数（与 diff -u 一致）
+const DefaultContext = 3
+
+// DefaultMaxSize 默认的文件大小上限，超过的文件不生成差异
+const DefaultMaxSize = 1 << 20
+
+// sniffLen 判断是否是文本时检查的最大字节数（与 git 一致）
+const sniffLen = 8000
+
+// IsText 判断内容是否是文本：开头的 8000 个字节中没有 NUL 字节
+func IsText(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), sniffLen)], 0) < 0
+}
+
+// Options 生成文件差异的选项
+type Options struct {
+	Context int   // 每个区块前后的上下文行数
+	MaxSize int64 // 文件大小上限，任一侧超过时按二进制文件报告（0 表示 DefaultMaxSize）
+}
+
+// Files 生成从文件 oldPath 到 newPath 的统一格式差异，两者内容相同时返回空字符串
+//
+// 任一侧不是文本或超过大小上限时返回 "Binary files ... differ"（与 diff 一致，patch 会跳过该行）。
+func Files(oldName, newName, oldPath, newPath string, opts Options) (string, error) {
+	oldFile, err := os.Open(oldPath)
+	if err != nil {
+		return "", err
+	}
+	defer oldFile.Close()
+	newFile, err := os.Open(newPath)
+	if err != nil {
+		return "", err
+	}
+	defer newFile.Close()
+	return Readers(oldName, newName, oldFile, newFile, opts)
+}
+
+// Readers 与 Files 相同，但从 oldReader 和 newReader 读取两侧的内容（如远程文件），
+// 每侧最多读取大小上限加一个字节
+func Readers(oldName, newName string, oldReader, newReader io.Reader, opts Options) (string, error) {
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	a, aFits, err := readLimited(oldReader, maxSize)
+	if err != nil {
+		return "", err
+	}
+	b, bFits, err := readLimited(newReader, maxSize)
+	if err != nil {
+		return "", err
+	}
+	if !aFits || !bFits || !IsText(a) || !IsText(b) {
+		if aFits && bFits && bytes.Equal(a, b) {
+			return "", nil
+		}
+		return BinaryMessage(oldName, newName), nil
+	}
+	return Unified(oldName, newName, a, b, opts.Context), nil
+}
+
+// BinaryMessage 返回二进制文件不同时的提示行
+func BinaryMessage(oldName, newName string) string {
+	return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+}
+
+// readLimited 读取内容的前 limit 个字节，fits 表示内容没有超过 limit
+func readLimited(r io.Reader, limit int64) (data []byte, fits bool, err error) {
+	data, err = io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) > limit {
+		return data[:limit], false, nil
+	}
+	return data, true, nil
+}
+
+// Unified 生成从 a 到 b 的统一格式差异，两者相同时返回空字符串
+//
+// oldName 和 newName 为 --- 和 +++ 行中的文件名（如 a/path 和 b/path），
+// context 为每个区块前后的上下文行数。没有以换行结尾的最后一行后面
+// 跟随 "\ No newline at end of file"，与 diff -u 一致，可以直接用于 patch。
+func Unified(oldName, newName string, a, b []byte, context int) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	context = max(context, 0)
+	aLines, bLines := splitLines(a), splitLines(b)
+	ops := diffLines(aLines, bLines)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	for _, h := range hunks(ops, context) {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.aStart, h.aLen), hunkRange(h.bStart, h.bLen))
+		for _, o := range ops[h.first:h.last] {
+			var line string
+			if o.kind == opInsert {
+				line = bLines[o.b]
+			} else {
+				line = aLines[o.a]
+			}
+			sb.WriteByte(o.kind)
+			sb.WriteString(line)
+			if !strings.HasSuffix(line, "\n") {
+				sb.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// splitLines 按换行拆分内容，每行保留结尾的换行（最后一行可能没有）
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+	return lines
+}
+
+// 编辑操作的类型，即统一格式中每行的前缀
+const (
+	opEqual  = ' '
+	opDelete = '-'
+	opInsert = '+'
+)
+
+// op 一行的编辑操作：a 和 b 为该行在两侧的下标（删除时只有 a 有效，插入时只有 b 有效）
+type op struct {
+	kind byte
+	a, b int
+}
+
+// diffLines 返回把 a 变为 b 的编辑操作序列，每个修改块中删除的行在插入的行之前
+func diffLines(a, b []string) []op {
+	// 把每行映射为整数，之后只比较整数
+	ids := make(map[string]int)
+	intern := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	d := &differ{
+		a:       intern(a),
+		b:       intern(b),
+		deleted: make([]bool, len(a)),
+		added:   make([]bool, len(b)),
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	ops := make([]op, 0, max(len(a), len(b)))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			ops = append(ops, op{kind: opDelete, a: i, b: j})
+			i++
+		case j < len(b) && d.added[j]:
+			ops = append(ops, op{kind: opInsert, a: i, b: j})
+			j++
+		default:
+			ops = append(ops, op{kind: opEqual, a: i, b: j})
+			i++
+			j++
+		}
+	}
+	return ops
+}
+
+// differ 记录每行是否被删除或插入
+type differ struct {
+	a, b           []int
+	deleted, added []bool
+	vf, vb         []int // 寻找中间蛇形时正向和反向搜索的各对角线上到达的最远位置
+}
+
+// compare 对比 a[aLo:aHi] 和 b[bLo:bHi]，标记删除和插入的行
+func (d *differ) compare(aLo, aHi, bLo, bHi int) {
+	// 去掉相同的开头和结尾
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	switch {
+	case aLo == aHi:
+		for j := bLo; j < bHi; j++ {
+			d.added[j] = true
+		}
+	case bLo == bHi:
+		for i := aLo; i < aHi; i++ {
+			d.deleted[i] = true
+		}
+	default:
+		x, y, u, v := d.middleSnake(aLo, aHi, bLo, bHi)
+		if (x == 0 && y == 0 && u == aHi-aLo && v == bHi-bLo) || (u == 0 && v == 0) {
+			// 不应出现（两侧的开头和结尾都不同时最短编辑路径至少为 2），防止无限递归
+			for i := aLo; i < aHi; i++ {
+				d.deleted[i] = true
+			}
+			for j := bLo; j < bHi; j++ {
+				d.added[j] = true
+			}
+			return
+		}
+		d.compare(aLo, aLo+x, bLo, bLo+y)
+		d.compare(aLo+u, aHi, bLo+v, bHi)
+	}
+}
+
+// middleSnake 寻找 a[aLo:aHi] 到 b[bLo:bHi] 的最短编辑路径的中间蛇形
+//
+// 从两端同时搜索，正向和反向的路径在某条对角线上重叠时，重叠的蛇形把问题分成两个
+// 编辑距离约为一半的子问题。返回蛇形的起点 (x, y) 和终点 (u, v)（相对 aLo、bLo）。
+func (d *differ) middleSnake(aLo, aHi, bLo, bHi int) (x, y, u, v int) {
+	n, m := aHi-aLo, bHi-bLo
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	if size := 2*maxD + 3; len(d.vf) < size {
+		d.vf = make([]int, size)
+		d.vb = make([]int, size)
+	}
+	vf, vb := d.vf, d.vb
+	vf[offset+1] = 0
+	vb[offset+1] = 0
+
+	for step := 0; step <= maxD; step++ {
+		// 正向搜索：对角线 k 上的 x，y = x - k
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+			// 正向对角线 k 对应反向对角线 delta - k
+			if odd && k >= delta-(step-1) && k <= delta+(step-1) && x+vb[offset+delta-k] >= n {
+				return x0, y0, x, y
+			}
+		}
+		// 反向搜索：从两个序列的末尾开始，x、y 为距末尾的行数
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			x0, y0 := x, y
+			for x < n && y < m && d.a[aHi-1-x] == d.b[bHi-1-y] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+			if !odd && k >= delta-step && k <= delta+step && x+vf[offset+delta-k] >= n {
+				return n - x, m - y, n - x0, m - y0
+			}
+		}
+	}
+	// 不会到达：编辑距离不超过 n + m
+	return 0, 0, n, m
+}
+
+// hunk 统一格式中的一个区块，ops[first:last] 为其中的行
+type hunk struct {
+	first, last  int
+	aStart, aLen int // a 中的起始下标和行数
+	bStart, bLen int
+}
+
+// hunks 把编辑操作分组为区块：相距不超过 2*context 个相同行的修改合并到同一个区块（与 GNU diff 一致）
+func hunks(ops []op, context int) []hunk {
+	var result []hunk
+	for i := 0; i < len(ops); {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+		first := max(i-context, 0)
+		// 找到区块中最后一个修改之后的位置
+		last := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != opEqual {
+				last = j + 1
+				continue
+			}
+			// ops[last:j+1] 是最后一个修改之后连续的相同行，超过 2*context 行时区块结束
+			if gap := j + 1 - last; gap > 2*context {
+				break
+			}
+		}
+		end := min(last+context, len(ops))
+
+		h := hunk{first: first, last: end, aStart: ops[first].a, bStart: ops[first].b}
+		for _, o := range ops[first:end] {
+			if o.kind != opInsert {
+				h.aLen++
+			}
+			if o.kind != opDelete {
+				h.bLen++
+			}
+		}
+		result = append(result, h)
+		i = end
+	}
+	return result
+}
+
+// hunkRange 格式化区块头中的行范围：起始行号（从 1 开始）和行数，行数为 1 时省略，
+// 行数为 0 时起始行号为区块之前的一行
+func hunkRange(start, length int) string {
+	switch length {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, length)
+	}
+}
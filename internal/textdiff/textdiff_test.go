@@ -0,0 +1,287 @@
+package textdiff
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	a := "a\nb\nc\nd\ne\nf\ng\nh\n"
+	b := "a\nb\nC\nd\ne\nf\ng\nh\ni\n"
+	expected := `--- a/x.txt
++++ b/x.txt
+@@ -1,8 +1,9 @@
+ a
+ b
+-c
++C
+ d
+ e
+ f
+ g
+ h
++i
+`
+	if got := Unified("a/x.txt", "b/x.txt", []byte(a), []byte(b), 3); got != expected {
+		t.Errorf("差异错误:\n%s", got)
+	}
+
+	// 上下文为 1 时两处修改分为两个区块
+	expected = `--- a/x.txt
++++ b/x.txt
+@@ -2,3 +2,3 @@
+ b
+-c
++C
+ d
+@@ -8 +8,2 @@
+ h
++i
+`
+	if got := Unified("a/x.txt", "b/x.txt", []byte(a), []byte(b), 1); got != expected {
+		t.Errorf("上下文为 1 时差异错误:\n%s", got)
+	}
+
+	if got := Unified("a", "b", []byte(a), []byte(a), 3); got != "" {
+		t.Errorf("内容相同时应该返回空字符串: %q", got)
+	}
+}
+
+func TestUnifiedHunkGap(t *testing.T) {
+	// 两处修改之间恰好有 2*context 个相同行时合并为一个区块
+	a := "1\nx\nb\nc\ny\n2\n"
+	b := "1\nX\nb\nc\nY\n2\n"
+	expected := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+-x
++X
+ b
+ c
+-y
++Y
+ 2
+`
+	if got := Unified("a", "b", []byte(a), []byte(b), 1); got != expected {
+		t.Errorf("相距 2*context 行的修改应合并为一个区块:\n%s", got)
+	}
+
+	// 多一个相同行时分为两个区块
+	a = "1\nx\nb\nc\nd\ny\n2\n"
+	b = "1\nX\nb\nc\nd\nY\n2\n"
+	expected = `--- a
++++ b
+@@ -1,3 +1,3 @@
+ 1
+-x
++X
+ b
+@@ -5,3 +5,3 @@
+ d
+-y
++Y
+ 2
+`
+	if got := Unified("a", "b", []byte(a), []byte(b), 1); got != expected {
+		t.Errorf("相距 2*context+1 行的修改应分为两个区块:\n%s", got)
+	}
+}
+
+func TestUnifiedNoNewline(t *testing.T) {
+	expected := `--- a
++++ b
+@@ -1,2 +1,2 @@
+ x
+-y
+\ No newline at end of file
++y
+`
+	if got := Unified("a", "b", []byte("x\ny"), []byte("x\ny\n"), 3); got != expected {
+		t.Errorf("缺少结尾换行时差异错误:\n%s", got)
+	}
+
+	expected = `--- a
++++ b
+@@ -0,0 +1 @@
++new
+`
+	if got := Unified("a", "b", nil, []byte("new\n"), 3); got != expected {
+		t.Errorf("空文件的差异错误:\n%s", got)
+	}
+}
+
+// TestUnifiedApply 随机生成文本，检查应用差异后得到新文本且修改的行数最少
+func TestUnifiedApply(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 300; i++ {
+		a := randomLines(rng, rng.Intn(40))
+		b := mutate(rng, a)
+		patch := Unified("a", "b", []byte(strings.Join(a, "")), []byte(strings.Join(b, "")), rng.Intn(4))
+		got, changed, err := apply(a, patch)
+		if err != nil {
+			t.Fatalf("第 %d 组无法应用差异: %v\n%s", i, err, patch)
+		}
+		if strings.Join(got, "") != strings.Join(b, "") {
+			t.Fatalf("第 %d 组应用差异后内容不一致\n%s", i, patch)
+		}
+		if lcs := lcsLen(a, b); changed != len(a)+len(b)-2*lcs {
+			t.Fatalf("第 %d 组修改了 %d 行，最少为 %d 行", i, changed, len(a)+len(b)-2*lcs)
+		}
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("无法创建测试文件: %v", err)
+		}
+		return path
+	}
+	oldText := write("old.txt", "hello\nworld\n")
+	newText := write("new.txt", "hello\nthere\n")
+	binary := write("data.bin", "hello\x00world\n")
+
+	patch, err := Files("a/f", "b/f", oldText, newText, Options{Context: DefaultContext})
+	if err != nil || !strings.Contains(patch, "-world\n+there\n") {
+		t.Errorf("文本文件的差异错误: %q, %v", patch, err)
+	}
+
+	patch, err = Files("a/f", "b/f", oldText, binary, Options{Context: DefaultContext})
+	if err != nil || patch != "Binary files a/f and b/f differ\n" {
+		t.Errorf("二进制文件应该只报告不同: %q, %v", patch, err)
+	}
+
+	// 超过大小上限时按二进制文件报告
+	patch, err = Files("a/f", "b/f", oldText, newText, Options{Context: DefaultContext, MaxSize: 8})
+	if err != nil || patch != BinaryMessage("a/f", "b/f") {
+		t.Errorf("超过大小上限的文件应该只报告不同: %q, %v", patch, err)
+	}
+
+	if _, err := Files("a/f", "b/f", oldText, filepath.Join(dir, "missing"), Options{}); err == nil {
+		t.Error("文件不存在时应该返回错误")
+	}
+}
+
+func TestIsText(t *testing.T) {
+	if !IsText([]byte("普通文本\n")) || !IsText(nil) {
+		t.Error("文本应该被识别为文本")
+	}
+	if IsText([]byte("a\x00b")) {
+		t.Error("含有 NUL 字节的内容不是文本")
+	}
+	if !IsText(append([]byte(strings.Repeat("a", sniffLen)), 0)) {
+		t.Error("只检查开头的 8000 个字节")
+	}
+}
+
+// randomLines 生成 n 行取自小字母表的文本，便于产生重复的行
+func randomLines(rng *rand.Rand, n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = strconv.Itoa(rng.Intn(6)) + "\n"
+	}
+	if n > 0 && rng.Intn(4) == 0 {
+		lines[n-1] = strings.TrimSuffix(lines[n-1], "\n")
+	}
+	return lines
+}
+
+// mutate 随机删除、插入和替换若干行
+func mutate(rng *rand.Rand, lines []string) []string {
+	out := append([]string(nil), lines...)
+	for n := rng.Intn(6); n > 0; n-- {
+		i := rng.Intn(len(out) + 1)
+		switch rng.Intn(3) {
+		case 0:
+			if i < len(out) {
+				out = append(out[:i], out[i+1:]...)
+			}
+		case 1:
+			out = append(out[:i], append([]string{strconv.Itoa(rng.Intn(6)) + "\n"}, out[i:]...)...)
+		default:
+			if i < len(out) {
+				out[i] = strconv.Itoa(rng.Intn(6)) + "\n"
+			}
+		}
+	}
+	// 只有最后一行可以没有换行
+	for i := 0; i < len(out)-1; i++ {
+		if !strings.HasSuffix(out[i], "\n") {
+			out[i] += "\n"
+		}
+	}
+	return out
+}
+
+// apply 把统一格式的差异应用到 lines，返回结果和增删的行数
+func apply(lines []string, patch string) ([]string, int, error) {
+	var out []string
+	changed, pos := 0, 0
+	rows := strings.SplitAfter(patch, "\n")
+	for i := 2; i < len(rows) && rows[i] != ""; i++ {
+		row := rows[i]
+		if strings.HasPrefix(row, "@@") {
+			var aStart int
+			if _, err := fmt.Sscanf(row, "@@ -%d", &aStart); err != nil {
+				return nil, 0, err
+			}
+			// 行数为 0 时起始行号指向区块之前的一行
+			if !strings.HasPrefix(row, fmt.Sprintf("@@ -%d,0 ", aStart)) {
+				aStart--
+			}
+			for pos < aStart {
+				out = append(out, lines[pos])
+				pos++
+			}
+			continue
+		}
+		line := row[1:]
+		if i+1 < len(rows) && rows[i+1] == "\\ No newline at end of file\n" {
+			line = strings.TrimSuffix(line, "\n")
+			i++
+		}
+		switch row[0] {
+		case ' ', '-':
+			if pos >= len(lines) || lines[pos] != line {
+				return nil, 0, fmt.Errorf("第 %d 行不匹配: %q", pos+1, line)
+			}
+			pos++
+			if row[0] == ' ' {
+				out = append(out, line)
+			} else {
+				changed++
+			}
+		case '+':
+			out = append(out, line)
+			changed++
+		default:
+			return nil, 0, fmt.Errorf("无效的行: %q", row)
+		}
+	}
+	return append(out, lines[pos:]...), changed, nil
+}
+
+// lcsLen 用动态规划计算最长公共子序列的长度
+func lcsLen(a, b []string) int {
+	prev := make([]int, len(b)+1)
+	for i := range a {
+		cur := make([]int, len(b)+1)
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(cur[j], prev[j+1])
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
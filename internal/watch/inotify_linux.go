@@ -0,0 +1,197 @@
+//go:build linux
+
+package watch
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"file_syn/internal/scanner"
+)
+
+// inotifyMask 监测的事件：条目的创建、删除、移动、内容和属性变化，以及被监测目录本身的删除和移动
+const inotifyMask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// inotify 使用 inotify 监测目录树中的每个目录
+type inotify struct {
+	root   string
+	fd     int      // inotify 实例的文件描述符（添加和移除监测）
+	file   *os.File // 以 fd 创建的文件（非阻塞，读取由运行时的网络轮询器等待，关闭时读取立即返回）
+	events chan Event
+	done   chan struct{} // Close 时关闭，停止发送事件
+	once   sync.Once
+	err    error // 读取事件失败的原因，events 关闭后才能读取
+
+	mu      sync.Mutex
+	watches map[int32][]string // 监测描述符对应的目录（同一个目录可能经由符号链接出现在多个路径下）
+	dirs    map[string]int32   // 目录对应的监测描述符
+}
+
+// newNotifier 创建监测 root 目录树的 inotify 实例，需要通过 Sync 添加监测的目录
+func newNotifier(root string) (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("无法创建 inotify 实例: %v", err)
+	}
+	n := &inotify{
+		root:    root,
+		fd:      fd,
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		events:  make(chan Event, 1024),
+		done:    make(chan struct{}),
+		watches: make(map[int32][]string),
+		dirs:    make(map[string]int32),
+	}
+	go n.read()
+	return n, nil
+}
+
+// Events 返回事件通道
+func (n *inotify) Events() <-chan Event {
+	return n.events
+}
+
+// Err 返回监测停止的原因
+func (n *inotify) Err() error {
+	return n.err
+}
+
+// Close 停止监测，正在等待的读取立即返回
+func (n *inotify) Close() error {
+	var err error
+	n.once.Do(func() {
+		close(n.done)
+		err = n.file.Close()
+	})
+	return err
+}
+
+// read 读取并解析 inotify 事件，直到实例被关闭或读取失败
+func (n *inotify) read() {
+	defer close(n.events)
+	buf := make([]byte, 64*1024)
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.err = fmt.Errorf("读取 inotify 事件失败: %v", err)
+			}
+			return
+		}
+		// 每个事件为 struct inotify_event（wd、mask、cookie、len）加上 len 字节以 NUL 填充的名称
+		for data := buf[:size]; len(data) >= syscall.SizeofInotifyEvent; {
+			wd := int32(binary.NativeEndian.Uint32(data[0:]))
+			mask := binary.NativeEndian.Uint32(data[4:])
+			nameLen := int(binary.NativeEndian.Uint32(data[12:]))
+			end := min(syscall.SizeofInotifyEvent+nameLen, len(data))
+			name := strings.TrimRight(string(data[syscall.SizeofInotifyEvent:end]), "\x00")
+			data = data[end:]
+			for _, event := range n.translate(wd, mask, name) {
+				select {
+				case n.events <- event:
+				case <-n.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+// translate 将 inotify 事件转换为发生变化的相对路径
+func (n *inotify) translate(wd int32, mask uint32, name string) []Event {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		return []Event{{Overflow: true}}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	dirs := n.watches[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		// 目录已被删除或停止监测，内核自动移除了监测
+		for _, dir := range dirs {
+			if n.dirs[dir] == wd {
+				delete(n.dirs, dir)
+			}
+		}
+		delete(n.watches, wd)
+		return nil
+	}
+
+	var events []Event
+	for _, dir := range dirs {
+		switch {
+		case name != "":
+			events = append(events, Event{Path: joinPath(dir, name)})
+		case mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0:
+			// 目录本身的其他变化由上级目录的监测报告，根目录没有上级目录
+			events = append(events, Event{Path: dir})
+		}
+	}
+	return events
+}
+
+// Sync 使 prefixes 下监测的目录与 dirs 一致，返回新开始监测的目录
+//
+// 添加监测时目录已经不存在视为正常（对应的事件会在之后到达），
+// 其他错误（如超过 fs.inotify.max_user_watches 的限制）返回错误。
+func (n *inotify) Sync(prefixes map[string]bool, dirs []string) ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	want := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		want[dir] = true
+	}
+	for dir, wd := range n.dirs {
+		if !want[dir] && scanner.WithinAny(dir, prefixes) {
+			n.unwatch(dir, wd)
+		}
+	}
+
+	var added []string
+	for _, dir := range dirs {
+		if _, ok := n.dirs[dir]; ok {
+			continue
+		}
+		path := filepath.Join(n.root, filepath.FromSlash(dir))
+		wd, err := syscall.InotifyAddWatch(n.fd, path, inotifyMask)
+		if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+			continue
+		}
+		if err != nil {
+			return added, fmt.Errorf("无法监测目录 %s: %v", path, err)
+		}
+		n.dirs[dir] = int32(wd)
+		if !slices.Contains(n.watches[int32(wd)], dir) {
+			n.watches[int32(wd)] = append(n.watches[int32(wd)], dir)
+		}
+		added = append(added, dir)
+	}
+	return added, nil
+}
+
+// unwatch 停止以路径 dir 监测目录，目录不再以任何路径监测时移除监测
+func (n *inotify) unwatch(dir string, wd int32) {
+	delete(n.dirs, dir)
+	n.watches[wd] = slices.DeleteFunc(n.watches[wd], func(d string) bool { return d == dir })
+	if len(n.watches[wd]) == 0 {
+		delete(n.watches, wd)
+		syscall.InotifyRmWatch(n.fd, uint32(wd))
+	}
+}
+
+// joinPath 拼接相对路径，dir 为空字符串表示根目录
+func joinPath(dir, name string) string {
+	if dir == "" {
+		return name
+	}
+	return dir + "/" + name
+}
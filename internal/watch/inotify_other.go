@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// newNotifier 其他平台不支持 inotify，监测时退化为轮询
+func newNotifier(root string) (notifier, error) {
+	return nil, errors.New("当前平台不支持 inotify")
+}
@@ -0,0 +1,20 @@
+package watch
+
+// Event 目录树中发生的变化
+type Event struct {
+	Path     string // 发生变化的条目（相对根目录的路径，空字符串表示根目录）
+	Overflow bool   // 事件队列溢出，丢失了部分事件，需要重新扫描整个目录树
+}
+
+// notifier 目录树的变化事件来源（Linux 上为 inotify）
+type notifier interface {
+	// Events 返回事件通道，通道关闭表示监测已经停止，原因见 Err
+	Events() <-chan Event
+	// Err 返回监测停止的原因（正常关闭时为 nil）
+	Err() error
+	// Sync 使 prefixes 下监测的目录与 dirs 一致：不在 dirs 中的目录停止监测，
+	// 返回新开始监测的目录（相对路径，空字符串表示根目录）
+	Sync(prefixes map[string]bool, dirs []string) ([]string, error)
+	// Close 停止监测
+	Close() error
+}
@@ -0,0 +1,322 @@
+// Package watch 持续监测两侧目录的变化并增量更新对比结果
+//
+// Linux 上使用 inotify 监测两侧目录树中的每个目录，只重新扫描发生变化的路径；
+// 其他平台、inotify 不可用或监测的目录数超过系统限制时，退化为定期重新扫描整个目录。
+// 连续到达的事件（如编辑器保存、复制大量文件）经过去抖动后合并为一次重新扫描。
+// inotify 事件队列溢出时丢失了部分事件，重新扫描溢出的一侧整个目录。
+package watch
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"time"
+
+	"file_syn/internal/diff"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+// 默认的去抖动时间和轮询间隔
+const (
+	DefaultDebounce = 200 * time.Millisecond
+	DefaultInterval = 2 * time.Second
+)
+
+// maxDelayFactor 持续有事件到达时，第一个事件之后最多延迟 Debounce 的多少倍重新扫描
+const maxDelayFactor = 10
+
+// 监测方式，见 Watcher.Mode
+const (
+	ModeInotify = "inotify"
+	ModePoll    = "poll"
+)
+
+// Options 监测选项
+type Options struct {
+	Debounce time.Duration // 最后一个事件之后等待多久重新扫描（<= 0 时使用 DefaultDebounce）
+	Interval time.Duration // 轮询时重新扫描的间隔（<= 0 时使用 DefaultInterval）
+	Poll     bool          // 不使用 inotify，总是轮询
+
+	IgnoreFile string      // 目录级忽略文件名，文件变化时重新扫描所在的目录（为空时不特殊处理）
+	Warn       func(error) // 报告不影响继续监测的问题，如事件队列溢出、退化为轮询（为 nil 时忽略）
+}
+
+// Update 一次重新扫描的结果
+type Update struct {
+	Time          time.Time
+	Changed       []*models.DiffResult // 状态或差异发生变化的结果，按路径排序
+	Errors        []*models.ScanError  // 当前两侧的扫描错误
+	ErrorsChanged bool                 // 扫描错误是否发生了变化
+}
+
+// Watcher 监测两侧目录并增量更新对比视图
+type Watcher struct {
+	view      *diff.View
+	options   Options
+	notifiers map[string]notifier        // 使用 inotify 监测的一侧
+	polling   map[string]bool            // 轮询的一侧
+	dirty     map[string]map[string]bool // 每侧等待重新扫描的路径
+
+	ticker  *time.Ticker // 轮询的定时器（没有轮询的一侧时为 nil）
+	timer   *time.Timer  // 去抖动的定时器
+	pending bool         // timer 是否在等待
+	first   time.Time    // 本轮第一个事件到达的时间
+}
+
+// New 为视图中实时扫描的一侧开始监测，清单文件一侧不会变化，不需要监测
+//
+// 无法使用 inotify 时通过 Options.Warn 报告原因并改为轮询。
+// 需要调用 Run 处理事件，Run 返回时停止监测。
+func New(view *diff.View, options Options) *Watcher {
+	if options.Debounce <= 0 {
+		options.Debounce = DefaultDebounce
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+	w := &Watcher{
+		view:      view,
+		options:   options,
+		notifiers: make(map[string]notifier),
+		polling:   make(map[string]bool),
+		dirty:     map[string]map[string]bool{models.SideLeft: {}, models.SideRight: {}},
+		timer:     time.NewTimer(time.Hour),
+	}
+	w.timer.Stop()
+
+	for _, side := range []string{models.SideLeft, models.SideRight} {
+		if !view.Live(side) {
+			continue
+		}
+		if options.Poll {
+			w.startPolling(side)
+			continue
+		}
+		n, err := newNotifier(view.Path(side))
+		if err == nil {
+			_, err = n.Sync(map[string]bool{"": true}, w.dirs(side, map[string]bool{"": true}))
+		}
+		if err != nil {
+			if n != nil {
+				n.Close()
+			}
+			w.warn(fmt.Errorf("%s: %v，改为每隔 %v 重新扫描", view.Path(side), err, options.Interval))
+			w.startPolling(side)
+			continue
+		}
+		w.notifiers[side] = n
+	}
+	return w
+}
+
+// Mode 返回一侧的监测方式：ModeInotify、ModePoll，不需要监测（清单文件）时为空字符串
+func (w *Watcher) Mode(side string) string {
+	switch {
+	case w.notifiers[side] != nil:
+		return ModeInotify
+	case w.polling[side]:
+		return ModePoll
+	}
+	return ""
+}
+
+// Run 处理目录的变化，每次重新扫描后结果或扫描错误发生变化时调用 handle，直到 ctx 被取消
+//
+// handle 与重新扫描在同一个协程中调用。返回时停止监测。
+func (w *Watcher) Run(ctx context.Context, handle func(*Update)) {
+	defer w.close()
+	for {
+		var tick <-chan time.Time
+		if w.ticker != nil {
+			tick = w.ticker.C
+		}
+		left, right := w.events(models.SideLeft), w.events(models.SideRight)
+
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-left:
+			w.receive(models.SideLeft, event, ok)
+		case event, ok := <-right:
+			w.receive(models.SideRight, event, ok)
+		case <-w.timer.C:
+			w.pending = false
+			w.flush(ctx, handle)
+		case <-tick:
+			for side := range w.polling {
+				w.dirty[side][""] = true
+			}
+			w.flush(ctx, handle)
+		}
+	}
+}
+
+// events 返回一侧的事件通道，没有使用 inotify 时为 nil
+func (w *Watcher) events(side string) <-chan Event {
+	if n := w.notifiers[side]; n != nil {
+		return n.Events()
+	}
+	return nil
+}
+
+// receive 记录一侧的事件，事件通道关闭（监测意外停止）时改为轮询
+func (w *Watcher) receive(side string, event Event, ok bool) {
+	switch {
+	case !ok:
+		w.fallback(side, w.notifiers[side].Err())
+		return
+	case event.Overflow:
+		// 溢出事件不属于任何监测描述符，无法知道丢失的事件来自哪些目录
+		w.warn(fmt.Errorf("%s: inotify 事件队列溢出，重新扫描整个目录（目录树很大时耗时较长，可以调大 fs.inotify.max_queued_events）", w.view.Path(side)))
+		w.dirty[side][""] = true
+	case w.options.IgnoreFile != "" && path.Base(event.Path) == w.options.IgnoreFile:
+		// 排除规则变化，所在目录下的条目都可能受影响
+		dir := path.Dir(event.Path)
+		if dir == "." {
+			dir = ""
+		}
+		w.dirty[side][dir] = true
+	default:
+		w.dirty[side][event.Path] = true
+	}
+	w.schedule()
+}
+
+// schedule 在最后一个事件之后等待 Debounce 重新扫描，但距第一个事件不超过 maxDelayFactor 倍的 Debounce
+func (w *Watcher) schedule() {
+	now := time.Now()
+	if !w.pending {
+		w.pending = true
+		w.first = now
+	}
+	delay := min(w.options.Debounce, w.first.Add(maxDelayFactor*w.options.Debounce).Sub(now))
+	w.timer.Reset(max(delay, 0))
+}
+
+// flush 重新扫描等待中的路径，结果或扫描错误发生变化时调用 handle
+func (w *Watcher) flush(ctx context.Context, handle func(*Update)) {
+	left, right := minimalPaths(w.dirty[models.SideLeft]), minimalPaths(w.dirty[models.SideRight])
+	clear(w.dirty[models.SideLeft])
+	clear(w.dirty[models.SideRight])
+	if len(left) == 0 && len(right) == 0 {
+		return
+	}
+
+	previousErrors := fmt.Sprint(w.view.Errors())
+	changed, err := w.view.Rescan(ctx, left, right)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.warn(err)
+		}
+		return
+	}
+	w.watchNew(models.SideLeft, left)
+	w.watchNew(models.SideRight, right)
+
+	errors := w.view.Errors()
+	errorsChanged := fmt.Sprint(errors) != previousErrors
+	if len(changed) == 0 && !errorsChanged {
+		return
+	}
+	handle(&Update{
+		Time:          time.Now(),
+		Changed:       changed,
+		Errors:        errors,
+		ErrorsChanged: errorsChanged,
+	})
+}
+
+// watchNew 更新重新扫描过的路径下监测的目录
+//
+// 新出现的目录在开始监测之前可能已经发生了变化，开始监测后需要再重新扫描一次。
+func (w *Watcher) watchNew(side string, paths []string) {
+	n := w.notifiers[side]
+	if n == nil || len(paths) == 0 {
+		return
+	}
+	prefixes := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		prefixes[p] = true
+	}
+	added, err := n.Sync(prefixes, w.dirs(side, prefixes))
+	if err != nil {
+		w.fallback(side, err)
+		return
+	}
+	for _, dir := range added {
+		w.dirty[side][dir] = true
+	}
+	if len(added) > 0 {
+		w.schedule()
+	}
+}
+
+// dirs 返回一侧 prefixes 下当前扫描到的目录（包括根目录）
+func (w *Watcher) dirs(side string, prefixes map[string]bool) []string {
+	var dirs []string
+	if prefixes[""] {
+		dirs = append(dirs, "")
+	}
+	for p, file := range w.view.Files(side) {
+		if file.IsDir && scanner.WithinAny(p, prefixes) {
+			dirs = append(dirs, p)
+		}
+	}
+	return dirs
+}
+
+// fallback inotify 无法继续使用时改为轮询，期间可能丢失了事件，重新扫描整个目录
+func (w *Watcher) fallback(side string, err error) {
+	if n := w.notifiers[side]; n != nil {
+		n.Close()
+		delete(w.notifiers, side)
+	}
+	if err == nil {
+		err = fmt.Errorf("inotify 监测意外停止")
+	}
+	w.warn(fmt.Errorf("%s: %v，改为每隔 %v 重新扫描", w.view.Path(side), err, w.options.Interval))
+	w.startPolling(side)
+	w.dirty[side][""] = true
+	w.schedule()
+}
+
+// startPolling 开始定期重新扫描一侧的整个目录
+func (w *Watcher) startPolling(side string) {
+	w.polling[side] = true
+	if w.ticker == nil {
+		w.ticker = time.NewTicker(w.options.Interval)
+	}
+}
+
+// close 停止监测
+func (w *Watcher) close() {
+	for _, n := range w.notifiers {
+		n.Close()
+	}
+	if w.ticker != nil {
+		w.ticker.Stop()
+	}
+	w.timer.Stop()
+}
+
+// warn 报告不影响继续监测的问题
+func (w *Watcher) warn(err error) {
+	if w.options.Warn != nil {
+		w.options.Warn(err)
+	}
+}
+
+// minimalPaths 返回排序后的路径，去掉已被其上级目录包含的路径
+func minimalPaths(paths map[string]bool) []string {
+	var result []string
+	for _, p := range slices.SortedFunc(maps.Keys(paths), scanner.ComparePaths) {
+		if n := len(result); n > 0 && scanner.Within(p, result[n-1]) {
+			continue
+		}
+		result = append(result, p)
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"file_syn/internal/diff"
+	"file_syn/internal/scanner"
+	"file_syn/pkg/models"
+)
+
+func TestMinimalPaths(t *testing.T) {
+	got := minimalPaths(map[string]bool{"a/b": true, "a": true, "a-b": true, "c/d/e": true, "c/d": true, "c/e": true})
+	want := []string{"a", "a-b", "c/d", "c/e"}
+	if !slices.Equal(got, want) {
+		t.Errorf("期望 %v，实际 %v", want, got)
+	}
+	if got := minimalPaths(map[string]bool{"a": true, "": true}); !slices.Equal(got, []string{""}) {
+		t.Errorf("包含根目录时只应保留根目录，实际 %v", got)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		leftDir := t.TempDir()
+		rightDir := t.TempDir()
+		write := func(name, content string) {
+			path := filepath.Join(rightDir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("无法创建目录: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatalf("无法创建文件: %v", err)
+			}
+		}
+		write("keep.txt", "keep")
+		write("debug.log", "log")
+
+		comparer := diff.NewComparerWithOptions(diff.Options{Scan: scanner.Options{IgnoreFile: ".filesynignore"}})
+		view, err := comparer.NewView(context.Background(), leftDir, rightDir)
+		if err != nil {
+			t.Fatalf("对比失败: %v", err)
+		}
+		w := New(view, Options{
+			Debounce:   20 * time.Millisecond,
+			Interval:   50 * time.Millisecond,
+			Poll:       poll,
+			IgnoreFile: ".filesynignore",
+			Warn:       func(err error) { t.Logf("警告: %v", err) },
+		})
+		wantMode := ModePoll
+		if !poll && runtime.GOOS == "linux" {
+			wantMode = ModeInotify
+		}
+		if mode := w.Mode(models.SideRight); mode != wantMode {
+			t.Errorf("期望监测方式 %s，实际 %s", wantMode, mode)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		updates := make(chan *Update, 100)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			w.Run(ctx, func(update *Update) { updates <- update })
+		}()
+
+		// 新增的文件、新目录中的文件（需要先开始监测新目录）
+		write("new.txt", "new")
+		waitFor(t, updates, "new.txt", models.StatusAdded)
+		write("dir/a.txt", "a")
+		waitFor(t, updates, "dir/a.txt", models.StatusAdded)
+		write("dir/b.txt", "b")
+		waitFor(t, updates, "dir/b.txt", models.StatusAdded)
+
+		// 忽略文件变化后重新扫描所在目录：被排除的文件不再出现在结果中
+		write(".filesynignore", "*.log\n")
+		waitFor(t, updates, ".filesynignore", models.StatusAdded)
+		for _, result := range view.Results() {
+			if result.Path == "debug.log" {
+				t.Errorf("[poll=%v] 忽略文件变化后 debug.log 应被排除", poll)
+			}
+		}
+
+		cancel()
+		<-done
+	}
+}
+
+// waitFor 等待 path 的状态变为 status
+func waitFor(t *testing.T, updates <-chan *Update, path, status string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update := <-updates:
+			for _, result := range update.Changed {
+				if result.Path == path && result.Status == status {
+					return
+				}
+			}
+		case <-timeout:
+			t.Fatalf("等待 %s 变为 %s 超时", path, status)
+		}
+	}
+}
+
+func TestReceive(t *testing.T) {
+	comparer := diff.NewComparer()
+	view, err := comparer.NewView(context.Background(), t.TempDir(), t.TempDir())
+	if err != nil {
+		t.Fatalf("对比失败: %v", err)
+	}
+	var warnings []error
+	w := New(view, Options{Poll: true, IgnoreFile: ".filesynignore", Warn: func(err error) { warnings = append(warnings, err) }})
+	defer w.close()
+
+	w.receive(models.SideLeft, Event{Path: "a/b.txt"}, true)
+	w.receive(models.SideLeft, Event{Path: "a/c/.filesynignore"}, true)
+	w.receive(models.SideRight, Event{Overflow: true}, true)
+	w.receive(models.SideRight, Event{Path: "x"}, true)
+	if got := minimalPaths(w.dirty[models.SideLeft]); !slices.Equal(got, []string{"a/b.txt", "a/c"}) {
+		t.Errorf("忽略文件变化应重新扫描所在目录，实际 %v", got)
+	}
+	if got := minimalPaths(w.dirty[models.SideRight]); !slices.Equal(got, []string{""}) {
+		t.Errorf("事件队列溢出应重新扫描整个目录，实际 %v", got)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("事件队列溢出应报告 1 个警告，实际 %v", warnings)
+	}
+}
@@ -0,0 +1,96 @@
+// Package xattr 读写文件的扩展属性和以扩展属性保存的 POSIX ACL（仅 Linux）
+package xattr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnsupported 当前平台不支持扩展属性
+var ErrUnsupported = errors.New("当前平台不支持扩展属性")
+
+// 保存 POSIX ACL 的扩展属性
+const (
+	ACLAccess  = "system.posix_acl_access"  // 访问 ACL
+	ACLDefault = "system.posix_acl_default" // 目录的默认 ACL（新建子项继承）
+)
+
+// POSIX ACL 在扩展属性中的存储格式（与内核的 posix_acl_xattr 一致）
+const (
+	aclVersion     = 2
+	aclUndefinedID = 0xffffffff
+
+	aclUserObj  = 0x01
+	aclUser     = 0x02
+	aclGroupObj = 0x04
+	aclGroup    = 0x08
+	aclMask     = 0x10
+	aclOther    = 0x20
+)
+
+// IsACL 判断扩展属性是否用于保存 POSIX ACL
+func IsACL(name string) bool {
+	return name == ACLAccess || name == ACLDefault
+}
+
+// ACLNames 返回保存 POSIX ACL 的扩展属性名称，目录还有默认 ACL
+func ACLNames(isDir bool) []string {
+	if isDir {
+		return []string{ACLAccess, ACLDefault}
+	}
+	return []string{ACLAccess}
+}
+
+// FormatACL 将扩展属性中的 POSIX ACL 转换为文本形式，如 user::rw-,user:1000:r--,group::r--,mask::r--,other::---
+func FormatACL(data []byte) (string, error) {
+	if len(data) < 4 || (len(data)-4)%8 != 0 {
+		return "", fmt.Errorf("无效的 ACL 长度: %d", len(data))
+	}
+	if version := binary.LittleEndian.Uint32(data); version != aclVersion {
+		return "", fmt.Errorf("不支持的 ACL 版本: %d", version)
+	}
+
+	var entries []string
+	for off := 4; off < len(data); off += 8 {
+		tag := binary.LittleEndian.Uint16(data[off:])
+		perm := binary.LittleEndian.Uint16(data[off+2:])
+		id := binary.LittleEndian.Uint32(data[off+4:])
+
+		var name string
+		switch tag {
+		case aclUserObj, aclUser:
+			name = "user"
+		case aclGroupObj, aclGroup:
+			name = "group"
+		case aclMask:
+			name = "mask"
+		case aclOther:
+			name = "other"
+		default:
+			return "", fmt.Errorf("未知的 ACL 条目类型: %#x", tag)
+		}
+		var qualifier string
+		if (tag == aclUser || tag == aclGroup) && id != aclUndefinedID {
+			qualifier = fmt.Sprint(id)
+		}
+		entries = append(entries, name+":"+qualifier+":"+formatPerm(perm))
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// formatPerm 将 ACL 条目的权限转换为 rwx 形式
+func formatPerm(perm uint16) string {
+	b := []byte("---")
+	if perm&4 != 0 {
+		b[0] = 'r'
+	}
+	if perm&2 != 0 {
+		b[1] = 'w'
+	}
+	if perm&1 != 0 {
+		b[2] = 'x'
+	}
+	return string(b)
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package xattr
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// List 列出文件的扩展属性名称（跟随符号链接），文件系统不支持扩展属性时返回空列表
+func List(path string) ([]string, error) {
+	var buf []byte
+	for {
+		size, err := syscall.Listxattr(path, nil)
+		if errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		buf = make([]byte, size)
+		size, err = syscall.Listxattr(path, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			// 两次调用之间增加了扩展属性
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "listxattr", Path: path, Err: err}
+		}
+		buf = buf[:size]
+		break
+	}
+
+	var names []string
+	for _, name := range strings.Split(string(buf), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// Get 读取文件的扩展属性（跟随符号链接），属性不存在时返回的错误满足 errors.Is(err, syscall.ENODATA)
+func Get(path, name string) ([]byte, error) {
+	for {
+		size, err := syscall.Getxattr(path, name, nil)
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+		}
+		buf := make([]byte, size)
+		size, err = syscall.Getxattr(path, name, buf)
+		if errors.Is(err, syscall.ERANGE) {
+			continue
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr " + name, Path: path, Err: err}
+		}
+		return buf[:size], nil
+	}
+}
+
+// Set 设置文件的扩展属性（跟随符号链接）
+func Set(path, name string, value []byte) error {
+	if err := syscall.Setxattr(path, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr " + name, Path: path, Err: err}
+	}
+	return nil
+}
+
+// Remove 删除文件的扩展属性（跟随符号链接），属性不存在时不返回错误
+func Remove(path, name string) error {
+	err := syscall.Removexattr(path, name)
+	if err != nil && !errors.Is(err, syscall.ENODATA) {
+		return &os.PathError{Op: "removexattr " + name, Path: path, Err: err}
+	}
+	return nil
+}
+
+// IsNotExist 判断错误是否表示扩展属性不存在（或文件系统不支持 ACL）
+func IsNotExist(err error) bool {
+	return errors.Is(err, syscall.ENODATA) || errors.Is(err, syscall.ENOTSUP)
+}
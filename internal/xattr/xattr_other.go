@@ -0,0 +1,28 @@
+//go:build !linux
+
+package xattr
+
+// List 当前平台不支持扩展属性
+func List(path string) ([]string, error) {
+	return nil, ErrUnsupported
+}
+
+// Get 当前平台不支持扩展属性
+func Get(path, name string) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+// Set 当前平台不支持扩展属性
+func Set(path, name string, value []byte) error {
+	return ErrUnsupported
+}
+
+// Remove 当前平台不支持扩展属性
+func Remove(path, name string) error {
+	return ErrUnsupported
+}
+
+// IsNotExist 判断错误是否表示扩展属性不存在
+func IsNotExist(err error) bool {
+	return false
+}
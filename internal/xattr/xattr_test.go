@@ -0,0 +1,85 @@
+package xattr
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// aclEntry 测试用的 ACL 条目
+type aclEntry struct {
+	tag  uint16
+	perm uint16
+	id   uint32
+}
+
+// encodeACL 按内核的扩展属性格式编码 ACL
+func encodeACL(entries ...aclEntry) []byte {
+	data := binary.LittleEndian.AppendUint32(nil, aclVersion)
+	for _, e := range entries {
+		data = binary.LittleEndian.AppendUint16(data, e.tag)
+		data = binary.LittleEndian.AppendUint16(data, e.perm)
+		data = binary.LittleEndian.AppendUint32(data, e.id)
+	}
+	return data
+}
+
+func TestFormatACL(t *testing.T) {
+	data := encodeACL(
+		aclEntry{aclUserObj, 6, aclUndefinedID},
+		aclEntry{aclUser, 4, 1000},
+		aclEntry{aclGroupObj, 4, aclUndefinedID},
+		aclEntry{aclGroup, 7, 50},
+		aclEntry{aclMask, 7, aclUndefinedID},
+		aclEntry{aclOther, 0, aclUndefinedID},
+	)
+	got, err := FormatACL(data)
+	if err != nil {
+		t.Fatalf("解析 ACL 失败: %v", err)
+	}
+	want := "user::rw-,user:1000:r--,group::r--,group:50:rwx,mask::rwx,other::---"
+	if got != want {
+		t.Errorf("期望 %s，实际 %s", want, got)
+	}
+
+	for _, invalid := range [][]byte{nil, data[:7], append([]byte{1, 0, 0, 0}, data[4:]...)} {
+		if _, err := FormatACL(invalid); err == nil {
+			t.Errorf("无效的 ACL %x 应返回错误", invalid)
+		}
+	}
+}
+
+func TestXattrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+		t.Fatalf("无法创建文件: %v", err)
+	}
+	if err := Set(path, "user.test", []byte("value")); err != nil {
+		if errors.Is(err, ErrUnsupported) || IsNotExist(err) {
+			t.Skipf("不支持扩展属性: %v", err)
+		}
+		t.Fatalf("设置扩展属性失败: %v", err)
+	}
+
+	names, err := List(path)
+	if err != nil || !slices.Contains(names, "user.test") {
+		t.Errorf("期望列出 user.test，实际 %v (%v)", names, err)
+	}
+	if value, err := Get(path, "user.test"); err != nil || string(value) != "value" {
+		t.Errorf("期望值为 value，实际 %q (%v)", value, err)
+	}
+
+	if err := Remove(path, "user.test"); err != nil {
+		t.Fatalf("删除扩展属性失败: %v", err)
+	}
+	if _, err := Get(path, "user.test"); !IsNotExist(err) {
+		t.Errorf("删除后读取应返回不存在错误，实际 %v", err)
+	}
+	// 删除不存在的扩展属性不是错误
+	if err := Remove(path, "user.test"); err != nil {
+		t.Errorf("删除不存在的扩展属性不应失败: %v", err)
+	}
+}
@@ -1,33 +1,213 @@
 package models
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"syscall"
 	"time"
 )
 
 // FileInfo 存储文件的元数据信息
 type FileInfo struct {
-	Path    string      // 相对路径
-	Size    int64       // 文件大小（字节）
-	ModTime time.Time   // 修改时间
-	IsDir   bool        // 是否为目录
-	Mode    os.FileMode // 文件权限
-	AbsPath string      // 绝对路径（用于区分来源）
+	Path       string      // 相对路径
+	Size       int64       // 文件大小（字节，符号链接为目标路径的长度）
+	ModTime    time.Time   // 修改时间
+	IsDir      bool        // 是否为目录
+	IsSymlink  bool        // 是否为符号链接（跟随符号链接扫描时只有无法跟随的链接）
+	LinkTarget string      // 符号链接的目标路径（仅符号链接）
+	Mode       os.FileMode // 文件权限
+	AbsPath    string      // 绝对路径（用于区分来源）
+	Digest     string      // 内容摘要（十六进制，未开启内容校验时为空）
+	Meta       *Metadata   // 扩展元数据（仅 Linux 上按扫描选项收集，未收集时为 nil）
+}
+
+// MetadataOptions 选择收集、对比和同步的扩展元数据
+type MetadataOptions struct {
+	Owner   bool `json:"owner,omitempty"`   // 属主和属组
+	Special bool `json:"special,omitempty"` // setuid、setgid 和 sticky 位
+	Xattrs  bool `json:"xattrs,omitempty"`  // 扩展属性（如 SELinux 标签、文件能力、user.*），不含 POSIX ACL
+	ACL     bool `json:"acl,omitempty"`     // POSIX ACL（访问 ACL 和目录的默认 ACL）
+}
+
+// Any 判断是否选择了任一扩展元数据
+func (o MetadataOptions) Any() bool {
+	return o.Owner || o.Special || o.Xattrs || o.ACL
+}
+
+// Metadata 扩展元数据
+//
+// Collected 记录实际收集了哪些属性（符号链接不收集扩展属性和 ACL），
+// 只有两侧都收集了的属性才参与对比。双向同步的基线以 JSON 保存该结构。
+type Metadata struct {
+	Collected MetadataOptions   `json:"collected"`
+	UID       uint32            `json:"uid,omitempty"`
+	GID       uint32            `json:"gid,omitempty"`
+	Xattrs    map[string][]byte `json:"xattrs,omitempty"` // 扩展属性的原始内容
+	ACL       string            `json:"acl,omitempty"`    // POSIX ACL 的文本形式（如 user::rw-,user:1000:r--,...），只有基本权限时为空
+}
+
+// SpecialBits setuid、setgid 和 sticky 位
+const SpecialBits = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// Type 返回文件类型：FileTypeFile、FileTypeDir 或 FileTypeSymlink
+func (f *FileInfo) Type() string {
+	switch {
+	case f.IsDir:
+		return FileTypeDir
+	case f.IsSymlink:
+		return FileTypeSymlink
+	default:
+		return FileTypeFile
+	}
 }
 
 // DiffResult 存储差异结果
 type DiffResult struct {
-	Path        string    // 文件相对路径
-	Status      string    // 差异状态：added, deleted, modified, unchanged
-	LeftInfo    *FileInfo // 左侧目录的文件信息（如果存在）
-	RightInfo   *FileInfo // 右侧目录的文件信息（如果存在）
-	Differences []string  // 差异的属性列表
+	Path        string       // 文件相对路径（重命名时为右侧的新路径）
+	OldPath     string       // 重命名前的路径（左侧路径，仅 renamed 状态）
+	Status      string       // 差异状态：added, deleted, modified, touched, renamed, unchanged, unknown
+	LeftInfo    *FileInfo    // 左侧目录的文件信息（如果存在）
+	RightInfo   *FileInfo    // 右侧目录的文件信息（如果存在）
+	Differences []Difference // 差异的属性列表
 }
 
+// Difference 一项属性差异
+//
+// Left 和 Right 的具体类型由 Kind 决定，见各差异类型常量的说明。
+type Difference struct {
+	Kind  DifferenceKind // 差异类型
+	Left  any            // 左侧的值
+	Right any            // 右侧的值
+}
+
+// DifferenceKind 差异类型，其值也是对比属性的名称（如 compare.attributes 中的 size、mtime）
+type DifferenceKind string
+
+// Difference kinds
+const (
+	DiffExists  DifferenceKind = "exists"  // 文件只存在于一侧，值为 bool（是否存在）
+	DiffType    DifferenceKind = "type"    // 文件类型不同，值为 FileTypeFile、FileTypeDir 或 FileTypeSymlink
+	DiffSize    DifferenceKind = "size"    // 大小不同，值为 int64（字节）
+	DiffModTime DifferenceKind = "mtime"   // 修改时间不同，值为 time.Time
+	DiffMode    DifferenceKind = "mode"    // 权限不同，值为 os.FileMode（只含权限位）
+	DiffContent DifferenceKind = "content" // 内容摘要不同，值为 string（十六进制摘要）
+	DiffTarget  DifferenceKind = "target"  // 符号链接的目标不同，值为 string（链接中保存的目标路径）
+	DiffOwner   DifferenceKind = "owner"   // 属主或属组不同，值为 string（uid:gid）
+	DiffSpecial DifferenceKind = "special" // setuid、setgid 或 sticky 位不同，值为 os.FileMode（只含这三位）
+	DiffXattr   DifferenceKind = "xattr"   // 扩展属性不同，值为 map[string][]byte（该侧全部扩展属性）
+	DiffACL     DifferenceKind = "acl"     // POSIX ACL 不同，值为 string（ACL 的文本形式）
+	DiffPath    DifferenceKind = "path"    // 重命名或移动，值为 string（相对路径）
+)
+
+// File types used by DiffType
+const (
+	FileTypeFile    = "file"
+	FileTypeDir     = "dir"
+	FileTypeSymlink = "symlink"
+)
+
 // Status constants
 const (
 	StatusAdded     = "added"
 	StatusDeleted   = "deleted"
 	StatusModified  = "modified"
+	StatusTouched   = "touched" // 内容一致，仅元数据（修改时间、权限）不同
+	StatusRenamed   = "renamed" // 左侧 OldPath 的文件被重命名或移动到右侧 Path
 	StatusUnchanged = "unchanged"
+	StatusUnknown   = "unknown" // 因扫描错误无法确定（所在目录无法读取、无法访问或无法计算摘要）
+)
+
+// Sides of a comparison
+const (
+	SideLeft  = "left"
+	SideRight = "right"
+)
+
+// ScanError 扫描时遇到的错误（扫描会跳过出错的路径继续进行）
+type ScanError struct {
+	Side string // 出错的一侧：left 或 right（单独扫描一个目录时为空）
+	Path string // 出错的相对路径（根目录为空字符串）
+	Op   string // 出错的操作：readdir, lstat, readlink, metadata, hash, ignore-file, symlink-loop
+	Err  error  // 底层错误
+}
+
+// Scan error operations
+const (
+	ScanOpReadDir     = "readdir"      // 读取目录失败，其中的条目没有扫描到
+	ScanOpLstat       = "lstat"        // 读取文件信息失败，该条目没有扫描到
+	ScanOpReadlink    = "readlink"     // 读取符号链接的目标失败，该条目没有扫描到
+	ScanOpMetadata    = "metadata"     // 读取扩展元数据（扩展属性、ACL）失败
+	ScanOpHash        = "hash"         // 计算内容摘要失败
+	ScanOpIgnoreFile  = "ignore-file"  // 读取目录级忽略文件失败，其中的规则没有生效
+	ScanOpSymlinkLoop = "symlink-loop" // 跟随符号链接时形成循环，该链接按符号链接记录，不再进入
+)
+
+func (e *ScanError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "."
+	}
+	if e.Side != "" {
+		return fmt.Sprintf("%s: %s %s: %v", e.Side, e.Op, path, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %v", e.Op, path, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// Errno 返回底层的系统错误码（不是系统调用错误时为 0）
+func (e *ScanError) Errno() syscall.Errno {
+	var errno syscall.Errno
+	errors.As(e.Err, &errno)
+	return errno
+}
+
+// SyncOperation 描述一次同步操作
+type SyncOperation struct {
+	Type   string // 操作类型：mkdir, copy, symlink, delete, setattr, rename
+	Path   string // 文件相对路径
+	Source string // 源文件绝对路径（copy/setattr/rename 使用）
+	Target string // 目标文件绝对路径
+	Reason string // 执行该操作的原因
+}
+
+// SyncResult 存储单个同步操作的执行结果
+type SyncResult struct {
+	Operation *SyncOperation // 对应的同步操作
+	Error     error          // 执行失败时的错误（成功为 nil）
+	DryRun    bool           // 是否为演练模式（未实际执行）
+
+	Literal int64 // 复制文件时写入的新数据字节数（完整复制时为文件大小）
+	Matched int64 // 增量传输时从目标原有内容中复用的字节数
+	Delta   bool  // 是否使用增量传输
+}
+
+// Sync operation constants
+const (
+	OpMkdir   = "mkdir"
+	OpCopy    = "copy"
+	OpSymlink = "symlink"
+	OpDelete  = "delete"
+	OpSetAttr = "setattr"
+	OpRename  = "rename"
+)
+
+// SyncConflict 双向同步中两侧相对基线都发生变化的冲突
+type SyncConflict struct {
+	Path       string    // 文件相对路径
+	LeftInfo   *FileInfo // 左侧当前的文件信息（nil 表示已被删除）
+	RightInfo  *FileInfo // 右侧当前的文件信息（nil 表示已被删除）
+	Resolution string    // 实际采用的冲突解决策略
+}
+
+// Conflict resolution constants
+const (
+	ConflictNewer    = "newer"     // 修改时间较新的一侧获胜（删除视为较旧）
+	ConflictLeft     = "left"      // 左侧获胜
+	ConflictRight    = "right"     // 右侧获胜
+	ConflictKeepBoth = "keep-both" // 保留两侧版本，右侧版本加后缀另存
+	ConflictSkip     = "skip"      // 跳过并报告
 )